@@ -17,6 +17,7 @@
 package agent
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -36,14 +37,14 @@ import (
 
 var SeededAgents chan *Agent = make(chan *Agent)
 
-var httpTimeout = time.Duration(time.Duration(config.Config.HttpTimeoutSeconds) * time.Second)
+var httpTimeout = time.Duration(time.Duration(config.Config().HttpTimeoutSeconds) * time.Second)
 
 func dialTimeout(network, addr string) (net.Conn, error) {
 	return net.DialTimeout(network, addr, httpTimeout)
 }
 
 var httpTransport = &http.Transport{
-	TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Config.SSLSkipVerify},
+	TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Config().SSLSkipVerify},
 	Dial:            dialTimeout,
 	ResponseHeaderTimeout: httpTimeout,
 }
@@ -61,7 +62,7 @@ func auditAgentOperation(auditType string, agent *Agent, message string) error {
 	if agent != nil {
 		instanceKey = &inst.InstanceKey{Hostname: agent.Hostname, Port: int(agent.MySQLPort)}
 	}
-	return inst.AuditOperation(auditType, instanceKey, message)
+	return inst.AuditOperation(context.Background(), auditType, instanceKey, message)
 }
 
 // readResponse returns the body of an HTTP response
@@ -121,7 +122,7 @@ func ForgetLongUnseenAgents() error {
 				from host_agent 
 			where 
 				last_submitted < NOW() - interval ? hour`,
-		config.Config.UnseenAgentForgetHours,
+		config.Config().UnseenAgentForgetHours,
 	)
 	return err
 }
@@ -137,7 +138,7 @@ func ReadOutdatedAgentsHosts() ([]string, error) {
 		where
 			IFNULL(last_checked < now() - interval %d minute, true)
 			`,
-		config.Config.AgentPollMinutes)
+		config.Config().AgentPollMinutes)
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		goto Cleanup
@@ -287,7 +288,7 @@ func UpdateAgentInfo(hostname string, agent Agent) error {
 // baseAgentUri returns the base URI for accessing an agent
 func baseAgentUri(agentHostname string, agentPort int) string {
 	protocol := "http"
-	if config.Config.AgentsUseSSL {
+	if config.Config().AgentsUseSSL {
 		protocol = "https"
 	}
 	uri := fmt.Sprintf("%s://%s:%d/api", protocol, agentHostname, agentPort)
@@ -646,14 +647,16 @@ func FailStaleSeeds() error {
 								where 
 									agent_seed.agent_seed_id = agent_seed_state.agent_seed_id
 						) < now() - interval ? minute`,
-		config.Config.StaleSeedFailMinutes,
+		config.Config().StaleSeedFailMinutes,
 	)
 	return err
 }
 
 // executeSeed is *the* function for taking a seed. It is a complex operation of testing, preparing, re-testing
 // agents on both sides, initiating data transfer, following up, awaiting completion, diagnosing errors, claning up.
-func executeSeed(seedId int64, targetHostname string, sourceHostname string) error {
+// It can be aborted by cancelling given context, in which case the agents' seed commands are aborted and the
+// source volume is unmounted.
+func executeSeed(ctx context.Context, seedId int64, targetHostname string, sourceHostname string) error {
 
 	var err error
 	var seedStateId int64
@@ -717,7 +720,13 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 	ReceiveMySQLSeedData(targetHostname, seedId)
 
 	seedStateId, _ = submitSeedStateEntry(seedId, fmt.Sprintf("Waiting some time for %s to start listening for incoming data", targetHostname), "")
-	time.Sleep(2 * time.Second)
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		AbortSeedCommand(targetHostname, seedId)
+		Unmount(sourceHostname)
+		return updateSeedStateEntry(seedStateId, ctx.Err())
+	}
 
 	seedStateId, _ = submitSeedStateEntry(seedId, fmt.Sprintf("%s will now send data to %s in background", sourceHostname, targetHostname), "")
 	SendMySQLSeedData(sourceHostname, targetHostname, seedId)
@@ -762,7 +771,14 @@ func executeSeed(seedId int64, targetHostname string, sourceHostname string) err
 		seedStateId, _ = submitSeedStateEntry(seedId, fmt.Sprintf("Copied %d/%d bytes (%d%%)", bytesCopied, sourceAgent.MountPoint.MySQLDiskUsage, copyPct), "")
 
 		if !copyComplete {
-			time.Sleep(30 * time.Second)
+			select {
+			case <-time.After(30 * time.Second):
+			case <-ctx.Done():
+				AbortSeedCommand(sourceHostname, seedId)
+				AbortSeedCommand(targetHostname, seedId)
+				Unmount(sourceHostname)
+				return updateSeedStateEntry(seedStateId, ctx.Err())
+			}
 		}
 	}
 
@@ -803,9 +819,12 @@ func Seed(targetHostname string, sourceHostname string) (int64, error) {
 		return 0, log.Errore(err)
 	}
 
+	// Seeds can take hours; they are not bound by OperationTimeoutSeconds, but can be cancelled
+	ctx, operation := inst.BeginOperationWithTimeout(context.Background(), fmt.Sprintf("seed %d: %s -> %s", seedId, sourceHostname, targetHostname), "", 0)
 	go func() {
-		err := executeSeed(seedId, targetHostname, sourceHostname)
+		err := executeSeed(ctx, seedId, targetHostname, sourceHostname)
 		updateSeedComplete(seedId, err)
+		inst.EndOperation(operation, &inst.OperationResult{Message: fmt.Sprintf("Seed %d complete", seedId), Details: seedId}, err)
 	}()
 
 	return seedId, nil
@@ -869,6 +888,15 @@ func ReadActiveSeedsForHost(hostname string) ([]SeedOperation, error) {
 	return readSeeds(whereCondition, "")
 }
 
+// ReadActiveSeeds reads all active seeds
+func ReadActiveSeeds() ([]SeedOperation, error) {
+	whereCondition := `
+		where
+			is_complete = 0
+		`
+	return readSeeds(whereCondition, "")
+}
+
 // ReadRecentCompletedSeedsForHost reads active seeds where host participates either as source or target
 func ReadRecentCompletedSeedsForHost(hostname string) ([]SeedOperation, error) {
 	whereCondition := fmt.Sprintf(`
@@ -17,29 +17,110 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/http"
 	"github.com/outbrain/orchestrator/inst"
 	"github.com/outbrain/orchestrator/logic"
 	"net"
 	"os"
+	"os/signal"
 	"os/user"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// interruptibleContext returns a context which is cancelled upon interrupt (e.g. Ctrl-C) or termination signal.
+// A topology operation thus interrupted aborts safely, restarting replication where it had been stopped.
+func interruptibleContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warningf("Caught %+v; aborting operation", sig)
+		cancel()
+	}()
+	return ctx
+}
+
+// operationCommands are the commands which refactor the topology. These are tracked as topology operations.
+var operationCommands = map[string]bool{
+	"move-up":                 true,
+	"move-below":              true,
+	"enslave-sublings-simple": true,
+	"make-co-master":          true,
+	"match-below":             true,
+	"rematch":                 true,
+	"get-candidate-slave":     true,
+	"multi-match-slaves":      true,
+	"match-up-slaves":         true,
+	"regroup-slaves":          true,
+	"reset-slave":             true,
+	"detach-slave":            true,
+	"reattach-slave":          true,
+	"set-read-only":           true,
+	"set-writeable":           true,
+}
+
+// dryRunCommands are the commands which can be planned, rather than executed, via --dry-run
+var dryRunCommands = map[string]bool{
+	"match-below":         true,
+	"rematch":             true,
+	"get-candidate-slave": true,
+	"multi-match-slaves":  true,
+	"match-up-slaves":     true,
+	"regroup-slaves":      true,
+}
+
+// ValidateConfig checks given configuration file, or otherwise the existing default configuration files,
+// printing any problems found. It exits with non-zero status when the configuration is invalid.
+func ValidateConfig(configFile string, outputFormat string) {
+	out := newCliOutput(outputFormat, "validate-config")
+	fileNames := []string{}
+	if configFile != "" {
+		fileNames = append(fileNames, configFile)
+	} else {
+		for _, fileName := range config.DefaultConfigFiles {
+			if _, err := os.Stat(fileName); err == nil {
+				fileNames = append(fileNames, fileName)
+			}
+		}
+	}
+	conf, errs := config.Validate(fileNames...)
+	if conf.MySQLTopologyCredentialsMapFile != "" {
+		if err := db.ValidateCredentialsMapFile(conf.MySQLTopologyCredentialsMapFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	problems := []string{}
+	for _, err := range errs {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		out.exit(ExitFailure, fmt.Errorf("Invalid configuration:\n%s", strings.Join(problems, "\n")))
+	}
+	out.set(fileNames, []string{fmt.Sprintf("Configuration is valid: %s", strings.Join(fileNames, ", "))}, [][]string{fileNames})
+	out.flush(nil)
+}
+
 // Cli initiates a command line interface, executing requested command.
-func Cli(command string, strict bool, instance string, sibling string, owner string, reason string, pattern string) {
+func Cli(command string, strict bool, instance string, sibling string, owner string, reason string, pattern string, operationId int64, dryRun bool, tokenName string, scopes string, expiry time.Duration, outputFormat string, format string, subtree bool, clusterAlias string) {
+	out := newCliOutput(outputFormat, command)
 
 	if instance != "" && !strings.Contains(instance, ":") {
-		instance = fmt.Sprintf("%s:%d", instance, config.Config.DefaultInstancePort)
+		instance = fmt.Sprintf("%s:%d", instance, config.Config().DefaultInstancePort)
 	}
 	instanceKey, err := inst.ParseInstanceKey(instance)
 	if err != nil {
 		instanceKey = nil
 	}
 	if sibling != "" && !strings.Contains(sibling, ":") {
-		sibling = fmt.Sprintf("%s:%d", sibling, config.Config.DefaultInstancePort)
+		sibling = fmt.Sprintf("%s:%d", sibling, config.Config().DefaultInstancePort)
 	}
 	siblingKey, err := inst.ParseInstanceKey(sibling)
 	if err != nil {
@@ -47,154 +128,146 @@ func Cli(command string, strict bool, instance string, sibling string, owner str
 	}
 	var thisInstanceKey *inst.InstanceKey = nil
 	if hostname, err := os.Hostname(); err == nil {
-		thisInstanceKey = &inst.InstanceKey{Hostname: hostname, Port: int(config.Config.DefaultInstancePort)}
+		thisInstanceKey = &inst.InstanceKey{Hostname: hostname, Port: int(config.Config().DefaultInstancePort)}
+	}
+	requireInstance := func() {
+		if instanceKey == nil {
+			out.usage("Cannot deduce instance: %s", instance)
+		}
+	}
+	requireSibling := func() {
+		if siblingKey == nil {
+			out.usage("Cannot deduce sibling: %s", sibling)
+		}
 	}
 
 	if len(owner) == 0 {
 		// get os username as owner
 		usr, err := user.Current()
 		if err != nil {
-			log.Fatale(err)
+			out.fail(nil, err)
 		}
 		owner = usr.Username
 	}
 	inst.SetMaintenanceOwner(owner)
 
 	if len(command) == 0 {
-		log.Fatal("expected command (-c) (discover|forget|continuous|move-up|move-below|make-co-master|match-below|reset-slave|set-read-only|set-writeable|begin-maintenance|end-maintenance|clusters|topology|resolve)")
+		out.usage("expected command (-c) (discover|forget|continuous|move-up|move-below|make-co-master|match-below|reset-slave|set-read-only|set-writeable|begin-maintenance|end-maintenance|clusters|which-cluster-master|submit-masters-to-kv-stores|topology|resolve)")
+	}
+
+	ctx := interruptibleContext()
+	description := fmt.Sprintf("%s %s", command, instance)
+	var plan *inst.Plan
+	if dryRun {
+		if !dryRunCommands[command] {
+			out.usage("--dry-run is not supported for %s", command)
+		}
+		ctx, plan = inst.NewDryRunContext(ctx)
+		description = fmt.Sprintf("%s (dry-run)", description)
 	}
+	var operation *inst.Operation
+	if operationCommands[command] {
+		ctx, operation = inst.BeginOperation(ctx, description, owner)
+		// The operation's outcome is recorded by out: on flush (success) or on exit (failure)
+		out.operation = operation
+	}
+
 	switch command {
 	case "move-up":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.MoveUp(instanceKey)
+			requireInstance()
+			_, err := inst.MoveUp(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
+			out.setKeys(*instanceKey)
 		}
 	case "move-below":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			if siblingKey == nil {
-				log.Fatal("Cannot deduce sibling:", sibling)
-			}
-			_, err := inst.MoveBelow(instanceKey, siblingKey)
+			requireInstance()
+			requireSibling()
+			_, err := inst.MoveBelow(ctx, instanceKey, siblingKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(fmt.Sprintf("%s<%s", instanceKey.DisplayString(), siblingKey.DisplayString()))
+			out.setKeys(*instanceKey, *siblingKey)
+			out.text = []string{fmt.Sprintf("%s<%s", instanceKey.DisplayString(), siblingKey.DisplayString())}
 		}
 	case "enslave-sublings-simple":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, _, err := inst.EnslaveSiblingsSimple(instanceKey)
+			requireInstance()
+			_, _, err := inst.EnslaveSiblingsSimple(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "make-co-master":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.MakeCoMaster(instanceKey)
+			requireInstance()
+			_, err := inst.MakeCoMaster(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "match-below":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			if siblingKey == nil {
-				log.Fatal("Cannot deduce sibling:", sibling)
-			}
-			_, _, err := inst.MatchBelow(instanceKey, siblingKey, true, true)
+			requireInstance()
+			requireSibling()
+			_, _, err := inst.MatchBelow(ctx, instanceKey, siblingKey, true, true)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(fmt.Sprintf("%s<%s", instanceKey.DisplayString(), siblingKey.DisplayString()))
+			out.setKeys(*instanceKey, *siblingKey)
+			out.text = []string{fmt.Sprintf("%s<%s", instanceKey.DisplayString(), siblingKey.DisplayString())}
 		}
 	case "rematch":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			instance, _, err := inst.RematchSlave(instanceKey, true, true)
+			requireInstance()
+			instance, _, err := inst.RematchSlave(ctx, instanceKey, true, true)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instance.Key.DisplayString())
+			out.setKeys(instance.Key)
 		}
 	case "get-candidate-slave":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-
-			instance, _, _, _, err := inst.GetCandidateSlave(instanceKey, strict, true)
+			requireInstance()
+			instance, _, _, _, err := inst.GetCandidateSlave(ctx, instanceKey, strict, true)
 			if err != nil {
-				log.Fatale(err)
-			} else {
-				fmt.Println(instance.Key.DisplayString())
+				out.fail(ctx, err)
 			}
+			out.setKeys(instance.Key)
 		}
 	case "multi-match-slaves":
 		{
 			// Move all slaves of "instance" beneath "sibling"
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			if siblingKey == nil {
-				log.Fatal("Cannot deduce sibling:", sibling)
-			}
-
-			matchedSlaves, _, err := inst.MultiMatchSlaves(instanceKey, siblingKey)
+			requireInstance()
+			requireSibling()
+			matchedSlaves, _, err := inst.MultiMatchSlaves(ctx, instanceKey, siblingKey)
 			if err != nil {
-				log.Fatale(err)
-			} else {
-				for _, slave := range matchedSlaves {
-					fmt.Println(slave.Key.DisplayString())
-				}
+				out.fail(ctx, err)
 			}
+			out.setInstancesKeys(matchedSlaves)
 		}
 	case "match-up-slaves":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-
-			matchedSlaves, _, err := inst.MatchUpSlaves(instanceKey)
+			requireInstance()
+			matchedSlaves, _, err := inst.MatchUpSlaves(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
-			} else {
-				for _, slave := range matchedSlaves {
-					fmt.Println(slave.Key.DisplayString())
-				}
+				out.fail(ctx, err)
 			}
+			out.setInstancesKeys(matchedSlaves)
 		}
 	case "regroup-slaves":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-
-			lostSlaves, equalSlaves, aheadSlaves, promotedSlave, err := inst.RegroupSlaves(instanceKey)
+			requireInstance()
+			lostSlaves, equalSlaves, aheadSlaves, promotedSlave, err := inst.RegroupSlaves(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
-			} else {
-				fmt.Println(fmt.Sprintf("promoted slave: %s, lost: %d, trivial: %d, pseudo-gtid: %d",
-					promotedSlave.Key.DisplayString(), len(lostSlaves), len(equalSlaves), len(aheadSlaves)))
+				out.fail(ctx, err)
 			}
+			out.setRegroupSlaves(inst.NewRegroupSlavesResult(promotedSlave, lostSlaves, equalSlaves, aheadSlaves))
 		}
 	case "last-pseudo-gtid":
 		{
@@ -202,142 +275,168 @@ func Cli(command string, strict bool, instance string, sibling string, owner str
 				instanceKey = thisInstanceKey
 			}
 			if instanceKey == nil {
-				log.Fatalf("Unresolved instance")
+				out.usage("Unresolved instance")
 			}
-			instance, err := inst.ReadTopologyInstance(instanceKey)
+			instance, err := inst.ReadTopologyInstance(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
 			if instance == nil {
-				log.Fatalf("Instance not found: %+v", *instanceKey)
+				out.notFound("Instance not found: %+v", *instanceKey)
 			}
-			coordinates, text, err := inst.FindLastPseudoGTIDEntry(instance, instance.RelaylogCoordinates, strict)
+			coordinates, text, err := inst.FindLastPseudoGTIDEntry(ctx, instance, instance.RelaylogCoordinates, strict)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(fmt.Sprintf("%+v:%s", *coordinates, text))
+			result := &http.LastPseudoGTIDEntry{Coordinates: *coordinates, Text: text}
+			out.set(result,
+				[]string{fmt.Sprintf("%+v:%s", *coordinates, text)},
+				[][]string{{coordinates.LogFile, fmt.Sprintf("%d", coordinates.LogPos), text}})
 		}
 	case "reset-slave":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.ResetSlaveOperation(instanceKey)
+			requireInstance()
+			_, err := inst.ResetSlaveOperation(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "detach-slave":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.DetachSlaveOperation(instanceKey)
+			requireInstance()
+			_, err := inst.DetachSlaveOperation(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "reattach-slave":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.ReattachSlaveOperation(instanceKey)
+			requireInstance()
+			_, err := inst.ReattachSlaveOperation(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "set-read-only":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.SetReadOnly(instanceKey, true)
+			requireInstance()
+			_, err := inst.SetReadOnly(ctx, instanceKey, true)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "set-writeable":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			_, err := inst.SetReadOnly(instanceKey, false)
+			requireInstance()
+			_, err := inst.SetReadOnly(ctx, instanceKey, false)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "discover":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
+			requireInstance()
 			orchestrator.StartDiscovery(*instanceKey)
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "forget":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			err := inst.ForgetInstance(instanceKey)
+			requireInstance()
+			err := inst.ForgetInstance(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "begin-maintenance":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
+			requireInstance()
 			if reason == "" {
-				log.Fatal("--reason option required")
-			}
-			maintenanceKey, err := inst.BeginMaintenance(instanceKey, inst.GetMaintenanceOwner(), reason)
-			if err == nil {
-				log.Infof("Maintenance key: %+v", maintenanceKey)
+				out.usage("--reason option required")
 			}
+			maintenanceKey, err := inst.BeginMaintenance(ctx, instanceKey, inst.GetMaintenanceOwner(), reason)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			log.Infof("Maintenance key: %+v", maintenanceKey)
+			out.setMaintenance(instanceKey, maintenanceKey)
 		}
 	case "end-maintenance":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
-			err := inst.EndMaintenanceByInstanceKey(instanceKey)
+			requireInstance()
+			err := inst.EndMaintenanceByInstanceKey(ctx, instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	case "clusters":
 		{
 			clusters, err := inst.ReadClusters()
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
+			}
+			out.setClusters(clusters)
+		}
+	case "submit-masters-to-kv-stores":
+		{
+			clusterName := ""
+			if clusterAlias != "" {
+				if clusterName, err = inst.ReadClusterNameByAlias(clusterAlias); err != nil {
+					out.notFound("%+v", err)
+				}
+			} else if instanceKey != nil {
+				instance, found, err := inst.ReadInstance(instanceKey)
+				if err != nil {
+					out.fail(ctx, err)
+				}
+				if !found {
+					out.notFound("Instance not found: %+v", *instanceKey)
+				}
+				clusterName = instance.ClusterName
+			}
+			kvPairs, err := inst.SubmitMastersToKVStores(clusterName)
+			if err != nil {
+				out.fail(ctx, err)
+			}
+			out.setKVPairs(kvPairs)
+		}
+	case "which-cluster-master":
+		{
+			clusterName := ""
+			if clusterAlias != "" {
+				if clusterName, err = inst.ReadClusterNameByAlias(clusterAlias); err != nil {
+					out.notFound("%+v", err)
+				}
 			} else {
-				fmt.Println(strings.Join(clusters, "\n"))
+				requireInstance()
+				instance, found, err := inst.ReadInstance(instanceKey)
+				if err != nil {
+					out.fail(ctx, err)
+				}
+				if !found {
+					out.notFound("Instance not found: %+v", *instanceKey)
+				}
+				clusterName = instance.ClusterName
 			}
+			master, err := inst.ReadClusterMaster(clusterName)
+			if err != nil {
+				out.notFound("%+v", err)
+			}
+			out.setKeys(master.Key)
 		}
 	case "find":
 		{
 			instances, err := inst.FindInstances(pattern)
 			if err != nil {
-				log.Fatale(err)
-			} else {
-				for _, instance := range instances {
-					fmt.Println(instance.Key.DisplayString())
-				}
+				out.fail(ctx, err)
 			}
+			out.setInstancesKeys(instances)
 		}
 	case "topology":
 		{
@@ -345,13 +444,30 @@ func Cli(command string, strict bool, instance string, sibling string, owner str
 				instanceKey = thisInstanceKey
 			}
 			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
+				out.usage("Cannot deduce instance: %s", instance)
+			}
+			instance, found, err := inst.ReadInstance(instanceKey)
+			if err != nil {
+				out.fail(ctx, err)
+			}
+			if !found {
+				out.notFound("Instance not found: %+v", *instanceKey)
 			}
-			output, err := inst.AsciiTopology(instanceKey)
+			instances, err := inst.ReadClusterInstances(instance.ClusterName)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
+			}
+			maintenance, err := inst.ReadActiveMaintenance()
+			if err != nil {
+				out.fail(ctx, err)
+			}
+			var subtreeRoot *inst.InstanceKey
+			if subtree {
+				subtreeRoot = instanceKey
+			}
+			if err := out.setTopology(instance.ClusterName, instances, maintenance, subtreeRoot, format); err != nil {
+				out.usage("%+v", err)
 			}
-			fmt.Println(output)
 		}
 	case "instance-status":
 		{
@@ -359,16 +475,75 @@ func Cli(command string, strict bool, instance string, sibling string, owner str
 				instanceKey = thisInstanceKey
 			}
 			if instanceKey == nil {
-				log.Fatalf("Unable to get status: unresolved instance")
+				out.usage("Unable to get status: unresolved instance")
 			}
 			instance, _, err := inst.ReadInstance(instanceKey)
 			if err != nil {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
 			if instance == nil {
-				log.Fatalf("Instance not found: %+v", *instanceKey)
+				out.notFound("Instance not found: %+v", *instanceKey)
 			}
-			fmt.Println(instance.HumanReadableDescription())
+			out.setInstanceStatus(instance)
+		}
+	case "operation-status":
+		{
+			if operationId == 0 {
+				out.usage("--operation option required")
+			}
+			operationStatus, err := inst.ReadOperationStatus(operationId)
+			if err != nil {
+				if _, notFound := err.(*inst.OperationNotFoundError); notFound {
+					out.exit(ExitNotFound, err)
+				}
+				out.fail(ctx, err)
+			}
+			out.setOperationStatus(operationStatus)
+		}
+	case "create-api-token":
+		{
+			if tokenName == "" {
+				out.usage("--token option required")
+			}
+			tokenScopes, err := inst.ParseScopes(scopes)
+			if err != nil {
+				out.usage("%+v", err)
+			}
+			secret, err := inst.CreateAPIToken(tokenName, tokenScopes, expiry, owner)
+			if err != nil {
+				out.fail(ctx, err)
+			}
+			// The secret is not stored, and is only ever presented here
+			result := struct {
+				TokenName string
+				Secret    string
+			}{tokenName, secret}
+			out.set(result, []string{secret}, [][]string{{tokenName, secret}})
+		}
+	case "revoke-api-token":
+		{
+			if tokenName == "" {
+				out.usage("--token option required")
+			}
+			if err := inst.RevokeAPIToken(tokenName); err != nil {
+				out.fail(ctx, err)
+			}
+			out.set(tokenName, []string{tokenName}, [][]string{{tokenName}})
+		}
+	case "api-tokens":
+		{
+			tokens, err := inst.ReadAPITokens()
+			if err != nil {
+				out.fail(ctx, err)
+			}
+			text := []string{}
+			rows := [][]string{}
+			for _, token := range tokens {
+				row := []string{token.TokenName, strings.Join(token.Scopes, ","), token.CreatedBy, token.CreateTimestamp, token.ExpireTimestamp, token.LastUsedTimestamp, fmt.Sprintf("%t", token.Revoked)}
+				text = append(text, strings.Join(row, "\t"))
+				rows = append(rows, row)
+			}
+			out.set(tokens, text, rows)
 		}
 	case "continuous":
 		{
@@ -376,17 +551,16 @@ func Cli(command string, strict bool, instance string, sibling string, owner str
 		}
 	case "resolve":
 		{
-			if instanceKey == nil {
-				log.Fatal("Cannot deduce instance:", instance)
-			}
+			requireInstance()
 			if conn, err := net.Dial("tcp", instanceKey.DisplayString()); err == nil {
 				conn.Close()
 			} else {
-				log.Fatale(err)
+				out.fail(ctx, err)
 			}
-			fmt.Println(instanceKey.DisplayString())
+			out.setKeys(*instanceKey)
 		}
 	default:
-		log.Fatal("Unknown command:", command)
+		out.usage("Unknown command: %s", command)
 	}
+	out.flush(plan)
 }
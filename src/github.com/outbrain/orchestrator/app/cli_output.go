@@ -0,0 +1,284 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/kv"
+	"os"
+	"strings"
+)
+
+// Output formats, as given by --output
+const (
+	TextOutput = "text"
+	JSONOutput = "json"
+	TSVOutput  = "tsv"
+)
+
+// Process exit codes, per class of failure
+const (
+	ExitOK           = 0
+	ExitFailure      = 1 // The command failed, e.g. a topology operation could not complete
+	ExitUsage        = 2 // Missing or invalid arguments, unknown command
+	ExitNotFound     = 3 // Requested instance or operation is unknown
+	ExitInterrupted  = 4 // The command was aborted by signal or operation timeout
+	ExitUnauthorized = 5 // The orchestrator service (-api) denied the request
+)
+
+// errorClasses names the exit codes in JSON output
+var errorClasses = map[int]string{
+	ExitFailure:      "failure",
+	ExitUsage:        "usage",
+	ExitNotFound:     "not-found",
+	ExitInterrupted:  "interrupted",
+	ExitUnauthorized: "unauthorized",
+}
+
+// CliResult is the document emitted by any command in JSON output mode. Result is command specific.
+type CliResult struct {
+	Command    string
+	Success    bool
+	ErrorClass string
+	Error      string
+	Result     interface{}
+	Plan       *inst.Plan
+}
+
+// cliOutput collects a command's result and emits it in the requested format: text (human readable, as
+// always printed), tsv (one tab separated row per line) or json (a single CliResult document)
+type cliOutput struct {
+	format    string
+	command   string
+	operation *inst.Operation
+	result    interface{}
+	text      []string
+	rows      [][]string
+}
+
+func newCliOutput(format string, command string) *cliOutput {
+	switch format {
+	case TextOutput, JSONOutput, TSVOutput:
+	default:
+		fmt.Fprintln(os.Stderr, fmt.Sprintf("Unknown output format: %s (expected text|json|tsv)", format))
+		os.Exit(ExitUsage)
+	}
+	return &cliOutput{format: format, command: command}
+}
+
+// set records the command's result: its JSON representation, its text lines and its tsv rows
+func (this *cliOutput) set(result interface{}, text []string, rows [][]string) {
+	this.result = result
+	this.text = text
+	this.rows = rows
+}
+
+// setKeys records a result made of instance keys
+func (this *cliOutput) setKeys(keys ...inst.InstanceKey) {
+	text := []string{}
+	rows := [][]string{}
+	for _, key := range keys {
+		text = append(text, key.DisplayString())
+		rows = append(rows, []string{key.Hostname, fmt.Sprintf("%d", key.Port)})
+	}
+	this.set(keys, text, rows)
+}
+
+// setInstancesKeys records a result made of the keys of given instances
+func (this *cliOutput) setInstancesKeys(instances [](*inst.Instance)) {
+	this.setKeys(instancesKeys(instances)...)
+}
+
+// setRegroupSlaves records the result of regroup-slaves
+func (this *cliOutput) setRegroupSlaves(result *inst.RegroupSlavesResult) {
+	this.set(result,
+		[]string{fmt.Sprintf("promoted slave: %s, lost: %d, trivial: %d, pseudo-gtid: %d",
+			result.PromotedSlave.DisplayString(), len(result.LostSlaves), len(result.EqualSlaves), len(result.AheadSlaves))},
+		[][]string{{result.PromotedSlave.DisplayString(), fmt.Sprintf("%d", len(result.LostSlaves)), fmt.Sprintf("%d", len(result.EqualSlaves)), fmt.Sprintf("%d", len(result.AheadSlaves))}})
+}
+
+// setMaintenance records the key of maintenance begun on an instance
+func (this *cliOutput) setMaintenance(instanceKey *inst.InstanceKey, maintenanceKey int64) {
+	result := struct {
+		Key            inst.InstanceKey
+		MaintenanceKey int64
+	}{*instanceKey, maintenanceKey}
+	this.set(result, []string{instanceKey.DisplayString()}, [][]string{{instanceKey.Hostname, fmt.Sprintf("%d", instanceKey.Port), fmt.Sprintf("%d", maintenanceKey)}})
+}
+
+// setClusters records a list of cluster names
+func (this *cliOutput) setClusters(clusters []string) {
+	rows := [][]string{}
+	for _, cluster := range clusters {
+		rows = append(rows, []string{cluster})
+	}
+	this.set(clusters, clusters, rows)
+}
+
+// setKVPairs records key-value pairs published to key-value stores
+func (this *cliOutput) setKVPairs(kvPairs []kv.KVPair) {
+	text := []string{}
+	rows := [][]string{}
+	for _, kvPair := range kvPairs {
+		text = append(text, kvPair.String())
+		rows = append(rows, []string{kvPair.Key, kvPair.Value})
+	}
+	this.set(kvPairs, text, rows)
+}
+
+// setTopology records the instances of a cluster, rendered in given format (ascii|dot|json|mermaid) and
+// annotated with given active maintenance. When subtreeRoot is given, only that instance and those
+// replicating from it, directly or indirectly, are included.
+func (this *cliOutput) setTopology(clusterName string, instances [](*inst.Instance), maintenance []inst.Maintenance, subtreeRoot *inst.InstanceKey, format string) error {
+	tree := inst.NewTopologyTree(instances)
+	tree.SetMaintenance(maintenance)
+	if subtreeRoot != nil {
+		if tree = tree.Subtree(subtreeRoot); tree == nil {
+			return fmt.Errorf("Instance not found in cluster %s: %+v", clusterName, *subtreeRoot)
+		}
+		subtreeInstances := [](*inst.Instance){}
+		for _, key := range tree.Keys() {
+			for _, instance := range instances {
+				if instance.Key.Equals(&key) {
+					subtreeInstances = append(subtreeInstances, instance)
+				}
+			}
+		}
+		instances = subtreeInstances
+	}
+	if format == "" || format == "ascii" {
+		rows := [][]string{}
+		for _, instance := range instances {
+			rows = append(rows, []string{instance.Key.DisplayString(), instance.MasterKey.DisplayString(), instance.Version, instance.StatusString()})
+		}
+		this.set(instances, []string{tree.Ascii()}, rows)
+		return nil
+	}
+	exported, err := tree.Export(clusterName, format)
+	if err != nil {
+		return err
+	}
+	var result interface{} = exported
+	if format == inst.JSONFormat {
+		result = tree.Roots
+	}
+	rows := [][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(exported), "\n") {
+		rows = append(rows, []string{line})
+	}
+	this.set(result, []string{exported}, rows)
+	return nil
+}
+
+// setInstanceStatus records an instance's status
+func (this *cliOutput) setInstanceStatus(instance *inst.Instance) {
+	this.set(instance,
+		[]string{instance.HumanReadableDescription()},
+		[][]string{{instance.Key.DisplayString(), instance.StatusString(), instance.Version, instance.Binlog_format, fmt.Sprintf("%t", instance.LogSlaveUpdatesEnabled)}})
+}
+
+// setOperationStatus records an operation's status and progress
+func (this *cliOutput) setOperationStatus(operationStatus *inst.OperationStatus) {
+	summary := []string{fmt.Sprintf("%d", operationStatus.OperationId), operationStatus.State, operationStatus.Owner, operationStatus.StartTimestamp, operationStatus.EndTimestamp, operationStatus.Description}
+	text := append([]string{strings.Join(summary, "\t")}, operationStatus.Steps...)
+	if operationStatus.Message != "" {
+		text = append(text, operationStatus.Message)
+	}
+	this.set(operationStatus, text, [][]string{summary})
+}
+
+// flush emits the recorded result, along with the dry-run plan, if any. A running topology operation is
+// recorded as completed, with the command's result.
+func (this *cliOutput) flush(plan *inst.Plan) {
+	if this.operation != nil {
+		inst.EndOperation(this.operation, &inst.OperationResult{Message: strings.Join(this.text, "\n"), Details: this.result}, nil)
+	}
+	switch this.format {
+	case JSONOutput:
+		this.printJSON(&CliResult{Command: this.command, Success: true, Result: this.result, Plan: plan})
+	case TSVOutput:
+		for _, row := range this.rows {
+			fmt.Println(strings.Join(row, "\t"))
+		}
+		if plan != nil {
+			for _, statement := range plan.Statements {
+				fmt.Println(fmt.Sprintf("%s\t%s", statement.InstanceKey.DisplayString(), statement.Statement))
+			}
+		}
+	default:
+		for _, line := range this.text {
+			fmt.Println(line)
+		}
+		if plan != nil {
+			fmt.Println(plan.HumanReadableDescription())
+		}
+	}
+}
+
+func (this *cliOutput) printJSON(result *CliResult) {
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		log.Errore(err)
+		os.Exit(ExitFailure)
+	}
+	fmt.Println(string(b))
+}
+
+// exit reports given error and terminates the process with given exit code. In JSON output mode, the
+// error is emitted as a CliResult document on standard output. A running topology operation is recorded as failed.
+func (this *cliOutput) exit(exitCode int, err error) {
+	if this.operation != nil {
+		inst.EndOperation(this.operation, nil, err)
+	}
+	if this.format == JSONOutput {
+		this.printJSON(&CliResult{Command: this.command, Success: false, ErrorClass: errorClasses[exitCode], Error: err.Error()})
+	}
+	log.Errore(err)
+	os.Exit(exitCode)
+}
+
+// fail terminates on an error returned by a command. An error due to the command's context being cancelled
+// (interrupt, operation timeout) is classified as such.
+func (this *cliOutput) fail(ctx context.Context, err error) {
+	if ctx != nil && ctx.Err() != nil {
+		this.exit(ExitInterrupted, err)
+	}
+	this.exit(ExitFailure, err)
+}
+
+// usage terminates on missing or invalid arguments
+func (this *cliOutput) usage(format string, args ...interface{}) {
+	this.exit(ExitUsage, fmt.Errorf(format, args...))
+}
+
+// notFound terminates on a requested entity which is unknown
+func (this *cliOutput) notFound(format string, args ...interface{}) {
+	this.exit(ExitNotFound, fmt.Errorf(format, args...))
+}
+
+// instancesKeys returns the keys of given instances
+func instancesKeys(instances [](*inst.Instance)) []inst.InstanceKey {
+	keys := []inst.InstanceKey{}
+	for _, instance := range instances {
+		keys = append(keys, instance.Key)
+	}
+	return keys
+}
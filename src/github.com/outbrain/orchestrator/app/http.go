@@ -24,56 +24,81 @@ import (
 	"github.com/martini-contrib/render"
 
 	nethttp "net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/db"
 	"github.com/outbrain/orchestrator/http"
 	"github.com/outbrain/orchestrator/inst"
 	"github.com/outbrain/orchestrator/logic"
+	"github.com/outbrain/orchestrator/ssl"
 )
 
 // Http starts serving
 func Http(discovery bool) {
 	martini.Env = martini.Prod
-	if config.Config.ServeAgentsHttp {
+	go handleReloadSignals()
+	if config.Config().ServeAgentsHttp {
 		go agentsHttp()
 	}
 	standardHttp(discovery)
 }
 
+// handleReloadSignals reloads configuration and topology credentials upon SIGHUP
+func handleReloadSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		log.Info("Received SIGHUP. Reloading configuration and credentials")
+		config.Reload()
+		db.ReloadCredentials()
+	}
+}
+
 // standardHttp starts serving standard HTTP (api/web) requests, to be used by normal clients
 func standardHttp(discovery bool) {
 	m := martini.Classic()
 
-	switch strings.ToLower(config.Config.AuthenticationMethod) {
+	switch strings.ToLower(config.Config().AuthenticationMethod) {
 	case "basic":
 		{
-			if config.Config.HTTPAuthUser == "" {
+			if config.Config().HTTPAuthUser == "" {
 				// Still allowed; may be disallowed in future versions
 				log.Warning("AuthenticationMethod is configured as 'basic' but HTTPAuthUser undefined. Running without authentication.")
 			}
-			m.Use(auth.Basic(config.Config.HTTPAuthUser, config.Config.HTTPAuthPassword))
+			m.Use(http.AuthenticateAPIToken(auth.Basic(config.Config().HTTPAuthUser, config.Config().HTTPAuthPassword)))
 		}
 	case "multi":
 		{
-			if config.Config.HTTPAuthUser == "" {
+			if config.Config().HTTPAuthUser == "" {
 				// Still allowed; may be disallowed in future versions
 				log.Fatal("AuthenticationMethod is configured as 'multi' but HTTPAuthUser undefined")
 			}
 
-			m.Use(auth.BasicFunc(func(username, password string) bool {
+			m.Use(http.AuthenticateAPIToken(auth.BasicFunc(func(username, password string) bool {
 				if username == "readonly" {
 					// Will be treated as "read-only"
 					return true
 				}
-				return auth.SecureCompare(username, config.Config.HTTPAuthUser) && auth.SecureCompare(password, config.Config.HTTPAuthPassword)
-			}))
+				return auth.SecureCompare(username, config.Config().HTTPAuthUser) && auth.SecureCompare(password, config.Config().HTTPAuthPassword)
+			})))
+		}
+	case "ssl":
+		{
+			if !config.Config().UseMutualTLS {
+				log.Fatal("AuthenticationMethod is configured as 'ssl' but UseMutualTLS is disabled")
+			}
+			m.Use(http.AuthenticateAPIToken(http.AuthenticateClientCertificate))
 		}
 	default:
 		{
 			// We inject a dummy User object because we have function signatures with User argument in api.go
 			m.Map(auth.User(""))
+			m.Use(http.AuthenticateAPIToken(nil))
 		}
 	}
 
@@ -97,8 +122,27 @@ func standardHttp(discovery bool) {
 	http.Web.RegisterRequests(m)
 
 	// Serve
-	if err := nethttp.ListenAndServe(config.Config.ListenAddress, m); err != nil {
-		log.Fatale(err)
+	if config.Config().UseSSL {
+		log.Info("Serving via SSL")
+		tlsConfig, err := ssl.NewServerTLSConfig(config.Config().SSLCAFile, config.Config().UseMutualTLS)
+		if err != nil {
+			log.Fatale(err)
+		}
+		server := &nethttp.Server{
+			Addr:      config.Config().ListenAddress,
+			Handler:   m,
+			TLSConfig: tlsConfig,
+		}
+		if err := server.ListenAndServeTLS(config.Config().SSLCertFile, config.Config().SSLPrivateKeyFile); err != nil {
+			log.Fatale(err)
+		}
+	} else {
+		if config.Config().UseMutualTLS {
+			log.Fatal("UseMutualTLS requires UseSSL")
+		}
+		if err := nethttp.ListenAndServe(config.Config().ListenAddress, m); err != nil {
+			log.Fatale(err)
+		}
 	}
 }
 
@@ -115,13 +159,13 @@ func agentsHttp() {
 	http.AgentsAPI.RegisterRequests(m)
 
 	// Serve
-	if config.Config.AgentsUseSSL {
+	if config.Config().AgentsUseSSL {
 		log.Info("Serving via SSL")
-		err := nethttp.ListenAndServeTLS(":3001", config.Config.SSLCertFile, config.Config.SSLPrivateKeyFile, m)
+		err := nethttp.ListenAndServeTLS(config.Config().AgentsListenAddress, config.Config().SSLCertFile, config.Config().SSLPrivateKeyFile, m)
 		if err != nil {
 			log.Fatale(err)
 		}
 	} else {
-		nethttp.ListenAndServe(":3001", m)
+		nethttp.ListenAndServe(config.Config().AgentsListenAddress, m)
 	}
 }
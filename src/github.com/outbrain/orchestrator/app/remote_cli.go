@@ -0,0 +1,436 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/http"
+	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/kv"
+	"github.com/outbrain/orchestrator/ssl"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// apiClient issues requests to a remote orchestrator service via its v2 API
+type apiClient struct {
+	baseURL    string
+	token      string
+	user       string
+	password   string
+	httpClient *nethttp.Client
+}
+
+// apiError is a failed API request, along with the CLI exit code it maps to
+type apiError struct {
+	exitCode int
+	message  string
+}
+
+func (this *apiError) Error() string {
+	return this.message
+}
+
+// getenvOrDefault returns the value of given environment variable, or the given default when unset
+func getenvOrDefault(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// newAPIClient creates a client of the orchestrator service at given URL. Credentials are taken from
+// environment (ORCHESTRATOR_API_TOKEN, or ORCHESTRATOR_API_USER & ORCHESTRATOR_API_PASSWORD), or otherwise config.
+func newAPIClient(baseURL string) (*apiClient, error) {
+	client := &apiClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		token:    getenvOrDefault("ORCHESTRATOR_API_TOKEN", config.Config().APIClientToken),
+		user:     getenvOrDefault("ORCHESTRATOR_API_USER", config.Config().APIClientUser),
+		password: getenvOrDefault("ORCHESTRATOR_API_PASSWORD", config.Config().APIClientPassword),
+	}
+	tlsConfig, err := ssl.NewTLSConfig(config.Config().APIClientSSLCAFile, config.Config().APIClientSSLCertFile, config.Config().APIClientSSLPrivateKeyFile, false)
+	if err != nil {
+		return nil, err
+	}
+	// Requests are not timed out by the client: operations are bounded by the service's OperationTimeoutSeconds,
+	// and are aborted upon interrupt
+	client.httpClient = &nethttp.Client{
+		Transport: &nethttp.Transport{TLSClientConfig: tlsConfig, Proxy: nethttp.ProxyFromEnvironment},
+	}
+	return client, nil
+}
+
+// exitCodeForStatus maps an HTTP error status onto a CLI exit code
+func exitCodeForStatus(status int) int {
+	switch status {
+	case nethttp.StatusBadRequest:
+		return ExitUsage
+	case nethttp.StatusNotFound:
+		return ExitNotFound
+	case nethttp.StatusUnauthorized, nethttp.StatusForbidden:
+		return ExitUnauthorized
+	default:
+		return ExitFailure
+	}
+}
+
+// do issues a request with given JSON body (nil for none), decoding the JSON response onto result (nil to discard).
+// An error status is returned as an *apiError.
+func (this *apiClient) do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var requestBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(b)
+	}
+	req, err := nethttp.NewRequest(method, this.baseURL+path, requestBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if this.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", this.token))
+	} else if this.user != "" {
+		req.SetBasicAuth(this.user, this.password)
+	}
+	log.Debugf("%s %s", method, req.URL)
+
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		apiV2Error := http.APIV2Error{}
+		message := strings.TrimSpace(string(content))
+		if json.Unmarshal(content, &apiV2Error) == nil && apiV2Error.Message != "" {
+			message = apiV2Error.Message
+		}
+		return &apiError{exitCode: exitCodeForStatus(resp.StatusCode), message: fmt.Sprintf("%s %s: %d %s", method, path, resp.StatusCode, message)}
+	}
+	if result == nil || len(content) == 0 {
+		return nil
+	}
+	return json.Unmarshal(content, result)
+}
+
+// instancePath returns the v2 API path of given instance, followed by given suffix
+func instancePath(instanceKey *inst.InstanceKey, suffix string) string {
+	return fmt.Sprintf("/api/v2/instances/%s/%d%s", url.PathEscape(instanceKey.Hostname), instanceKey.Port, suffix)
+}
+
+// runOperation runs a topology operation on the remote service, decoding the operation's details onto given
+// value. In dry-run mode the details are the plan, which is returned.
+func (this *apiClient) runOperation(ctx context.Context, name string, instanceKey *inst.InstanceKey, request *http.OperationRequest, details interface{}) (*inst.Plan, error) {
+	result := struct {
+		Message string
+		Details json.RawMessage
+	}{}
+	if err := this.do(ctx, "POST", instancePath(instanceKey, "/"+name), request, &result); err != nil {
+		return nil, err
+	}
+	log.Info(result.Message)
+	if request.DryRun {
+		plan := &inst.Plan{}
+		return plan, json.Unmarshal(result.Details, plan)
+	}
+	if details != nil && len(result.Details) > 0 {
+		return nil, json.Unmarshal(result.Details, details)
+	}
+	return nil, nil
+}
+
+// failRemote terminates on a failed remote command, classifying the failure
+func failRemote(ctx context.Context, out *cliOutput, err error) {
+	if apiErr, ok := err.(*apiError); ok {
+		out.exit(apiErr.exitCode, err)
+	}
+	out.fail(ctx, err)
+}
+
+// RemoteCli executes a CLI command via the HTTP API of the orchestrator service at given URL, rather than by
+// accessing the backend and topology databases directly. Output is as with Cli.
+func RemoteCli(apiURL string, command string, strict bool, instance string, sibling string, owner string, reason string, pattern string, operationId int64, dryRun bool, outputFormat string, format string, subtree bool, clusterAlias string) {
+	out := newCliOutput(outputFormat, command)
+	client, err := newAPIClient(apiURL)
+	if err != nil {
+		out.usage("%+v", err)
+	}
+
+	if instance != "" && !strings.Contains(instance, ":") {
+		instance = fmt.Sprintf("%s:%d", instance, config.Config().DefaultInstancePort)
+	}
+	instanceKey, _ := inst.ParseRawInstanceKey(instance)
+	if sibling != "" && !strings.Contains(sibling, ":") {
+		sibling = fmt.Sprintf("%s:%d", sibling, config.Config().DefaultInstancePort)
+	}
+	siblingKey, _ := inst.ParseRawInstanceKey(sibling)
+	if instanceKey == nil && (command == "topology" || command == "instance-status" || command == "last-pseudo-gtid") {
+		if hostname, err := os.Hostname(); err == nil {
+			instanceKey = &inst.InstanceKey{Hostname: hostname, Port: int(config.Config().DefaultInstancePort)}
+		}
+	}
+	requireInstance := func() {
+		if instanceKey == nil {
+			out.usage("Cannot deduce instance: %s", instance)
+		}
+	}
+	requireSibling := func() {
+		if siblingKey == nil {
+			out.usage("Cannot deduce sibling: %s", sibling)
+		}
+	}
+
+	if len(command) == 0 {
+		out.usage("expected command (-c)")
+	}
+	if dryRun && !dryRunCommands[command] {
+		out.usage("--dry-run is not supported for %s", command)
+	}
+	ctx := interruptibleContext()
+	var plan *inst.Plan
+
+	switch command {
+	case "move-up", "enslave-sublings-simple", "make-co-master", "reset-slave", "detach-slave", "reattach-slave", "set-read-only", "set-writeable":
+		{
+			requireInstance()
+			operationName := command
+			if command == "enslave-sublings-simple" {
+				operationName = "enslave-siblings-simple"
+			}
+			if _, err := client.runOperation(ctx, operationName, instanceKey, &http.OperationRequest{}, nil); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(*instanceKey)
+		}
+	case "move-below", "match-below":
+		{
+			requireInstance()
+			requireSibling()
+			if plan, err = client.runOperation(ctx, command, instanceKey, &http.OperationRequest{Target: siblingKey, DryRun: dryRun}, nil); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(*instanceKey, *siblingKey)
+			out.text = []string{fmt.Sprintf("%s<%s", instanceKey.DisplayString(), siblingKey.DisplayString())}
+		}
+	case "rematch", "get-candidate-slave":
+		{
+			requireInstance()
+			resultInstance := &inst.Instance{}
+			if plan, err = client.runOperation(ctx, command, instanceKey, &http.OperationRequest{DryRun: dryRun, Strict: strict}, resultInstance); err != nil {
+				failRemote(ctx, out, err)
+			}
+			if plan != nil {
+				out.setKeys(*instanceKey)
+			} else {
+				out.setKeys(resultInstance.Key)
+			}
+		}
+	case "multi-match-slaves", "match-up-slaves":
+		{
+			requireInstance()
+			var targetKey *inst.InstanceKey
+			if command == "multi-match-slaves" {
+				requireSibling()
+				targetKey = siblingKey
+			}
+			result := &inst.MatchSlavesResult{}
+			if plan, err = client.runOperation(ctx, command, instanceKey, &http.OperationRequest{Target: targetKey, DryRun: dryRun}, result); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(result.MatchedSlaves...)
+		}
+	case "regroup-slaves":
+		{
+			requireInstance()
+			result := &inst.RegroupSlavesResult{}
+			if plan, err = client.runOperation(ctx, command, instanceKey, &http.OperationRequest{DryRun: dryRun}, result); err != nil {
+				failRemote(ctx, out, err)
+			}
+			if plan == nil {
+				out.setRegroupSlaves(result)
+			}
+		}
+	case "discover":
+		{
+			requireInstance()
+			if err := client.do(ctx, "POST", instancePath(instanceKey, "/discover"), nil, nil); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(*instanceKey)
+		}
+	case "forget":
+		{
+			requireInstance()
+			if err := client.do(ctx, "DELETE", instancePath(instanceKey, ""), nil, nil); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(*instanceKey)
+		}
+	case "begin-maintenance":
+		{
+			requireInstance()
+			if reason == "" {
+				out.usage("--reason option required")
+			}
+			var maintenanceKey int64
+			request := &http.MaintenanceRequest{Owner: owner, Reason: reason}
+			if err := client.do(ctx, "POST", instancePath(instanceKey, "/maintenance"), request, &maintenanceKey); err != nil {
+				failRemote(ctx, out, err)
+			}
+			log.Infof("Maintenance key: %+v", maintenanceKey)
+			out.setMaintenance(instanceKey, maintenanceKey)
+		}
+	case "end-maintenance":
+		{
+			requireInstance()
+			if err := client.do(ctx, "DELETE", instancePath(instanceKey, "/maintenance"), nil, nil); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(*instanceKey)
+		}
+	case "clusters":
+		{
+			clustersInfo := []inst.ClusterInfo{}
+			if err := client.do(ctx, "GET", "/api/v2/clusters", nil, &clustersInfo); err != nil {
+				failRemote(ctx, out, err)
+			}
+			clusters := []string{}
+			for _, clusterInfo := range clustersInfo {
+				clusters = append(clusters, clusterInfo.ClusterName)
+			}
+			out.setClusters(clusters)
+		}
+	case "submit-masters-to-kv-stores":
+		{
+			clusterHint := clusterAlias
+			if clusterHint == "" && instanceKey != nil {
+				instance := &inst.Instance{}
+				if err := client.do(ctx, "GET", instancePath(instanceKey, ""), nil, instance); err != nil {
+					failRemote(ctx, out, err)
+				}
+				clusterHint = instance.ClusterName
+			}
+			kvPairs := []kv.KVPair{}
+			if err := client.do(ctx, "POST", fmt.Sprintf("/api/v2/kv-stores/masters?cluster=%s", url.QueryEscape(clusterHint)), nil, &kvPairs); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKVPairs(kvPairs)
+		}
+	case "which-cluster-master":
+		{
+			clusterHint := clusterAlias
+			if clusterHint == "" {
+				requireInstance()
+				instance := &inst.Instance{}
+				if err := client.do(ctx, "GET", instancePath(instanceKey, ""), nil, instance); err != nil {
+					failRemote(ctx, out, err)
+				}
+				clusterHint = instance.ClusterName
+			}
+			master := &inst.Instance{}
+			if err := client.do(ctx, "GET", fmt.Sprintf("/api/v2/clusters/%s/master", url.PathEscape(clusterHint)), nil, master); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setKeys(master.Key)
+		}
+	case "find":
+		{
+			instances := [](*inst.Instance){}
+			if err := client.do(ctx, "GET", fmt.Sprintf("/api/v2/instances?pattern=%s", url.QueryEscape(pattern)), nil, &instances); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setInstancesKeys(instances)
+		}
+	case "topology":
+		{
+			requireInstance()
+			instance := &inst.Instance{}
+			if err := client.do(ctx, "GET", instancePath(instanceKey, ""), nil, instance); err != nil {
+				failRemote(ctx, out, err)
+			}
+			instances := [](*inst.Instance){}
+			if err := client.do(ctx, "GET", fmt.Sprintf("/api/v2/clusters/%s/instances", url.PathEscape(instance.ClusterName)), nil, &instances); err != nil {
+				failRemote(ctx, out, err)
+			}
+			maintenance := []inst.Maintenance{}
+			if err := client.do(ctx, "GET", "/api/v2/maintenance", nil, &maintenance); err != nil {
+				failRemote(ctx, out, err)
+			}
+			var subtreeRoot *inst.InstanceKey
+			if subtree {
+				subtreeRoot = instanceKey
+			}
+			if err := out.setTopology(instance.ClusterName, instances, maintenance, subtreeRoot, format); err != nil {
+				out.usage("%+v", err)
+			}
+		}
+	case "instance-status":
+		{
+			requireInstance()
+			instance := &inst.Instance{}
+			if err := client.do(ctx, "GET", instancePath(instanceKey, ""), nil, instance); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setInstanceStatus(instance)
+		}
+	case "last-pseudo-gtid":
+		{
+			requireInstance()
+			result := &http.LastPseudoGTIDEntry{}
+			if err := client.do(ctx, "GET", instancePath(instanceKey, fmt.Sprintf("/last-pseudo-gtid?strict=%t", strict)), nil, result); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.set(result,
+				[]string{fmt.Sprintf("%+v:%s", result.Coordinates, result.Text)},
+				[][]string{{result.Coordinates.LogFile, fmt.Sprintf("%d", result.Coordinates.LogPos), result.Text}})
+		}
+	case "operation-status":
+		{
+			if operationId == 0 {
+				out.usage("--operation option required")
+			}
+			operationStatus := &inst.OperationStatus{}
+			if err := client.do(ctx, "GET", fmt.Sprintf("/api/v2/operations/%d", operationId), nil, operationStatus); err != nil {
+				failRemote(ctx, out, err)
+			}
+			out.setOperationStatus(operationStatus)
+		}
+	default:
+		out.usage("%s is not supported via -api", command)
+	}
+	out.flush(plan)
+}
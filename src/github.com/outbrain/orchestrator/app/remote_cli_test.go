@@ -0,0 +1,91 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/outbrain/orchestrator/http"
+	"github.com/outbrain/orchestrator/inst"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type RemoteCliTestSuite struct{}
+
+var _ = Suite(&RemoteCliTestSuite{})
+
+func (s *RemoteCliTestSuite) TestAPIClient(c *C) {
+	server := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		c.Assert(req.Header.Get("Authorization"), Equals, "Bearer secret")
+		switch req.URL.Path {
+		case "/api/v2/instances/db-1/3306":
+			w.Write([]byte(`{"Key": {"Hostname": "db-1", "Port": 3306}, "SlaveHosts": [{"Hostname": "db-2", "Port": 3306}]}`))
+		case "/api/v2/instances/db-1/3306/regroup-slaves":
+			w.Write([]byte(`{"Message": "", "Details": {"AheadSlaves": [], "CandidateSlave": {"Hostname": "db-2", "Port": 3306}, "Statements": []}}`))
+		case "/api/v2/instances/db-1/3306/get-candidate-slave":
+			operationRequest := http.OperationRequest{}
+			c.Assert(json.NewDecoder(req.Body).Decode(&operationRequest), IsNil)
+			c.Assert(operationRequest.Strict, Equals, true)
+			w.Write([]byte(`{"Message": "", "Details": {"Key": {"Hostname": "db-2", "Port": 3306}}}`))
+		case "/api/v2/instances/db-1/3306/last-pseudo-gtid":
+			c.Assert(req.URL.Query().Get("strict"), Equals, "true")
+			w.Write([]byte(`{"Coordinates": {"LogFile": "mysql-relay.000002", "LogPos": 120, "Type": 1}, "Text": "drop view"}`))
+		case "/api/v2/instances/db-9/3306":
+			w.WriteHeader(nethttp.StatusNotFound)
+			w.Write([]byte(`{"Status": 404, "Message": "Instance not found"}`))
+		default:
+			w.WriteHeader(nethttp.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newAPIClient(server.URL + "/")
+	c.Assert(err, IsNil)
+	client.token = "secret"
+	ctx := context.Background()
+
+	instance := &inst.Instance{}
+	c.Assert(client.do(ctx, "GET", instancePath(&inst.InstanceKey{Hostname: "db-1", Port: 3306}, ""), nil, instance), IsNil)
+	c.Assert(instance.Key.Hostname, Equals, "db-1")
+	c.Assert(len(instance.SlaveHosts), Equals, 1)
+
+	plan, err := client.runOperation(ctx, "regroup-slaves", &inst.InstanceKey{Hostname: "db-1", Port: 3306}, &http.OperationRequest{DryRun: true}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(plan.CandidateSlave.Hostname, Equals, "db-2")
+	c.Assert(plan.HumanReadableDescription(), Not(Equals), "")
+
+	candidate := &inst.Instance{}
+	_, err = client.runOperation(ctx, "get-candidate-slave", &inst.InstanceKey{Hostname: "db-1", Port: 3306}, &http.OperationRequest{Strict: true}, candidate)
+	c.Assert(err, IsNil)
+	c.Assert(candidate.Key.Hostname, Equals, "db-2")
+
+	lastPseudoGTIDEntry := &http.LastPseudoGTIDEntry{}
+	c.Assert(client.do(ctx, "GET", instancePath(&inst.InstanceKey{Hostname: "db-1", Port: 3306}, "/last-pseudo-gtid?strict=true"), nil, lastPseudoGTIDEntry), IsNil)
+	c.Assert(lastPseudoGTIDEntry.Coordinates.LogPos, Equals, int64(120))
+
+	err = client.do(ctx, "GET", instancePath(&inst.InstanceKey{Hostname: "db-9", Port: 3306}, ""), nil, instance)
+	c.Assert(err.(*apiError).exitCode, Equals, ExitNotFound)
+
+	err = client.do(ctx, "DELETE", "/api/v2/maintenance/1", nil, nil)
+	c.Assert(err.(*apiError).exitCode, Equals, ExitUnauthorized)
+}
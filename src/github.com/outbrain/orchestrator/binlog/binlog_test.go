@@ -0,0 +1,219 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type BinlogTestSuite struct{}
+
+var _ = Suite(&BinlogTestSuite{})
+
+// testBinlogFile is synthetic: assembled event by event to cover the decoded event types, not written by a server
+const testBinlogFile = "testdata/mysql-bin.000001"
+
+var expectedTestBinlogEvents = []struct {
+	eventType EventType
+	info      string
+}{
+	{FormatDescriptionEvent, "Server ver: 5.6.27-log, Binlog ver: 4"},
+	{PreviousGTIDsEvent, "00020192-1111-1111-1111-111111111111:1-6"},
+	{QueryEvent, "use `test`; drop view if exists `_pseudo_gtid_`.`_pseudo_gtid_hint__asc:0000000000000001`"},
+	{QueryEvent, "use `test`; BEGIN"},
+	{TableMapEvent, "table_id: 70 (test.t1)"},
+	{WriteRowsEvent, "table_id: 70 flags: STMT_END_F"},
+	{XIDEvent, "COMMIT /* xid=123 */"},
+	{QueryEvent, "drop view if exists `_pseudo_gtid_`.`_pseudo_gtid_hint__asc:0000000000000002`"},
+	{RotateEvent, "mysql-bin.000002;pos=4"},
+}
+
+// readAllEvents reads events until EOF, validating they are contiguous
+func readAllEvents(c *C, reader EventReader) []*Event {
+	events := []*Event{}
+	for {
+		event, err := reader.NextEvent()
+		if err == io.EOF {
+			return events
+		}
+		c.Assert(err, IsNil)
+		if len(events) > 0 {
+			c.Assert(event.LogPos, Equals, events[len(events)-1].NextLogPos)
+		}
+		events = append(events, event)
+	}
+}
+
+func assertTestBinlogEvents(c *C, events []*Event) {
+	c.Assert(len(events), Equals, len(expectedTestBinlogEvents))
+	c.Assert(events[0].LogPos, Equals, int64(MagicLength))
+	for i, expected := range expectedTestBinlogEvents {
+		c.Assert(events[i].LogFile, Equals, "mysql-bin.000001")
+		c.Assert(events[i].Type, Equals, expected.eventType)
+		c.Assert(events[i].Info, Equals, expected.info)
+		c.Assert(events[i].IsArtificial(), Equals, false)
+	}
+	rotate := events[len(events)-1]
+	c.Assert(rotate.RotateLogFile, Equals, "mysql-bin.000002")
+	c.Assert(rotate.RotateLogPos, Equals, int64(4))
+}
+
+func (s *BinlogTestSuite) TestReadFile(c *C) {
+	reader, err := OpenFile(testBinlogFile)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	assertTestBinlogEvents(c, readAllEvents(c, reader))
+}
+
+func (s *BinlogTestSuite) TestReadFileChecksumMismatch(c *C) {
+	data, err := ioutil.ReadFile(testBinlogFile)
+	c.Assert(err, IsNil)
+	corrupted := bytes.Replace(data, []byte("BEGIN"), []byte("BEGAN"), 1)
+	reader, err := NewFileReader(bytes.NewReader(corrupted), "mysql-bin.000001")
+	c.Assert(err, IsNil)
+	for err == nil {
+		_, err = reader.NextEvent()
+	}
+	c.Assert(strings.Contains(err.Error(), "checksum mismatch"), Equals, true)
+}
+
+func (s *BinlogTestSuite) TestReadFileNotBinlog(c *C) {
+	_, err := NewFileReader(strings.NewReader("not a binlog"), "mysql-bin.000001")
+	c.Assert(err, NotNil)
+}
+
+// fakeMaster serves a single dump request, streaming the events of the test binary log
+type fakeMaster struct {
+	c        *C
+	conn     net.Conn
+	sequence byte
+}
+
+func (this *fakeMaster) write(payload ...byte) {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), this.sequence}
+	this.sequence++
+	_, err := this.conn.Write(append(header, payload...))
+	this.c.Check(err, IsNil)
+}
+
+func (this *fakeMaster) read() []byte {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(this.conn, header)
+	this.c.Assert(err, IsNil)
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err = io.ReadFull(this.conn, payload)
+	this.c.Assert(err, IsNil)
+	this.sequence = header[3] + 1
+	return payload
+}
+
+func (this *fakeMaster) serve(scramble []byte, password string) {
+	defer this.conn.Close()
+	handshake := []byte{10}
+	handshake = append(handshake, "5.6.27-log\x00"...)
+	handshake = append(handshake, 1, 0, 0, 0)
+	handshake = append(handshake, scramble[:8]...)
+	handshake = append(handshake, 0, 0xff, 0xff, utf8GeneralCICollation, 2, 0, 0x0f, 0x80, 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(handshake, scramble[8:]...)
+	handshake = append(handshake, 0)
+	handshake = append(handshake, nativePasswordPlugin+"\x00"...)
+	this.write(handshake...)
+
+	response := this.read()
+	userEnd := 32 + bytes.IndexByte(response[32:], 0)
+	this.c.Check(string(response[32:userEnd]), Equals, "repl")
+	authResponse := response[userEnd+2 : userEnd+2+int(response[userEnd+1])]
+	this.c.Check(authResponse, DeepEquals, scrambleNativePassword(scramble, password))
+	this.write(0, 0, 0, 2, 0, 0, 0)
+
+	this.sequence = 0
+	this.c.Check(string(this.read()[1:]), Equals, "select @@global.binlog_checksum")
+	this.write(1)
+	this.write(append([]byte{3}, "def\x00\x00\x00\x05value\x00\x0c\x21\x00\x00\x00\x00\x00\xfd\x00\x00\x00\x00\x00"...)...)
+	this.write(0xfe, 0, 0, 2, 0)
+	this.write(append([]byte{5}, "CRC32"...)...)
+	this.write(0xfe, 0, 0, 2, 0)
+
+	this.sequence = 0
+	this.c.Check(string(this.read()[1:]), Equals, "set @master_binlog_checksum = @@global.binlog_checksum")
+	this.write(0, 0, 0, 2, 0, 0, 0)
+
+	this.sequence = 0
+	request := this.read()
+	this.c.Check(request[0], Equals, comBinlogDump)
+	this.c.Check(binary.LittleEndian.Uint32(request[1:]), Equals, uint32(MagicLength))
+	this.c.Check(string(request[11:]), Equals, "mysql-bin.000001")
+
+	// Artificial rotate event pointing at requested coordinates, followed by the binary log's events
+	rotate := make([]byte, EventHeaderLength, EventHeaderLength+8+16+checksumLength)
+	rotate[4] = byte(RotateEvent)
+	binary.LittleEndian.PutUint16(rotate[17:], artificialEventFlag)
+	rotate = append(rotate, 4, 0, 0, 0, 0, 0, 0, 0)
+	rotate = append(rotate, "mysql-bin.000001"...)
+	binary.LittleEndian.PutUint32(rotate[9:], uint32(len(rotate)+checksumLength))
+	checksum := make([]byte, checksumLength)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(rotate))
+	rotate = append(rotate, checksum...)
+	this.write(append([]byte{0}, rotate...)...)
+
+	data, err := ioutil.ReadFile(testBinlogFile)
+	this.c.Assert(err, IsNil)
+	for pos := MagicLength; pos < len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+9:]))
+		this.write(append([]byte{0}, data[pos:pos+size]...)...)
+		pos += size
+	}
+	this.write(0xfe, 0, 0, 2, 0)
+}
+
+func (s *BinlogTestSuite) TestDump(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		master := &fakeMaster{c: c, conn: conn}
+		master.serve([]byte("abcdefghijklmnopqrst"), "secret")
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	reader, err := Dump(address.IP.String(), address.Port, "repl", "secret", "mysql-bin.000001", 0, 5*time.Second)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+
+	rotate, err := reader.NextEvent()
+	c.Assert(err, IsNil)
+	c.Assert(rotate.Type, Equals, RotateEvent)
+	c.Assert(rotate.IsArtificial(), Equals, true)
+	assertTestBinlogEvents(c, readAllEvents(c, reader))
+}
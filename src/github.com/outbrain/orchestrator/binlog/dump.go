@@ -0,0 +1,318 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	comQuery      byte = 0x03
+	comBinlogDump byte = 0x12
+
+	clientLongPassword     uint32 = 0x00000001
+	clientLongFlag         uint32 = 0x00000004
+	clientProtocol41       uint32 = 0x00000200
+	clientTransactions     uint32 = 0x00002000
+	clientSecureConnection uint32 = 0x00008000
+	clientPluginAuth       uint32 = 0x00080000
+
+	// binlogDumpNonBlock has the master send EOF upon reaching the end of its binary logs, rather than wait for more
+	binlogDumpNonBlock uint16 = 0x01
+
+	maxPacketLength        = 1<<24 - 1
+	nativePasswordPlugin   = "mysql_native_password"
+	utf8GeneralCICollation = 33
+)
+
+// DumpReader streams binary log events off a master via the replication protocol (COM_BINLOG_DUMP), the way
+// a slave's IO thread or mysqlbinlog --read-from-remote-server do. It requires the REPLICATION SLAVE privilege.
+// The master sends its binary logs starting the requested coordinates and up to the end of its last binary
+// log, at which point NextEvent returns io.EOF.
+type DumpReader struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	sequence byte
+	timeout  time.Duration
+	parser   *EventParser
+	logFile  string
+}
+
+// Dump connects to given MySQL server and requests its binary log events starting the given coordinates.
+// Authentication is via mysql_native_password. The connection is not encrypted.
+func Dump(hostname string, port int, user string, password string, logFile string, logPos int64, timeout time.Duration) (*DumpReader, error) {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", hostname, port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	this := newDumpReader(conn, timeout)
+	if err := this.dump(user, password, logFile, logPos); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return this, nil
+}
+
+func newDumpReader(conn net.Conn, timeout time.Duration) *DumpReader {
+	return &DumpReader{conn: conn, reader: bufio.NewReader(conn), timeout: timeout, parser: NewEventParser(false)}
+}
+
+func (this *DumpReader) dump(user string, password string, logFile string, logPos int64) error {
+	if err := this.authenticate(user, password); err != nil {
+		return err
+	}
+	// Servers logging checksums refuse to dump to clients which do not announce awareness of checksums
+	checksum, err := this.queryValue("select @@global.binlog_checksum")
+	if err == nil && checksum != "NONE" {
+		if err := this.exec("set @master_binlog_checksum = @@global.binlog_checksum"); err != nil {
+			return err
+		}
+		this.parser.checksum = true
+	}
+	if logPos < MagicLength {
+		logPos = MagicLength
+	}
+	request := make([]byte, 11, 11+len(logFile))
+	request[0] = comBinlogDump
+	binary.LittleEndian.PutUint32(request[1:], uint32(logPos))
+	binary.LittleEndian.PutUint16(request[5:], binlogDumpNonBlock)
+	// Server id 0, as mysqlbinlog does when not waiting for new events
+	binary.LittleEndian.PutUint32(request[7:], 0)
+	request = append(request, logFile...)
+	this.sequence = 0
+	this.logFile = logFile
+	return this.writePacket(request)
+}
+
+// authenticate reads the server's handshake and responds with given credentials
+func (this *DumpReader) authenticate(user string, password string) error {
+	handshake, err := this.readPacket()
+	if err != nil {
+		return err
+	}
+	if handshake[0] == 0xff {
+		return parseErrorPacket(handshake)
+	}
+	if handshake[0] != 10 {
+		return fmt.Errorf("Unsupported protocol version: %d", handshake[0])
+	}
+	// protocol(1), server version, 0, connection id(4), scramble part 1(8), 0, capabilities(2),
+	// charset(1), status(2), capabilities(2), scramble length(1), reserved(10), scramble part 2, 0, plugin name, 0
+	pos := 1 + bytes.IndexByte(handshake[1:], 0) + 1 + 4
+	if pos < 6 || len(handshake) < pos+8+1+2+1+2+2+1+10 {
+		return errors.New("Malformed handshake packet")
+	}
+	scramble := append([]byte{}, handshake[pos:pos+8]...)
+	pos += 8 + 1 + 2 + 1 + 2 + 2 + 1 + 10
+	if end := bytes.IndexByte(handshake[pos:], 0); end >= 0 {
+		scramble = append(scramble, handshake[pos:pos+end]...)
+	}
+
+	capabilities := clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth
+	authResponse := scrambleNativePassword(scramble, password)
+	response := make([]byte, 32, 32+len(user)+1+1+len(authResponse)+len(nativePasswordPlugin)+1)
+	binary.LittleEndian.PutUint32(response[0:], capabilities)
+	binary.LittleEndian.PutUint32(response[4:], maxPacketLength)
+	response[8] = utf8GeneralCICollation
+	response = append(response, user...)
+	response = append(response, 0, byte(len(authResponse)))
+	response = append(response, authResponse...)
+	response = append(response, nativePasswordPlugin...)
+	response = append(response, 0)
+	if err := this.writePacket(response); err != nil {
+		return err
+	}
+	for {
+		result, err := this.readPacket()
+		if err != nil {
+			return err
+		}
+		switch result[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return parseErrorPacket(result)
+		case 0xfe:
+			// Auth switch request: plugin name, 0, scramble
+			plugin := result[1:]
+			if end := bytes.IndexByte(plugin, 0); end >= 0 {
+				scramble = bytes.TrimRight(plugin[end+1:], "\x00")
+				plugin = plugin[:end]
+			}
+			if string(plugin) != nativePasswordPlugin {
+				return fmt.Errorf("Unsupported authentication plugin: %s", plugin)
+			}
+			if err := this.writePacket(scrambleNativePassword(scramble, password)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unexpected authentication response: %x", result[0])
+		}
+	}
+}
+
+// scrambleNativePassword computes SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+func scrambleNativePassword(scramble []byte, password string) []byte {
+	if password == "" {
+		return []byte{}
+	}
+	hash := sha1.Sum([]byte(password))
+	doubleHash := sha1.Sum(hash[:])
+	scrambleHash := sha1.New()
+	scrambleHash.Write(scramble)
+	scrambleHash.Write(doubleHash[:])
+	result := scrambleHash.Sum(nil)
+	for i := range result {
+		result[i] ^= hash[i]
+	}
+	return result
+}
+
+// exec runs a statement which returns no result set
+func (this *DumpReader) exec(query string) error {
+	this.sequence = 0
+	if err := this.writePacket(append([]byte{comQuery}, query...)); err != nil {
+		return err
+	}
+	result, err := this.readPacket()
+	if err != nil {
+		return err
+	}
+	if result[0] == 0xff {
+		return parseErrorPacket(result)
+	}
+	return nil
+}
+
+// queryValue runs a query returning a single row, single column, and returns that value
+func (this *DumpReader) queryValue(query string) (value string, err error) {
+	this.sequence = 0
+	if err := this.writePacket(append([]byte{comQuery}, query...)); err != nil {
+		return value, err
+	}
+	packet, err := this.readPacket()
+	if err != nil {
+		return value, err
+	}
+	if packet[0] == 0xff {
+		return value, parseErrorPacket(packet)
+	}
+	// Column count, column definitions, EOF, rows, EOF
+	eofPackets := 0
+	for eofPackets < 2 {
+		if packet, err = this.readPacket(); err != nil {
+			return value, err
+		}
+		if packet[0] == 0xff {
+			return value, parseErrorPacket(packet)
+		}
+		if packet[0] == 0xfe && len(packet) < 9 {
+			eofPackets++
+		} else if eofPackets == 1 && packet[0] < 0xfb {
+			// A row whose first column is a short length-encoded string
+			value = string(packet[1 : 1+int(packet[0])])
+		}
+	}
+	return value, nil
+}
+
+// NextEvent returns the next event sent by the master; it returns io.EOF once the master's binary logs are exhausted
+func (this *DumpReader) NextEvent() (*Event, error) {
+	packet, err := this.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case packet[0] == 0xff:
+		return nil, parseErrorPacket(packet)
+	case packet[0] == 0xfe && len(packet) < 9:
+		return nil, io.EOF
+	case packet[0] != 0x00:
+		return nil, fmt.Errorf("Unexpected binlog dump packet: %x", packet[0])
+	}
+	event, err := this.parser.Parse(packet[1:], this.logFile)
+	if err != nil {
+		return nil, err
+	}
+	if event.Type == RotateEvent {
+		// Events following a rotate (be it artificial or not) belong to the log it points to
+		this.logFile = event.RotateLogFile
+	}
+	return event, nil
+}
+
+func (this *DumpReader) Close() error {
+	return this.conn.Close()
+}
+
+// readPacket reads a protocol packet, joining packets split over the maximum packet length
+func (this *DumpReader) readPacket() ([]byte, error) {
+	data := []byte{}
+	for {
+		if this.timeout > 0 {
+			this.conn.SetReadDeadline(time.Now().Add(this.timeout))
+		}
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(this.reader, header); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		this.sequence = header[3] + 1
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(this.reader, payload); err != nil {
+			return nil, err
+		}
+		data = append(data, payload...)
+		if length < maxPacketLength {
+			break
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("Empty packet")
+	}
+	return data, nil
+}
+
+func (this *DumpReader) writePacket(payload []byte) error {
+	if this.timeout > 0 {
+		this.conn.SetWriteDeadline(time.Now().Add(this.timeout))
+	}
+	packet := make([]byte, 4, 4+len(payload))
+	packet[0] = byte(len(payload))
+	packet[1] = byte(len(payload) >> 8)
+	packet[2] = byte(len(payload) >> 16)
+	packet[3] = this.sequence
+	this.sequence++
+	_, err := this.conn.Write(append(packet, payload...))
+	return err
+}
+
+// parseErrorPacket returns the error described by an ERR packet: 0xff, code(2), '#', sql state(5), message
+func parseErrorPacket(packet []byte) error {
+	if len(packet) < 9 {
+		return errors.New("Malformed error packet")
+	}
+	return fmt.Errorf("Error %d: %s", binary.LittleEndian.Uint16(packet[1:]), packet[9:])
+}
@@ -0,0 +1,352 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package binlog
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// EventType is the type code of a binary log event, as found in the v4 event header
+type EventType byte
+
+const (
+	QueryEvent             EventType = 2
+	StopEvent              EventType = 3
+	RotateEvent            EventType = 4
+	IntvarEvent            EventType = 5
+	FormatDescriptionEvent EventType = 15
+	XIDEvent               EventType = 16
+	TableMapEvent          EventType = 19
+	WriteRowsEventV1       EventType = 23
+	UpdateRowsEventV1      EventType = 24
+	DeleteRowsEventV1      EventType = 25
+	RowsQueryEvent         EventType = 29
+	WriteRowsEvent         EventType = 30
+	UpdateRowsEvent        EventType = 31
+	DeleteRowsEvent        EventType = 32
+	GTIDEvent              EventType = 33
+	AnonymousGTIDEvent     EventType = 34
+	PreviousGTIDsEvent     EventType = 35
+)
+
+// eventTypeNames are named as SHOW BINLOG EVENTS names them in its Event_type column
+var eventTypeNames = map[EventType]string{
+	1:                      "Start_v3",
+	QueryEvent:             "Query",
+	StopEvent:              "Stop",
+	RotateEvent:            "Rotate",
+	IntvarEvent:            "Intvar",
+	6:                      "Load",
+	7:                      "Slave",
+	8:                      "Create_file",
+	9:                      "Append_block",
+	10:                     "Exec_load",
+	11:                     "Delete_file",
+	12:                     "New_load",
+	13:                     "RAND",
+	14:                     "User var",
+	FormatDescriptionEvent: "Format_desc",
+	XIDEvent:               "Xid",
+	17:                     "Begin_load_query",
+	18:                     "Execute_load_query",
+	TableMapEvent:          "Table_map",
+	20:                     "Write_rows_v0",
+	21:                     "Update_rows_v0",
+	22:                     "Delete_rows_v0",
+	WriteRowsEventV1:       "Write_rows",
+	UpdateRowsEventV1:      "Update_rows",
+	DeleteRowsEventV1:      "Delete_rows",
+	26:                     "Incident",
+	27:                     "Heartbeat",
+	28:                     "Ignorable",
+	RowsQueryEvent:         "Rows_query",
+	WriteRowsEvent:         "Write_rows",
+	UpdateRowsEvent:        "Update_rows",
+	DeleteRowsEvent:        "Delete_rows",
+	GTIDEvent:              "Gtid",
+	AnonymousGTIDEvent:     "Anonymous_Gtid",
+	PreviousGTIDsEvent:     "Previous_gtids",
+}
+
+func (this EventType) String() string {
+	if name, found := eventTypeNames[this]; found {
+		return name
+	}
+	return fmt.Sprintf("Unknown(%d)", this)
+}
+
+const (
+	// EventHeaderLength is the length of a v4 event header
+	EventHeaderLength = 19
+	// MagicLength is the length of the magic number opening each binary log; the first event is found at this position
+	MagicLength = 4
+	// artificialEventFlag marks events which are generated by the dump thread rather than read from the binary log
+	artificialEventFlag = 0x20
+	checksumLength      = 4
+	rowsStmtEndFlag     = 0x01
+)
+
+var binlogMagic = []byte{0xfe, 'b', 'i', 'n'}
+
+// Event is a binary log event. Info is formatted the way SHOW BINLOG EVENTS formats its Info column, such
+// that events read by either method compare equal.
+type Event struct {
+	LogFile    string
+	LogPos     int64
+	NextLogPos int64
+	Type       EventType
+	Timestamp  uint32
+	ServerId   uint32
+	Flags      uint16
+	Info       string
+	// RotateLogFile, RotateLogPos are the coordinates to which a Rotate event points
+	RotateLogFile string
+	RotateLogPos  int64
+}
+
+// IsArtificial returns true for events generated on the fly by a master's dump thread (e.g. the Rotate and
+// Format_desc events sent upon a dump request), which do not reside in the binary log at their coordinates
+func (this *Event) IsArtificial() bool {
+	return this.NextLogPos == 0 || this.Flags&artificialEventFlag != 0
+}
+
+// EventParser decodes v4 binary log events. It is stateful: the Format_desc event determines whether
+// following events carry a checksum.
+type EventParser struct {
+	checksum bool
+}
+
+// NewEventParser returns a parser, expecting events to carry a CRC32 checksum or not until told otherwise
+// by a Format_desc event
+func NewEventParser(checksum bool) *EventParser {
+	return &EventParser{checksum: checksum}
+}
+
+// Parse decodes a single, complete event read from given binary log
+func (this *EventParser) Parse(data []byte, logFile string) (*Event, error) {
+	if len(data) < EventHeaderLength {
+		return nil, fmt.Errorf("Binlog event too short: %d bytes", len(data))
+	}
+	event := &Event{
+		LogFile:    logFile,
+		Timestamp:  binary.LittleEndian.Uint32(data[0:]),
+		Type:       EventType(data[4]),
+		ServerId:   binary.LittleEndian.Uint32(data[5:]),
+		NextLogPos: int64(binary.LittleEndian.Uint32(data[13:])),
+		Flags:      binary.LittleEndian.Uint16(data[17:]),
+	}
+	eventSize := binary.LittleEndian.Uint32(data[9:])
+	if int(eventSize) != len(data) {
+		return nil, fmt.Errorf("Binlog event size mismatch: header says %d, got %d bytes", eventSize, len(data))
+	}
+	if event.NextLogPos > 0 {
+		event.LogPos = event.NextLogPos - int64(eventSize)
+	}
+	checksum := this.checksum
+	body := data[EventHeaderLength:]
+	if event.Type == FormatDescriptionEvent {
+		var err error
+		if body, checksum, err = this.parseFormatDescription(event, body); err != nil {
+			return nil, err
+		}
+	} else if checksum {
+		if len(body) < checksumLength {
+			return nil, fmt.Errorf("Binlog event at %s:%d too short for checksum", logFile, event.LogPos)
+		}
+		body = body[:len(body)-checksumLength]
+	}
+	if checksum {
+		expected := binary.LittleEndian.Uint32(data[len(data)-checksumLength:])
+		if actual := crc32.ChecksumIEEE(data[:len(data)-checksumLength]); actual != expected {
+			return nil, fmt.Errorf("Binlog event checksum mismatch at %s:%d", logFile, event.LogPos)
+		}
+	}
+	if err := event.decodeBody(body); err != nil {
+		return nil, fmt.Errorf("Cannot decode %s event at %s:%d: %+v", event.Type, logFile, event.LogPos, err)
+	}
+	return event, nil
+}
+
+// parseFormatDescription sets the parser's checksum algorithm as announced by given Format_desc event, and
+// returns the body stripped of checksum related trailer
+func (this *EventParser) parseFormatDescription(event *Event, body []byte) ([]byte, bool, error) {
+	if len(body) < 57 {
+		return body, false, fmt.Errorf("Format_desc event too short: %d bytes", len(body))
+	}
+	serverVersion := strings.TrimRight(string(body[2:52]), "\x00")
+	this.checksum = false
+	// Servers as of 5.6.1 trail the event with the checksum algorithm followed by a (possibly unused) checksum
+	if versionProduct(serverVersion) >= versionProduct("5.6.1") {
+		this.checksum = (body[len(body)-checksumLength-1] == 1)
+		body = body[:len(body)-checksumLength-1]
+	}
+	return body, this.checksum, nil
+}
+
+// versionProduct turns a "5.6.17-log" like version into a comparable number
+func versionProduct(version string) int {
+	product := 0
+	tokens := strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3)
+	for i := 0; i < 3; i++ {
+		product *= 1000
+		if i < len(tokens) {
+			value, _ := strconv.Atoi(tokens[i])
+			product += value
+		}
+	}
+	return product
+}
+
+// decodeBody formats the event's Info. Only events whose Info is meaningful to orchestrator are decoded;
+// other events are left with empty Info.
+func (this *Event) decodeBody(body []byte) error {
+	switch this.Type {
+	case FormatDescriptionEvent:
+		this.Info = fmt.Sprintf("Server ver: %s, Binlog ver: %d", strings.TrimRight(string(body[2:52]), "\x00"), binary.LittleEndian.Uint16(body))
+	case QueryEvent:
+		// thread_id(4), exec_time(4), db_len(1), error_code(2), status_vars_len(2)
+		if len(body) < 13 {
+			return fmt.Errorf("short post header")
+		}
+		schemaLength := int(body[8])
+		statusVarsLength := int(binary.LittleEndian.Uint16(body[11:]))
+		schemaStart := 13 + statusVarsLength
+		if len(body) < schemaStart+schemaLength+1 {
+			return fmt.Errorf("short body")
+		}
+		schema := string(body[schemaStart : schemaStart+schemaLength])
+		query := string(body[schemaStart+schemaLength+1:])
+		this.Info = query
+		if schema != "" {
+			this.Info = fmt.Sprintf("use `%s`; %s", schema, query)
+		}
+	case RotateEvent:
+		if len(body) < 8 {
+			return fmt.Errorf("short post header")
+		}
+		this.RotateLogPos = int64(binary.LittleEndian.Uint64(body))
+		this.RotateLogFile = string(body[8:])
+		this.Info = fmt.Sprintf("%s;pos=%d", this.RotateLogFile, this.RotateLogPos)
+	case XIDEvent:
+		if len(body) < 8 {
+			return fmt.Errorf("short body")
+		}
+		this.Info = fmt.Sprintf("COMMIT /* xid=%d */", binary.LittleEndian.Uint64(body))
+	case IntvarEvent:
+		if len(body) < 9 {
+			return fmt.Errorf("short body")
+		}
+		variable := "INSERT_ID"
+		if body[0] == 1 {
+			variable = "LAST_INSERT_ID"
+		}
+		this.Info = fmt.Sprintf("%s=%d", variable, binary.LittleEndian.Uint64(body[1:]))
+	case TableMapEvent:
+		// table_id(6), flags(2), schema_len(1), schema, 0, table_len(1), table, 0
+		if len(body) < 9 {
+			return fmt.Errorf("short post header")
+		}
+		schemaLength := int(body[8])
+		if len(body) < 9+schemaLength+2 {
+			return fmt.Errorf("short body")
+		}
+		schema := string(body[9 : 9+schemaLength])
+		tableStart := 9 + schemaLength + 2
+		tableLength := int(body[tableStart-1])
+		if len(body) < tableStart+tableLength {
+			return fmt.Errorf("short body")
+		}
+		table := string(body[tableStart : tableStart+tableLength])
+		this.Info = fmt.Sprintf("table_id: %d (%s.%s)", tableId(body), schema, table)
+	case WriteRowsEventV1, UpdateRowsEventV1, DeleteRowsEventV1, WriteRowsEvent, UpdateRowsEvent, DeleteRowsEvent:
+		if len(body) < 8 {
+			return fmt.Errorf("short post header")
+		}
+		this.Info = fmt.Sprintf("table_id: %d", tableId(body))
+		if binary.LittleEndian.Uint16(body[6:])&rowsStmtEndFlag != 0 {
+			this.Info = fmt.Sprintf("%s flags: STMT_END_F", this.Info)
+		}
+	case RowsQueryEvent:
+		if len(body) < 1 {
+			return fmt.Errorf("short body")
+		}
+		this.Info = fmt.Sprintf("# %s", body[1:])
+	case GTIDEvent:
+		if len(body) < 25 {
+			return fmt.Errorf("short body")
+		}
+		this.Info = fmt.Sprintf("SET @@SESSION.GTID_NEXT= '%s:%d'", formatUUID(body[1:17]), binary.LittleEndian.Uint64(body[17:]))
+	case AnonymousGTIDEvent:
+		this.Info = "SET @@SESSION.GTID_NEXT= 'ANONYMOUS'"
+	case PreviousGTIDsEvent:
+		info, err := formatGTIDSet(body)
+		if err != nil {
+			return err
+		}
+		this.Info = info
+	}
+	return nil
+}
+
+// tableId reads the 6 bytes table id opening table map and rows events
+func tableId(body []byte) uint64 {
+	return uint64(binary.LittleEndian.Uint32(body)) | uint64(binary.LittleEndian.Uint16(body[4:]))<<32
+}
+
+func formatUUID(sid []byte) string {
+	hexed := hex.EncodeToString(sid)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", hexed[0:8], hexed[8:12], hexed[12:16], hexed[16:20], hexed[20:32])
+}
+
+// formatGTIDSet decodes the encoded GTID set of a Previous_gtids event
+func formatGTIDSet(body []byte) (string, error) {
+	if len(body) < 8 {
+		return "", fmt.Errorf("short body")
+	}
+	sids := []string{}
+	numSids := binary.LittleEndian.Uint64(body)
+	pos := 8
+	for i := uint64(0); i < numSids; i++ {
+		if len(body) < pos+24 {
+			return "", fmt.Errorf("short body")
+		}
+		sid := formatUUID(body[pos : pos+16])
+		numIntervals := binary.LittleEndian.Uint64(body[pos+16:])
+		pos += 24
+		for j := uint64(0); j < numIntervals; j++ {
+			if len(body) < pos+16 {
+				return "", fmt.Errorf("short body")
+			}
+			start := binary.LittleEndian.Uint64(body[pos:])
+			// Interval end is exclusive
+			end := binary.LittleEndian.Uint64(body[pos+8:]) - 1
+			pos += 16
+			if start == end {
+				sid = fmt.Sprintf("%s:%d", sid, start)
+			} else {
+				sid = fmt.Sprintf("%s:%d-%d", sid, start, end)
+			}
+		}
+		sids = append(sids, sid)
+	}
+	return strings.Join(sids, ",\n"), nil
+}
@@ -0,0 +1,92 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// EventReader provides binary log events one at a time. NextEvent returns io.EOF past the last event.
+type EventReader interface {
+	NextEvent() (*Event, error)
+	Close() error
+}
+
+// FileReader reads events off a binary log file, such as one copied off a server
+type FileReader struct {
+	logFile string
+	reader  *bufio.Reader
+	closer  io.Closer
+	parser  *EventParser
+}
+
+// OpenFile opens a binary log file for reading, validating its magic number
+func OpenFile(fileName string) (*FileReader, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewFileReader(file, filepath.Base(fileName))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// NewFileReader reads events of the given named binary log off a reader positioned at the log's beginning
+func NewFileReader(r io.Reader, logFile string) (*FileReader, error) {
+	reader := bufio.NewReader(r)
+	magic := make([]byte, MagicLength)
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, binlogMagic) {
+		return nil, fmt.Errorf("%s is not a binary log", logFile)
+	}
+	return &FileReader{logFile: logFile, reader: reader, parser: NewEventParser(false)}, nil
+}
+
+// NextEvent reads the next event in the file
+func (this *FileReader) NextEvent() (*Event, error) {
+	header, err := this.reader.Peek(EventHeaderLength)
+	if err == io.EOF && len(header) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := make([]byte, binary.LittleEndian.Uint32(header[9:]))
+	if _, err := io.ReadFull(this.reader, data); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return this.parser.Parse(data, this.logFile)
+}
+
+func (this *FileReader) Close() error {
+	if this.closer == nil {
+		return nil
+	}
+	return this.closer.Close()
+}
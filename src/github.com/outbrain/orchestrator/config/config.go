@@ -19,11 +19,17 @@ package config
 import (
 	"code.google.com/p/gcfg"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/outbrain/golib/log"
 )
 
+// AccessGrants maps a cluster alias to the roles granted to users on that cluster
+type AccessGrants map[string]map[string]string
+
 // Configuration makes for orchestrator configuration input, which can be provided by user via JSON formatted file.
 // Some of the parameteres have reasonable default values, and some (like database credentials) are
 // strictly expected from user.
@@ -32,22 +38,42 @@ type Configuration struct {
 	MySQLTopologyUser                          string
 	MySQLTopologyPassword                      string // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
 	MySQLTopologyCredentialsConfigFile         string
-	MySQLTopologyMaxPoolConnections            int // Max concurrent connections on any topology instance
+	MySQLTopologyCredentialsMapFile            string // JSON file mapping hostname/cluster patterns to topology credentials. Reloaded on SIGHUP
+	MySQLTopologyCredentialsCommand            string // Command printing topology credentials as JSON ({"User": ..., "Password": ...}) for the instance given by ORC_* environment variables
+	MySQLTopologyCredentialsCacheSeconds       int    // Duration for which credentials fetched by MySQLTopologyCredentialsCommand are cached
+	MySQLTopologyMaxPoolConnections            int    // Max concurrent connections on any topology instance
+	MySQLTopologyUseSSL                        bool   // Connect to topology servers via TLS
+	MySQLTopologySSLCAFile                     string // Certificate authority (PEM) by which to verify topology servers. System CAs are used when empty
+	MySQLTopologySSLCertFile                   string // Client certificate (PEM) to present to topology servers. Optional
+	MySQLTopologySSLPrivateKeyFile             string // Private key (PEM) of the client certificate
+	MySQLTopologySSLSkipVerify                 bool   // Do not verify topology servers' certificates
 	MySQLOrchestratorHost                      string
 	MySQLOrchestratorPort                      uint
 	MySQLOrchestratorDatabase                  string
 	MySQLOrchestratorUser                      string
 	MySQLOrchestratorPassword                  string
 	MySQLOrchestratorCredentialsConfigFile     string // my.cnf style configuration file from where to pick credentials. Expecting `user`, `password` under `[client]` section
+	MySQLOrchestratorUseSSL                    bool   // Connect to the backend database via TLS
+	MySQLOrchestratorSSLCAFile                 string // Certificate authority (PEM) by which to verify the backend database. System CAs are used when empty
+	MySQLOrchestratorSSLCertFile               string // Client certificate (PEM) to present to the backend database. Optional
+	MySQLOrchestratorSSLPrivateKeyFile         string // Private key (PEM) of the client certificate
+	MySQLOrchestratorSSLSkipVerify             bool   // Do not verify the backend database's certificate
 	MySQLConnectTimeoutSeconds                 int    // Number of seconds before connection is aborted (driver-side)
 	DefaultInstancePort                        uint   // In case port was not specified on command line
 	SlaveLagQuery                              string // custom query to check on slave lg (e.g. heartbeat table)
+	DetectClusterAliasQuery                    string // Optional query (executed on the master) returning the alias of its cluster
+	DetectClusterDomainQuery                   string // Optional query (executed on the master) returning the writer DNS name or VIP of its cluster
 	SlaveStartPostWaitMilliseconds             int    // Time to wait after START SLAVE before re-readong instance (give slave chance to connect to master)
 	DiscoverByShowSlaveHosts                   bool   // Attempt SHOW SLAVE HOSTS before PROCESSLIST
 	InstancePollSeconds                        uint   // Number of seconds between instance reads
 	UnseenInstanceForgetHours                  uint   // Number of hours after which an unseen instance is forgotten
 	DiscoveryPollSeconds                       uint   // Auto/continuous discovery of instances sleep time between polls
+	DiscoveryMaxConcurrency                    int    // Number of discovery workers, i.e. max number of instances concurrently being discovered
+	DiscoveryQueueCapacity                     int    // Max number of instance keys pending discovery. When the queue is saturated, new keys are dropped and discovery ticks are skipped.
+	DiscoveryTimeoutSeconds                    uint   // Time after which a discovery worker gives up waiting on a single instance. 0 waits forever.
 	InstanceBulkOperationsWaitTimeoutSeconds   uint   // Time to wait on a single instance when doing bulk (many instances) operation
+	OperationTimeoutSeconds                    uint   // Time after which a topology operation (e.g. regroup-slaves) is aborted. 0 for no limit.
+	OperationHistoryDays                       uint   // Number of days to keep records of completed topology operations
 	ActiveNodeExpireSeconds                    uint
 	HostnameResolveMethod                      string // Method by which to "normalize" hostname ("none"/"default"/"cname")
 	ExpiryHostnameResolvesMinutes              int    // Number of minutes after which to expire hostname-resolves
@@ -58,32 +84,81 @@ type Configuration struct {
 	AuditLogFile                               string // Name of log file for audit operations. Disabled when empty.
 	AuditPageSize                              int
 	ReadOnly                                   bool
-	AuthenticationMethod                       string            // Type of autherntication to use, if any. "" for none, "basic" for BasicAuth, "multi" for advanced BasicAuth, "proxy" for forwarded credentials via reverse proxy
+	AuthenticationMethod                       string            // Type of autherntication to use, if any. "" for none, "basic" for BasicAuth, "multi" for advanced BasicAuth, "proxy" for forwarded credentials via reverse proxy, "ssl" for client certificates (requires UseMutualTLS)
 	HTTPAuthUser                               string            // Username for HTTP Basic authentication (blank disables authentication)
 	HTTPAuthPassword                           string            // Password for HTTP Basic authentication
 	AuthUserHeader                             string            // HTTP header indicating auth user, when AuthenticationMethod is "proxy"
-	PowerAuthUsers                             []string          // On AuthenticationMethod == "proxy", list of users that can make changes. All others are read-only.
+	APIClientToken                             string            // With -api (remote CLI mode): API token by which to authenticate. Overridden by ORCHESTRATOR_API_TOKEN
+	APIClientUser                              string            // With -api: HTTP basic authentication user. Overridden by ORCHESTRATOR_API_USER
+	APIClientPassword                          string            // With -api: HTTP basic authentication password. Overridden by ORCHESTRATOR_API_PASSWORD
+	APIClientSSLCAFile                         string            // With -api: certificate authority (PEM) by which to verify the orchestrator service. System CAs are used when empty
+	APIClientSSLCertFile                       string            // With -api: client certificate (PEM) to present to the orchestrator service (mutual TLS)
+	APIClientSSLPrivateKeyFile                 string            // With -api: private key (PEM) of the client certificate
+	PowerAuthUsers                             []string          // On AuthenticationMethod == "proxy" or "ssl", list of users that can make changes. All others are read-only.
+	SSLClientCNToUser                          map[string]string // On AuthenticationMethod == "ssl", map between client certificate common name and user. Unmapped common names are taken as user names.
+	AccessControlRoles                         map[string]string // map between user and role ("viewer", "operator" or "admin") on all clusters; "*" applies to any user. When non-empty, role based access control replaces PowerAuthUsers and the "readonly" user
+	ClusterAccessGrants                        AccessGrants      // map between cluster alias and (user, role) grants on that cluster. Further grants may be stored in the backend.
 	ClusterNameToAlias                         map[string]string // map between regex matching cluster name to a human friendly alias
+	UseSSL                                     bool              // Serve the main web/API interface (ListenAddress) via HTTPS, using SSLCertFile & SSLPrivateKeyFile
+	UseMutualTLS                               bool              // When UseSSL, require clients to present a certificate signed by SSLCAFile
+	SSLCAFile                                  string            // Certificate authority (PEM) by which client certificates are verified, applies only when UseMutualTLS = true
 	ServeAgentsHttp                            bool              // Spawn another HTTP interface dedicated for orcehstrator-agent
+	AgentsListenAddress                        string            // Address on which to serve the agents HTTP interface
 	AgentsUseSSL                               bool              // When "true" orchestrator will listen on agents port with SSL as well as connect to agents via SSL
 	SSLSkipVerify                              bool              // When using SSL, should we ignore SSL certification error
-	SSLPrivateKeyFile                          string            // Name of SSL private key file, applies only when AgentsUseSSL = true
-	SSLCertFile                                string            // Name of SSL certification file, applies only when AgentsUseSSL = true
+	SSLPrivateKeyFile                          string            // Name of SSL private key file, applies when UseSSL or AgentsUseSSL = true
+	SSLCertFile                                string            // Name of SSL certification file, applies when UseSSL or AgentsUseSSL = true
 	HttpTimeoutSeconds                         int               // Number of idle seconds before HTTP GET request times out (when accessing orchestrator-agent)
 	AgentPollMinutes                           uint              // Minutes between agent polling
 	UnseenAgentForgetHours                     uint              // Number of hours after which an unseen agent is forgotten
 	StaleSeedFailMinutes                       uint              // Number of minutes after which a stale (no progress) seed is considered failed.
 	SeedAcceptableBytesDiff                    int64             // Difference in bytes between seed source & target data size that is still considered as successful copy
 	PseudoGTIDPattern                          string            // Pattern to look for in binary logs that makes for a unique entry (pseudo GTID). When empty, Pseudo-GTID based refactoring is disabled.
+	PseudoGTIDMonotonicHint                    string            // Substring of pseudo GTID entries which indicates entries are monotonically ascending, such that binary logs are binary searched for them. Entries are ordered by the alphanumeric tokens following the hint, which need not be of fixed width. Empty disables.
+	PseudoGTIDCachePersistent                  bool              // Also keep the coordinates of matched pseudo GTID entries in the backend database, such that they survive restarts
+	AutoPseudoGTID                             bool              // Have the elected orchestrator node inject pseudo GTID entries onto cluster masters
+	PseudoGTIDInjectionSeconds                 uint              // Interval between pseudo GTID injections, applies when AutoPseudoGTID = true
+	PseudoGTIDInjectionStatement               string            // Statement injected as pseudo GTID entry; "{token}" is substituted with a unique, ascending token. Must match PseudoGTIDPattern.
+	BinlogEventsReader                         string            // How binary log events are read when matching slaves: "show-binlog-events", or "binlog-dump" to stream them via the replication protocol (requires REPLICATION SLAVE; relay logs are still read via SHOW RELAYLOG EVENTS)
+	LagHistoryRetentionHours                   uint              // Number of hours to keep replication lag history samples. 0 disables lag history collection.
+	LagHistoryDownsampleHours                  uint              // Lag history samples older than this are thinned out to one sample per LagHistoryDownsampleMinutes
+	LagHistoryDownsampleMinutes                uint              // Resolution of downsampled lag history
+	GraphiteAddr                               string            // host:port of Graphite (plaintext protocol, TCP) or StatsD (UDP) server to push metrics to. Empty disables pushing.
+	GraphiteProtocol                           string            // "graphite" or "statsd"
+	GraphitePath                               string            // Prefix of pushed metric paths. "{hostname}" is substituted with this node's hostname.
+	GraphitePollSeconds                        uint              // Interval between metrics pushes
+	KVClusterMasterPrefix                      string            // Cluster masters are published to key-value stores as <prefix>/<cluster alias>
+	ConsulAddress                              string            // Address of a Consul agent (e.g. http://127.0.0.1:8500) to publish cluster masters to. Empty disables.
+	ConsulACLToken                             string            // Optional ACL token by which to write to Consul
+	KVFile                                     string            // JSON file serving as a key-value store to publish cluster masters to, for local setups and testing. Empty disables.
+}
+
+var configuration atomic.Value
+
+func init() {
+	configuration.Store(NewConfiguration())
 }
 
-var Config *Configuration = NewConfiguration()
+// Config returns the current configuration. Reload replaces the configuration as a whole, atomically, such that
+// readers see either the previous or the reloaded configuration; a caller which reads several fields expected to be
+// consistent with each other should read them off a single returned value.
+func Config() *Configuration {
+	return configuration.Load().(*Configuration)
+}
+
+// setConfig atomically replaces the current configuration
+func setConfig(conf *Configuration) {
+	configuration.Store(conf)
+}
 
 func NewConfiguration() *Configuration {
 	return &Configuration{
 		ListenAddress:                              ":3000",
 		MySQLOrchestratorPort:                      3306,
 		MySQLTopologyMaxPoolConnections:            3,
+		MySQLTopologyCredentialsMapFile:            "",
+		MySQLTopologyCredentialsCommand:            "",
+		MySQLTopologyCredentialsCacheSeconds:       60,
 		MySQLConnectTimeoutSeconds:                 5,
 		DefaultInstancePort:                        3306,
 		InstancePollSeconds:                        60,
@@ -91,7 +166,12 @@ func NewConfiguration() *Configuration {
 		SlaveStartPostWaitMilliseconds:             1000,
 		DiscoverByShowSlaveHosts:                   false,
 		DiscoveryPollSeconds:                       5,
+		DiscoveryMaxConcurrency:                    20,
+		DiscoveryQueueCapacity:                     1000,
+		DiscoveryTimeoutSeconds:                    60,
 		InstanceBulkOperationsWaitTimeoutSeconds:   60,
+		OperationTimeoutSeconds:                    3600,
+		OperationHistoryDays:                       7,
 		ActiveNodeExpireSeconds:                    60,
 		HostnameResolveMethod:                      "cname",
 		ExpiryHostnameResolvesMinutes:              60,
@@ -107,8 +187,15 @@ func NewConfiguration() *Configuration {
 		HTTPAuthPassword:                           "",
 		AuthUserHeader:                             "X-Forwarded-User",
 		PowerAuthUsers:                             []string{"*"},
+		AccessControlRoles:                         make(map[string]string),
+		ClusterAccessGrants:                        make(AccessGrants),
 		ClusterNameToAlias:                         make(map[string]string),
+		SSLClientCNToUser:                          make(map[string]string),
+		UseSSL:                                     false,
+		UseMutualTLS:                               false,
+		SSLCAFile:                                  "",
 		ServeAgentsHttp:                            false,
+		AgentsListenAddress:                        ":3001",
 		AgentsUseSSL:                               false,
 		SSLSkipVerify:                              false,
 		SSLPrivateKeyFile:                          "",
@@ -119,56 +206,85 @@ func NewConfiguration() *Configuration {
 		StaleSeedFailMinutes:                       60,
 		SeedAcceptableBytesDiff:                    8192,
 		PseudoGTIDPattern:                          "",
+		PseudoGTIDMonotonicHint:                    "",
+		PseudoGTIDCachePersistent:                  false,
+		AutoPseudoGTID:                             false,
+		PseudoGTIDInjectionSeconds:                 5,
+		PseudoGTIDInjectionStatement:               "drop view if exists `_pseudo_gtid_`.`_pseudo_gtid_hint__asc:{token}`",
+		BinlogEventsReader:                         "show-binlog-events",
+		LagHistoryRetentionHours:                   24 * 7,
+		LagHistoryDownsampleHours:                  6,
+		LagHistoryDownsampleMinutes:                10,
+		GraphiteAddr:                               "",
+		GraphiteProtocol:                           "graphite",
+		GraphitePath:                               "orchestrator.{hostname}",
+		GraphitePollSeconds:                        60,
+		KVClusterMasterPrefix:                      "mysql/master",
+		ConsulAddress:                              "",
+		ConsulACLToken:                             "",
+		KVFile:                                     "",
 	}
 }
 
-// read reads configuration from given file, or silently skips if the file does not exist.
-// If the file does exist, then it is expected to be in valid JSON format or the function bails out.
-func read(file_name string) (*Configuration, error) {
-	file, err := os.Open(file_name)
-	if err == nil {
-		decoder := json.NewDecoder(file)
-		err := decoder.Decode(Config)
-		if err == nil {
-			log.Infof("Read config: %s", file_name)
-		} else {
-			log.Fatal("Cannot read config file:", file_name, err)
+// DefaultConfigFiles are the files from which configuration is read when no config file is explicitly given
+var DefaultConfigFiles = []string{"/etc/orchestrator.conf.json", "conf/orchestrator.conf.json", "orchestrator.conf.json"}
+
+// configFileNames lists the files configuration was read from, in order, such that it can be reloaded
+var configFileNames = []string{}
+
+// readCredentialsConfigFile reads user & password from a my.cnf style file, under the `[client]` section
+func readCredentialsConfigFile(file_name string) (user string, password string, err error) {
+	mySQLConfig := struct {
+		Client struct {
+			User     string
+			Password string
 		}
-		if Config.MySQLOrchestratorCredentialsConfigFile != "" {
-			mySQLConfig := struct {
-				Client struct {
-					User     string
-					Password string
-				}
-			}{}
-			err := gcfg.ReadFileInto(&mySQLConfig, Config.MySQLOrchestratorCredentialsConfigFile)
-			if err != nil {
-				log.Fatalf("Failed to parse gcfg data from file: %+v", err)
-			} else {
-				log.Debugf("Parsed orchestrator credentials from %s", Config.MySQLOrchestratorCredentialsConfigFile)
-				Config.MySQLOrchestratorUser = mySQLConfig.Client.User
-				Config.MySQLOrchestratorPassword = mySQLConfig.Client.Password
-			}
+	}{}
+	err = gcfg.ReadFileInto(&mySQLConfig, file_name)
+	return mySQLConfig.Client.User, mySQLConfig.Client.Password, err
+}
+
+// decodeInto decodes JSON configuration into given configuration, then applies credentials config files, if any
+func decodeInto(conf *Configuration, reader io.Reader) error {
+	decoder := json.NewDecoder(reader)
+	if err := decoder.Decode(conf); err != nil {
+		return err
+	}
+	if conf.MySQLOrchestratorCredentialsConfigFile != "" {
+		user, password, err := readCredentialsConfigFile(conf.MySQLOrchestratorCredentialsConfigFile)
+		if err != nil {
+			return fmt.Errorf("Failed to parse gcfg data from file: %+v", err)
 		}
-		if Config.MySQLTopologyCredentialsConfigFile != "" {
-			mySQLConfig := struct {
-				Client struct {
-					User     string
-					Password string
-				}
-			}{}
-			err := gcfg.ReadFileInto(&mySQLConfig, Config.MySQLTopologyCredentialsConfigFile)
-			if err != nil {
-				log.Fatalf("Failed to parse gcfg data from file: %+v", err)
-			} else {
-				log.Debugf("Parsed topology credentials from %s", Config.MySQLOrchestratorCredentialsConfigFile)
-				Config.MySQLTopologyUser = mySQLConfig.Client.User
-				Config.MySQLTopologyPassword = mySQLConfig.Client.Password
-			}
+		log.Debugf("Parsed orchestrator credentials from %s", conf.MySQLOrchestratorCredentialsConfigFile)
+		conf.MySQLOrchestratorUser = user
+		conf.MySQLOrchestratorPassword = password
+	}
+	if conf.MySQLTopologyCredentialsConfigFile != "" {
+		user, password, err := readCredentialsConfigFile(conf.MySQLTopologyCredentialsConfigFile)
+		if err != nil {
+			return fmt.Errorf("Failed to parse gcfg data from file: %+v", err)
 		}
+		log.Debugf("Parsed topology credentials from %s", conf.MySQLTopologyCredentialsConfigFile)
+		conf.MySQLTopologyUser = user
+		conf.MySQLTopologyPassword = password
+	}
+	return nil
+}
 
+// read reads configuration from given file, or silently skips if the file does not exist.
+// If the file does exist, then it is expected to be in valid JSON format or the function bails out.
+func read(file_name string) (*Configuration, error) {
+	file, err := os.Open(file_name)
+	if err != nil {
+		return Config(), err
+	}
+	defer file.Close()
+	if err := decodeInto(Config(), file); err != nil {
+		log.Fatal("Cannot read config file:", file_name, err)
 	}
-	return Config, err
+	log.Infof("Read config: %s", file_name)
+	configFileNames = append(configFileNames, file_name)
+	return Config(), nil
 }
 
 // Read reads configuration from zero, either, some or all given files, in order of input.
@@ -177,7 +293,7 @@ func Read(file_names ...string) *Configuration {
 	for _, file_name := range file_names {
 		read(file_name)
 	}
-	return Config
+	return Config()
 }
 
 // ForceRead reads configuration from given file name or bails out if it fails
@@ -186,5 +302,5 @@ func ForceRead(file_name string) *Configuration {
 	if err != nil {
 		log.Fatal("Cannot read config file:", file_name, err)
 	}
-	return Config
+	return Config()
 }
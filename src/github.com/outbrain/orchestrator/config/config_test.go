@@ -0,0 +1,142 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type ConfigTestSuite struct{}
+
+var _ = Suite(&ConfigTestSuite{})
+
+func (s *ConfigTestSuite) TestUnknownKeys(c *C) {
+	unknown, err := unknownKeys([]byte(`{"ListenAddress": ":3000", "pseudogtidpattern": "x", "ListenAdress": ":3001", "Foo": 1}`))
+	c.Assert(err, IsNil)
+	c.Assert(unknown, DeepEquals, []string{"Foo", "ListenAdress"})
+}
+
+func (s *ConfigTestSuite) TestValidate(c *C) {
+	fileName := filepath.Join(c.MkDir(), "orchestrator.conf.json")
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{
+		"PseudoGTIDPattern": "drop view if exists .*?_pseudo_gtid_hint__",
+		"ClusterNameToAlias": {"^db-a": "app1"}
+	}`), 0600), IsNil)
+	conf, errs := Validate(fileName)
+	c.Assert(errs, HasLen, 0)
+	c.Assert(conf.ClusterNameToAlias["^db-a"], Equals, "app1")
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{
+		"PseudoGTIDPattern": "(",
+		"UseMutualTLS": true,
+		"SSLCAFile": "/nonexistent/ca.pem",
+		"AuthenticationMethod": "ssl"
+	}`), 0600), IsNil)
+	_, errs = Validate(fileName)
+	// invalid pattern, missing CA file, mutual TLS without UseSSL
+	c.Assert(errs, HasLen, 3)
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{
+		"PseudoGTIDPattern": "drop view if exists .*?[.]`+"`"+`_pseudo_gtid_hint__",
+		"AutoPseudoGTID": true
+	}`), 0600), IsNil)
+	_, errs = Validate(fileName)
+	c.Assert(errs, HasLen, 0)
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{
+		"PseudoGTIDPattern": "drop view if exists .*?_pseudo_gtid_hint__",
+		"AutoPseudoGTID": true,
+		"PseudoGTIDInjectionStatement": "drop view if exists meta.v"
+	}`), 0600), IsNil)
+	_, errs = Validate(fileName)
+	// no token, no pattern match
+	c.Assert(errs, HasLen, 2)
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{
+		"BinlogEventsReader": "binlog-dump",
+		"MySQLTopologyUseSSL": true
+	}`), 0600), IsNil)
+	_, errs = Validate(fileName)
+	c.Assert(errs, HasLen, 1)
+}
+
+func (s *ConfigTestSuite) TestReload(c *C) {
+	defer func(config *Configuration, fileNames []string) {
+		setConfig(config)
+		configFileNames = fileNames
+	}(Config(), configFileNames)
+
+	fileName := filepath.Join(c.MkDir(), "orchestrator.conf.json")
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{"ReasonableReplicationLagSeconds": 10, "ListenAddress": ":3000"}`), 0600), IsNil)
+	setConfig(NewConfiguration())
+	configFileNames = []string{}
+	_, err := read(fileName)
+	c.Assert(err, IsNil)
+	previous := Config()
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{"ReasonableReplicationLagSeconds": 20, "ListenAddress": ":4000"}`), 0600), IsNil)
+	c.Assert(Reload(), IsNil)
+	c.Assert(Config() == previous, Equals, false)
+	c.Assert(Config().ReasonableReplicationLagSeconds, Equals, 20)
+	c.Assert(Config().ListenAddress, Equals, ":3000")
+	c.Assert(previous.ReasonableReplicationLagSeconds, Equals, 10)
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{"PseudoGTIDPattern": "("}`), 0600), IsNil)
+	c.Assert(Reload(), NotNil)
+	c.Assert(Config().ReasonableReplicationLagSeconds, Equals, 20)
+}
+
+// TestReloadConcurrentReads is meant to run under -race: readers must see whole configurations while Reload runs
+func (s *ConfigTestSuite) TestReloadConcurrentReads(c *C) {
+	defer func(config *Configuration, fileNames []string) {
+		setConfig(config)
+		configFileNames = fileNames
+	}(Config(), configFileNames)
+
+	fileName := filepath.Join(c.MkDir(), "orchestrator.conf.json")
+	c.Assert(ioutil.WriteFile(fileName, []byte(`{"ReasonableReplicationLagSeconds": 10, "AuditPageSize": 10}`), 0600), IsNil)
+	setConfig(NewConfiguration())
+	configFileNames = []string{}
+	_, err := read(fileName)
+	c.Assert(err, IsNil)
+
+	done := make(chan bool)
+	inconsistent := make(chan int, 1)
+	go func() {
+		defer close(done)
+		for i := 0; i < 10000; i++ {
+			conf := Config()
+			if conf.ReasonableReplicationLagSeconds != conf.AuditPageSize {
+				inconsistent <- i
+				return
+			}
+		}
+	}()
+	for i := 11; i < 30; i++ {
+		c.Assert(ioutil.WriteFile(fileName, []byte(fmt.Sprintf(`{"ReasonableReplicationLagSeconds": %d, "AuditPageSize": %d}`, i, i)), 0600), IsNil)
+		c.Assert(Reload(), IsNil)
+	}
+	<-done
+	c.Assert(inconsistent, HasLen, 0)
+	c.Assert(Config().ReasonableReplicationLagSeconds, Equals, 29)
+}
@@ -0,0 +1,104 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"reflect"
+	"sync"
+
+	"github.com/outbrain/golib/log"
+)
+
+// reloadableFields are the configuration fields which take effect upon Reload. Changes to any other field
+// require a restart.
+var reloadableFields = []string{
+	"ClusterNameToAlias",
+	"PseudoGTIDPattern",
+	"PseudoGTIDMonotonicHint",
+	"BinlogEventsReader",
+	"ReasonableReplicationLagSeconds",
+	"ReasonableMaintenanceReplicationLagSeconds",
+	"PowerAuthUsers",
+	"SSLClientCNToUser",
+	"AccessControlRoles",
+	"ClusterAccessGrants",
+	"MaintenanceOwner",
+	"AuditPageSize",
+	"SlaveLagQuery",
+	"DetectClusterAliasQuery",
+	"DetectClusterDomainQuery",
+}
+
+var reloadMutex sync.Mutex
+
+// Reload re-reads the configuration files previously read, and applies the reloadable fields. The reloaded
+// configuration atomically replaces the current one as a whole, such that readers of Config() see either
+// the previous or the reloaded configuration. On error (unreadable file, invalid configuration) nothing changes.
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	fresh := NewConfiguration()
+	for _, file_name := range configFileNames {
+		if err := readFileInto(fresh, file_name); err != nil {
+			return log.Errorf("Cannot reload config file %s: %+v", file_name, err)
+		}
+	}
+	if errs := fresh.validate(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Errore(err)
+		}
+		return log.Errorf("Configuration is invalid; not reloading")
+	}
+
+	current := Config()
+	reloaded := *current
+	reloadedValue := reflect.ValueOf(&reloaded).Elem()
+	freshValue := reflect.ValueOf(fresh).Elem()
+	currentValue := reflect.ValueOf(current).Elem()
+
+	isReloadable := make(map[string]bool)
+	for _, name := range reloadableFields {
+		isReloadable[name] = true
+		if !reflect.DeepEqual(currentValue.FieldByName(name).Interface(), freshValue.FieldByName(name).Interface()) {
+			log.Infof("Reloading %s", name)
+		}
+		reloadedValue.FieldByName(name).Set(freshValue.FieldByName(name))
+	}
+	for i := 0; i < currentValue.NumField(); i++ {
+		name := currentValue.Type().Field(i).Name
+		if isReloadable[name] {
+			continue
+		}
+		if !reflect.DeepEqual(currentValue.Field(i).Interface(), freshValue.Field(i).Interface()) {
+			log.Warningf("%s has changed, but will only take effect upon restart", name)
+		}
+	}
+	setConfig(&reloaded)
+	return nil
+}
+
+// readFileInto reads configuration from given file into given configuration
+func readFileInto(conf *Configuration, file_name string) error {
+	file, err := os.Open(file_name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return decodeInto(conf, file)
+}
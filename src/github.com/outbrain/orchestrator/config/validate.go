@@ -0,0 +1,167 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// unknownKeys returns the top level keys of given JSON object which do not map onto any configuration field.
+// Like encoding/json, field names are matched case insensitively.
+func unknownKeys(content []byte) ([]string, error) {
+	keys := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]bool)
+	configurationType := reflect.TypeOf(Configuration{})
+	for i := 0; i < configurationType.NumField(); i++ {
+		fields[strings.ToLower(configurationType.Field(i).Name)] = true
+	}
+	unknown := []string{}
+	for key := range keys {
+		if !fields[strings.ToLower(key)] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+// Validate reads given configuration files into a fresh configuration, and returns it along with all problems
+// found: unreadable files, unknown keys, invalid regular expressions, missing files and conflicting settings.
+func Validate(file_names ...string) (*Configuration, []error) {
+	errs := []error{}
+	conf := NewConfiguration()
+	for _, file_name := range file_names {
+		content, err := ioutil.ReadFile(file_name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		unknown, err := unknownKeys(content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %+v", file_name, err))
+			continue
+		}
+		for _, key := range unknown {
+			errs = append(errs, fmt.Errorf("%s: unknown key %s", file_name, key))
+		}
+		if err := decodeInto(conf, bytes.NewReader(content)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %+v", file_name, err))
+		}
+	}
+	return conf, append(errs, conf.validate()...)
+}
+
+// validate checks this configuration for invalid regular expressions, missing files and conflicting settings
+func (this *Configuration) validate() []error {
+	errs := []error{}
+	checkRegexp := func(name string, pattern string) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid regular expression %s: %+v", name, pattern, err))
+		}
+	}
+	checkFile := func(name string, file_name string) {
+		if file_name == "" {
+			return
+		}
+		if _, err := os.Stat(file_name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %+v", name, err))
+		}
+	}
+	conflict := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	checkRegexp("PseudoGTIDPattern", this.PseudoGTIDPattern)
+	checkRegexp("RejectHostnameResolvePattern", this.RejectHostnameResolvePattern)
+	for pattern := range this.ClusterNameToAlias {
+		checkRegexp("ClusterNameToAlias", pattern)
+	}
+
+	checkFile("MySQLTopologyCredentialsConfigFile", this.MySQLTopologyCredentialsConfigFile)
+	checkFile("MySQLTopologyCredentialsMapFile", this.MySQLTopologyCredentialsMapFile)
+	checkFile("MySQLOrchestratorCredentialsConfigFile", this.MySQLOrchestratorCredentialsConfigFile)
+	checkFile("MySQLTopologySSLCAFile", this.MySQLTopologySSLCAFile)
+	checkFile("MySQLTopologySSLCertFile", this.MySQLTopologySSLCertFile)
+	checkFile("MySQLTopologySSLPrivateKeyFile", this.MySQLTopologySSLPrivateKeyFile)
+	checkFile("MySQLOrchestratorSSLCAFile", this.MySQLOrchestratorSSLCAFile)
+	checkFile("MySQLOrchestratorSSLCertFile", this.MySQLOrchestratorSSLCertFile)
+	checkFile("MySQLOrchestratorSSLPrivateKeyFile", this.MySQLOrchestratorSSLPrivateKeyFile)
+	checkFile("SSLCAFile", this.SSLCAFile)
+	checkFile("SSLCertFile", this.SSLCertFile)
+	checkFile("SSLPrivateKeyFile", this.SSLPrivateKeyFile)
+
+	if (this.MySQLTopologySSLCertFile == "") != (this.MySQLTopologySSLPrivateKeyFile == "") {
+		conflict("MySQLTopologySSLCertFile and MySQLTopologySSLPrivateKeyFile must be given together")
+	}
+	if (this.MySQLOrchestratorSSLCertFile == "") != (this.MySQLOrchestratorSSLPrivateKeyFile == "") {
+		conflict("MySQLOrchestratorSSLCertFile and MySQLOrchestratorSSLPrivateKeyFile must be given together")
+	}
+	if (this.UseSSL || this.AgentsUseSSL) && (this.SSLCertFile == "" || this.SSLPrivateKeyFile == "") {
+		conflict("UseSSL and AgentsUseSSL require SSLCertFile and SSLPrivateKeyFile")
+	}
+	if this.UseMutualTLS && !this.UseSSL {
+		conflict("UseMutualTLS requires UseSSL")
+	}
+	if this.UseMutualTLS && this.SSLCAFile == "" {
+		conflict("UseMutualTLS requires SSLCAFile")
+	}
+	switch strings.ToLower(this.AuthenticationMethod) {
+	case "", "basic", "proxy":
+	case "multi":
+		if this.HTTPAuthUser == "" {
+			conflict("AuthenticationMethod 'multi' requires HTTPAuthUser")
+		}
+	case "ssl":
+		if !this.UseMutualTLS {
+			conflict("AuthenticationMethod 'ssl' requires UseMutualTLS")
+		}
+	default:
+		conflict("Unknown AuthenticationMethod: %s", this.AuthenticationMethod)
+	}
+	if this.AutoPseudoGTID {
+		if !strings.Contains(this.PseudoGTIDInjectionStatement, "{token}") {
+			conflict("PseudoGTIDInjectionStatement must include {token}")
+		}
+		if matched, _ := regexp.MatchString(this.PseudoGTIDPattern, this.PseudoGTIDInjectionStatement); this.PseudoGTIDPattern == "" || !matched {
+			conflict("AutoPseudoGTID requires PseudoGTIDPattern to match PseudoGTIDInjectionStatement")
+		}
+	}
+	switch this.BinlogEventsReader {
+	case "show-binlog-events":
+	case "binlog-dump":
+		if this.MySQLTopologyUseSSL {
+			conflict("BinlogEventsReader 'binlog-dump' does not support MySQLTopologyUseSSL")
+		}
+	default:
+		conflict("Unknown BinlogEventsReader: %s", this.BinlogEventsReader)
+	}
+	if this.ServeAgentsHttp && this.AgentsListenAddress == this.ListenAddress {
+		conflict("AgentsListenAddress and ListenAddress are both %s", this.ListenAddress)
+	}
+	return errs
+}
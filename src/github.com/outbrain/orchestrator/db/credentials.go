@@ -0,0 +1,256 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/pmylund/go-cache"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials is a user/password pair by which to connect to a MySQL server
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// TopologyInstance identifies a topology server for which credentials are requested
+type TopologyInstance struct {
+	Hostname     string
+	Port         int
+	ClusterName  string
+	ClusterAlias string
+}
+
+// CredentialsProvider supplies credentials for topology servers. A provider returns nil credentials
+// when it has no opinion on a given instance, in which case the next provider is consulted.
+type CredentialsProvider interface {
+	GetCredentials(instance *TopologyInstance) (*Credentials, error)
+	Reload() error
+}
+
+// TopologyClusterResolver, when set, resolves the cluster name and alias of a topology server.
+// It is used by credentials providers which map credentials per cluster.
+var TopologyClusterResolver func(hostname string, port int) (clusterName string, clusterAlias string)
+
+// CredentialsMapping maps topology servers, by hostname and/or cluster regexp patterns, to credentials.
+// An empty pattern matches all. ClusterPattern matches either cluster name or cluster alias.
+type CredentialsMapping struct {
+	HostnamePattern string
+	ClusterPattern  string
+	User            string
+	Password        string
+
+	hostnameRegexp *regexp.Regexp
+	clusterRegexp  *regexp.Regexp
+}
+
+func (this *CredentialsMapping) compile() (err error) {
+	if this.HostnamePattern != "" {
+		if this.hostnameRegexp, err = regexp.Compile(this.HostnamePattern); err != nil {
+			return err
+		}
+	}
+	if this.ClusterPattern != "" {
+		if this.clusterRegexp, err = regexp.Compile(this.ClusterPattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches returns true when given instance matches this mapping's patterns
+func (this *CredentialsMapping) matches(instance *TopologyInstance) bool {
+	if this.hostnameRegexp != nil && !this.hostnameRegexp.MatchString(instance.Hostname) {
+		return false
+	}
+	if this.clusterRegexp != nil {
+		if !this.clusterRegexp.MatchString(instance.ClusterName) && (instance.ClusterAlias == "" || !this.clusterRegexp.MatchString(instance.ClusterAlias)) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileCredentialsProvider reads a JSON list of CredentialsMapping from a file. First matching mapping wins.
+type fileCredentialsProvider struct {
+	fileName string
+	mappings []CredentialsMapping
+	mutex    sync.RWMutex
+}
+
+func newFileCredentialsProvider(fileName string) (*fileCredentialsProvider, error) {
+	provider := &fileCredentialsProvider{fileName: fileName}
+	return provider, provider.Reload()
+}
+
+// Reload re-reads the mappings file. On error, the previously read mappings remain in effect.
+func (this *fileCredentialsProvider) Reload() error {
+	content, err := ioutil.ReadFile(this.fileName)
+	if err != nil {
+		return err
+	}
+	mappings := []CredentialsMapping{}
+	if err := json.Unmarshal(content, &mappings); err != nil {
+		return fmt.Errorf("Cannot parse credentials map file %s: %+v", this.fileName, err)
+	}
+	for i := range mappings {
+		if err := mappings[i].compile(); err != nil {
+			return fmt.Errorf("Invalid pattern in credentials map file %s: %+v", this.fileName, err)
+		}
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.mappings = mappings
+	log.Debugf("Read %d credentials mappings from %s", len(mappings), this.fileName)
+	return nil
+}
+
+func (this *fileCredentialsProvider) GetCredentials(instance *TopologyInstance) (*Credentials, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	for i := range this.mappings {
+		if this.mappings[i].matches(instance) {
+			return &Credentials{User: this.mappings[i].User, Password: this.mappings[i].Password}, nil
+		}
+	}
+	return nil, nil
+}
+
+// execCredentialsProvider runs a command which prints credentials as JSON. The instance is described to
+// the command via ORC_HOSTNAME, ORC_PORT, ORC_CLUSTER_NAME and ORC_CLUSTER_ALIAS environment variables.
+// Empty output means the command has no opinion. Results are cached.
+type execCredentialsProvider struct {
+	command string
+	cache   *cache.Cache
+}
+
+func newExecCredentialsProvider(command string, cacheDuration time.Duration) *execCredentialsProvider {
+	return &execCredentialsProvider{
+		command: command,
+		cache:   cache.New(cacheDuration, time.Minute),
+	}
+}
+
+// Reload flushes cached credentials, such that they are fetched again upon next request
+func (this *execCredentialsProvider) Reload() error {
+	this.cache.Flush()
+	return nil
+}
+
+func (this *execCredentialsProvider) GetCredentials(instance *TopologyInstance) (*Credentials, error) {
+	cacheKey := fmt.Sprintf("%s:%d", instance.Hostname, instance.Port)
+	if credentials, found := this.cache.Get(cacheKey); found {
+		return credentials.(*Credentials), nil
+	}
+	cmd := exec.Command("sh", "-c", this.command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("ORC_HOSTNAME=%s", instance.Hostname),
+		fmt.Sprintf("ORC_PORT=%d", instance.Port),
+		fmt.Sprintf("ORC_CLUSTER_NAME=%s", instance.ClusterName),
+		fmt.Sprintf("ORC_CLUSTER_ALIAS=%s", instance.ClusterAlias),
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Credentials command failed for %s: %+v", cacheKey, err)
+	}
+	var credentials *Credentials
+	if strings.TrimSpace(string(output)) != "" {
+		credentials = &Credentials{}
+		if err := json.Unmarshal(output, credentials); err != nil {
+			return nil, fmt.Errorf("Cannot parse credentials command output for %s: %+v", cacheKey, err)
+		}
+	}
+	this.cache.Set(cacheKey, credentials, cache.DefaultExpiration)
+	return credentials, nil
+}
+
+var credentialsProviders = struct {
+	sync.Mutex
+	initialized bool
+	providers   []CredentialsProvider
+}{}
+
+// getCredentialsProviders returns the configured credentials providers, creating them upon first call
+func getCredentialsProviders() []CredentialsProvider {
+	credentialsProviders.Lock()
+	defer credentialsProviders.Unlock()
+
+	if !credentialsProviders.initialized {
+		credentialsProviders.initialized = true
+		if config.Config().MySQLTopologyCredentialsCommand != "" {
+			cacheDuration := time.Duration(config.Config().MySQLTopologyCredentialsCacheSeconds) * time.Second
+			credentialsProviders.providers = append(credentialsProviders.providers, newExecCredentialsProvider(config.Config().MySQLTopologyCredentialsCommand, cacheDuration))
+		}
+		if config.Config().MySQLTopologyCredentialsMapFile != "" {
+			provider, err := newFileCredentialsProvider(config.Config().MySQLTopologyCredentialsMapFile)
+			if err != nil {
+				log.Errore(err)
+			}
+			credentialsProviders.providers = append(credentialsProviders.providers, provider)
+		}
+	}
+	return credentialsProviders.providers
+}
+
+// ValidateCredentialsMapFile checks given credentials map file is readable and well formed
+func ValidateCredentialsMapFile(fileName string) error {
+	_, err := newFileCredentialsProvider(fileName)
+	return err
+}
+
+// ReloadCredentials reloads all credentials providers (re-reading files, flushing cached credentials)
+func ReloadCredentials() error {
+	var lastErr error
+	for _, provider := range getCredentialsProviders() {
+		if err := provider.Reload(); err != nil {
+			lastErr = log.Errore(err)
+		}
+	}
+	return lastErr
+}
+
+// GetTopologyCredentials returns the credentials by which to connect to given topology server: those
+// of the first provider to supply any, or otherwise the globally configured MySQLTopologyUser/Password
+func GetTopologyCredentials(hostname string, port int) (*Credentials, error) {
+	providers := getCredentialsProviders()
+	if len(providers) > 0 {
+		instance := &TopologyInstance{Hostname: hostname, Port: port}
+		if TopologyClusterResolver != nil {
+			instance.ClusterName, instance.ClusterAlias = TopologyClusterResolver(hostname, port)
+		}
+		for _, provider := range providers {
+			credentials, err := provider.GetCredentials(instance)
+			if err != nil {
+				return nil, err
+			}
+			if credentials != nil {
+				return credentials, nil
+			}
+		}
+	}
+	return &Credentials{User: config.Config().MySQLTopologyUser, Password: config.Config().MySQLTopologyPassword}, nil
+}
@@ -0,0 +1,59 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CredentialsTestSuite struct{}
+
+var _ = Suite(&CredentialsTestSuite{})
+
+func (s *CredentialsTestSuite) TestFileCredentialsProvider(c *C) {
+	fileName := filepath.Join(c.MkDir(), "credentials.json")
+	c.Assert(ioutil.WriteFile(fileName, []byte(`[
+		{"ClusterPattern": "^payments$", "User": "payments_orc", "Password": "p"},
+		{"HostnamePattern": "^db-analytics-", "User": "analytics_orc", "Password": "a"}
+	]`), 0600), IsNil)
+
+	provider, err := newFileCredentialsProvider(fileName)
+	c.Assert(err, IsNil)
+
+	credentials, err := provider.GetCredentials(&TopologyInstance{Hostname: "db-analytics-1", Port: 3306})
+	c.Assert(err, IsNil)
+	c.Assert(credentials.User, Equals, "analytics_orc")
+
+	credentials, err = provider.GetCredentials(&TopologyInstance{Hostname: "db-payments-1", Port: 3306, ClusterName: "db-payments-0:3306", ClusterAlias: "payments"})
+	c.Assert(err, IsNil)
+	c.Assert(credentials.User, Equals, "payments_orc")
+
+	credentials, err = provider.GetCredentials(&TopologyInstance{Hostname: "db-other-1", Port: 3306})
+	c.Assert(err, IsNil)
+	c.Assert(credentials, IsNil)
+
+	c.Assert(ioutil.WriteFile(fileName, []byte(`[{"HostnamePattern": "(", "User": "x"}]`), 0600), IsNil)
+	c.Assert(provider.Reload(), NotNil)
+	credentials, err = provider.GetCredentials(&TopologyInstance{Hostname: "db-analytics-1", Port: 3306})
+	c.Assert(err, IsNil)
+	c.Assert(credentials.User, Equals, "analytics_orc")
+}
@@ -179,6 +179,39 @@ var generateSQL = []string{
 		  PRIMARY KEY (cluster_name)
 		) ENGINE=InnoDB DEFAULT CHARSET=ascii
 	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_domain_name (
+		  cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+		  domain_name varchar(128) NOT NULL,
+		  last_registered timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (cluster_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS cluster_injected_pseudo_gtid (
+		  cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+		  master_host varchar(128) CHARACTER SET ascii NOT NULL,
+		  master_port smallint(5) unsigned NOT NULL,
+		  token varchar(128) CHARACTER SET ascii NOT NULL,
+		  time_injected timestamp NULL DEFAULT NULL,
+		  last_attempted timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  last_error text CHARACTER SET utf8 NOT NULL,
+		  PRIMARY KEY (cluster_name),
+		  KEY master_host_port_idx (master_host, master_port)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS pseudo_gtid_entry_cache (
+		  hostname varchar(128) CHARACTER SET ascii NOT NULL,
+		  port smallint(5) unsigned NOT NULL,
+		  entry_hash char(64) CHARACTER SET ascii NOT NULL,
+		  log_file varchar(128) CHARACTER SET ascii NOT NULL,
+		  log_pos bigint unsigned NOT NULL,
+		  cached_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (hostname, port, entry_hash),
+		  KEY cached_timestamp_idx (cached_timestamp)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
 	`
 		CREATE TABLE IF NOT EXISTS active_node (
 		  anchor tinyint unsigned NOT NULL,
@@ -200,6 +233,69 @@ var generateSQL = []string{
 		  PRIMARY KEY (hostname)
 		) ENGINE=InnoDB DEFAULT CHARSET=ascii
 	`,
+	`
+		CREATE TABLE IF NOT EXISTS database_instance_lag_history (
+		  hostname varchar(128) CHARACTER SET ascii NOT NULL,
+		  port smallint(5) unsigned NOT NULL,
+		  sample_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  cluster_name varchar(128) CHARACTER SET ascii NOT NULL,
+		  read_only tinyint(3) unsigned NOT NULL,
+		  slave_sql_running tinyint(3) unsigned NOT NULL,
+		  slave_io_running tinyint(3) unsigned NOT NULL,
+		  relay_master_log_file varchar(128) CHARACTER SET ascii NOT NULL,
+		  exec_master_log_pos bigint(20) unsigned NOT NULL,
+		  seconds_behind_master bigint(20) unsigned DEFAULT NULL,
+		  slave_lag_seconds bigint(20) unsigned DEFAULT NULL,
+		  threads_running int(10) unsigned DEFAULT NULL,
+		  PRIMARY KEY (hostname,port,sample_timestamp),
+		  KEY cluster_name_idx (cluster_name,sample_timestamp),
+		  KEY sample_timestamp_idx (sample_timestamp)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS topology_operation (
+		  operation_id bigint(20) unsigned NOT NULL AUTO_INCREMENT,
+		  description text CHARACTER SET utf8 NOT NULL,
+		  owner varchar(128) CHARACTER SET utf8 NOT NULL,
+		  state varchar(16) CHARACTER SET ascii NOT NULL,
+		  start_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  end_timestamp timestamp NULL DEFAULT NULL,
+		  deadline_timestamp timestamp NULL DEFAULT NULL,
+		  message text CHARACTER SET utf8 NOT NULL,
+		  step_log mediumtext CHARACTER SET utf8 NOT NULL,
+		  result mediumtext CHARACTER SET utf8 NOT NULL,
+		  PRIMARY KEY (operation_id),
+		  KEY state_idx (state,start_timestamp),
+		  KEY start_timestamp_idx (start_timestamp)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS access_grant (
+		  user_name varchar(128) CHARACTER SET utf8 NOT NULL,
+		  cluster_alias varchar(128) NOT NULL,
+		  role varchar(16) CHARACTER SET ascii NOT NULL,
+		  granted_by varchar(128) CHARACTER SET utf8 NOT NULL,
+		  grant_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (user_name,cluster_alias),
+		  KEY cluster_alias_idx (cluster_alias)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
+	`
+		CREATE TABLE IF NOT EXISTS api_token (
+		  token_id int(10) unsigned NOT NULL AUTO_INCREMENT,
+		  token_name varchar(128) CHARACTER SET utf8 NOT NULL,
+		  token_hash char(64) CHARACTER SET ascii NOT NULL,
+		  scopes varchar(128) CHARACTER SET ascii NOT NULL,
+		  created_by varchar(128) CHARACTER SET utf8 NOT NULL,
+		  create_timestamp timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  expire_timestamp timestamp NULL DEFAULT NULL,
+		  last_used_timestamp timestamp NULL DEFAULT NULL,
+		  revoked tinyint unsigned NOT NULL DEFAULT 0,
+		  PRIMARY KEY (token_id),
+		  UNIQUE KEY token_hash_uidx (token_hash),
+		  KEY token_name_idx (token_name)
+		) ENGINE=InnoDB DEFAULT CHARSET=ascii
+	`,
 }
 
 var generateSQLPatches = []string{
@@ -258,21 +354,49 @@ var generateSQLPatches = []string{
 			database_instance
 			ADD COLUMN replication_depth TINYINT UNSIGNED NOT NULL AFTER cluster_name
 	`,
+	`
+		ALTER TABLE 
+			audit
+			ADD COLUMN token_name varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT '' AFTER message
+	`,
+	`
+		ALTER TABLE 
+			cluster_alias
+			ADD COLUMN owner_team varchar(128) CHARACTER SET utf8 NOT NULL DEFAULT '' AFTER alias
+	`,
+	`
+		ALTER TABLE 
+			database_instance_lag_history
+			ADD COLUMN threads_running int(10) unsigned DEFAULT NULL AFTER slave_lag_seconds
+	`,
 }
 
-// OpenTopology returns a DB instance to access a topology instance
+// OpenTopology returns a DB instance to access a topology instance, connecting with credentials chosen
+// per instance by configured credentials providers
 func OpenTopology(host string, port int) (*sql.DB, error) {
-	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=%ds", config.Config.MySQLTopologyUser, config.Config.MySQLTopologyPassword, host, port, config.Config.MySQLConnectTimeoutSeconds)
+	tlsParam, err := topologyTLSParam()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := GetTopologyCredentials(host, port)
+	if err != nil {
+		return nil, err
+	}
+	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/?timeout=%ds%s", credentials.User, credentials.Password, host, port, config.Config().MySQLConnectTimeoutSeconds, tlsParam)
 	db, _, err := sqlutils.GetDB(mysql_uri)
-	db.SetMaxOpenConns(config.Config.MySQLTopologyMaxPoolConnections)
-	db.SetMaxIdleConns(config.Config.MySQLTopologyMaxPoolConnections)
+	db.SetMaxOpenConns(config.Config().MySQLTopologyMaxPoolConnections)
+	db.SetMaxIdleConns(config.Config().MySQLTopologyMaxPoolConnections)
 	return db, err
 }
 
 // OpenTopology returns the DB instance for the orchestrator backed database
 func OpenOrchestrator() (*sql.DB, error) {
-	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=%ds", config.Config.MySQLOrchestratorUser, config.Config.MySQLOrchestratorPassword,
-		config.Config.MySQLOrchestratorHost, config.Config.MySQLOrchestratorPort, config.Config.MySQLOrchestratorDatabase, config.Config.MySQLConnectTimeoutSeconds)
+	tlsParam, err := orchestratorTLSParam()
+	if err != nil {
+		return nil, err
+	}
+	mysql_uri := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=%ds%s", config.Config().MySQLOrchestratorUser, config.Config().MySQLOrchestratorPassword,
+		config.Config().MySQLOrchestratorHost, config.Config().MySQLOrchestratorPort, config.Config().MySQLOrchestratorDatabase, config.Config().MySQLConnectTimeoutSeconds, tlsParam)
 	db, fromCache, err := sqlutils.GetDB(mysql_uri)
 	if err == nil && !fromCache {
 		initOrchestratorDB(db)
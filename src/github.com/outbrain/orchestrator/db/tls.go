@@ -0,0 +1,77 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/ssl"
+	"sync"
+)
+
+// Names under which TLS configurations are registered with the mysql driver, referenced by the "tls" DSN parameter
+const (
+	topologyTLSConfigName     = "orchestrator-topology"
+	orchestratorTLSConfigName = "orchestrator-backend"
+)
+
+var tlsRegistration = struct {
+	sync.Mutex
+	registered map[string]error
+}{registered: make(map[string]error)}
+
+// registerTLSConfig registers a TLS configuration with the mysql driver by given name, once.
+// A failure to register (e.g. unreadable certificate) is returned on each call.
+func registerTLSConfig(name string, caFile string, certFile string, keyFile string, skipVerify bool) error {
+	tlsRegistration.Lock()
+	defer tlsRegistration.Unlock()
+
+	if err, registered := tlsRegistration.registered[name]; registered {
+		return err
+	}
+	tlsConfig, err := ssl.NewTLSConfig(caFile, certFile, keyFile, skipVerify)
+	if err == nil {
+		err = mysql.RegisterTLSConfig(name, tlsConfig)
+	}
+	if err != nil {
+		err = log.Errorf("Cannot set up TLS for %s: %+v", name, err)
+	}
+	tlsRegistration.registered[name] = err
+	return err
+}
+
+// topologyTLSParam returns the DSN parameter for topology connections' TLS, if any
+func topologyTLSParam() (string, error) {
+	if !config.Config().MySQLTopologyUseSSL {
+		return "", nil
+	}
+	err := registerTLSConfig(topologyTLSConfigName, config.Config().MySQLTopologySSLCAFile, config.Config().MySQLTopologySSLCertFile,
+		config.Config().MySQLTopologySSLPrivateKeyFile, config.Config().MySQLTopologySSLSkipVerify)
+	return fmt.Sprintf("&tls=%s", topologyTLSConfigName), err
+}
+
+// orchestratorTLSParam returns the DSN parameter for the backend connection's TLS, if any
+func orchestratorTLSParam() (string, error) {
+	if !config.Config().MySQLOrchestratorUseSSL {
+		return "", nil
+	}
+	err := registerTLSConfig(orchestratorTLSConfigName, config.Config().MySQLOrchestratorSSLCAFile, config.Config().MySQLOrchestratorSSLCertFile,
+		config.Config().MySQLOrchestratorSSLPrivateKeyFile, config.Config().MySQLOrchestratorSSLSkipVerify)
+	return fmt.Sprintf("&tls=%s", orchestratorTLSConfigName), err
+}
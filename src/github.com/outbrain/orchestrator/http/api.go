@@ -17,20 +17,24 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/go-martini/martini"
 	"github.com/martini-contrib/auth"
 	"github.com/martini-contrib/render"
+	"github.com/outbrain/golib/log"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/outbrain/orchestrator/agent"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/inst"
 	"github.com/outbrain/orchestrator/logic"
+	"github.com/outbrain/orchestrator/metrics"
 )
 
 // APIResponseCode is an OK/ERROR response code
@@ -67,20 +71,16 @@ type HttpAPI struct{}
 var API HttpAPI = HttpAPI{}
 
 func (this *HttpAPI) getProxyAuthUser(req *http.Request) string {
-	for _, user := range req.Header[config.Config.AuthUserHeader] {
+	for _, user := range req.Header[config.Config().AuthUserHeader] {
 		return user
 	}
 	return ""
 }
 
-// isAuthorizedForAction checks req to see whether authenticated user has write-privileges.
-// This depends on configured authentication method.
-func (this *HttpAPI) isAuthorizedForAction(req *http.Request, user auth.User) bool {
-	if config.Config.ReadOnly {
-		return false
-	}
-
-	switch strings.ToLower(config.Config.AuthenticationMethod) {
+// hasWritePrivileges checks req to see whether authenticated user has write-privileges, when role based
+// access control is not configured. This depends on configured authentication method.
+func (this *HttpAPI) hasWritePrivileges(req *http.Request, user auth.User) bool {
+	switch strings.ToLower(config.Config().AuthenticationMethod) {
 	case "basic":
 		{
 			// The mere fact we're here means the user has passed authentication
@@ -98,13 +98,22 @@ func (this *HttpAPI) isAuthorizedForAction(req *http.Request, user auth.User) bo
 	case "proxy":
 		{
 			authUser := this.getProxyAuthUser(req)
-			for _, user := range config.Config.PowerAuthUsers {
+			for _, user := range config.Config().PowerAuthUsers {
 				if user == "*" || user == authUser {
 					return true
 				}
 			}
 			return false
 		}
+	case "ssl":
+		{
+			for _, powerUser := range config.Config().PowerAuthUsers {
+				if powerUser == "*" || powerUser == string(user) {
+					return true
+				}
+			}
+			return false
+		}
 	default:
 		{
 			// Default: no authentication method
@@ -113,11 +122,208 @@ func (this *HttpAPI) isAuthorizedForAction(req *http.Request, user auth.User) bo
 	}
 }
 
+// getPermissions returns the effective roles of the user issuing the request. Without role based access
+// control, users with write-privileges are admins and all others are viewers.
+func (this *HttpAPI) getPermissions(req *http.Request, user auth.User) *inst.Permissions {
+	userName := this.getUserId(req, user)
+	var permissions *inst.Permissions
+	if token, ok := inst.APITokenFromContext(req.Context()); ok {
+		// Errors are logged; we go on with whatever grants could be read
+		permissions, _ = inst.ReadAPITokenPermissions(token)
+	} else if inst.IsAccessControlEnabled() {
+		// Errors are logged; we go on with whatever grants could be read
+		permissions, _ = inst.ReadUserPermissions(userName)
+	} else {
+		permissions = &inst.Permissions{UserName: userName, Role: inst.ViewerRole, ClusterRoles: make(map[string]inst.Role)}
+		if this.hasWritePrivileges(req, user) {
+			permissions.Role = inst.AdminRole
+		}
+	}
+	if config.Config().ReadOnly {
+		permissions.CapAt(inst.ViewerRole)
+	}
+	return permissions
+}
+
+// scopeForRole returns the API token scope an action requiring given role needs
+func scopeForRole(role inst.Role) string {
+	if role >= inst.OperatorRole {
+		return inst.TopologyChangesScope
+	}
+	return inst.ReadOnlyScope
+}
+
+// isAuthorizedForAction checks whether authenticated user has given role on all clusters
+func (this *HttpAPI) isAuthorizedForAction(req *http.Request, user auth.User, role inst.Role) bool {
+	permissions := this.getPermissions(req, user)
+	return permissions.HasScope(scopeForRole(role)) && permissions.Role >= role
+}
+
+// isAuthorizedForCluster checks whether authenticated user has given role on given cluster
+func (this *HttpAPI) isAuthorizedForCluster(req *http.Request, user auth.User, role inst.Role, clusterName string) bool {
+	permissions := this.getPermissions(req, user)
+	return permissions.HasScope(scopeForRole(role)) && permissions.RoleOnCluster(clusterName) >= role
+}
+
+// isAuthorizedForInstance checks whether authenticated user has given role on the clusters of all given instances.
+// An instance unknown to orchestrator requires the role on all clusters.
+func (this *HttpAPI) isAuthorizedForInstance(req *http.Request, user auth.User, role inst.Role, instanceKeys ...*inst.InstanceKey) bool {
+	return this.isAuthorizedForInstanceScope(req, user, role, scopeForRole(role), instanceKeys...)
+}
+
+// isAuthorizedForMaintenance checks whether authenticated user may begin or end maintenance on given instance.
+// This is allowed for API tokens with the maintenance scope.
+func (this *HttpAPI) isAuthorizedForMaintenance(req *http.Request, user auth.User, instanceKey *inst.InstanceKey) bool {
+	return this.isAuthorizedForInstanceScope(req, user, inst.OperatorRole, inst.MaintenanceScope, instanceKey)
+}
+
+func (this *HttpAPI) isAuthorizedForInstanceScope(req *http.Request, user auth.User, role inst.Role, scope string, instanceKeys ...*inst.InstanceKey) bool {
+	permissions := this.getPermissions(req, user)
+	if !permissions.HasScope(scope) {
+		return false
+	}
+	for _, instanceKey := range instanceKeys {
+		clusterName := ""
+		if instance, found, _ := inst.ReadInstance(instanceKey); found {
+			clusterName = instance.ClusterName
+		}
+		if permissions.RoleOnCluster(clusterName) < role {
+			return false
+		}
+	}
+	return true
+}
+
+// isAuthorizedToCancelOperation checks whether authenticated user is an admin or the owner of given operation
+func (this *HttpAPI) isAuthorizedToCancelOperation(req *http.Request, user auth.User, operationId int64) bool {
+	if this.isAuthorizedForAction(req, user, inst.AdminRole) {
+		return true
+	}
+	if config.Config().ReadOnly {
+		return false
+	}
+	for _, operation := range inst.ReadActiveOperations() {
+		if operation.Id == operationId {
+			return operation.Owner != "" && operation.Owner == this.getUserId(req, user)
+		}
+	}
+	return false
+}
+
+// getUserId returns the name of the authenticated user issuing the request, if known. For requests authenticated
+// by API token, this is the token's name.
+func (this *HttpAPI) getUserId(req *http.Request, user auth.User) string {
+	if tokenName := inst.APITokenNameFromContext(req.Context()); tokenName != "" {
+		return tokenName
+	}
+	if strings.ToLower(config.Config().AuthenticationMethod) == "proxy" {
+		return this.getProxyAuthUser(req)
+	}
+	return string(user)
+}
+
+// isAsync returns true when the request asks for its operation to run in the background ("?async=true")
+func (this *HttpAPI) isAsync(req *http.Request) bool {
+	async, _ := strconv.ParseBool(req.URL.Query().Get("async"))
+	return async
+}
+
+// isDryRun returns true when the request asks for its operation to only be planned ("?dry-run=1")
+func (this *HttpAPI) isDryRun(req *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry-run"))
+	return dryRun
+}
+
+// runOperation runs a topology operation issued by given request, and renders its outcome. The operation is
+// cancelled should the client disconnect, and can be cancelled via /api/cancel-operation.
+// With "?async=true", the operation is instead submitted as a background job, and its id is rendered right away.
+// Its progress and outcome are then polled via /api/operation/:id
+func (this *HttpAPI) runOperation(r render.Render, req *http.Request, user auth.User, description string, operationFunc inst.OperationFunc) {
+	if this.isDryRun(req) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "dry-run is not supported for this operation"})
+		return
+	}
+	this.executeOperation(r, req, user, description, operationFunc)
+}
+
+// runDryRunnableOperation is like runOperation, for operations which support "?dry-run=1". In dry-run mode the
+// operation does not change replication state; its plan is rendered instead.
+func (this *HttpAPI) runDryRunnableOperation(r render.Render, req *http.Request, user auth.User, description string, operationFunc inst.OperationFunc) {
+	if !this.isDryRun(req) {
+		this.executeOperation(r, req, user, description, operationFunc)
+		return
+	}
+	planFunc := func(ctx context.Context) (*inst.OperationResult, error) {
+		ctx, plan := inst.NewDryRunContext(ctx)
+		result, err := operationFunc(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Dry run: %s", result.Message), Details: plan}, nil
+	}
+	this.executeOperation(r, req, user, fmt.Sprintf("%s (dry-run)", description), planFunc)
+}
+
+func (this *HttpAPI) executeOperation(r render.Render, req *http.Request, user auth.User, description string, operationFunc inst.OperationFunc) {
+	owner := this.getUserId(req, user)
+	if this.isAsync(req) {
+		operation := inst.SubmitOperation(req.Context(), description, owner, operationFunc)
+		r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Submitted operation %d: %s", operation.Id, description), Details: operation.Id})
+		return
+	}
+	result, err := inst.RunOperation(req.Context(), description, owner, operationFunc)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code: OK, Message: result.Message, Details: result.Details})
+}
+
 func (this *HttpAPI) getInstanceKey(host string, port string) (inst.InstanceKey, error) {
 	instanceKey, err := inst.NewInstanceKeyFromStrings(host, port)
 	return *instanceKey, err
 }
 
+// getSinceSeconds parses the "since" request argument, which is either a number of seconds or a
+// duration such as "90m" or "6h". It defaults to one hour.
+func (this *HttpAPI) getSinceSeconds(req *http.Request) (uint, error) {
+	since := req.URL.Query().Get("since")
+	if since == "" {
+		return 3600, nil
+	}
+	if seconds, err := strconv.ParseUint(since, 10, 32); err == nil {
+		return uint(seconds), nil
+	}
+	duration, err := time.ParseDuration(since)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("Negative duration: %s", since)
+	}
+	return uint(duration.Seconds()), nil
+}
+
+// getClusterSlavesFilter reads the optional "max-lag" (seconds) and "read-only" (true|false) cluster slaves
+// filters off the request. maxLagSeconds is -1 when no lag filter is given.
+func (this *HttpAPI) getClusterSlavesFilter(req *http.Request) (maxLagSeconds int64, readOnly *bool, err error) {
+	maxLagSeconds = -1
+	if maxLag := req.URL.Query().Get("max-lag"); maxLag != "" {
+		if maxLagSeconds, err = strconv.ParseInt(maxLag, 10, 64); err != nil || maxLagSeconds < 0 {
+			return maxLagSeconds, readOnly, fmt.Errorf("Invalid max-lag: %s", maxLag)
+		}
+	}
+	if readOnlyParam := req.URL.Query().Get("read-only"); readOnlyParam != "" {
+		readOnlyValue, err := strconv.ParseBool(readOnlyParam)
+		if err != nil {
+			return maxLagSeconds, readOnly, fmt.Errorf("Invalid read-only: %s", readOnlyParam)
+		}
+		readOnly = &readOnlyValue
+	}
+	return maxLagSeconds, readOnly, nil
+}
+
 // Instance reads and returns an instance's details.
 func (this *HttpAPI) Instance(params martini.Params, r render.Render, req *http.Request) {
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
@@ -136,16 +342,16 @@ func (this *HttpAPI) Instance(params martini.Params, r render.Render, req *http.
 
 // Discover starts an asynchronuous discovery for an instance
 func (this *HttpAPI) Discover(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
 	go orchestrator.StartDiscovery(instanceKey)
 
 	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance submitted for discovery: %+v", instanceKey)})
@@ -153,18 +359,18 @@ func (this *HttpAPI) Discover(params martini.Params, r render.Render, req *http.
 
 // Refresh synchronuously re-reads a topology instance
 func (this *HttpAPI) Refresh(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
 
-	_, err = inst.RefreshTopologyInstance(&instanceKey)
+	_, err = inst.RefreshTopologyInstance(req.Context(), &instanceKey)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -175,14 +381,14 @@ func (this *HttpAPI) Refresh(params martini.Params, r render.Render, req *http.R
 
 // Forget removes an instance entry fro backend database
 func (this *HttpAPI) Forget(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	// We ignore errors: we're looking to do a destructive operation anyhow.
+	instanceKey, _ := this.getInstanceKey(params["host"], params["port"])
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	// We ignore errors: we're looking to do a destructive operation anyhow.
-	instanceKey, _ := this.getInstanceKey(params["host"], params["port"])
 
-	inst.ForgetInstance(&instanceKey)
+	inst.ForgetInstance(req.Context(), &instanceKey)
 
 	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance forgotten: %+v", instanceKey)})
 }
@@ -208,17 +414,17 @@ func (this *HttpAPI) Resolve(params martini.Params, r render.Render, req *http.R
 
 // BeginMaintenance begins maintenance mode for given instance
 func (this *HttpAPI) BeginMaintenance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	key, err := inst.BeginMaintenance(&instanceKey, params["owner"], params["reason"])
+	if !this.isAuthorizedForMaintenance(req, user, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	key, err := inst.BeginMaintenance(req.Context(), &instanceKey, params["owner"], params["reason"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error(), Details: key})
 		return
@@ -229,16 +435,21 @@ func (this *HttpAPI) BeginMaintenance(params martini.Params, r render.Render, re
 
 // EndMaintenance terminates maintenance mode
 func (this *HttpAPI) EndMaintenance(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+	maintenanceKey, err := strconv.ParseInt(params["maintenanceKey"], 10, 0)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	maintenanceKey, err := strconv.ParseInt(params["maintenanceKey"], 10, 0)
+	instanceKey, err := inst.ReadMaintenanceInstanceKey(maintenanceKey)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	err = inst.EndMaintenance(maintenanceKey)
+	if !this.isAuthorizedForMaintenance(req, user, instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	err = inst.EndMaintenance(req.Context(), maintenanceKey)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -249,17 +460,17 @@ func (this *HttpAPI) EndMaintenance(params martini.Params, r render.Render, req
 
 // EndMaintenanceByInstanceKey terminates maintenance mode for given instance
 func (this *HttpAPI) EndMaintenanceByInstanceKey(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	err = inst.EndMaintenanceByInstanceKey(&instanceKey)
+	if !this.isAuthorizedForMaintenance(req, user, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	err = inst.EndMaintenanceByInstanceKey(req.Context(), &instanceKey)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -282,117 +493,113 @@ func (this *HttpAPI) Maintenance(params martini.Params, r render.Render, req *ht
 
 // MoveUp attempts to move an instance up the topology
 func (this *HttpAPI) MoveUp(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.MoveUp(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Instance moved up", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("move-up %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.MoveUp(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Instance moved up", Details: instance}, nil
+	})
 }
 
 // MakeCoMaster attempts to make an instance co-master with its own master
 func (this *HttpAPI) MakeCoMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.MakeCoMaster(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Instance made co-master", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("make-co-master %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.MakeCoMaster(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Instance made co-master", Details: instance}, nil
+	})
 }
 
 // ResetSlave makes a slave forget about its master, effectively breaking the replication
 func (this *HttpAPI) ResetSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.ResetSlaveOperation(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave reset", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("reset-slave %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.ResetSlaveOperation(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave reset", Details: instance}, nil
+	})
 }
 
 // DetachSlave corrupts a slave's binlog corrdinates (though encodes it in such way
 // that is reversible), effectively breaking replication
 func (this *HttpAPI) DetachSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.DetachSlaveOperation(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave detached", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("detach-slave %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.DetachSlaveOperation(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave detached", Details: instance}, nil
+	})
 }
 
 // ReattachSlave reverts a DetachSlave commands by reassigning the correct
 // binlog coordinates to an instance
 func (this *HttpAPI) ReattachSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.ReattachSlaveOperation(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave reattached", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("reattach-slave %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.ReattachSlaveOperation(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave reattached", Details: instance}, nil
+	})
 }
 
 // MoveBelow attempts to move an instance below its supposed sibling
 func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
@@ -403,50 +610,54 @@ func (this *HttpAPI) MoveBelow(params martini.Params, r render.Render, req *http
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	instance, err := inst.MoveBelow(&instanceKey, &siblingKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey, &siblingKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance %+v moved below %+v", instanceKey, siblingKey), Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("move-below %+v below %+v", instanceKey, siblingKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.MoveBelow(ctx, &instanceKey, &siblingKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v moved below %+v", instanceKey, siblingKey), Details: instance}, nil
+	})
 }
 
 // EnslaveSiblingsSimple
 func (this *HttpAPI) EnslaveSiblingsSimple(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	instance, count, err := inst.EnslaveSiblingsSimple(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Enslaved %d siblings of %+v", count, instanceKey), Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("enslave-siblings-simple %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, count, err := inst.EnslaveSiblingsSimple(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Enslaved %d siblings of %+v", count, instanceKey), Details: instance}, nil
+	})
 }
 
 // LastPseudoGTID attempts to find the last pseugo-gtid entry in an instance
 func (this *HttpAPI) LastPseudoGTID(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
 
-	instance, err := inst.ReadTopologyInstance(&instanceKey)
+	instance, err := inst.ReadTopologyInstance(req.Context(), &instanceKey)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -455,7 +666,7 @@ func (this *HttpAPI) LastPseudoGTID(params martini.Params, r render.Render, req
 		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("Instance not found: %+v", instanceKey)})
 		return
 	}
-	coordinates, text, err := inst.FindLastPseudoGTIDEntry(instance, instance.RelaylogCoordinates, false)
+	coordinates, text, err := inst.FindLastPseudoGTIDEntry(req.Context(), instance, instance.RelaylogCoordinates, false)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
@@ -471,10 +682,6 @@ func (this *HttpAPI) LastPseudoGTID(params martini.Params, r render.Render, req
 
 // MatchBelow attempts to move an instance below another via pseudo GTID matching of binlog entries
 func (this *HttpAPI) MatchBelow(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
@@ -485,22 +692,22 @@ func (this *HttpAPI) MatchBelow(params martini.Params, r render.Render, req *htt
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	instance, matchedCoordinates, err := inst.MatchBelow(&instanceKey, &belowKey, true, true)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey, &belowKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance %+v matched below %+v at %+v", instanceKey, belowKey, *matchedCoordinates), Details: instance})
+	this.runDryRunnableOperation(r, req, user, fmt.Sprintf("match-below %+v below %+v", instanceKey, belowKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, matchedCoordinates, err := inst.MatchBelow(ctx, &instanceKey, &belowKey, true, true)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v matched below %+v at %+v", instanceKey, belowKey, *matchedCoordinates), Details: instance}, nil
+	})
 }
 
 // MultiMatchSlaves attempts to match all slaves of a given instance below another, efficiently
 func (this *HttpAPI) MultiMatchSlaves(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
@@ -511,233 +718,235 @@ func (this *HttpAPI) MultiMatchSlaves(params martini.Params, r render.Render, re
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	slaves, newMaster, err := inst.MultiMatchSlaves(&instanceKey, &belowKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey, &belowKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Matched up %d slaves of %+v below %+v", len(slaves), instanceKey, newMaster.Key), Details: newMaster.Key})
+	this.runDryRunnableOperation(r, req, user, fmt.Sprintf("multi-match-slaves %+v below %+v", instanceKey, belowKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		slaves, newMaster, err := inst.MultiMatchSlaves(ctx, &instanceKey, &belowKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Matched up %d slaves of %+v below %+v", len(slaves), instanceKey, newMaster.Key), Details: newMaster.Key}, nil
+	})
 }
 
 // MatchBelow attempts to move an instance below another via pseudo GTID matching of binlog entries
 func (this *HttpAPI) MatchUpSlaves(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	slaves, newMaster, err := inst.MatchUpSlaves(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Matched up %d slaves of %+v below %+v", len(slaves), instanceKey, newMaster.Key), Details: newMaster.Key})
+	this.runDryRunnableOperation(r, req, user, fmt.Sprintf("match-up-slaves %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		slaves, newMaster, err := inst.MatchUpSlaves(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Matched up %d slaves of %+v below %+v", len(slaves), instanceKey, newMaster.Key), Details: newMaster.Key}, nil
+	})
 }
 
 // RegroupSlaves attempts to pick a slave of a given instance and make it enslave its siblings, efficiently,
 // using pseudo-gtid if necessary
 func (this *HttpAPI) RegroupSlaves(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	lostSlaves, equalSlaves, aheadSlaves, promotedSlave, err := inst.RegroupSlaves(&instanceKey)
-
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("promoted slave: %s, lost: %d, trivial: %d, pseudo-gtid: %d",
-		promotedSlave.Key.DisplayString(), len(lostSlaves), len(equalSlaves), len(aheadSlaves)), Details: promotedSlave.Key})
+	this.runDryRunnableOperation(r, req, user, fmt.Sprintf("regroup-slaves %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		lostSlaves, equalSlaves, aheadSlaves, promotedSlave, err := inst.RegroupSlaves(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("promoted slave: %s, lost: %d, trivial: %d, pseudo-gtid: %d",
+			promotedSlave.Key.DisplayString(), len(lostSlaves), len(equalSlaves), len(aheadSlaves)), Details: promotedSlave.Key}, nil
+	})
 }
 
 // MakeMaster attempts to make the given instance a master, and match its siblings to be its slaves
 func (this *HttpAPI) MakeMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	instance, err := inst.MakeMaster(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance %+v now made master", instanceKey), Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("make-master %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.MakeMaster(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v now made master", instanceKey), Details: instance}, nil
+	})
 }
 
 // MakeLocalMaster attempts to make the given instance a local master: take over its master by
 // enslaving its siblings and replicating from its grandparent.
 func (this *HttpAPI) MakeLocalMaster(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
-	instance, err := inst.MakeLocalMaster(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
 
-	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Instance %+v now made local master", instanceKey), Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("make-local-master %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.MakeLocalMaster(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v now made local master", instanceKey), Details: instance}, nil
+	})
 }
 
 // StartSlave starts replication on given instance
 func (this *HttpAPI) StartSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.StartSlave(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave started", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("start-slave %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.StartSlave(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave started", Details: instance}, nil
+	})
 }
 
 // StopSlave stops replication on given instance
 func (this *HttpAPI) StopSlave(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.StopSlave(&instanceKey)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave stopped", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("stop-slave %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.StopSlave(ctx, &instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave stopped", Details: instance}, nil
+	})
 }
 
 // StopSlaveNicely stops replication on given instance, such that sql thead is aligned with IO thread
 func (this *HttpAPI) StopSlaveNicely(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.StopSlaveNicely(&instanceKey, 0)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave stopped nicely", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("stop-slave-nice %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.StopSlaveNicely(ctx, &instanceKey, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave stopped nicely", Details: instance}, nil
+	})
 }
 
 // SetReadOnly sets the global read_only variable
 func (this *HttpAPI) SetReadOnly(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.SetReadOnly(&instanceKey, true)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Server set as read-only", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("set-read-only %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.SetReadOnly(ctx, &instanceKey, true)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Server set as read-only", Details: instance}, nil
+	})
 }
 
 // SetWriteable clear the global read_only variable
 func (this *HttpAPI) SetWriteable(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
 
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.SetReadOnly(&instanceKey, false)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Server set as writeable", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("set-writeable %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.SetReadOnly(ctx, &instanceKey, false)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Server set as writeable", Details: instance}, nil
+	})
 }
 
 // KillQuery kills a query running on a server
 func (this *HttpAPI) KillQuery(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
-		return
-	}
 	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
-	processId, err := strconv.ParseInt(params["process"], 10, 0)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-
+	processId, err := strconv.ParseInt(params["process"], 10, 0)
 	if err != nil {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
 		return
 	}
-	instance, err := inst.KillQuery(&instanceKey, processId)
-	if err != nil {
-		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+	if !this.isAuthorizedForInstance(req, user, inst.OperatorRole, &instanceKey) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-
-	r.JSON(200, &APIResponse{Code: OK, Message: "Slave stopped", Details: instance})
+	this.runOperation(r, req, user, fmt.Sprintf("kill-query %+v", instanceKey), func(ctx context.Context) (*inst.OperationResult, error) {
+		instance, err := inst.KillQuery(ctx, &instanceKey, processId)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: "Slave stopped", Details: instance}, nil
+	})
 }
 
 // Cluster provides list of instances in given cluster
@@ -752,6 +961,31 @@ func (this *HttpAPI) Cluster(params martini.Params, r render.Render, req *http.R
 	r.JSON(200, instances)
 }
 
+// ClusterExport provides the topology of a given cluster, exported by the "format" argument: dot (default),
+// json (nested tree) or mermaid
+func (this *HttpAPI) ClusterExport(params martini.Params, r render.Render, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = inst.DOTFormat
+	}
+	instances, err := inst.ReadClusterInstances(params["clusterName"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	tree := inst.NewTopologyTree(instances)
+	if format == inst.JSONFormat {
+		r.JSON(200, tree.Roots)
+		return
+	}
+	exported, err := tree.Export(params["clusterName"], format)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	r.Text(200, exported)
+}
+
 // ClusterInfo provides details of a given cluster
 func (this *HttpAPI) ClusterInfo(params martini.Params, r render.Render, req *http.Request) {
 	clusterInfo, err := inst.ReadClusterInfo(params["clusterName"])
@@ -764,8 +998,88 @@ func (this *HttpAPI) ClusterInfo(params martini.Params, r render.Render, req *ht
 	r.JSON(200, clusterInfo)
 }
 
+// ClusterMaster returns the writeable master of a cluster, given by alias or name
+func (this *HttpAPI) ClusterMaster(params martini.Params, r render.Render, req *http.Request) {
+	clusterName, err := inst.ReadClusterNameByAlias(params["clusterHint"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	master, err := inst.ReadClusterMaster(clusterName)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(200, &master.Key)
+}
+
+// ClusterSlaves returns the slaves of a cluster, given by alias or name, optionally filtered by lag and read_only
+func (this *HttpAPI) ClusterSlaves(params martini.Params, r render.Render, req *http.Request) {
+	maxLagSeconds, readOnly, err := this.getClusterSlavesFilter(req)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	clusterName, err := inst.ReadClusterNameByAlias(params["clusterHint"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+	slaves, err := inst.ReadClusterSlaves(clusterName, maxLagSeconds, readOnly)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(200, slaves)
+}
+
+// InstanceLagHistory returns the replication lag time series of a given instance
+func (this *HttpAPI) InstanceLagHistory(params martini.Params, r render.Render, req *http.Request) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	sinceSeconds, err := this.getSinceSeconds(req)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	samples, err := inst.ReadInstanceLagHistory(&instanceKey, sinceSeconds)
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(200, samples)
+}
+
+// ClusterLagHistory returns the replication lag time series of all instances in a given cluster
+func (this *HttpAPI) ClusterLagHistory(params martini.Params, r render.Render, req *http.Request) {
+	sinceSeconds, err := this.getSinceSeconds(req)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	samples, err := inst.ReadClusterLagHistory(params["clusterName"], sinceSeconds)
+
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: fmt.Sprintf("%+v", err)})
+		return
+	}
+
+	r.JSON(200, samples)
+}
+
 // ClusterInfo provides details of a given cluster
-func (this *HttpAPI) SetClusterAlias(params martini.Params, r render.Render, req *http.Request) {
+func (this *HttpAPI) SetClusterAlias(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
 	clusterName := params["clusterName"]
 	alias := req.URL.Query().Get("alias")
 
@@ -859,7 +1173,11 @@ func (this *HttpAPI) LongQueries(params martini.Params, r render.Render, req *ht
 }
 
 // Audit provides list of audit entries by given page number
-func (this *HttpAPI) ResetHostnameResolveCache(params martini.Params, r render.Render, req *http.Request) {
+func (this *HttpAPI) ResetHostnameResolveCache(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
 	err := inst.ResetHostnameResolveCache()
 
 	if err != nil {
@@ -872,11 +1190,11 @@ func (this *HttpAPI) ResetHostnameResolveCache(params martini.Params, r render.R
 
 // Agents provides complete list of registered agents (See https://github.com/outbrain/orchestrator-agent)
 func (this *HttpAPI) Agents(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -893,11 +1211,11 @@ func (this *HttpAPI) Agents(params martini.Params, r render.Render, req *http.Re
 
 // Agent returns complete information of a given agent
 func (this *HttpAPI) Agent(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -914,11 +1232,11 @@ func (this *HttpAPI) Agent(params martini.Params, r render.Render, req *http.Req
 
 // AgentUnmount instructs an agent to unmount the designated mount point
 func (this *HttpAPI) AgentUnmount(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -935,11 +1253,11 @@ func (this *HttpAPI) AgentUnmount(params martini.Params, r render.Render, req *h
 
 // AgentMountLV instructs an agent to mount a given volume on the designated mount point
 func (this *HttpAPI) AgentMountLV(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -956,11 +1274,11 @@ func (this *HttpAPI) AgentMountLV(params martini.Params, r render.Render, req *h
 
 // AgentCreateSnapshot instructs an agent to create a new snapshot. Agent's DIY implementation.
 func (this *HttpAPI) AgentCreateSnapshot(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -977,11 +1295,11 @@ func (this *HttpAPI) AgentCreateSnapshot(params martini.Params, r render.Render,
 
 // AgentRemoveLV instructs an agent to remove a logical volume
 func (this *HttpAPI) AgentRemoveLV(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -998,11 +1316,11 @@ func (this *HttpAPI) AgentRemoveLV(params martini.Params, r render.Render, req *
 
 // AgentMySQLStop stops MySQL service on agent
 func (this *HttpAPI) AgentMySQLStop(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1019,11 +1337,11 @@ func (this *HttpAPI) AgentMySQLStop(params martini.Params, r render.Render, req
 
 // AgentMySQLStart starts MySQL service on agent
 func (this *HttpAPI) AgentMySQLStart(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1041,11 +1359,11 @@ func (this *HttpAPI) AgentMySQLStart(params martini.Params, r render.Render, req
 // AgentSeed completely seeds a host with another host's snapshots. This is a complex operation
 // governed by orchestrator and executed by the two agents involved.
 func (this *HttpAPI) AgentSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1062,11 +1380,11 @@ func (this *HttpAPI) AgentSeed(params martini.Params, r render.Render, req *http
 
 // AgentActiveSeeds lists active seeds and their state
 func (this *HttpAPI) AgentActiveSeeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1083,11 +1401,11 @@ func (this *HttpAPI) AgentActiveSeeds(params martini.Params, r render.Render, re
 
 // AgentRecentSeeds lists recent seeds of a given agent
 func (this *HttpAPI) AgentRecentSeeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1104,11 +1422,11 @@ func (this *HttpAPI) AgentRecentSeeds(params martini.Params, r render.Render, re
 
 // AgentSeedDetails provides details of a given seed
 func (this *HttpAPI) AgentSeedDetails(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1126,11 +1444,11 @@ func (this *HttpAPI) AgentSeedDetails(params martini.Params, r render.Render, re
 
 // AgentSeedStates returns the breakdown of states (steps) of a given seed
 func (this *HttpAPI) AgentSeedStates(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1148,11 +1466,11 @@ func (this *HttpAPI) AgentSeedStates(params martini.Params, r render.Render, req
 
 // Seeds retruns all recent seeds
 func (this *HttpAPI) Seeds(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.OperatorRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1169,11 +1487,11 @@ func (this *HttpAPI) Seeds(params martini.Params, r render.Render, req *http.Req
 
 // AbortSeed instructs agents to abort an active seed
 func (this *HttpAPI) AbortSeed(params martini.Params, r render.Render, req *http.Request, user auth.User) {
-	if !this.isAuthorizedForAction(req, user) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
 		return
 	}
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		r.JSON(200, &APIResponse{Code: ERROR, Message: "Agents not served"})
 		return
 	}
@@ -1206,6 +1524,125 @@ func (this *HttpAPI) Health(params martini.Params, r render.Render, req *http.Re
 
 }
 
+// Operations lists currently running topology operations
+func (this *HttpAPI) Operations(params martini.Params, r render.Render, req *http.Request) {
+	r.JSON(200, inst.ReadActiveOperations())
+}
+
+// Operation returns the state, progress log and outcome of a topology operation
+func (this *HttpAPI) Operation(params martini.Params, r render.Render, req *http.Request) {
+	operationId, err := strconv.ParseInt(params["id"], 10, 0)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	operationStatus, err := inst.ReadOperationStatus(operationId)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, operationStatus)
+}
+
+// RecentOperations returns records of latest topology operations, paged
+func (this *HttpAPI) RecentOperations(params martini.Params, r render.Render, req *http.Request) {
+	page, err := strconv.Atoi(params["page"])
+	if err != nil || page < 0 {
+		page = 0
+	}
+	operations, err := inst.ReadRecentOperations(page)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, operations)
+}
+
+// CancelOperation aborts a running topology operation
+func (this *HttpAPI) CancelOperation(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	operationId, err := strconv.ParseInt(params["id"], 10, 0)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	if !this.isAuthorizedToCancelOperation(req, user, operationId) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	err = inst.CancelOperation(req.Context(), operationId)
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Operation %d cancelled", operationId)})
+}
+
+// WhoAmI shows the effective roles of the authenticated user
+func (this *HttpAPI) WhoAmI(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	r.JSON(200, this.getPermissions(req, user))
+}
+
+// AccessGrants lists the access grants stored in the backend
+func (this *HttpAPI) AccessGrants(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	grants, err := inst.ReadAccessGrants()
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, grants)
+}
+
+// GrantAccess grants a role to a user on a cluster alias, or on all clusters ("*")
+func (this *HttpAPI) GrantAccess(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	role, err := inst.ParseRole(params["role"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+	err = inst.GrantAccess(req.Context(), params["userName"], params["clusterAlias"], role, this.getUserId(req, user))
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Granted %s on %s to %s", role, params["clusterAlias"], params["userName"])})
+}
+
+// RevokeAccess removes a user's grant on a cluster alias
+func (this *HttpAPI) RevokeAccess(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+	if !this.isAuthorizedForAction(req, user, inst.AdminRole) {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: "Unauthorized"})
+		return
+	}
+	err := inst.RevokeAccess(req.Context(), params["userName"], params["clusterAlias"])
+	if err != nil {
+		r.JSON(200, &APIResponse{Code: ERROR, Message: err.Error()})
+		return
+	}
+
+	r.JSON(200, &APIResponse{Code: OK, Message: fmt.Sprintf("Revoked grant on %s from %s", params["clusterAlias"], params["userName"])})
+}
+
+// Metrics exports orchestrator's internal and topology metrics in Prometheus text format
+func (this *HttpAPI) Metrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", metrics.PrometheusContentType)
+	if err := metrics.WritePrometheus(w); err != nil {
+		log.Errore(err)
+	}
+}
+
 // RegisterRequests makes for the de-facto list of known API calls
 func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	m.Get("/api/instance/:host/:port", this.Instance)
@@ -1237,9 +1674,19 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	m.Get("/api/set-writeable/:host/:port", this.SetWriteable)
 	m.Get("/api/kill-query/:host/:port/:process", this.KillQuery)
 	m.Get("/api/maintenance", this.Maintenance)
+	m.Get("/api/operations", this.Operations)
+	m.Get("/api/cancel-operation/:id", this.CancelOperation)
+	m.Get("/api/operation/:id", this.Operation)
+	m.Get("/api/recent-operations", this.RecentOperations)
+	m.Get("/api/recent-operations/:page", this.RecentOperations)
 	m.Get("/api/cluster/:clusterName", this.Cluster)
+	m.Get("/api/cluster/:clusterName/export", this.ClusterExport)
 	m.Get("/api/cluster-info/:clusterName", this.ClusterInfo)
+	m.Get("/api/master/:clusterHint", this.ClusterMaster)
+	m.Get("/api/cluster-slaves/:clusterHint", this.ClusterSlaves)
 	m.Get("/api/set-cluster-alias/:clusterName", this.SetClusterAlias)
+	m.Get("/api/instance-lag-history/:host/:port", this.InstanceLagHistory)
+	m.Get("/api/cluster-lag-history/:clusterName", this.ClusterLagHistory)
 	m.Get("/api/clusters", this.Clusters)
 	m.Get("/api/clusters-info", this.ClustersInfo)
 	m.Get("/api/search/:searchString", this.Search)
@@ -1266,6 +1713,13 @@ func (this *HttpAPI) RegisterRequests(m *martini.ClassicMartini) {
 	m.Get("/api/agent-seed-states/:seedId", this.AgentSeedStates)
 	m.Get("/api/agent-abort-seed/:seedId", this.AbortSeed)
 	m.Get("/api/seeds", this.Seeds)
+	m.Get("/api/whoami", this.WhoAmI)
+	m.Get("/api/access-grants", this.AccessGrants)
+	m.Get("/api/grant-access/:userName/:clusterAlias/:role", this.GrantAccess)
+	m.Get("/api/revoke-access/:userName/:clusterAlias", this.RevokeAccess)
 	m.Get("/api/headers", this.Headers)
 	m.Get("/api/health", this.Health)
+	m.Get("/metrics", this.Metrics)
+
+	this.registerV2Requests(m)
 }
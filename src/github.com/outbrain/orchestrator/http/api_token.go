@@ -0,0 +1,62 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"github.com/outbrain/golib/log"
+	"net/http"
+	"strings"
+
+	"github.com/outbrain/orchestrator/inst"
+)
+
+// getBearerToken returns the secret presented via "Authorization: Bearer <token>", if any
+func getBearerToken(req *http.Request) (string, bool) {
+	authorization := req.Header.Get("Authorization")
+	if len(authorization) < len("Bearer ") || !strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len("Bearer "):]), true
+}
+
+// AuthenticateAPIToken returns a martini handler which authenticates requests presenting an API token via
+// "Authorization: Bearer". The token's name becomes the request's user, and the token is carried by the
+// request's context. Other requests are passed on to given authentication handler (nil for none).
+func AuthenticateAPIToken(authenticationHandler martini.Handler) martini.Handler {
+	return func(c martini.Context, res http.ResponseWriter, req *http.Request) {
+		secret, isBearer := getBearerToken(req)
+		if !isBearer {
+			if authenticationHandler != nil {
+				if _, err := c.Invoke(authenticationHandler); err != nil {
+					log.Errore(err)
+					http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}
+			return
+		}
+		token, err := inst.AuthenticateAPIToken(secret)
+		if err != nil {
+			res.Header().Set("WWW-Authenticate", `Bearer realm="orchestrator"`)
+			http.Error(res, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+		c.Map(auth.User(token.TokenName))
+		c.Map(req.WithContext(inst.NewAPITokenContext(req.Context(), token)))
+	}
+}
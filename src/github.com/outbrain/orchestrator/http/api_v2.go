@@ -0,0 +1,905 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"github.com/martini-contrib/render"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/outbrain/orchestrator/agent"
+	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/kv"
+	"github.com/outbrain/orchestrator/logic"
+)
+
+// APIV2Error is the body of a v2 API error response
+type APIV2Error struct {
+	Status  int
+	Message string
+}
+
+// MaintenanceRequest is the body of a v2 begin-maintenance request
+type MaintenanceRequest struct {
+	Owner  string
+	Reason string
+}
+
+// OperationRequest is the body of a v2 topology operation request
+type OperationRequest struct {
+	Target *inst.InstanceKey // The sibling/below instance, for operations which relocate an instance relative to another
+	DryRun bool              // Only plan the operation, without changing replication state. Supported by pseudo-GTID operations.
+	Async  bool              // Submit the operation as a background job, and return right away
+	Strict bool              // Strict mode: more checks, slower. Applies to get-candidate-slave.
+}
+
+// LastPseudoGTIDEntry is the response to a last-pseudo-gtid request: the latest pseudo GTID entry in an instance's
+// relay logs, and its coordinates
+type LastPseudoGTIDEntry struct {
+	Coordinates inst.BinlogCoordinates
+	Text        string
+}
+
+// OperationSubmission is the response to an asynchronuous v2 operation request
+type OperationSubmission struct {
+	OperationId int64
+	Description string
+}
+
+// Location is the URL via which the submitted operation is polled
+func (this *OperationSubmission) Location() string {
+	return fmt.Sprintf("/api/v2/operations/%d", this.OperationId)
+}
+
+// KillQueryRequest is the body of a v2 kill-query request
+type KillQueryRequest struct {
+	ProcessId int64
+}
+
+// ClusterAliasRequest is the body of a v2 set-cluster-alias request
+type ClusterAliasRequest struct {
+	Alias string
+}
+
+// ClusterDomainRequest is the body of a v2 set-cluster-domain request
+type ClusterDomainRequest struct {
+	DomainName string
+}
+
+// ClusterOwnerTeamRequest is the body of a v2 set-cluster-owner-team request
+type ClusterOwnerTeamRequest struct {
+	OwnerTeam string
+}
+
+// LogicalVolumeRequest is the body of v2 agent logical volume requests
+type LogicalVolumeRequest struct {
+	LV string
+}
+
+// AccessGrantRequest is the body of a v2 grant-access request
+type AccessGrantRequest struct {
+	Role inst.Role
+}
+
+// SeedRequest is the body of a v2 seed request
+type SeedRequest struct {
+	TargetHost string
+	SourceHost string
+}
+
+// apiV2HandlerFunc serves a v2 API request, returning the HTTP status and the body to render as JSON (nil for none)
+type apiV2HandlerFunc func(params martini.Params, req *http.Request, user auth.User) (int, interface{})
+
+// apiV2QueryParam is an optional query parameter of a v2 route; Type is its OpenAPI type
+type apiV2QueryParam struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+var (
+	patternQueryParam  = apiV2QueryParam{Name: "pattern", Type: "string", Description: "Regular expression"}
+	sinceQueryParam    = apiV2QueryParam{Name: "since", Type: "string", Description: "Seconds or duration (e.g. 90m); default 1h"}
+	pageQueryParam     = apiV2QueryParam{Name: "page", Type: "integer"}
+	maxLagQueryParam   = apiV2QueryParam{Name: "max-lag", Type: "integer", Description: "Seconds"}
+	readOnlyQueryParam = apiV2QueryParam{Name: "read-only", Type: "boolean"}
+	clusterQueryParam  = apiV2QueryParam{Name: "cluster", Type: "string", Description: "Cluster name or alias"}
+	strictQueryParam   = apiV2QueryParam{Name: "strict", Type: "boolean", Description: "Strict mode: more checks, slower"}
+)
+
+// apiV2Route describes a single v2 API endpoint. The route table both registers the endpoints and
+// generates their OpenAPI spec.
+type apiV2Route struct {
+	Method      string
+	Path        string
+	Summary     string
+	Role        inst.Role         // Role required, on the cluster of the :host/:port instance or of :clusterName, otherwise on all clusters
+	Query       []apiV2QueryParam // Supported query parameters
+	Request     interface{}       // A value of the request body type, or nil when the endpoint takes no body
+	Response    interface{}       // A value of the response body type, or nil when the response has no body
+	Status      int               // Status on success
+	handlerFunc apiV2HandlerFunc
+}
+
+// apiV2Operation is a topology operation exposed via the v2 API
+type apiV2Operation struct {
+	Name        string
+	Summary     string
+	NeedsTarget bool
+	DryRunnable bool
+	run         func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error)
+}
+
+func apiV2ErrorResponse(status int, err error) (int, interface{}) {
+	return status, &APIV2Error{Status: status, Message: err.Error()}
+}
+
+// readAPIV2Body decodes the JSON request body onto given value. An empty body is accepted.
+func readAPIV2Body(req *http.Request, value interface{}) error {
+	if req.Body == nil {
+		return nil
+	}
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil && err != io.EOF {
+		return fmt.Errorf("Invalid request body: %+v", err)
+	}
+	return nil
+}
+
+// apiV2Operations lists the topology operations exposed as POST /api/v2/instances/:host/:port/<operation>
+var apiV2Operations = []apiV2Operation{
+	{Name: "move-up", Summary: "Move an instance up the topology, making it a sibling of its master", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.MoveUp(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Instance moved up", Details: instance}, err
+	}},
+	{Name: "move-below", Summary: "Move an instance below its sibling (Target)", NeedsTarget: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.MoveBelow(ctx, instanceKey, request.Target)
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v moved below %+v", *instanceKey, *request.Target), Details: instance}, err
+	}},
+	{Name: "make-co-master", Summary: "Make an instance co-master with its master", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.MakeCoMaster(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Instance made co-master", Details: instance}, err
+	}},
+	{Name: "reset-slave", Summary: "Reset a slave, breaking replication", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.ResetSlaveOperation(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Slave reset", Details: instance}, err
+	}},
+	{Name: "detach-slave", Summary: "Detach a slave from replication, in a reversible manner", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.DetachSlaveOperation(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Slave detached", Details: instance}, err
+	}},
+	{Name: "reattach-slave", Summary: "Reattach a detached slave", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.ReattachSlaveOperation(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Slave reattached", Details: instance}, err
+	}},
+	{Name: "enslave-siblings-simple", Summary: "Move all siblings of an instance below it", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, count, err := inst.EnslaveSiblingsSimple(ctx, instanceKey)
+		return &inst.OperationResult{Message: fmt.Sprintf("Enslaved %d siblings of %+v", count, *instanceKey), Details: instance}, err
+	}},
+	{Name: "match-below", Summary: "Match an instance below another (Target) via Pseudo-GTID", NeedsTarget: true, DryRunnable: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, matchedCoordinates, err := inst.MatchBelow(ctx, instanceKey, request.Target, true, true)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v matched below %+v at %+v", *instanceKey, *request.Target, *matchedCoordinates), Details: instance}, nil
+	}},
+	{Name: "multi-match-slaves", Summary: "Match all slaves of an instance below another (Target) via Pseudo-GTID", NeedsTarget: true, DryRunnable: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		slaves, newMaster, err := inst.MultiMatchSlaves(ctx, instanceKey, request.Target)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Matched up %d slaves of %+v below %+v", len(slaves), *instanceKey, newMaster.Key), Details: inst.NewMatchSlavesResult(newMaster, slaves)}, nil
+	}},
+	{Name: "match-up-slaves", Summary: "Match all slaves of an instance up the topology, via Pseudo-GTID", DryRunnable: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		slaves, newMaster, err := inst.MatchUpSlaves(ctx, instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Matched up %d slaves of %+v below %+v", len(slaves), *instanceKey, newMaster.Key), Details: inst.NewMatchSlavesResult(newMaster, slaves)}, nil
+	}},
+	{Name: "regroup-slaves", Summary: "Pick a slave of an instance and make it enslave its siblings", DryRunnable: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		lostSlaves, equalSlaves, aheadSlaves, promotedSlave, err := inst.RegroupSlaves(ctx, instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("promoted slave: %s, lost: %d, trivial: %d, pseudo-gtid: %d",
+			promotedSlave.Key.DisplayString(), len(lostSlaves), len(equalSlaves), len(aheadSlaves)), Details: inst.NewRegroupSlavesResult(promotedSlave, lostSlaves, equalSlaves, aheadSlaves)}, nil
+	}},
+	{Name: "rematch", Summary: "Reconnect a slave onto its master, via Pseudo-GTID", DryRunnable: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, _, err := inst.RematchSlave(ctx, instanceKey, true, true)
+		return &inst.OperationResult{Message: "Slave rematched", Details: instance}, err
+	}},
+	{Name: "get-candidate-slave", Summary: "Pick the most up-to-date slave of an instance, and match its siblings below it", DryRunnable: true, run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, _, _, _, err := inst.GetCandidateSlave(ctx, instanceKey, request.Strict, true)
+		if err != nil {
+			return nil, err
+		}
+		return &inst.OperationResult{Message: fmt.Sprintf("Candidate slave: %+v", instance.Key), Details: instance}, nil
+	}},
+	{Name: "make-master", Summary: "Make an instance the master of its siblings", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.MakeMaster(ctx, instanceKey)
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v now made master", *instanceKey), Details: instance}, err
+	}},
+	{Name: "make-local-master", Summary: "Make an instance take over its master, replicating from its grandparent", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.MakeLocalMaster(ctx, instanceKey)
+		return &inst.OperationResult{Message: fmt.Sprintf("Instance %+v now made local master", *instanceKey), Details: instance}, err
+	}},
+	{Name: "start-slave", Summary: "Start replication", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.StartSlave(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Slave started", Details: instance}, err
+	}},
+	{Name: "stop-slave", Summary: "Stop replication", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.StopSlave(ctx, instanceKey)
+		return &inst.OperationResult{Message: "Slave stopped", Details: instance}, err
+	}},
+	{Name: "stop-slave-nice", Summary: "Stop replication once the SQL thread has caught up with the IO thread", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.StopSlaveNicely(ctx, instanceKey, 0)
+		return &inst.OperationResult{Message: "Slave stopped nicely", Details: instance}, err
+	}},
+	{Name: "set-read-only", Summary: "Set an instance read-only", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.SetReadOnly(ctx, instanceKey, true)
+		return &inst.OperationResult{Message: "Server set as read-only", Details: instance}, err
+	}},
+	{Name: "set-writeable", Summary: "Set an instance writeable", run: func(ctx context.Context, instanceKey *inst.InstanceKey, request *OperationRequest) (*inst.OperationResult, error) {
+		instance, err := inst.SetReadOnly(ctx, instanceKey, false)
+		return &inst.OperationResult{Message: "Server set as writeable", Details: instance}, err
+	}},
+}
+
+// apiV2InstanceKey reads the instance key off the :host/:port path parameters
+func (this *HttpAPI) apiV2InstanceKey(params martini.Params) (*inst.InstanceKey, error) {
+	instanceKey, err := this.getInstanceKey(params["host"], params["port"])
+	if err != nil {
+		return nil, err
+	}
+	return &instanceKey, nil
+}
+
+// apiV2OperationHandler returns the handler of given topology operation
+func (this *HttpAPI) apiV2OperationHandler(operation apiV2Operation) apiV2HandlerFunc {
+	return func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+		instanceKey, err := this.apiV2InstanceKey(params)
+		if err != nil {
+			return apiV2ErrorResponse(http.StatusBadRequest, err)
+		}
+		operationRequest := OperationRequest{}
+		if err := readAPIV2Body(req, &operationRequest); err != nil {
+			return apiV2ErrorResponse(http.StatusBadRequest, err)
+		}
+		if operation.NeedsTarget && operationRequest.Target == nil {
+			return apiV2ErrorResponse(http.StatusBadRequest, fmt.Errorf("%s requires a Target instance", operation.Name))
+		}
+		if operationRequest.DryRun && !operation.DryRunnable {
+			return apiV2ErrorResponse(http.StatusBadRequest, fmt.Errorf("dry-run is not supported for %s", operation.Name))
+		}
+		if operationRequest.Target != nil && !this.isAuthorizedForInstance(req, user, inst.OperatorRole, operationRequest.Target) {
+			return apiV2ErrorResponse(http.StatusForbidden, fmt.Errorf("Unauthorized on %+v", *operationRequest.Target))
+		}
+		for _, key := range []*inst.InstanceKey{instanceKey, operationRequest.Target} {
+			if key == nil {
+				continue
+			}
+			if _, found, err := inst.ReadInstance(key); err != nil {
+				return apiV2ErrorResponse(http.StatusInternalServerError, err)
+			} else if !found {
+				return apiV2ErrorResponse(http.StatusNotFound, fmt.Errorf("Instance not found: %+v", *key))
+			}
+		}
+
+		description := fmt.Sprintf("%s %+v", operation.Name, *instanceKey)
+		if operationRequest.Target != nil {
+			description = fmt.Sprintf("%s below %+v", description, *operationRequest.Target)
+		}
+		operationFunc := func(ctx context.Context) (*inst.OperationResult, error) {
+			return operation.run(ctx, instanceKey, &operationRequest)
+		}
+		if operationRequest.DryRun {
+			description = fmt.Sprintf("%s (dry-run)", description)
+			operationFunc = func(ctx context.Context) (*inst.OperationResult, error) {
+				ctx, plan := inst.NewDryRunContext(ctx)
+				result, err := operation.run(ctx, instanceKey, &operationRequest)
+				if err != nil {
+					return nil, err
+				}
+				return &inst.OperationResult{Message: fmt.Sprintf("Dry run: %s", result.Message), Details: plan}, nil
+			}
+		}
+
+		owner := this.getUserId(req, user)
+		if operationRequest.Async {
+			submitted := inst.SubmitOperation(req.Context(), description, owner, operationFunc)
+			return http.StatusAccepted, &OperationSubmission{OperationId: submitted.Id, Description: description}
+		}
+		result, err := inst.RunOperation(req.Context(), description, owner, operationFunc)
+		if err != nil {
+			return apiV2ErrorResponse(apiV2OperationErrorStatus(err), err)
+		}
+		return http.StatusOK, result
+	}
+}
+
+// apiV2OperationErrorStatus maps the error of a failed operation onto a response status: 409 when an involved
+// instance is already under maintenance, 422 when the topology does not allow the operation, 500 otherwise
+func apiV2OperationErrorStatus(err error) int {
+	switch err.(type) {
+	case *inst.TopologyConflictError:
+		return http.StatusConflict
+	case *inst.TopologyPreconditionError:
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// apiV2Routes returns the v2 API route table
+func (this *HttpAPI) apiV2Routes() []apiV2Route {
+	routes := []apiV2Route{
+		{Method: "GET", Path: "/api/v2/instances", Summary: "Find instances whose hostname matches a regular expression", Query: []apiV2QueryParam{patternQueryParam}, Response: []inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				pattern := req.URL.Query().Get("pattern")
+				if _, err := regexp.Compile(pattern); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				instances, err := inst.FindInstances(pattern)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, instances
+			}},
+		{Method: "GET", Path: "/api/v2/instances/:host/:port", Summary: "Get an instance", Response: inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				instance, found, err := inst.ReadInstance(instanceKey)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				if !found {
+					return apiV2ErrorResponse(http.StatusNotFound, fmt.Errorf("Instance not found: %+v", *instanceKey))
+				}
+				return http.StatusOK, instance
+			}},
+		{Method: "DELETE", Path: "/api/v2/instances/:host/:port", Summary: "Forget an instance", Role: inst.OperatorRole, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.ForgetInstance(req.Context(), instanceKey); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "POST", Path: "/api/v2/instances/:host/:port/discover", Summary: "Submit an instance for asynchronuous discovery", Role: inst.OperatorRole, Status: http.StatusAccepted,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				go orchestrator.StartDiscovery(*instanceKey)
+				return http.StatusAccepted, nil
+			}},
+		{Method: "POST", Path: "/api/v2/instances/:host/:port/refresh", Summary: "Synchronuously re-read an instance", Role: inst.OperatorRole, Response: inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				instance, err := inst.RefreshTopologyInstance(req.Context(), instanceKey)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, instance
+			}},
+		{Method: "GET", Path: "/api/v2/instances/:host/:port/last-pseudo-gtid", Summary: "Find the latest pseudo GTID entry in an instance's relay logs", Query: []apiV2QueryParam{strictQueryParam}, Response: LastPseudoGTIDEntry{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				strict := false
+				if value := req.URL.Query().Get("strict"); value != "" {
+					if strict, err = strconv.ParseBool(value); err != nil {
+						return apiV2ErrorResponse(http.StatusBadRequest, err)
+					}
+				}
+				instance, err := inst.ReadTopologyInstance(req.Context(), instanceKey)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				if instance == nil {
+					return apiV2ErrorResponse(http.StatusNotFound, fmt.Errorf("Instance not found: %+v", *instanceKey))
+				}
+				coordinates, text, err := inst.FindLastPseudoGTIDEntry(req.Context(), instance, instance.RelaylogCoordinates, strict)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, &LastPseudoGTIDEntry{Coordinates: *coordinates, Text: text}
+			}},
+		{Method: "GET", Path: "/api/v2/instances/:host/:port/lag-history", Summary: "Get replication lag history of an instance", Query: []apiV2QueryParam{sinceQueryParam}, Response: []inst.LagHistorySample{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				sinceSeconds, err := this.getSinceSeconds(req)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				samples, err := inst.ReadInstanceLagHistory(instanceKey, sinceSeconds)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, samples
+			}},
+		{Method: "POST", Path: "/api/v2/instances/:host/:port/maintenance", Summary: "Begin maintenance on an instance", Role: inst.OperatorRole, Request: MaintenanceRequest{}, Response: int64(0), Status: http.StatusCreated,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				maintenanceRequest := MaintenanceRequest{}
+				if err := readAPIV2Body(req, &maintenanceRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if maintenanceRequest.Owner == "" {
+					maintenanceRequest.Owner = this.getUserId(req, user)
+				}
+				if maintenanceRequest.Owner == "" || maintenanceRequest.Reason == "" {
+					return apiV2ErrorResponse(http.StatusBadRequest, fmt.Errorf("Owner and Reason are required"))
+				}
+				maintenanceKey, err := inst.BeginMaintenance(req.Context(), instanceKey, maintenanceRequest.Owner, maintenanceRequest.Reason)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusConflict, err)
+				}
+				return http.StatusCreated, maintenanceKey
+			}},
+		{Method: "DELETE", Path: "/api/v2/instances/:host/:port/maintenance", Summary: "End maintenance on an instance", Role: inst.OperatorRole, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.EndMaintenanceByInstanceKey(req.Context(), instanceKey); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "POST", Path: "/api/v2/instances/:host/:port/kill-query", Summary: "Kill a query running on an instance", Role: inst.OperatorRole, Request: KillQueryRequest{}, Response: inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instanceKey, err := this.apiV2InstanceKey(params)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				killQueryRequest := KillQueryRequest{}
+				if err := readAPIV2Body(req, &killQueryRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				result, err := inst.RunOperation(req.Context(), fmt.Sprintf("kill-query %+v %d", *instanceKey, killQueryRequest.ProcessId), this.getUserId(req, user), func(ctx context.Context) (*inst.OperationResult, error) {
+					instance, err := inst.KillQuery(ctx, instanceKey, killQueryRequest.ProcessId)
+					return &inst.OperationResult{Message: "Query killed", Details: instance}, err
+				})
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, result.Details
+			}},
+		{Method: "GET", Path: "/api/v2/maintenance", Summary: "List active maintenance", Response: []inst.Maintenance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				maintenance, err := inst.ReadActiveMaintenance()
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, maintenance
+			}},
+		{Method: "DELETE", Path: "/api/v2/maintenance/:maintenanceKey", Summary: "End maintenance by key", Role: inst.OperatorRole, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				maintenanceKey, err := strconv.ParseInt(params["maintenanceKey"], 10, 0)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.EndMaintenance(req.Context(), maintenanceKey); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "GET", Path: "/api/v2/operations", Summary: "List operations running on this node", Response: []inst.Operation{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				return http.StatusOK, inst.ReadActiveOperations()
+			}},
+		{Method: "GET", Path: "/api/v2/operations/recent", Summary: "List latest operations, paged", Query: []apiV2QueryParam{pageQueryParam}, Response: []inst.OperationStatus{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				page, err := strconv.Atoi(req.URL.Query().Get("page"))
+				if err != nil || page < 0 {
+					page = 0
+				}
+				operations, err := inst.ReadRecentOperations(page)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, operations
+			}},
+		{Method: "GET", Path: "/api/v2/operations/:id", Summary: "Get state, progress and outcome of an operation", Response: inst.OperationStatus{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				operationId, err := strconv.ParseInt(params["id"], 10, 0)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				operationStatus, err := inst.ReadOperationStatus(operationId)
+				if _, notFound := err.(*inst.OperationNotFoundError); notFound {
+					return apiV2ErrorResponse(http.StatusNotFound, err)
+				}
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, operationStatus
+			}},
+		{Method: "DELETE", Path: "/api/v2/operations/:id", Summary: "Cancel an operation running on this node", Role: inst.OperatorRole, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				operationId, err := strconv.ParseInt(params["id"], 10, 0)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.CancelOperation(req.Context(), operationId); err != nil {
+					return apiV2ErrorResponse(http.StatusNotFound, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "GET", Path: "/api/v2/clusters", Summary: "List known clusters", Response: []inst.ClusterInfo{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clustersInfo, err := inst.ReadClustersInfo()
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, clustersInfo
+			}},
+		{Method: "GET", Path: "/api/v2/clusters/:clusterName", Summary: "Get a cluster", Response: inst.ClusterInfo{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clusterInfo, err := inst.ReadClusterInfo(params["clusterName"])
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusNotFound, err)
+				}
+				return http.StatusOK, clusterInfo
+			}},
+		{Method: "GET", Path: "/api/v2/clusters/:clusterName/instances", Summary: "List instances of a cluster", Response: []inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				instances, err := inst.ReadClusterInstances(params["clusterName"])
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, instances
+			}},
+		{Method: "GET", Path: "/api/v2/clusters/:clusterName/master", Summary: "Get the writeable master of a cluster, given by name or alias", Response: inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clusterName, err := inst.ReadClusterNameByAlias(params["clusterName"])
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusNotFound, err)
+				}
+				master, err := inst.ReadClusterMaster(clusterName)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusNotFound, err)
+				}
+				return http.StatusOK, master
+			}},
+		{Method: "GET", Path: "/api/v2/clusters/:clusterName/slaves", Summary: "List slaves of a cluster, given by name or alias, filtered by max lag seconds and read_only", Query: []apiV2QueryParam{maxLagQueryParam, readOnlyQueryParam}, Response: []inst.Instance{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				maxLagSeconds, readOnly, err := this.getClusterSlavesFilter(req)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				clusterName, err := inst.ReadClusterNameByAlias(params["clusterName"])
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusNotFound, err)
+				}
+				slaves, err := inst.ReadClusterSlaves(clusterName, maxLagSeconds, readOnly)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, slaves
+			}},
+		{Method: "GET", Path: "/api/v2/clusters/:clusterName/lag-history", Summary: "Get replication lag history of a cluster's instances", Query: []apiV2QueryParam{sinceQueryParam}, Response: []inst.LagHistorySample{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				sinceSeconds, err := this.getSinceSeconds(req)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				samples, err := inst.ReadClusterLagHistory(params["clusterName"], sinceSeconds)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, samples
+			}},
+		{Method: "PUT", Path: "/api/v2/clusters/:clusterName/alias", Summary: "Set the alias of a cluster", Role: inst.AdminRole, Request: ClusterAliasRequest{}, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clusterAliasRequest := ClusterAliasRequest{}
+				if err := readAPIV2Body(req, &clusterAliasRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.SetClusterAlias(params["clusterName"], clusterAliasRequest.Alias); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "PUT", Path: "/api/v2/clusters/:clusterName/domain", Summary: "Set the writer domain name (DNS name or VIP) of a cluster", Role: inst.AdminRole, Request: ClusterDomainRequest{}, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clusterDomainRequest := ClusterDomainRequest{}
+				if err := readAPIV2Body(req, &clusterDomainRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.WriteClusterDomainName(params["clusterName"], clusterDomainRequest.DomainName); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "PUT", Path: "/api/v2/clusters/:clusterName/owner-team", Summary: "Set the team owning a cluster", Role: inst.AdminRole, Request: ClusterOwnerTeamRequest{}, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clusterOwnerTeamRequest := ClusterOwnerTeamRequest{}
+				if err := readAPIV2Body(req, &clusterOwnerTeamRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.WriteClusterOwnerTeam(params["clusterName"], clusterOwnerTeamRequest.OwnerTeam); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "GET", Path: "/api/v2/pseudo-gtid-injections", Summary: "List the state of pseudo GTID injection per cluster", Response: []inst.PseudoGTIDInjection{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				injections, err := inst.ReadPseudoGTIDInjections()
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, injections
+			}},
+		{Method: "POST", Path: "/api/v2/kv-stores/masters", Summary: "Publish the masters of all clusters, or of a cluster given by name or alias, to key-value stores", Role: inst.OperatorRole, Query: []apiV2QueryParam{clusterQueryParam}, Response: []kv.KVPair{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				clusterName := ""
+				if clusterHint := req.URL.Query().Get("cluster"); clusterHint != "" {
+					var err error
+					if clusterName, err = inst.ReadClusterNameByAlias(clusterHint); err != nil {
+						return apiV2ErrorResponse(http.StatusNotFound, err)
+					}
+				}
+				kvPairs, err := inst.SubmitMastersToKVStores(clusterName)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, kvPairs
+			}},
+		{Method: "GET", Path: "/api/v2/audit", Summary: "List audit entries, paged", Query: []apiV2QueryParam{pageQueryParam}, Response: []inst.Audit{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				page, err := strconv.Atoi(req.URL.Query().Get("page"))
+				if err != nil || page < 0 {
+					page = 0
+				}
+				audits, err := inst.ReadRecentAudit(page)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, audits
+			}},
+		{Method: "GET", Path: "/api/v2/whoami", Summary: "Get the effective roles of the authenticated user", Response: inst.Permissions{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				return http.StatusOK, this.getPermissions(req, user)
+			}},
+		{Method: "GET", Path: "/api/v2/access-grants", Summary: "List access grants stored in the backend", Role: inst.AdminRole, Response: []inst.AccessGrant{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				grants, err := inst.ReadAccessGrants()
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, grants
+			}},
+		{Method: "PUT", Path: "/api/v2/access-grants/:userName/:clusterAlias", Summary: "Grant a role to a user on a cluster alias (* for all clusters)", Role: inst.AdminRole, Request: AccessGrantRequest{}, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				accessGrantRequest := AccessGrantRequest{}
+				if err := readAPIV2Body(req, &accessGrantRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := inst.GrantAccess(req.Context(), params["userName"], params["clusterAlias"], accessGrantRequest.Role, this.getUserId(req, user)); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "DELETE", Path: "/api/v2/access-grants/:userName/:clusterAlias", Summary: "Revoke a user's grant on a cluster alias", Role: inst.AdminRole, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				if err := inst.RevokeAccess(req.Context(), params["userName"], params["clusterAlias"]); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+		{Method: "GET", Path: "/api/v2/agents", Summary: "List agents", Role: inst.OperatorRole, Response: []agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				agents, err := agent.ReadAgents()
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, agents
+			}},
+		{Method: "GET", Path: "/api/v2/agents/:host", Summary: "Get an agent", Role: inst.OperatorRole, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				hostAgent, err := agent.GetAgent(params["host"])
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, hostAgent
+			}},
+		{Method: "POST", Path: "/api/v2/agents/:host/unmount", Summary: "Unmount the agent's MySQL data volume", Role: inst.AdminRole, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: apiV2AgentCommand(agent.Unmount)},
+		{Method: "POST", Path: "/api/v2/agents/:host/mount", Summary: "Mount a logical volume on the agent", Role: inst.AdminRole, Request: LogicalVolumeRequest{}, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: apiV2AgentLogicalVolumeCommand(agent.MountLV)},
+		{Method: "POST", Path: "/api/v2/agents/:host/snapshot", Summary: "Create a snapshot on the agent", Role: inst.AdminRole, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: apiV2AgentCommand(agent.CreateSnapshot)},
+		{Method: "DELETE", Path: "/api/v2/agents/:host/lv", Summary: "Remove a logical volume on the agent", Role: inst.AdminRole, Request: LogicalVolumeRequest{}, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: apiV2AgentLogicalVolumeCommand(agent.RemoveLV)},
+		{Method: "POST", Path: "/api/v2/agents/:host/mysql-stop", Summary: "Stop MySQL on the agent's host", Role: inst.AdminRole, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: apiV2AgentCommand(agent.MySQLStop)},
+		{Method: "POST", Path: "/api/v2/agents/:host/mysql-start", Summary: "Start MySQL on the agent's host", Role: inst.AdminRole, Response: agent.Agent{}, Status: http.StatusOK,
+			handlerFunc: apiV2AgentCommand(agent.MySQLStart)},
+		{Method: "GET", Path: "/api/v2/seeds", Summary: "List recent seeds", Role: inst.OperatorRole, Response: []agent.SeedOperation{}, Status: http.StatusOK,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				seeds, err := agent.ReadRecentSeeds()
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusOK, seeds
+			}},
+		{Method: "POST", Path: "/api/v2/seeds", Summary: "Seed a target host from a source host", Role: inst.AdminRole, Request: SeedRequest{}, Response: int64(0), Status: http.StatusCreated,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				seedRequest := SeedRequest{}
+				if err := readAPIV2Body(req, &seedRequest); err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if seedRequest.TargetHost == "" || seedRequest.SourceHost == "" {
+					return apiV2ErrorResponse(http.StatusBadRequest, fmt.Errorf("TargetHost and SourceHost are required"))
+				}
+				seedId, err := agent.Seed(seedRequest.TargetHost, seedRequest.SourceHost)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusCreated, seedId
+			}},
+		{Method: "DELETE", Path: "/api/v2/seeds/:seedId", Summary: "Abort a seed", Role: inst.AdminRole, Status: http.StatusNoContent,
+			handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+				seedId, err := strconv.ParseInt(params["seedId"], 10, 0)
+				if err != nil {
+					return apiV2ErrorResponse(http.StatusBadRequest, err)
+				}
+				if err := agent.AbortSeed(seedId); err != nil {
+					return apiV2ErrorResponse(http.StatusInternalServerError, err)
+				}
+				return http.StatusNoContent, nil
+			}},
+	}
+	for _, operation := range apiV2Operations {
+		routes = append(routes, apiV2Route{
+			Method:      "POST",
+			Path:        fmt.Sprintf("/api/v2/instances/:host/:port/%s", operation.Name),
+			Summary:     operation.Summary,
+			Role:        inst.OperatorRole,
+			Request:     OperationRequest{},
+			Response:    inst.OperationResult{},
+			Status:      http.StatusOK,
+			handlerFunc: this.apiV2OperationHandler(operation),
+		})
+	}
+	routes = append(routes, apiV2Route{Method: "GET", Path: "/api/v2/openapi.json", Summary: "This OpenAPI spec", Status: http.StatusOK,
+		handlerFunc: func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+			return http.StatusOK, this.OpenAPISpec()
+		}})
+	return routes
+}
+
+func apiV2AgentCommand(command func(hostname string) (agent.Agent, error)) apiV2HandlerFunc {
+	return func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+		output, err := command(params["host"])
+		if err != nil {
+			return apiV2ErrorResponse(http.StatusInternalServerError, err)
+		}
+		return http.StatusOK, output
+	}
+}
+
+func apiV2AgentLogicalVolumeCommand(command func(hostname string, lv string) (agent.Agent, error)) apiV2HandlerFunc {
+	return func(params martini.Params, req *http.Request, user auth.User) (int, interface{}) {
+		logicalVolumeRequest := LogicalVolumeRequest{}
+		if err := readAPIV2Body(req, &logicalVolumeRequest); err != nil {
+			return apiV2ErrorResponse(http.StatusBadRequest, err)
+		}
+		output, err := command(params["host"], logicalVolumeRequest.LV)
+		if err != nil {
+			return apiV2ErrorResponse(http.StatusInternalServerError, err)
+		}
+		return http.StatusOK, output
+	}
+}
+
+// isAuthorizedForRoute checks whether authenticated user has the route's role on the instance, cluster,
+// maintenance or operation the request refers to
+func (this *HttpAPI) isAuthorizedForRoute(route apiV2Route, params martini.Params, req *http.Request, user auth.User) bool {
+	switch {
+	case params["host"] != "" && params["port"] != "":
+		instanceKey, err := this.apiV2InstanceKey(params)
+		if err != nil {
+			// Let the handler report the invalid key
+			return this.isAuthorizedForAction(req, user, route.Role)
+		}
+		if strings.HasSuffix(route.Path, "/maintenance") {
+			return this.isAuthorizedForMaintenance(req, user, instanceKey)
+		}
+		return this.isAuthorizedForInstance(req, user, route.Role, instanceKey)
+	case params["clusterName"] != "":
+		return this.isAuthorizedForCluster(req, user, route.Role, params["clusterName"])
+	case params["maintenanceKey"] != "":
+		maintenanceKey, _ := strconv.ParseInt(params["maintenanceKey"], 10, 0)
+		instanceKey, err := inst.ReadMaintenanceInstanceKey(maintenanceKey)
+		if err != nil {
+			return this.isAuthorizedForAction(req, user, route.Role)
+		}
+		return this.isAuthorizedForMaintenance(req, user, instanceKey)
+	case params["id"] != "" && route.Method == "DELETE":
+		operationId, _ := strconv.ParseInt(params["id"], 10, 0)
+		return this.isAuthorizedToCancelOperation(req, user, operationId)
+	}
+	return this.isAuthorizedForAction(req, user, route.Role)
+}
+
+// apiV2Handler wraps a v2 route's handler function as a martini handler: it checks authorization,
+// and renders the returned status and body
+func (this *HttpAPI) apiV2Handler(route apiV2Route) martini.Handler {
+	return func(params martini.Params, r render.Render, req *http.Request, user auth.User) {
+		if route.Role > inst.ViewerRole && !this.isAuthorizedForRoute(route, params, req, user) {
+			r.JSON(http.StatusForbidden, &APIV2Error{Status: http.StatusForbidden, Message: "Unauthorized"})
+			return
+		}
+		status, body := route.handlerFunc(params, req, user)
+		if submission, ok := body.(*OperationSubmission); ok {
+			r.Header().Set("Location", submission.Location())
+		}
+		if body == nil {
+			r.Status(status)
+			return
+		}
+		r.JSON(status, body)
+	}
+}
+
+// registerV2Requests registers the v2 API, off its route table
+func (this *HttpAPI) registerV2Requests(m *martini.ClassicMartini) {
+	for _, route := range this.apiV2Routes() {
+		handler := this.apiV2Handler(route)
+		switch route.Method {
+		case "GET":
+			m.Get(route.Path, handler)
+		case "POST":
+			m.Post(route.Path, handler)
+		case "PUT":
+			m.Put(route.Path, handler)
+		case "DELETE":
+			m.Delete(route.Path, handler)
+		}
+	}
+}
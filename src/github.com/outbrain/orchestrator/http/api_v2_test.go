@@ -0,0 +1,124 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/outbrain/orchestrator/inst"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type APIV2TestSuite struct{}
+
+var _ = Suite(&APIV2TestSuite{})
+
+func (s *APIV2TestSuite) TestRoutesAreUnique(c *C) {
+	seen := map[string]bool{}
+	for _, route := range API.apiV2Routes() {
+		routeKey := fmt.Sprintf("%s %s", route.Method, route.Path)
+		c.Assert(seen[routeKey], Equals, false, Commentf("duplicate route: %s", routeKey))
+		seen[routeKey] = true
+		c.Assert(route.Status, Not(Equals), 0, Commentf("no status: %s", routeKey))
+	}
+}
+
+func (s *APIV2TestSuite) TestOpenAPIPath(c *C) {
+	c.Assert(openAPIPath("/api/v2/instances/:host/:port/match-below"), Equals, "/api/v2/instances/{host}/{port}/match-below")
+	c.Assert(openAPIPath("/api/v2/clusters"), Equals, "/api/v2/clusters")
+}
+
+func (s *APIV2TestSuite) TestOpenAPISpec(c *C) {
+	spec := API.OpenAPISpec()
+	paths := spec["paths"].(map[string]interface{})
+
+	instancePath := paths["/api/v2/instances/{host}/{port}"].(map[string]interface{})
+	c.Assert(instancePath["get"], NotNil)
+	c.Assert(instancePath["delete"], NotNil)
+
+	matchBelow := paths["/api/v2/instances/{host}/{port}/match-below"].(map[string]interface{})["post"].(map[string]interface{})
+	c.Assert(matchBelow["requestBody"], NotNil)
+	responses := matchBelow["responses"].(map[string]interface{})
+	for _, status := range []string{"200", "202", "400", "403", "409", "422", "500"} {
+		c.Assert(responses[status], NotNil, Commentf("missing response %s", status))
+	}
+
+	queryTypes := func(path string) map[string]interface{} {
+		types := map[string]interface{}{}
+		for _, parameter := range paths[path].(map[string]interface{})["get"].(map[string]interface{})["parameters"].([]interface{}) {
+			parameter := parameter.(map[string]interface{})
+			if parameter["in"] == "query" {
+				types[parameter["name"].(string)] = parameter["schema"].(map[string]interface{})["type"]
+			}
+		}
+		return types
+	}
+	c.Assert(queryTypes("/api/v2/instances/{host}/{port}/lag-history"), DeepEquals, map[string]interface{}{"since": "string"})
+	c.Assert(queryTypes("/api/v2/audit"), DeepEquals, map[string]interface{}{"page": "integer"})
+	c.Assert(queryTypes("/api/v2/clusters/{clusterName}/slaves"), DeepEquals, map[string]interface{}{"max-lag": "integer", "read-only": "boolean"})
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(openAPISchemas)
+	c.Assert(schemas["Instance"], NotNil)
+	c.Assert(schemas["OperationRequest"], NotNil)
+	properties := schemas["OperationRequest"].(map[string]interface{})["properties"].(map[string]interface{})
+	c.Assert(properties["Target"], DeepEquals, map[string]interface{}{"$ref": "#/components/schemas/InstanceKey"})
+	c.Assert(properties["DryRun"], DeepEquals, map[string]interface{}{"type": "boolean"})
+
+	_, err := json.Marshal(spec)
+	c.Assert(err, IsNil)
+}
+
+func (s *APIV2TestSuite) TestAPIV2OperationErrorStatus(c *C) {
+	c.Assert(apiV2OperationErrorStatus(&inst.TopologyConflictError{Message: "Cannot begin maintenance"}), Equals, http.StatusConflict)
+	c.Assert(apiV2OperationErrorStatus(&inst.TopologyPreconditionError{Message: "instance is not a slave"}), Equals, http.StatusUnprocessableEntity)
+	c.Assert(apiV2OperationErrorStatus(errors.New("Error 2003: Can't connect")), Equals, http.StatusInternalServerError)
+}
+
+func (s *APIV2TestSuite) TestReadAPIV2Body(c *C) {
+	operationRequest := OperationRequest{}
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{"Target": {"Hostname": "db1", "Port": 3306}, "DryRun": true}`))
+	c.Assert(readAPIV2Body(req, &operationRequest), IsNil)
+	c.Assert(operationRequest.DryRun, Equals, true)
+	c.Assert(operationRequest.Target.Hostname, Equals, "db1")
+
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(``))
+	c.Assert(readAPIV2Body(req, &OperationRequest{}), IsNil)
+
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(`{"Targett": {}}`))
+	c.Assert(readAPIV2Body(req, &OperationRequest{}), NotNil)
+}
+
+func (s *APIV2TestSuite) TestGetBearerToken(c *C) {
+	req, _ := http.NewRequest("GET", "/api/clusters", nil)
+	_, isBearer := getBearerToken(req)
+	c.Assert(isBearer, Equals, false)
+
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	_, isBearer = getBearerToken(req)
+	c.Assert(isBearer, Equals, false)
+
+	req.Header.Set("Authorization", "bearer 0123abcd")
+	secret, isBearer := getBearerToken(req)
+	c.Assert(isBearer, Equals, true)
+	c.Assert(secret, Equals, "0123abcd")
+}
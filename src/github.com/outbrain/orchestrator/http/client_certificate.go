@@ -0,0 +1,52 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/auth"
+	"net/http"
+
+	"github.com/outbrain/orchestrator/config"
+)
+
+// getClientCertificateUser returns the user by which a client certificate was issued: the certificate's
+// common name, as mapped by SSLClientCNToUser
+func getClientCertificateUser(req *http.Request) (string, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	commonName := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if commonName == "" {
+		return "", false
+	}
+	if user, ok := config.Config().SSLClientCNToUser[commonName]; ok {
+		return user, true
+	}
+	return commonName, true
+}
+
+// AuthenticateClientCertificate is a martini handler which authenticates requests by their verified client
+// certificate (mutual TLS), mapping the certificate to the request's user
+func AuthenticateClientCertificate(c martini.Context, res http.ResponseWriter, req *http.Request) {
+	user, ok := getClientCertificateUser(req)
+	if !ok {
+		http.Error(res, "Not Authorized", http.StatusUnauthorized)
+		return
+	}
+	c.Map(auth.User(user))
+}
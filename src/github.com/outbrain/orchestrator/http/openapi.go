@@ -0,0 +1,219 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package http
+
+import (
+	"encoding"
+	"encoding/json"
+	"github.com/outbrain/orchestrator/inst"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generates the OpenAPI (3.0) spec of the v2 API off its route table, reflecting on the
+// request and response types.
+
+var pathParamRegexp = regexp.MustCompile(`:([a-zA-Z]+)`)
+
+// integerPathParams are path parameters which are documented as integers
+var integerPathParams = map[string]bool{"port": true, "id": true, "seedId": true, "maintenanceKey": true}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// openAPISchemas collects the named schemas referenced by the spec
+type openAPISchemas map[string]interface{}
+
+// schemaOf returns the schema of given type; named struct types are registered as components and referenced
+func (this openAPISchemas) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType, t.Kind() == reflect.Interface, t.Implements(jsonMarshalerType), reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]interface{}{}
+	case t.Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": this.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": this.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return this.structSchema(t)
+		}
+		name := t.Name()
+		if _, found := this[name]; !found {
+			// Register before descending, so that recursive types reference rather than recurse
+			this[name] = nil
+			this[name] = this.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema lists the JSON properties of a struct, following encoding/json's naming rules
+func (this openAPISchemas) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	this.addStructProperties(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (this openAPISchemas) addStructProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			}
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				this.addStructProperties(fieldType, properties)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		properties[name] = this.schemaOf(field.Type)
+	}
+}
+
+// openAPIPath converts a martini route path into an OpenAPI path template
+func openAPIPath(path string) string {
+	return pathParamRegexp.ReplaceAllString(path, "{$1}")
+}
+
+func (this openAPISchemas) operationOf(route apiV2Route) map[string]interface{} {
+	parameters := []interface{}{}
+	for _, match := range pathParamRegexp.FindAllStringSubmatch(route.Path, -1) {
+		paramType := "string"
+		if integerPathParams[match[1]] {
+			paramType = "integer"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": paramType},
+		})
+	}
+	for _, query := range route.Query {
+		parameter := map[string]interface{}{
+			"name": query.Name, "in": "query", "required": false, "schema": map[string]interface{}{"type": query.Type},
+		}
+		if query.Description != "" {
+			parameter["description"] = query.Description
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(APIV2Error{}))}},
+	}
+	success := map[string]interface{}{"description": http.StatusText(route.Status)}
+	if route.Response != nil {
+		success["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(route.Response))}}
+	}
+	responses := map[string]interface{}{
+		strconv.Itoa(route.Status): success,
+		"400":                      errorResponse,
+		"404":                      errorResponse,
+		"500":                      errorResponse,
+	}
+	if route.Role > inst.ViewerRole {
+		responses["403"] = errorResponse
+	}
+	if _, isOperation := route.Request.(OperationRequest); isOperation {
+		responses["409"] = errorResponse
+		responses["422"] = errorResponse
+		responses["202"] = map[string]interface{}{
+			"description": "Submitted as a background operation (Async)",
+			"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(OperationSubmission{}))}},
+		}
+	}
+
+	operation := map[string]interface{}{
+		"summary":    route.Summary,
+		"parameters": parameters,
+		"responses":  responses,
+	}
+	if route.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": false,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": this.schemaOf(reflect.TypeOf(route.Request))}},
+		}
+	}
+	return operation
+}
+
+// OpenAPISpec generates the OpenAPI spec of the v2 API
+func (this *HttpAPI) OpenAPISpec() map[string]interface{} {
+	schemas := openAPISchemas{}
+	paths := map[string]interface{}{}
+	for _, route := range this.apiV2Routes() {
+		path := openAPIPath(route.Path)
+		pathItem, found := paths[path].(map[string]interface{})
+		if !found {
+			pathItem = map[string]interface{}{}
+			paths[path] = pathItem
+		}
+		pathItem[strings.ToLower(route.Method)] = schemas.operationOf(route)
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "orchestrator",
+			"version": "2",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
@@ -45,7 +45,7 @@ func (this *HttpWeb) getInstanceKey(host string, port string) (inst.InstanceKey,
 
 func (this *HttpWeb) Clusters(params martini.Params, r render.Render) {
 	r.HTML(200, "templates/clusters", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "clusters",
 		"activePage":        "cluster",
 		"autoshow_problems": false,
@@ -54,13 +54,13 @@ func (this *HttpWeb) Clusters(params martini.Params, r render.Render) {
 
 func (this *HttpWeb) Cluster(params martini.Params, r render.Render) {
 	r.HTML(200, "templates/cluster", map[string]interface{}{
-		"agentsHttpActive":      config.Config.ServeAgentsHttp,
+		"agentsHttpActive":      config.Config().ServeAgentsHttp,
 		"title":                 "cluster",
 		"activePage":            "cluster",
 		"clusterName":           params["clusterName"],
 		"autoshow_problems":     true,
 		"contextMenuVisible":    true,
-		"pseudoGTIDModeEnabled": (config.Config.PseudoGTIDPattern != ""),
+		"pseudoGTIDModeEnabled": (config.Config().PseudoGTIDPattern != ""),
 	})
 }
 
@@ -70,7 +70,7 @@ func (this *HttpWeb) Search(params martini.Params, r render.Render, req *http.Re
 		searchString = req.URL.Query().Get("s")
 	}
 	r.HTML(200, "templates/search", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "search",
 		"activePage":        "search",
 		"searchString":      searchString,
@@ -81,7 +81,7 @@ func (this *HttpWeb) Search(params martini.Params, r render.Render, req *http.Re
 func (this *HttpWeb) Discover(params martini.Params, r render.Render) {
 
 	r.HTML(200, "templates/discover", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "discover",
 		"activePage":        "discover",
 		"autoshow_problems": false,
@@ -95,7 +95,7 @@ func (this *HttpWeb) LongQueries(params martini.Params, r render.Render, req *ht
 	}
 
 	r.HTML(200, "templates/long_queries", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "long queries",
 		"activePage":        "queries",
 		"autoshow_problems": false,
@@ -110,7 +110,7 @@ func (this *HttpWeb) Audit(params martini.Params, r render.Render) {
 	}
 
 	r.HTML(200, "templates/audit", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "audit",
 		"activePage":        "audit",
 		"autoshow_problems": false,
@@ -120,7 +120,7 @@ func (this *HttpWeb) Audit(params martini.Params, r render.Render) {
 
 func (this *HttpWeb) Agents(params martini.Params, r render.Render) {
 	r.HTML(200, "templates/agents", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "agents",
 		"activePage":        "agents",
 		"autoshow_problems": false,
@@ -129,7 +129,7 @@ func (this *HttpWeb) Agents(params martini.Params, r render.Render) {
 
 func (this *HttpWeb) Agent(params martini.Params, r render.Render) {
 	r.HTML(200, "templates/agent", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "agent",
 		"activePage":        "agents",
 		"autoshow_problems": false,
@@ -139,7 +139,7 @@ func (this *HttpWeb) Agent(params martini.Params, r render.Render) {
 
 func (this *HttpWeb) AgentSeedDetails(params martini.Params, r render.Render) {
 	r.HTML(200, "templates/agent_seed_details", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "agent seed details",
 		"activePage":        "agents",
 		"autoshow_problems": false,
@@ -149,7 +149,7 @@ func (this *HttpWeb) AgentSeedDetails(params martini.Params, r render.Render) {
 
 func (this *HttpWeb) Seeds(params martini.Params, r render.Render) {
 	r.HTML(200, "templates/seeds", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "seeds",
 		"activePage":        "agents",
 		"autoshow_problems": false,
@@ -159,7 +159,7 @@ func (this *HttpWeb) Seeds(params martini.Params, r render.Render) {
 func (this *HttpWeb) Home(params martini.Params, r render.Render) {
 
 	r.HTML(200, "templates/home", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "home",
 		"activePage":        "home",
 		"autoshow_problems": false,
@@ -169,7 +169,7 @@ func (this *HttpWeb) Home(params martini.Params, r render.Render) {
 func (this *HttpWeb) About(params martini.Params, r render.Render) {
 
 	r.HTML(200, "templates/about", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "about",
 		"activePage":        "home",
 		"autoshow_problems": false,
@@ -179,7 +179,7 @@ func (this *HttpWeb) About(params martini.Params, r render.Render) {
 func (this *HttpWeb) FAQ(params martini.Params, r render.Render) {
 
 	r.HTML(200, "templates/faq", map[string]interface{}{
-		"agentsHttpActive":  config.Config.ServeAgentsHttp,
+		"agentsHttpActive":  config.Config().ServeAgentsHttp,
 		"title":             "FAQ",
 		"activePage":        "home",
 		"autoshow_problems": false,
@@ -0,0 +1,237 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"context"
+	"fmt"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/pmylund/go-cache"
+	"strings"
+	"time"
+)
+
+// Role is a user's level of access to a cluster
+type Role int
+
+const (
+	NoRole Role = iota
+	ViewerRole
+	OperatorRole
+	AdminRole
+)
+
+// AllClusters is the cluster alias of a grant which applies to all clusters
+const AllClusters = "*"
+
+var roleNames = map[Role]string{
+	NoRole:       "",
+	ViewerRole:   "viewer",
+	OperatorRole: "operator",
+	AdminRole:    "admin",
+}
+
+func (this Role) String() string {
+	return roleNames[this]
+}
+
+func (this Role) MarshalText() ([]byte, error) {
+	return []byte(this.String()), nil
+}
+
+func (this *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*this = role
+	return nil
+}
+
+// ParseRole returns the role by given name
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if role != NoRole && roleName == strings.ToLower(strings.TrimSpace(name)) {
+			return role, nil
+		}
+	}
+	return NoRole, fmt.Errorf("Unknown role: %s. Expected one of viewer, operator, admin", name)
+}
+
+// AccessGrant is a role granted to a user on a cluster alias
+type AccessGrant struct {
+	UserName       string
+	ClusterAlias   string
+	Role           Role
+	GrantedBy      string
+	GrantTimestamp string
+}
+
+// Permissions are the effective roles of a user
+type Permissions struct {
+	UserName             string
+	AccessControlEnabled bool
+	Role                 Role            // Role on all clusters
+	ClusterRoles         map[string]Role // Additional roles per cluster alias
+	TokenName            string          // Name of the API token the user authenticated with, if any
+	Scopes               []string        // Scopes of the API token
+}
+
+// HasScope returns true unless authenticated with an API token lacking given scope
+func (this *Permissions) HasScope(scope string) bool {
+	if this.TokenName == "" {
+		return true
+	}
+	for _, tokenScope := range this.Scopes {
+		if tokenScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleOnCluster returns the effective role of the user on given cluster
+func (this *Permissions) RoleOnCluster(clusterName string) Role {
+	role := this.Role
+	if clusterName == "" {
+		return role
+	}
+	for _, clusterKey := range []string{clusterName, GetClusterAlias(clusterName)} {
+		if clusterRole, found := this.ClusterRoles[clusterKey]; found && clusterRole > role {
+			role = clusterRole
+		}
+	}
+	return role
+}
+
+// CapAt lowers all roles to at most given role. This applies e.g. on a read-only orchestrator.
+func (this *Permissions) CapAt(role Role) {
+	if this.Role > role {
+		this.Role = role
+	}
+	for clusterAlias, clusterRole := range this.ClusterRoles {
+		if clusterRole > role {
+			this.ClusterRoles[clusterAlias] = role
+		}
+	}
+}
+
+// GetClusterAlias returns the alias of given cluster, or empty string when it has none
+func GetClusterAlias(clusterName string) string {
+	clusterInfo := &ClusterInfo{ClusterName: clusterName}
+	ApplyClusterAlias(clusterInfo)
+	return clusterInfo.ClusterAlias
+}
+
+// IsAccessControlEnabled returns true when roles are configured. Otherwise the legacy
+// all-or-nothing authorization (PowerAuthUsers, "readonly" user) applies.
+func IsAccessControlEnabled() bool {
+	return len(config.Config().AccessControlRoles) > 0
+}
+
+var accessGrantsCache = cache.New(time.Minute, time.Minute)
+
+// readCachedAccessGrants returns the grants stored in the backend, reading them at most once a minute
+func readCachedAccessGrants() ([]AccessGrant, error) {
+	if grants, found := accessGrantsCache.Get("grants"); found {
+		return grants.([]AccessGrant), nil
+	}
+	grants, err := ReadAccessGrants()
+	if err != nil {
+		return grants, err
+	}
+	accessGrantsCache.Set("grants", grants, cache.DefaultExpiration)
+	return grants, nil
+}
+
+// ReadUserPermissions computes the effective roles of given user, from the configured roles and grants
+// as well as from grants stored in the backend.
+func ReadUserPermissions(userName string) (*Permissions, error) {
+	permissions := &Permissions{
+		UserName:             userName,
+		AccessControlEnabled: IsAccessControlEnabled(),
+		Role:                 NoRole,
+		ClusterRoles:         make(map[string]Role),
+	}
+	grant := func(clusterAlias string, grantUserName string, roleName string) error {
+		if grantUserName != userName && grantUserName != "*" {
+			return nil
+		}
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return err
+		}
+		if clusterAlias == AllClusters {
+			if role > permissions.Role {
+				permissions.Role = role
+			}
+		} else if role > permissions.ClusterRoles[clusterAlias] {
+			permissions.ClusterRoles[clusterAlias] = role
+		}
+		return nil
+	}
+
+	var err error
+	for grantUserName, roleName := range config.Config().AccessControlRoles {
+		if grantErr := grant(AllClusters, grantUserName, roleName); grantErr != nil {
+			err = grantErr
+		}
+	}
+	for clusterAlias, clusterGrants := range config.Config().ClusterAccessGrants {
+		for grantUserName, roleName := range clusterGrants {
+			if grantErr := grant(clusterAlias, grantUserName, roleName); grantErr != nil {
+				err = grantErr
+			}
+		}
+	}
+	grants, readErr := readCachedAccessGrants()
+	if readErr != nil {
+		err = readErr
+	}
+	for _, accessGrant := range grants {
+		grant(accessGrant.ClusterAlias, accessGrant.UserName, accessGrant.Role.String())
+	}
+	if permissions.Role < ViewerRole {
+		permissions.Role = ViewerRole
+	}
+	return permissions, err
+}
+
+// GrantAccess grants a role to a user on a cluster alias (or AllClusters), storing the grant in the backend
+func GrantAccess(ctx context.Context, userName string, clusterAlias string, role Role, grantedBy string) error {
+	if userName == "" || clusterAlias == "" || role == NoRole {
+		return fmt.Errorf("GrantAccess: user name, cluster alias and role are required")
+	}
+	err := WriteAccessGrant(&AccessGrant{UserName: userName, ClusterAlias: clusterAlias, Role: role, GrantedBy: grantedBy})
+	accessGrantsCache.Flush()
+	if err != nil {
+		return err
+	}
+	AuditOperation(ctx, "grant-access", nil, fmt.Sprintf("granted %s on %s to %s", role, clusterAlias, userName))
+	return nil
+}
+
+// RevokeAccess removes a user's grant on a cluster alias from the backend
+func RevokeAccess(ctx context.Context, userName string, clusterAlias string) error {
+	err := DeleteAccessGrant(userName, clusterAlias)
+	accessGrantsCache.Flush()
+	if err != nil {
+		return err
+	}
+	AuditOperation(ctx, "revoke-access", nil, fmt.Sprintf("revoked grant on %s from %s", clusterAlias, userName))
+	return nil
+}
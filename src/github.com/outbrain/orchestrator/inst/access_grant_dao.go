@@ -0,0 +1,120 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+)
+
+// ReadAccessGrants returns all grants stored in the backend
+func ReadAccessGrants() ([]AccessGrant, error) {
+	res := []AccessGrant{}
+	query := `
+		select
+			user_name,
+			cluster_alias,
+			role,
+			granted_by,
+			grant_timestamp
+		from
+			access_grant
+		order by
+			cluster_alias, user_name
+		`
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		goto Cleanup
+	}
+
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		role, err := ParseRole(m.GetString("role"))
+		if err != nil {
+			log.Errore(err)
+			return nil
+		}
+		grant := AccessGrant{
+			UserName:       m.GetString("user_name"),
+			ClusterAlias:   m.GetString("cluster_alias"),
+			Role:           role,
+			GrantedBy:      m.GetString("granted_by"),
+			GrantTimestamp: m.GetString("grant_timestamp"),
+		}
+		res = append(res, grant)
+		return nil
+	})
+Cleanup:
+
+	if err != nil {
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// WriteAccessGrant writes (and overrides) a user's grant on a cluster alias
+func WriteAccessGrant(grant *AccessGrant) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			replace into
+					access_grant (user_name, cluster_alias, role, granted_by, grant_timestamp)
+				values
+					(?, ?, ?, ?, NOW())
+			`,
+			grant.UserName,
+			grant.ClusterAlias,
+			grant.Role.String(),
+			grant.GrantedBy)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// DeleteAccessGrant removes a user's grant on a cluster alias
+func DeleteAccessGrant(userName string, clusterAlias string) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			delete from
+					access_grant
+				where
+					user_name = ?
+					and cluster_alias = ?
+			`,
+			userName,
+			clusterAlias)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
@@ -0,0 +1,199 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/pmylund/go-cache"
+	"strings"
+	"time"
+)
+
+// API token scopes
+const (
+	ReadOnlyScope        = "read-only"
+	MaintenanceScope     = "maintenance"
+	TopologyChangesScope = "topology-changes"
+)
+
+var knownScopes = []string{ReadOnlyScope, MaintenanceScope, TopologyChangesScope}
+
+// APIToken is an issued API token. Only the hash of the token secret is stored.
+type APIToken struct {
+	TokenId           int64
+	TokenName         string
+	Scopes            []string
+	CreatedBy         string
+	CreateTimestamp   string
+	ExpireTimestamp   string
+	LastUsedTimestamp string
+	Revoked           bool
+}
+
+// HasScope returns true when the token was issued with given scope
+func (this *APIToken) HasScope(scope string) bool {
+	for _, tokenScope := range this.Scopes {
+		if tokenScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Role returns the highest role the token's scopes allow
+func (this *APIToken) Role() Role {
+	if this.HasScope(MaintenanceScope) || this.HasScope(TopologyChangesScope) {
+		return OperatorRole
+	}
+	return ViewerRole
+}
+
+// ParseScopes parses a comma delimited list of scopes
+func ParseScopes(scopes string) ([]string, error) {
+	res := []string{}
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		known := false
+		for _, knownScope := range knownScopes {
+			known = known || scope == knownScope
+		}
+		if !known {
+			return res, fmt.Errorf("Unknown scope: %s. Expected any of %s", scope, strings.Join(knownScopes, ", "))
+		}
+		res = append(res, scope)
+	}
+	if len(res) == 0 {
+		return res, errors.New("At least one scope is required")
+	}
+	return res, nil
+}
+
+// hashAPITokenSecret returns the hex encoded SHA256 of a token secret. Secrets are random,
+// hence a fast, unsalted hash suffices.
+func hashAPITokenSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateAPIToken issues a new token with given scopes, expiring after given duration (0 for never).
+// It returns the token secret, which is not stored and cannot be recovered.
+func CreateAPIToken(tokenName string, scopes []string, expiry time.Duration, createdBy string) (string, error) {
+	if tokenName == "" {
+		return "", errors.New("Token name is required")
+	}
+	if tokens, err := ReadAPITokens(); err != nil {
+		return "", err
+	} else {
+		for _, token := range tokens {
+			if token.TokenName == tokenName && !token.Revoked {
+				return "", fmt.Errorf("An active token named %s already exists", tokenName)
+			}
+		}
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", log.Errore(err)
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	if err := writeAPIToken(tokenName, hashAPITokenSecret(secret), scopes, expiry, createdBy); err != nil {
+		return "", err
+	}
+	AuditOperation(context.Background(), "create-api-token", nil, fmt.Sprintf("token: %s, scopes: %s, expiry: %+v, created by: %s", tokenName, strings.Join(scopes, ","), expiry, createdBy))
+	return secret, nil
+}
+
+// RevokeAPIToken revokes all tokens by given name
+func RevokeAPIToken(tokenName string) error {
+	revoked, err := writeAPITokenRevoked(tokenName)
+	if err != nil {
+		return err
+	}
+	if revoked == 0 {
+		return fmt.Errorf("No active token named %s", tokenName)
+	}
+	apiTokensCache.Flush()
+	AuditOperation(context.Background(), "revoke-api-token", nil, fmt.Sprintf("token: %s", tokenName))
+	return nil
+}
+
+// apiTokensCache caches authenticated tokens by hash, such that the backend is not hit on each request.
+// A revoked token may thus be accepted by other orchestrator nodes for the duration of the cache.
+var apiTokensCache = cache.New(10*time.Second, time.Minute)
+
+// AuthenticateAPIToken returns the valid (unrevoked, unexpired) token by given secret
+func AuthenticateAPIToken(secret string) (*APIToken, error) {
+	tokenHash := hashAPITokenSecret(secret)
+	if token, found := apiTokensCache.Get(tokenHash); found {
+		return token.(*APIToken), nil
+	}
+	token, err := readValidAPIToken(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, errors.New("Invalid API token")
+	}
+	apiTokensCache.Set(tokenHash, token, cache.DefaultExpiration)
+	go writeAPITokenLastUsed(token.TokenId)
+	return token, nil
+}
+
+// ReadAPITokenPermissions computes the effective roles of a token: those allowed by its scopes, further limited by
+// the grants of the token's name when role based access control is enabled.
+func ReadAPITokenPermissions(token *APIToken) (*Permissions, error) {
+	permissions := &Permissions{Role: token.Role(), ClusterRoles: make(map[string]Role)}
+	var err error
+	if IsAccessControlEnabled() {
+		permissions, err = ReadUserPermissions(token.TokenName)
+		permissions.CapAt(token.Role())
+	}
+	permissions.UserName = token.TokenName
+	permissions.TokenName = token.TokenName
+	permissions.Scopes = token.Scopes
+	return permissions, err
+}
+
+type apiTokenContextKey struct{}
+
+// NewAPITokenContext returns a context carrying given authenticated token
+func NewAPITokenContext(parent context.Context, token *APIToken) context.Context {
+	return context.WithValue(parent, apiTokenContextKey{}, token)
+}
+
+// APITokenFromContext returns the authenticated token carried by given context, if any
+func APITokenFromContext(ctx context.Context) (*APIToken, bool) {
+	token, ok := ctx.Value(apiTokenContextKey{}).(*APIToken)
+	return token, ok
+}
+
+// APITokenNameFromContext returns the name of the authenticated token carried by given context, or empty string
+func APITokenNameFromContext(ctx context.Context) string {
+	if token, ok := APITokenFromContext(ctx); ok {
+		return token.TokenName
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"strings"
+	"time"
+)
+
+func readAPITokens(whereCondition string, args ...interface{}) ([]APIToken, error) {
+	res := []APIToken{}
+	query := fmt.Sprintf(`
+		select
+			token_id,
+			token_name,
+			scopes,
+			created_by,
+			create_timestamp,
+			ifnull(expire_timestamp, '') as expire_timestamp,
+			ifnull(last_used_timestamp, '') as last_used_timestamp,
+			revoked
+		from
+			api_token
+		%s
+		order by
+			token_id
+		`, whereCondition)
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		goto Cleanup
+	}
+
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		token := APIToken{
+			TokenId:           m.GetInt64("token_id"),
+			TokenName:         m.GetString("token_name"),
+			Scopes:            strings.Split(m.GetString("scopes"), ","),
+			CreatedBy:         m.GetString("created_by"),
+			CreateTimestamp:   m.GetString("create_timestamp"),
+			ExpireTimestamp:   m.GetString("expire_timestamp"),
+			LastUsedTimestamp: m.GetString("last_used_timestamp"),
+			Revoked:           m.GetBool("revoked"),
+		}
+		res = append(res, token)
+		return nil
+	}, args...)
+Cleanup:
+
+	if err != nil {
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadAPITokens returns all issued tokens, including revoked and expired ones
+func ReadAPITokens() ([]APIToken, error) {
+	return readAPITokens(``)
+}
+
+// readValidAPIToken returns the unrevoked, unexpired token by given hash, or nil when there is none
+func readValidAPIToken(tokenHash string) (*APIToken, error) {
+	tokens, err := readAPITokens(`
+		where
+			token_hash = ?
+			and revoked = 0
+			and (expire_timestamp is null or expire_timestamp > NOW())
+		`, tokenHash)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	return &tokens[0], nil
+}
+
+// writeAPIToken stores a new token by the hash of its secret
+func writeAPIToken(tokenName string, tokenHash string, scopes []string, expiry time.Duration, createdBy string) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			insert into
+					api_token (token_name, token_hash, scopes, created_by, create_timestamp, expire_timestamp)
+				values
+					(?, ?, ?, ?, NOW(), if(? > 0, NOW() + INTERVAL ? SECOND, NULL))
+			`,
+			tokenName,
+			tokenHash,
+			strings.Join(scopes, ","),
+			createdBy,
+			int64(expiry.Seconds()),
+			int64(expiry.Seconds()))
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// writeAPITokenRevoked revokes all active tokens by given name, returning the number of revoked tokens
+func writeAPITokenRevoked(tokenName string) (int64, error) {
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+
+	res, err := sqlutils.Exec(db, `
+			update
+				api_token
+			set
+				revoked = 1
+			where
+				token_name = ?
+				and revoked = 0
+			`,
+		tokenName)
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	return res.RowsAffected()
+}
+
+// writeAPITokenLastUsed notes the time a token was last used
+func writeAPITokenLastUsed(tokenId int64) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			update
+				api_token
+			set
+				last_used_timestamp = NOW()
+			where
+				token_id = ?
+			`,
+			tokenId)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
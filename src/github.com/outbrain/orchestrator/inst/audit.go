@@ -25,4 +25,5 @@ type Audit struct {
 	AuditType        string
 	AuditInstanceKey InstanceKey
 	Message          string
+	TokenName        string // Name of the API token the audited request authenticated with, if any
 }
@@ -17,6 +17,7 @@
 package inst
 
 import (
+	"context"
 	"fmt"
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/golib/sqlutils"
@@ -26,21 +27,23 @@ import (
 	"time"
 )
 
-// AuditOperation creates and writes a new audit entry by given params
-func AuditOperation(auditType string, instanceKey *InstanceKey, message string) error {
+// AuditOperation creates and writes a new audit entry by given params. The name of the API token
+// the request was authenticated with, if any, is read from given context.
+func AuditOperation(ctx context.Context, auditType string, instanceKey *InstanceKey, message string) error {
 
 	if instanceKey == nil {
 		instanceKey = &InstanceKey{}
 	}
+	tokenName := APITokenNameFromContext(ctx)
 
-	if config.Config.AuditLogFile != "" {
-		f, err := os.OpenFile(config.Config.AuditLogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if config.Config().AuditLogFile != "" {
+		f, err := os.OpenFile(config.Config().AuditLogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
 		if err != nil {
 			return log.Errore(err)
 		}
 
 		defer f.Close()
-		text := fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t\n", time.Now().Format(log.TimeFormat), auditType, instanceKey.Hostname, instanceKey.Port, message)
+		text := fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t%s\t\n", time.Now().Format(log.TimeFormat), auditType, instanceKey.Hostname, instanceKey.Port, message, tokenName)
 		if _, err = f.WriteString(text); err != nil {
 			return log.Errore(err)
 		}
@@ -54,15 +57,16 @@ func AuditOperation(auditType string, instanceKey *InstanceKey, message string)
 	_, err = sqlutils.Exec(db, `
 			insert 
 				into audit (
-					audit_timestamp, audit_type, hostname, port, message
+					audit_timestamp, audit_type, hostname, port, message, token_name
 				) VALUES (
-					NOW(), ?, ?, ?, ?
+					NOW(), ?, ?, ?, ?, ?
 				)
 			`,
 		auditType,
 		instanceKey.Hostname,
 		instanceKey.Port,
 		message,
+		tokenName,
 	)
 	if err != nil {
 		return log.Errore(err)
@@ -81,14 +85,15 @@ func ReadRecentAudit(page int) ([]Audit, error) {
 			audit_type,
 			hostname,
 			port,
-			message
+			message,
+			token_name
 		from 
 			audit
 		order by
 			audit_timestamp desc
 		limit %d
 		offset %d
-		`, config.Config.AuditPageSize, page*config.Config.AuditPageSize)
+		`, config.Config().AuditPageSize, page*config.Config().AuditPageSize)
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		goto Cleanup
@@ -102,6 +107,7 @@ func ReadRecentAudit(page int) ([]Audit, error) {
 		audit.AuditInstanceKey.Hostname = m.GetString("hostname")
 		audit.AuditInstanceKey.Port = m.GetInt("port")
 		audit.Message = m.GetString("message")
+		audit.TokenName = m.GetString("token_name")
 
 		res = append(res, audit)
 		return err
@@ -20,5 +20,7 @@ package inst
 type ClusterInfo struct {
 	ClusterName    string
 	ClusterAlias   string // Human friendly alias
+	ClusterDomain  string // Writer DNS name or VIP, by which applications reach the master
+	OwnerTeam      string
 	CountInstances uint
 }
@@ -19,17 +19,21 @@ package inst
 import (
 	"github.com/outbrain/orchestrator/config"
 	"regexp"
+	"sync"
 )
 
 // clusterAlias maps a cluster name to an alias
 var clusterAliasMap map[string]string = make(map[string]string)
+var clusterAliasMapMutex = &sync.RWMutex{}
 
 func ApplyClusterAlias(clusterInfo *ClusterInfo) {
-	for pattern, _ := range config.Config.ClusterNameToAlias {
+	for pattern, _ := range config.Config().ClusterNameToAlias {
 		if matched, _ := regexp.MatchString(pattern, clusterInfo.ClusterName); matched {
-			clusterInfo.ClusterAlias = config.Config.ClusterNameToAlias[pattern]
+			clusterInfo.ClusterAlias = config.Config().ClusterNameToAlias[pattern]
 		}
 	}
+	clusterAliasMapMutex.RLock()
+	defer clusterAliasMapMutex.RUnlock()
 	if alias, ok := clusterAliasMap[clusterInfo.ClusterName]; ok {
 		clusterInfo.ClusterAlias = alias
 	}
@@ -42,6 +46,15 @@ func SetClusterAlias(clusterName string, alias string) error {
 	if err != nil {
 		return err
 	}
+	clusterAliasMapMutex.Lock()
+	defer clusterAliasMapMutex.Unlock()
 	clusterAliasMap[clusterName] = alias
 	return nil
 }
+
+// getClusterAliasOverride returns the alias explicitly set for given cluster, or empty string
+func getClusterAliasOverride(clusterName string) string {
+	clusterAliasMapMutex.RLock()
+	defer clusterAliasMapMutex.RUnlock()
+	return clusterAliasMap[clusterName]
+}
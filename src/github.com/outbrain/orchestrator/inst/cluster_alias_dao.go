@@ -31,12 +31,16 @@ func ReadClusterAliases() error {
 			alias
 		from 
 			cluster_alias
+		where
+			alias != ''
 		`)
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		goto Cleanup
 	}
 
+	clusterAliasMapMutex.Lock()
+	defer clusterAliasMapMutex.Unlock()
 	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
 		clusterAliasMap[m.GetString("cluster_name")] = m.GetString("alias")
 		return err
@@ -59,10 +63,12 @@ func WriteClusterAlias(clusterName string, alias string) error {
 		}
 
 		_, err = sqlutils.Exec(db, `
-			replace into  
+			insert into  
 					cluster_alias (cluster_name, alias)
 				values
 					(?, ?)
+				on duplicate key update
+					alias = values(alias)
 			`,
 			clusterName,
 			alias)
@@ -74,3 +80,30 @@ func WriteClusterAlias(clusterName string, alias string) error {
 	}
 	return ExecDBWriteFunc(writeFunc)
 }
+
+// WriteClusterOwnerTeam will write (and override) the team owning a cluster
+func WriteClusterOwnerTeam(clusterName string, ownerTeam string) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			insert into  
+					cluster_alias (cluster_name, alias, owner_team)
+				values
+					(?, '', ?)
+				on duplicate key update
+					owner_team = values(owner_team)
+			`,
+			clusterName,
+			ownerTeam)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
@@ -0,0 +1,42 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"sync"
+)
+
+// clusterDomainNameMap maps a cluster name to the domain name last written for it
+var clusterDomainNameMap map[string]string = make(map[string]string)
+var clusterDomainNameMapMutex = &sync.RWMutex{}
+
+// SetClusterDomainName writes the domain name of a single cluster, unless unchanged since last written
+func SetClusterDomainName(clusterName string, domainName string) error {
+	clusterDomainNameMapMutex.RLock()
+	writtenDomainName, written := clusterDomainNameMap[clusterName]
+	clusterDomainNameMapMutex.RUnlock()
+	if written && writtenDomainName == domainName {
+		return nil
+	}
+	if err := WriteClusterDomainName(clusterName, domainName); err != nil {
+		return err
+	}
+	clusterDomainNameMapMutex.Lock()
+	defer clusterDomainNameMapMutex.Unlock()
+	clusterDomainNameMap[clusterName] = domainName
+	return nil
+}
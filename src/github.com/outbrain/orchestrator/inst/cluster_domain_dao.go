@@ -0,0 +1,51 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+)
+
+// WriteClusterDomainName will write (and override) the writer domain name (DNS name or VIP) of a cluster
+func WriteClusterDomainName(clusterName string, domainName string) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			insert into  
+					cluster_domain_name (cluster_name, domain_name, last_registered)
+				values
+					(?, ?, NOW())
+				on duplicate key update
+					domain_name = values(domain_name),
+					last_registered = values(last_registered)
+			`,
+			clusterName,
+			domainName)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
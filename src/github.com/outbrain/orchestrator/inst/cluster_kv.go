@@ -0,0 +1,121 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"context"
+	"errors"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/kv"
+	"github.com/pmylund/go-cache"
+	"time"
+)
+
+// publishedClusterMasters remembers the master last published per cluster, such that discovery only
+// publishes masters which changed
+var publishedClusterMasters = cache.New(time.Hour, time.Minute)
+
+// newClusterMasterKVPair returns the key-value pair by which given master of given cluster is published:
+// <prefix>/<cluster alias> -> host:port. Clusters without an alias are published by name.
+func newClusterMasterKVPair(clusterName string, masterKey *InstanceKey) *kv.KVPair {
+	clusterAlias := GetClusterAlias(clusterName)
+	if clusterAlias == "" {
+		clusterAlias = clusterName
+	}
+	return &kv.KVPair{Key: kv.ClusterMasterKey(clusterAlias), Value: masterKey.DisplayString()}
+}
+
+// putClusterMasterKVPair writes given pair to the key-value stores, unless it is known to have been
+// published already and force is false
+func putClusterMasterKVPair(kvPair *kv.KVPair, force bool) error {
+	if published, found := publishedClusterMasters.Get(kvPair.Key); found && published.(string) == kvPair.Value && !force {
+		return nil
+	}
+	if err := kv.PutKVPair(kvPair); err != nil {
+		return err
+	}
+	publishedClusterMasters.Set(kvPair.Key, kvPair.Value, cache.DefaultExpiration)
+	log.Infof("Published cluster master to key-value stores: %s", kvPair.String())
+	return nil
+}
+
+// PublishClusterMaster publishes the writeable master of given cluster to the key-value stores, if changed
+// since last published. This is a no-op when no key-value stores are configured.
+func PublishClusterMaster(clusterName string) error {
+	if len(kv.GetKVStores()) == 0 {
+		return nil
+	}
+	master, err := ReadClusterMaster(clusterName)
+	if err != nil {
+		return err
+	}
+	return putClusterMasterKVPair(newClusterMasterKVPair(clusterName, &master.Key), false)
+}
+
+// PublishDiscoveredClusterMaster publishes the writeable master of given discovered instance's cluster, unless
+// the instance is already the published master. The cluster master is only read when the instance differs from
+// the published master, such that polling an unchanged master costs nothing.
+func PublishDiscoveredClusterMaster(instance *Instance) error {
+	if len(kv.GetKVStores()) == 0 {
+		return nil
+	}
+	kvPair := newClusterMasterKVPair(instance.ClusterName, &instance.Key)
+	if published, found := publishedClusterMasters.Get(kvPair.Key); found && published.(string) == kvPair.Value {
+		return nil
+	}
+	return PublishClusterMaster(instance.ClusterName)
+}
+
+// publishPromotedMaster publishes given instance as the master of its cluster, following a topology change
+// which promoted it
+func publishPromotedMaster(ctx context.Context, instance *Instance) error {
+	if IsDryRun(ctx) || len(kv.GetKVStores()) == 0 {
+		return nil
+	}
+	return putClusterMasterKVPair(newClusterMasterKVPair(instance.ClusterName, &instance.Key), false)
+}
+
+// SubmitMastersToKVStores publishes the writeable masters of given cluster, or of all clusters when
+// clusterName is empty, regardless of what was previously published. It returns the published pairs.
+func SubmitMastersToKVStores(clusterName string) ([]kv.KVPair, error) {
+	kvPairs := []kv.KVPair{}
+	if len(kv.GetKVStores()) == 0 {
+		return kvPairs, errors.New("No key-value stores configured (ConsulAddress, KVFile)")
+	}
+	clusterNames := []string{clusterName}
+	if clusterName == "" {
+		var err error
+		if clusterNames, err = ReadClusters(); err != nil {
+			return kvPairs, err
+		}
+	}
+	var lastErr error
+	for _, clusterName := range clusterNames {
+		master, err := ReadClusterMaster(clusterName)
+		if err != nil {
+			lastErr = log.Errore(err)
+			continue
+		}
+		kvPair := newClusterMasterKVPair(clusterName, &master.Key)
+		if err := putClusterMasterKVPair(kvPair, true); err != nil {
+			lastErr = err
+			continue
+		}
+		kvPairs = append(kvPairs, *kvPair)
+	}
+	return kvPairs, lastErr
+}
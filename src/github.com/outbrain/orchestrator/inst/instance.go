@@ -60,6 +60,20 @@ func ParseInstanceKey(hostPort string) (*InstanceKey, error) {
 	return NewInstanceKeyFromStrings(tokens[0], tokens[1])
 }
 
+// ParseRawInstanceKey parses an InstanceKey from a string representation such as 127.0.0.1:3306, without
+// resolving the hostname
+func ParseRawInstanceKey(hostPort string) (*InstanceKey, error) {
+	tokens := strings.SplitN(hostPort, ":", 2)
+	if len(tokens) != 2 {
+		return nil, errors.New(fmt.Sprintf("Cannot parse InstanceKey from %s. Expected format is host:port", hostPort))
+	}
+	port, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid port: %s", tokens[1]))
+	}
+	return &InstanceKey{Hostname: tokens[0], Port: port}, nil
+}
+
 // Formalize this key by getting CNAME for hostname
 func (this *InstanceKey) Formalize() *InstanceKey {
 	this.Hostname, _ = ResolveHostname(this.Hostname)
@@ -154,6 +168,19 @@ func (this *InstanceKeyMap) MarshalJSON() ([]byte, error) {
 	return json.Marshal(this.GetInstanceKeys())
 }
 
+// UnmarshalJSON will unmarshal this map from a JSON list of keys
+func (this *InstanceKeyMap) UnmarshalJSON(b []byte) error {
+	var keys []InstanceKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	*this = make(InstanceKeyMap)
+	for _, key := range keys {
+		(*this)[key] = true
+	}
+	return nil
+}
+
 // Instance represents a database instance, including its current configuration & status.
 // It presents important replication configuration and detailed replication status.
 type Instance struct {
@@ -178,6 +205,7 @@ type Instance struct {
 	LastIOError            string
 	SecondsBehindMaster    sql.NullInt64
 	SlaveLagSeconds        sql.NullInt64
+	ThreadsRunning         sql.NullInt64
 	SlaveHosts             InstanceKeyMap
 	ClusterName            string
 	ReplicationDepth       uint
@@ -280,6 +308,16 @@ func (this *Instance) SetBinaryLogs(binlogs []string) {
 	this.binaryLogs = binlogs
 }
 
+// hasBinaryLog returns true when given binary log is listed in this instance's binary logs
+func (this *Instance) hasBinaryLog(binlog string) bool {
+	for _, current := range this.binaryLogs {
+		if current == binlog {
+			return true
+		}
+	}
+	return false
+}
+
 // GetNextBinaryLog returns the successive, if any, binary log file to the one given
 func (this *Instance) GetNextBinaryLog(binlog string) (string, error) {
 	returnNext := false
@@ -308,24 +346,24 @@ func (this *Instance) IsMasterOf(slave *Instance) bool {
 // Checks are made to binlog format, version number, binary logs etc.
 func (this *Instance) CanReplicateFrom(other *Instance) (bool, error) {
 	if !other.LogBinEnabled {
-		return false, errors.New(fmt.Sprintf("instance does not have binary logs enabled: %+v", other.Key))
+		return false, newPreconditionError("instance does not have binary logs enabled: %+v", other.Key)
 	}
 	if !other.LogSlaveUpdatesEnabled {
-		return false, errors.New(fmt.Sprintf("instance does not have log_slave_updates enabled: %+v", other.Key))
+		return false, newPreconditionError("instance does not have log_slave_updates enabled: %+v", other.Key)
 	}
 	if this.IsSmallerMajorVersion(other) {
-		return false, errors.New(fmt.Sprintf("instance %+v has version %s, which is lower than %s on %+v ", this.Key, this.Version, other.Version, other.Key))
+		return false, newPreconditionError("instance %+v has version %s, which is lower than %s on %+v ", this.Key, this.Version, other.Version, other.Key)
 	}
 	if this.LogBinEnabled && this.LogSlaveUpdatesEnabled {
 		if this.Binlog_format == "STATEMENT" && (other.Binlog_format == "ROW" || other.Binlog_format == "MIXED") {
-			return false, errors.New(fmt.Sprintf("Cannot replicate from ROW/MIXED binlog format on %+v to STATEMENT on %+v", other.Key, this.Key))
+			return false, newPreconditionError("Cannot replicate from ROW/MIXED binlog format on %+v to STATEMENT on %+v", other.Key, this.Key)
 		}
 		if this.Binlog_format == "MIXED" && other.Binlog_format == "ROW" {
-			return false, errors.New(fmt.Sprintf("Cannot replicate from ROW binlog format on %+v to MIXED on %+v", other.Key, this.Key))
+			return false, newPreconditionError("Cannot replicate from ROW binlog format on %+v to MIXED on %+v", other.Key, this.Key)
 		}
 	}
 	if this.ServerID == other.ServerID {
-		return false, errors.New(fmt.Sprintf("Identical server id: %+v, %+v both have %d", other.Key, this.Key, this.ServerID))
+		return false, newPreconditionError("Identical server id: %+v, %+v both have %d", other.Key, this.Key, this.ServerID)
 	}
 	return true, nil
 }
@@ -334,22 +372,22 @@ func (this *Instance) CanReplicateFrom(other *Instance) (bool, error) {
 // if this instance lags too much, it will not be moveable.
 func (this *Instance) CanMove() (bool, error) {
 	if !this.IsLastCheckValid {
-		return false, errors.New(fmt.Sprintf("%+v: last check invalid", this.Key))
+		return false, newPreconditionError("%+v: last check invalid", this.Key)
 	}
 	if !this.IsRecentlyChecked {
-		return false, errors.New(fmt.Sprintf("%+v: not recently checked", this.Key))
+		return false, newPreconditionError("%+v: not recently checked", this.Key)
 	}
 	if !this.Slave_SQL_Running {
-		return false, errors.New(fmt.Sprintf("%+v: instance is not replicating", this.Key))
+		return false, newPreconditionError("%+v: instance is not replicating", this.Key)
 	}
 	if !this.Slave_IO_Running {
-		return false, errors.New(fmt.Sprintf("%+v: instance is not replicating", this.Key))
+		return false, newPreconditionError("%+v: instance is not replicating", this.Key)
 	}
 	if !this.SecondsBehindMaster.Valid {
-		return false, errors.New(fmt.Sprintf("%+v: cannot determine slave lag", this.Key))
+		return false, newPreconditionError("%+v: cannot determine slave lag", this.Key)
 	}
-	if this.SecondsBehindMaster.Int64 > int64(config.Config.ReasonableMaintenanceReplicationLagSeconds) {
-		return false, errors.New(fmt.Sprintf("%+v: lags too much", this.Key))
+	if this.SecondsBehindMaster.Int64 > int64(config.Config().ReasonableMaintenanceReplicationLagSeconds) {
+		return false, newPreconditionError("%+v: lags too much", this.Key)
 	}
 	return true, nil
 }
@@ -357,16 +395,16 @@ func (this *Instance) CanMove() (bool, error) {
 // CanMoveAsCoMaster returns true if this instance's state allows it to be repositioned.
 func (this *Instance) CanMoveAsCoMaster() (bool, error) {
 	if !this.IsLastCheckValid {
-		return false, errors.New(fmt.Sprintf("%+v: last check invalid", this.Key))
+		return false, newPreconditionError("%+v: last check invalid", this.Key)
 	}
 	if !this.IsRecentlyChecked {
-		return false, errors.New(fmt.Sprintf("%+v: not recently checked", this.Key))
+		return false, newPreconditionError("%+v: not recently checked", this.Key)
 	}
 	if this.Slave_SQL_Running {
-		return false, errors.New(fmt.Sprintf("%+v: instance is replicating", this.Key))
+		return false, newPreconditionError("%+v: instance is replicating", this.Key)
 	}
 	if this.Slave_IO_Running {
-		return false, errors.New(fmt.Sprintf("%+v: instance is replicating", this.Key))
+		return false, newPreconditionError("%+v: instance is replicating", this.Key)
 	}
 	return true, nil
 }
@@ -374,10 +412,10 @@ func (this *Instance) CanMoveAsCoMaster() (bool, error) {
 // CanMoveViaMatch returns true if this instance's state allows it to be repositioned via pseudo-GTID matching
 func (this *Instance) CanMoveViaMatch() (bool, error) {
 	if !this.IsLastCheckValid {
-		return false, errors.New(fmt.Sprintf("%+v: last check invalid", this.Key))
+		return false, newPreconditionError("%+v: last check invalid", this.Key)
 	}
 	if !this.IsRecentlyChecked {
-		return false, errors.New(fmt.Sprintf("%+v: not recently checked", this.Key))
+		return false, newPreconditionError("%+v: not recently checked", this.Key)
 	}
 	return true, nil
 }
@@ -396,7 +434,7 @@ func (this *Instance) StatusString() string {
 	if this.IsSlave() && !this.SecondsBehindMaster.Valid {
 		return "cannot determine slave lag"
 	}
-	if this.IsSlave() && this.SecondsBehindMaster.Int64 > int64(config.Config.ReasonableMaintenanceReplicationLagSeconds) {
+	if this.IsSlave() && this.SecondsBehindMaster.Int64 > int64(config.Config().ReasonableMaintenanceReplicationLagSeconds) {
 		return "lags too much"
 	}
 	return "OK"
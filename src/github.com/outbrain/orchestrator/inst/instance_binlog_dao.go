@@ -17,32 +17,34 @@
 package inst
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/golib/math"
 	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/binlog"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/db"
 	"github.com/pmylund/go-cache"
+	"io"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 )
 
 const binlogEventsChunkSize int = 1000000
 
-var instancePseudoGTIDEntryCache = cache.New(time.Duration(10)*time.Minute, time.Minute)
-
-func getInstancePseudoGTIDKey(instance *Instance, entry string) string {
-	return fmt.Sprintf("%s;%s", instance.Key.DisplayString, entry)
-}
+// binlogFirstEntryChunkSize is the (smaller) chunk size by which binary logs are scanned for their first pseudo GTID entry
+const binlogFirstEntryChunkSize int = 10000
 
 // Try and find the last position of a pseudo GTID query entry in the given binary log.
 // Also return the full text of that entry.
 // maxCoordinates is the position beyond which we should not read. This is relevant when reading relay logs; in particular,
 // the last relay log. We must be careful not to scan for Pseudo-GTID entries past the position executed by the SQL thread.
 // maxCoordinates == nil means no limit.
-func getLastPseudoGTIDEntryInBinlog(instanceKey *InstanceKey, binlog string, binlogType BinlogType, maxCoordinates *BinlogCoordinates) (*BinlogCoordinates, string, error) {
+func getLastPseudoGTIDEntryInBinlog(ctx context.Context, instanceKey *InstanceKey, binlog string, binlogType BinlogType, maxCoordinates *BinlogCoordinates) (*BinlogCoordinates, string, error) {
 	binlogCoordinates := BinlogCoordinates{LogFile: binlog, LogPos: 0, Type: binlogType}
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
@@ -55,13 +57,16 @@ func getLastPseudoGTIDEntryInBinlog(instanceKey *InstanceKey, binlog string, bin
 	entryText := ""
 	commandToken := math.TernaryString(binlogCoordinates.Type == BinaryLog, "binlog", "relaylog")
 	for moreRowsExpected {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
 		query := fmt.Sprintf("show %s events in '%s' LIMIT %d,%d", commandToken, binlog, (step * binlogEventsChunkSize), binlogEventsChunkSize)
 
 		moreRowsExpected = false
 		err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
 			moreRowsExpected = true
 			binlogEntryInfo := m.GetString("Info")
-			if matched, _ := regexp.MatchString(config.Config.PseudoGTIDPattern, binlogEntryInfo); matched {
+			if matched, _ := regexp.MatchString(config.Config().PseudoGTIDPattern, binlogEntryInfo); matched {
 				if maxCoordinates != nil && maxCoordinates.SmallerThan(&BinlogCoordinates{LogFile: binlog, LogPos: m.GetInt64("Pos")}) {
 					// past the limitation
 					moreRowsExpected = false
@@ -87,18 +92,34 @@ func getLastPseudoGTIDEntryInBinlog(instanceKey *InstanceKey, binlog string, bin
 	return &binlogCoordinates, entryText, err
 }
 
-func getLastPseudoGTIDEntryInInstance(instance *Instance, exhaustiveSearch bool) (*BinlogCoordinates, string, error) {
+// getLastPseudoGTIDEntryInInstanceBinlog returns the last pseudo GTID entry in given binary log of given instance.
+// Rotated binary logs no longer change, and so their last entry is cached.
+func getLastPseudoGTIDEntryInInstanceBinlog(ctx context.Context, instance *Instance, binlog string, isRotated bool) (*BinlogCoordinates, string, error) {
+	if !isRotated {
+		return getLastPseudoGTIDEntryInBinlog(ctx, &instance.Key, binlog, BinaryLog, nil)
+	}
+	if cachedEntry, found := getCachedBinlogLastPseudoGTIDEntry(&instance.Key, binlog); found {
+		return cachedEntry.Coordinates, cachedEntry.EntryText, nil
+	}
+	resultCoordinates, entryInfo, err := getLastPseudoGTIDEntryInBinlog(ctx, &instance.Key, binlog, BinaryLog, nil)
+	if err == nil {
+		binlogLastPseudoGTIDEntryCache.Set(getInstanceBinlogKey(&instance.Key, binlog), &binlogPseudoGTIDEntry{Coordinates: resultCoordinates, EntryText: entryInfo}, cache.DefaultExpiration)
+	}
+	return resultCoordinates, entryInfo, err
+}
+
+func getLastPseudoGTIDEntryInInstance(ctx context.Context, instance *Instance, exhaustiveSearch bool) (*BinlogCoordinates, string, error) {
 	// Look for last GTID in instance:
 	instanceBinlogs := instance.GetBinaryLogs()
 
 	for i := len(instanceBinlogs) - 1; i >= 0; i-- {
-		log.Debugf("Searching for latest pseudo gtid entry in binlog %+v of %+v", instanceBinlogs[i], instance.Key)
-		resultCoordinates, entryInfo, err := getLastPseudoGTIDEntryInBinlog(&instance.Key, instanceBinlogs[i], BinaryLog, nil)
+		logOperationDebugf(ctx, "Searching for latest pseudo gtid entry in binlog %+v of %+v", instanceBinlogs[i], instance.Key)
+		resultCoordinates, entryInfo, err := getLastPseudoGTIDEntryInInstanceBinlog(ctx, instance, instanceBinlogs[i], i < len(instanceBinlogs)-1)
 		if err != nil {
 			return nil, "", err
 		}
 		if resultCoordinates != nil {
-			log.Debugf("Found pseudo gtid entry in %+v: %+v", instance.Key, resultCoordinates)
+			logOperationDebugf(ctx, "Found pseudo gtid entry in %+v: %+v", instance.Key, resultCoordinates)
 			return resultCoordinates, entryInfo, err
 		}
 		if !exhaustiveSearch {
@@ -108,7 +129,7 @@ func getLastPseudoGTIDEntryInInstance(instance *Instance, exhaustiveSearch bool)
 	return nil, "", log.Errorf("Cannot find pseudo GTID entry in binlogs of %+v", instance.Key)
 }
 
-func getLastPseudoGTIDEntryInRelayLogs(instance *Instance, recordedInstanceRelayLogCoordinates BinlogCoordinates, exhaustiveSearch bool) (*BinlogCoordinates, string, error) {
+func getLastPseudoGTIDEntryInRelayLogs(ctx context.Context, instance *Instance, recordedInstanceRelayLogCoordinates BinlogCoordinates, exhaustiveSearch bool) (*BinlogCoordinates, string, error) {
 	// Look for last GTID in relay logs:
 	// Since MySQL does not provide with a SHOW RELAY LOGS command, we heuristically srtart from current
 	// relay log (indiciated by Relay_log_file) and walk backwards.
@@ -116,11 +137,11 @@ func getLastPseudoGTIDEntryInRelayLogs(instance *Instance, recordedInstanceRelay
 	currentRelayLog := recordedInstanceRelayLogCoordinates
 	var err error = nil
 	for err == nil {
-		log.Debugf("Searching for latest pseudo gtid entry in relaylog %+v of %+v, up to pos %+v", currentRelayLog.LogFile, instance.Key, recordedInstanceRelayLogCoordinates)
-		if resultCoordinates, entryInfo, err := getLastPseudoGTIDEntryInBinlog(&instance.Key, currentRelayLog.LogFile, RelayLog, &recordedInstanceRelayLogCoordinates); err != nil {
+		logOperationDebugf(ctx, "Searching for latest pseudo gtid entry in relaylog %+v of %+v, up to pos %+v", currentRelayLog.LogFile, instance.Key, recordedInstanceRelayLogCoordinates)
+		if resultCoordinates, entryInfo, err := getLastPseudoGTIDEntryInBinlog(ctx, &instance.Key, currentRelayLog.LogFile, RelayLog, &recordedInstanceRelayLogCoordinates); err != nil {
 			return nil, "", err
 		} else if resultCoordinates != nil {
-			log.Debugf("Found pseudo gtid entry in %+v: %+v", instance.Key, resultCoordinates)
+			logOperationDebugf(ctx, "Found pseudo gtid entry in %+v: %+v", instance.Key, resultCoordinates)
 			return resultCoordinates, entryInfo, err
 		}
 		if !exhaustiveSearch {
@@ -131,8 +152,222 @@ func getLastPseudoGTIDEntryInRelayLogs(instance *Instance, recordedInstanceRelay
 	return nil, "", log.Errorf("Cannot find pseudo GTID entry in relay logs of %+v", instance.Key)
 }
 
+// readFirstPseudoGTIDEntryInBinlog scans given binary log for the text of its first pseudo GTID entry, returning
+// empty string when the binary log has none.
+func readFirstPseudoGTIDEntryInBinlog(ctx context.Context, instanceKey *InstanceKey, binlog string) (string, error) {
+	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return "", err
+	}
+
+	moreRowsExpected := true
+	step := 0
+
+	entryText := ""
+	for moreRowsExpected && entryText == "" {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		query := fmt.Sprintf("show binlog events in '%s' LIMIT %d,%d", binlog, (step * binlogFirstEntryChunkSize), binlogFirstEntryChunkSize)
+		moreRowsExpected = false
+		err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+			moreRowsExpected = true
+			if entryText != "" {
+				return nil
+			}
+			binlogEntryInfo := m.GetString("Info")
+			if matched, _ := regexp.MatchString(config.Config().PseudoGTIDPattern, binlogEntryInfo); matched {
+				entryText = binlogEntryInfo
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		step++
+	}
+	return entryText, nil
+}
+
+// getFirstPseudoGTIDEntryInBinlog returns the first pseudo GTID entry in given binary log of given instance, as
+// read by readEntry, or empty string when the binary log has none.
+func getFirstPseudoGTIDEntryInBinlog(instance *Instance, binlog string, readEntry func(binlog string) (string, error)) (string, error) {
+	cacheKey := getInstanceBinlogKey(&instance.Key, binlog)
+	if entryText, found := binlogFirstPseudoGTIDEntryCache.Get(cacheKey); found {
+		pseudoGTIDCacheHitsCounter.Inc()
+		return entryText.(string), nil
+	}
+	pseudoGTIDCacheMissesCounter.Inc()
+	entryText, err := readEntry(binlog)
+	if err != nil {
+		return "", err
+	}
+	if binlogs := instance.GetBinaryLogs(); entryText != "" || len(binlogs) == 0 || binlogs[len(binlogs)-1] != binlog {
+		// The current binary log, while empty of entries, may yet get some
+		binlogFirstPseudoGTIDEntryCache.Set(cacheKey, entryText, cache.DefaultExpiration)
+	}
+	return entryText, nil
+}
+
+// pseudoGTIDMonotonicTokens returns the components of given monotonic pseudo GTID entry by which it is ordered:
+// the alphanumeric runs following PseudoGTIDMonotonicHint, or throughout the entry when the hint is not found.
+func pseudoGTIDMonotonicTokens(entryText string) []string {
+	if hint := config.Config().PseudoGTIDMonotonicHint; hint != "" {
+		if index := strings.Index(entryText, hint); index >= 0 {
+			entryText = entryText[index+len(hint):]
+		}
+	}
+	return strings.FieldsFunc(entryText, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// comparePseudoGTIDMonotonicEntries compares two monotonic pseudo GTID entries, returning -1, 0 or 1.
+// Entries are compared token by token; a longer token (leading zeros aside) is the greater, such that
+// numeric tokens need not be of fixed width.
+func comparePseudoGTIDMonotonicEntries(entryText1, entryText2 string) int {
+	tokens1, tokens2 := pseudoGTIDMonotonicTokens(entryText1), pseudoGTIDMonotonicTokens(entryText2)
+	for i := 0; i < len(tokens1) && i < len(tokens2); i++ {
+		token1, token2 := strings.TrimLeft(tokens1[i], "0"), strings.TrimLeft(tokens2[i], "0")
+		switch {
+		case len(token1) < len(token2):
+			return -1
+		case len(token1) > len(token2):
+			return 1
+		case token1 < token2:
+			return -1
+		case token1 > token2:
+			return 1
+		}
+	}
+	switch {
+	case len(tokens1) < len(tokens2):
+		return -1
+	case len(tokens1) > len(tokens2):
+		return 1
+	}
+	return 0
+}
+
+// findBinlogByFirstEntries binary searches given binary logs (ascending) for the one which may contain given
+// entry: the last binary log whose first entry is not greater than the entry. Binary logs having no entries
+// are skipped over. It returns empty string when no binary log qualifies.
+func findBinlogByFirstEntries(binlogs []string, entryText string, firstEntry func(binlog string) (string, error)) (string, error) {
+	candidate := ""
+	low, high := 0, len(binlogs)-1
+	for low <= high {
+		mid := (low + high) / 2
+		// Nearest binary log at or below mid which has an entry
+		probe := mid
+		probeEntry := ""
+		for ; probe >= low; probe-- {
+			var err error
+			if probeEntry, err = firstEntry(binlogs[probe]); err != nil {
+				return "", err
+			}
+			if probeEntry != "" {
+				break
+			}
+		}
+		if probe < low {
+			low = mid + 1
+			continue
+		}
+		if comparePseudoGTIDMonotonicEntries(probeEntry, entryText) <= 0 {
+			candidate = binlogs[probe]
+			low = mid + 1
+		} else {
+			high = probe - 1
+		}
+	}
+	return candidate, nil
+}
+
+// searchPseudoGTIDEntryInInstanceMonotonic looks for given (monotonic) pseudo GTID entry by binary searching
+// the instance's binary logs, then scanning the single binary log which may contain it.
+func searchPseudoGTIDEntryInInstanceMonotonic(ctx context.Context, instance *Instance, entryText string) (*BinlogCoordinates, error) {
+	readEntry := func(binlog string) (string, error) {
+		return readFirstPseudoGTIDEntryInBinlog(ctx, &instance.Key, binlog)
+	}
+	firstEntry := func(binlog string) (string, error) {
+		return getFirstPseudoGTIDEntryInBinlog(instance, binlog, readEntry)
+	}
+	binlog, err := findBinlogByFirstEntries(instance.GetBinaryLogs(), entryText, firstEntry)
+	if err != nil {
+		return nil, err
+	}
+	if binlog == "" {
+		return nil, fmt.Errorf("Pseudo GTID entry precedes binlogs of %+v", instance.Key)
+	}
+	binlogs := instance.GetBinaryLogs()
+	isRotated := binlog != binlogs[len(binlogs)-1]
+	logOperationDebugf(ctx, "Searching for given monotonic pseudo gtid entry in binlog %+v of %+v", binlog, instance.Key)
+	return searchMonotonicPseudoGTIDEntryInBinlog(ctx, instance, binlog, entryText, isRotated)
+}
+
+// searchMonotonicPseudoGTIDEntryInBinlog looks for given (monotonic) pseudo GTID entry in given binary log. The last
+// entry of a rotated binary log is sampled along the way, and cached: subsequent searches for entries past it
+// need not scan the binary log at all.
+func searchMonotonicPseudoGTIDEntryInBinlog(ctx context.Context, instance *Instance, binlog string, entryText string, isRotated bool) (*BinlogCoordinates, error) {
+	if isRotated {
+		if lastEntry, found := getCachedBinlogLastPseudoGTIDEntry(&instance.Key, binlog); found && lastEntry.Coordinates != nil {
+			if lastEntry.EntryText == entryText {
+				return lastEntry.Coordinates, nil
+			}
+			if comparePseudoGTIDMonotonicEntries(lastEntry.EntryText, entryText) < 0 {
+				return nil, fmt.Errorf("Pseudo GTID entry follows last entry of binlog %s of %+v", binlog, instance.Key)
+			}
+		}
+	}
+	db, err := db.OpenTopology(instance.Key.Hostname, instance.Key.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	moreRowsExpected := true
+	step := 0
+
+	var resultCoordinates *BinlogCoordinates
+	lastEntry := &binlogPseudoGTIDEntry{}
+	for moreRowsExpected && resultCoordinates == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		query := fmt.Sprintf("show binlog events in '%s' LIMIT %d,%d", binlog, (step * binlogEventsChunkSize), binlogEventsChunkSize)
+		moreRowsExpected = false
+		err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+			moreRowsExpected = true
+			if resultCoordinates != nil {
+				return nil
+			}
+			binlogEntryInfo := m.GetString("Info")
+			if matched, _ := regexp.MatchString(config.Config().PseudoGTIDPattern, binlogEntryInfo); !matched {
+				return nil
+			}
+			coordinates := &BinlogCoordinates{LogFile: binlog, LogPos: m.GetInt64("Pos"), Type: BinaryLog}
+			if binlogEntryInfo == entryText {
+				resultCoordinates = coordinates
+			}
+			lastEntry = &binlogPseudoGTIDEntry{Coordinates: coordinates, EntryText: binlogEntryInfo}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		step++
+	}
+	if resultCoordinates != nil {
+		return resultCoordinates, nil
+	}
+	if isRotated {
+		// Scanned throughout
+		binlogLastPseudoGTIDEntryCache.Set(getInstanceBinlogKey(&instance.Key, binlog), lastEntry, cache.DefaultExpiration)
+	}
+	return nil, fmt.Errorf("Cannot match pseudo GTID entry in binlog '%s'", binlog)
+}
+
 // Given a binlog entry text (query), search it in the given binary log of a given instance
-func SearchPseudoGTIDEntryInBinlog(instanceKey *InstanceKey, binlog string, entryText string) (BinlogCoordinates, error) {
+func SearchPseudoGTIDEntryInBinlog(ctx context.Context, instanceKey *InstanceKey, binlog string, entryText string) (BinlogCoordinates, error) {
 	binlogCoordinates := BinlogCoordinates{LogFile: binlog, LogPos: 0, Type: BinaryLog}
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
@@ -144,6 +379,9 @@ func SearchPseudoGTIDEntryInBinlog(instanceKey *InstanceKey, binlog string, entr
 
 	commandToken := math.TernaryString(binlogCoordinates.Type == BinaryLog, "binlog", "relaylog")
 	for moreRowsExpected {
+		if err := ctx.Err(); err != nil {
+			return binlogCoordinates, err
+		}
 		query := fmt.Sprintf("show %s events in '%s' LIMIT %d,%d", commandToken, binlog, (step * binlogEventsChunkSize), binlogEventsChunkSize)
 		moreRowsExpected = false
 		err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
@@ -170,22 +408,36 @@ func SearchPseudoGTIDEntryInBinlog(instanceKey *InstanceKey, binlog string, entr
 	return binlogCoordinates, err
 }
 
-func SearchPseudoGTIDEntryInInstance(instance *Instance, entryText string) (*BinlogCoordinates, error) {
-	cacheKey := getInstancePseudoGTIDKey(instance, entryText)
-	coords, found := instancePseudoGTIDEntryCache.Get(cacheKey)
-	if found {
+func SearchPseudoGTIDEntryInInstance(ctx context.Context, instance *Instance, entryText string) (*BinlogCoordinates, error) {
+	if coords, found := getCachedPseudoGTIDEntryCoordinates(instance, entryText); found {
 		// This is wonderful. We can skip the tedious GTID search in the binary log
-		log.Debugf("Found instance Pseudo GTID entry coordinates in cache: %+v, %+v, %+v", instance.Key, entryText, coords)
-		return coords.(*BinlogCoordinates), nil
+		log.Debugf("Found instance Pseudo GTID entry coordinates in cache: %+v, %+v, %+v", instance.Key, entryText, *coords)
+		return coords, nil
+	}
+	if config.Config().PseudoGTIDMonotonicHint != "" && strings.Contains(entryText, config.Config().PseudoGTIDMonotonicHint) {
+		resultCoordinates, err := searchPseudoGTIDEntryInInstanceMonotonic(ctx, instance, entryText)
+		if err == nil {
+			logOperationDebugf(ctx, "Matched entry in %+v: %+v", instance.Key, *resultCoordinates)
+			setCachedPseudoGTIDEntryCoordinates(instance, entryText, resultCoordinates)
+			return resultCoordinates, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// Falling back to linear search, in case entries are not monotonic after all
+		log.Warningf("Monotonic search for pseudo GTID entry in %+v failed: %+v; searching all binlogs", instance.Key, err)
 	}
 	// Look for GTID entry in other-instance:
 	binlogs := instance.GetBinaryLogs()
 	for i := len(binlogs) - 1; i >= 0; i-- {
-		log.Debugf("Searching for given pseudo gtid entry in binlog %+v of %+v", binlogs[i], instance.Key)
-		resultCoordinates, err := SearchPseudoGTIDEntryInBinlog(&instance.Key, binlogs[i], entryText)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		logOperationDebugf(ctx, "Searching for given pseudo gtid entry in binlog %+v of %+v", binlogs[i], instance.Key)
+		resultCoordinates, err := SearchPseudoGTIDEntryInBinlog(ctx, &instance.Key, binlogs[i], entryText)
 		if resultCoordinates.LogPos != 0 && err == nil {
-			log.Debugf("Matched entry in %+v: %+v", instance.Key, resultCoordinates)
-			instancePseudoGTIDEntryCache.Set(cacheKey, &resultCoordinates, 0)
+			logOperationDebugf(ctx, "Matched entry in %+v: %+v", instance.Key, resultCoordinates)
+			setCachedPseudoGTIDEntryCoordinates(instance, entryText, &resultCoordinates)
 			return &resultCoordinates, nil
 		}
 	}
@@ -193,8 +445,11 @@ func SearchPseudoGTIDEntryInInstance(instance *Instance, entryText string) (*Bin
 }
 
 // Read (as much as possible of) a chink of binary log events starting the given startingCoordinates
-func readBinlogEventsChunk(instanceKey *InstanceKey, startingCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
+func readBinlogEventsChunk(ctx context.Context, instanceKey *InstanceKey, startingCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
 	events := []BinlogEvent{}
+	if err := ctx.Err(); err != nil {
+		return events, err
+	}
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
 		return events, err
@@ -216,10 +471,66 @@ func readBinlogEventsChunk(instanceKey *InstanceKey, startingCoordinates BinlogC
 	return events, err
 }
 
+// Stream (as much as possible of) a chunk of binary log events starting the given startingCoordinates, via
+// the replication protocol. Like readBinlogEventsChunk, it does not cross into the next binary log.
+func dumpBinlogEventsChunk(ctx context.Context, instanceKey *InstanceKey, startingCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
+	events := []BinlogEvent{}
+	if err := ctx.Err(); err != nil {
+		return events, err
+	}
+	credentials, err := db.GetTopologyCredentials(instanceKey.Hostname, instanceKey.Port)
+	if err != nil {
+		return events, err
+	}
+	reader, err := binlog.Dump(instanceKey.Hostname, instanceKey.Port, credentials.User, credentials.Password,
+		startingCoordinates.LogFile, startingCoordinates.LogPos, time.Duration(config.Config().MySQLConnectTimeoutSeconds)*time.Second)
+	if err != nil {
+		return events, log.Errore(err)
+	}
+	defer reader.Close()
+	for len(events) < binlogEventsChunkSize {
+		if err := ctx.Err(); err != nil {
+			return events, err
+		}
+		event, err := reader.NextEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return events, log.Errore(err)
+		}
+		if event.LogFile != startingCoordinates.LogFile {
+			// Streamed into the next binary log
+			break
+		}
+		if event.IsArtificial() {
+			continue
+		}
+		binlogEvent := BinlogEvent{}
+		binlogEvent.Coordinates.LogFile = event.LogFile
+		binlogEvent.Coordinates.LogPos = event.LogPos
+		binlogEvent.Coordinates.Type = startingCoordinates.Type
+		binlogEvent.NextEventPos = event.NextLogPos
+		binlogEvent.EventType = event.Type.String()
+		binlogEvent.Info = event.Info
+
+		events = append(events, binlogEvent)
+		if event.Type == binlog.RotateEvent {
+			break
+		}
+	}
+	return events, nil
+}
+
 // Return the next chunk of binlog events; skip to next binary log file if need be; return empty result only
-// if reached end of binary logs
-func getNextBinlogEventsChunk(instance *Instance, startingCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
-	events, err := readBinlogEventsChunk(&instance.Key, startingCoordinates)
+// if reached end of binary logs. Binary logs are read by the configured BinlogEventsReader; relay logs can only be
+// read via SHOW RELAYLOG EVENTS.
+func getNextBinlogEventsChunk(ctx context.Context, instance *Instance, startingCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
+	readEventsChunk := readBinlogEventsChunk
+	if config.Config().BinlogEventsReader == "binlog-dump" && startingCoordinates.Type == BinaryLog {
+		readEventsChunk = dumpBinlogEventsChunk
+	}
+	events, err := readEventsChunk(ctx, &instance.Key, startingCoordinates)
 	if err != nil {
 		return events, err
 	}
@@ -229,7 +540,7 @@ func getNextBinlogEventsChunk(instance *Instance, startingCoordinates BinlogCoor
 	// events are empty
 	if nextBinlogFile, err := instance.GetNextBinaryLog(startingCoordinates.LogFile); err == nil {
 		nextCoordinates := BinlogCoordinates{LogFile: nextBinlogFile, LogPos: 0, Type: startingCoordinates.Type}
-		return getNextBinlogEventsChunk(instance, nextCoordinates)
+		return getNextBinlogEventsChunk(ctx, instance, nextCoordinates)
 	}
 	// No more log file. We return the empty array: but no error, since there is no error; we've just reached the end.
 	// This behaviour is strictly expected by BinlogEventCursor
@@ -244,21 +555,24 @@ func getNextBinlogEventsChunk(instance *Instance, startingCoordinates BinlogCoor
 // If "other" runs out that means "instance" is more advanced in replication than "other", in which case we can't
 // turn it into a slave of "other".
 // Otherwise "instance" will point to the *next* binlog entry in "other"
-func GetNextBinlogCoordinatesToMatch(instance *Instance, instanceCoordinates BinlogCoordinates, recordedInstanceRelayLogCoordinates BinlogCoordinates,
+func GetNextBinlogCoordinatesToMatch(ctx context.Context, instance *Instance, instanceCoordinates BinlogCoordinates, recordedInstanceRelayLogCoordinates BinlogCoordinates,
 	other *Instance, otherCoordinates BinlogCoordinates) (*BinlogCoordinates, error) {
 
 	fetchNextEvents := func(binlogCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
-		return getNextBinlogEventsChunk(instance, binlogCoordinates)
+		return getNextBinlogEventsChunk(ctx, instance, binlogCoordinates)
 	}
 	instanceCursor := NewBinlogEventCursor(instanceCoordinates, fetchNextEvents)
 
 	fetchOtherNextEvents := func(binlogCoordinates BinlogCoordinates) ([]BinlogEvent, error) {
-		return getNextBinlogEventsChunk(other, binlogCoordinates)
+		return getNextBinlogEventsChunk(ctx, other, binlogCoordinates)
 	}
 	otherCursor := NewBinlogEventCursor(otherCoordinates, fetchOtherNextEvents)
 
 	var lastConsumedEventCoordinates BinlogCoordinates
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, log.Errore(err)
+		}
 		// Exhaust binlogs/relaylogs on instance. While iterating them, also iterate the otherInstance binlogs.
 		// We expect entries on both to match, sequentially, until instance's binlogs/relaylogs are exhausted.
 		var instanceEventInfo string
@@ -285,7 +599,7 @@ func GetNextBinlogCoordinatesToMatch(instance *Instance, instanceCoordinates Bin
 					if !nextCoordinates.Equals(&instance.SelfBinlogCoordinates) {
 						return nil, log.Errorf("Unexpected problem: instance binlog iteration did not end with current master status. Ended with: %+v, self coordinates: %+v", nextCoordinates, instance.SelfBinlogCoordinates)
 					}
-					log.Debugf("Reached end of binary logs for instance, at %+v. Other coordinates: %+v", nextCoordinates, targetMatchCoordinates)
+					logOperationDebugf(ctx, "Reached end of binary logs for instance, at %+v. Other coordinates: %+v", nextCoordinates, targetMatchCoordinates)
 					return &targetMatchCoordinates, nil
 				}
 			case RelayLog:
@@ -302,11 +616,11 @@ func GetNextBinlogCoordinatesToMatch(instance *Instance, instanceCoordinates Bin
 				if event == nil {
 					// End of relay log...
 					endOfScan = true
-					log.Debugf("Reached end of relay log at %+v", recordedInstanceRelayLogCoordinates)
+					logOperationDebugf(ctx, "Reached end of relay log at %+v", recordedInstanceRelayLogCoordinates)
 				} else if recordedInstanceRelayLogCoordinates.Equals(&event.Coordinates) {
 					// We've passed the maxScanInstanceCoordinates (applies for relay logs)
 					endOfScan = true
-					log.Debugf("Reached slave relay log coordinates at %+v", recordedInstanceRelayLogCoordinates)
+					logOperationDebugf(ctx, "Reached slave relay log coordinates at %+v", recordedInstanceRelayLogCoordinates)
 				} else if recordedInstanceRelayLogCoordinates.SmallerThan(&event.Coordinates) {
 					return nil, log.Errorf("Unexpected problem: relay log scan passed relay log position without hitting it. Ended with: %+v, relay log position: %+v", event.Coordinates, recordedInstanceRelayLogCoordinates)
 				}
@@ -317,7 +631,7 @@ func GetNextBinlogCoordinatesToMatch(instance *Instance, instanceCoordinates Bin
 						return nil, log.Errore(err)
 					}
 					// No further sanity checks (read the above lengthy explanation)
-					log.Debugf("Reached limit of relay logs for instance, just after %+v. Other coordinates: %+v", lastConsumedEventCoordinates, targetMatchCoordinates)
+					logOperationDebugf(ctx, "Reached limit of relay logs for instance, just after %+v. Other coordinates: %+v", lastConsumedEventCoordinates, targetMatchCoordinates)
 					return &targetMatchCoordinates, nil
 				}
 			}
@@ -0,0 +1,138 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/pmylund/go-cache"
+	. "gopkg.in/check.v1"
+)
+
+type BinlogDaoTestSuite struct{}
+
+var _ = Suite(&BinlogDaoTestSuite{})
+
+func (s *BinlogDaoTestSuite) SetUpTest(c *C) {
+	binlogFirstPseudoGTIDEntryCache.Flush()
+}
+
+func (s *BinlogDaoTestSuite) TestGetInstancePseudoGTIDKey(c *C) {
+	instance1 := NewInstance()
+	instance1.Key = InstanceKey{Hostname: "db-1", Port: 3306}
+	instance2 := NewInstance()
+	instance2.Key = InstanceKey{Hostname: "db-2", Port: 3306}
+	entry := "drop view if exists `meta`.`_pseudo_gtid_hint__asc:0001`"
+	c.Assert(getInstancePseudoGTIDKey(instance1, entry), Equals, "db-1:3306;"+entry)
+	c.Assert(getInstancePseudoGTIDKey(instance1, entry) == getInstancePseudoGTIDKey(instance2, entry), Equals, false)
+}
+
+func (s *BinlogDaoTestSuite) TestFindBinlogByFirstEntriesInActiveBinlog(c *C) {
+	instance := NewInstance()
+	instance.Key = InstanceKey{Hostname: "db-active-binlog", Port: 3306}
+	instance.SetBinaryLogs([]string{"mysql-bin.000001", "mysql-bin.000002"})
+
+	entry1 := "drop view if exists `meta`.`_pseudo_gtid_hint__asc:0001`"
+	entry2 := "drop view if exists `meta`.`_pseudo_gtid_hint__asc:0002`"
+	firstEntries := map[string]string{"mysql-bin.000001": entry1}
+	reads := 0
+	readEntry := func(binlog string) (string, error) {
+		reads++
+		return firstEntries[binlog], nil
+	}
+	firstEntry := func(binlog string) (string, error) {
+		return getFirstPseudoGTIDEntryInBinlog(instance, binlog, readEntry)
+	}
+
+	// The active binary log has no entries as yet
+	binlog, err := findBinlogByFirstEntries(instance.GetBinaryLogs(), entry2, firstEntry)
+	c.Assert(err, IsNil)
+	c.Assert(binlog, Equals, "mysql-bin.000001")
+
+	// A new entry is written onto the active binary log, and must be found there
+	firstEntries["mysql-bin.000002"] = entry2
+	binlog, err = findBinlogByFirstEntries(instance.GetBinaryLogs(), entry2, firstEntry)
+	c.Assert(err, IsNil)
+	c.Assert(binlog, Equals, "mysql-bin.000002")
+
+	// Both binary logs now have entries, and are served from cache
+	reads = 0
+	binlog, err = findBinlogByFirstEntries(instance.GetBinaryLogs(), entry1, firstEntry)
+	c.Assert(err, IsNil)
+	c.Assert(binlog, Equals, "mysql-bin.000001")
+	c.Assert(reads, Equals, 0)
+}
+
+func (s *BinlogDaoTestSuite) TestComparePseudoGTIDMonotonicEntries(c *C) {
+	entry := func(token string) string {
+		return "drop view if exists `meta`.`_pseudo_gtid_hint__asc:" + token + "`"
+	}
+	c.Assert(comparePseudoGTIDMonotonicEntries(entry("0001"), entry("0001")), Equals, 0)
+	c.Assert(comparePseudoGTIDMonotonicEntries(entry("0001"), entry("0002")), Equals, -1)
+	c.Assert(comparePseudoGTIDMonotonicEntries(entry("9"), entry("10")), Equals, -1)
+	c.Assert(comparePseudoGTIDMonotonicEntries(entry("10"), entry("9")), Equals, 1)
+	c.Assert(comparePseudoGTIDMonotonicEntries(entry("55B364E3:0000000000056EE2"), entry("55B364E3:0000000000056EE3")), Equals, -1)
+	c.Assert(comparePseudoGTIDMonotonicEntries(entry("55B364E4:01"), entry("55B364E3:0000000000056EE3")), Equals, 1)
+}
+
+func (s *BinlogDaoTestSuite) TestFindBinlogByFirstEntriesVariableWidth(c *C) {
+	entry := func(token string) string {
+		return "drop view if exists `meta`.`_pseudo_gtid_hint__asc:" + token + "`"
+	}
+	binlogs := []string{"mysql-bin.000001", "mysql-bin.000002", "mysql-bin.000003"}
+	firstEntries := map[string]string{"mysql-bin.000001": entry("8"), "mysql-bin.000002": entry("95"), "mysql-bin.000003": entry("1000")}
+	firstEntry := func(binlog string) (string, error) {
+		return firstEntries[binlog], nil
+	}
+
+	for token, expected := range map[string]string{"7": "", "9": "mysql-bin.000001", "100": "mysql-bin.000002", "999": "mysql-bin.000002", "1000": "mysql-bin.000003"} {
+		binlog, err := findBinlogByFirstEntries(binlogs, entry(token), firstEntry)
+		c.Assert(err, IsNil)
+		c.Assert(binlog, Equals, expected, Commentf("token %s", token))
+	}
+}
+
+func (s *BinlogDaoTestSuite) TestReviewInstanceBinlogsReset(c *C) {
+	instance := NewInstance()
+	instance.Key = InstanceKey{Hostname: "db-reset-binlogs", Port: 3306}
+	instance.SetBinaryLogs([]string{"mysql-bin.000001"})
+	instance.SelfBinlogCoordinates = BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 5000}
+	ReviewInstanceBinlogs(instance)
+
+	entry := "drop view if exists `meta`.`_pseudo_gtid_hint__asc:0001`"
+	setCachedPseudoGTIDEntryCoordinates(instance, entry, &BinlogCoordinates{LogFile: "mysql-bin.000001", LogPos: 4000})
+	binlogFirstPseudoGTIDEntryCache.Set(getInstanceBinlogKey(&instance.Key, "mysql-bin.000001"), entry, cache.DefaultExpiration)
+
+	// Same binary log, advancing: entries remain cached
+	instance.SelfBinlogCoordinates.LogPos = 6000
+	ReviewInstanceBinlogs(instance)
+	_, found := getCachedPseudoGTIDEntryCoordinates(instance, entry)
+	c.Assert(found, Equals, true)
+
+	// RESET MASTER: the binary log name repeats, yet its position goes backwards
+	instance.SelfBinlogCoordinates.LogPos = 120
+	ReviewInstanceBinlogs(instance)
+	_, found = getCachedPseudoGTIDEntryCoordinates(instance, entry)
+	c.Assert(found, Equals, false)
+	_, found = binlogFirstPseudoGTIDEntryCache.Get(getInstanceBinlogKey(&instance.Key, "mysql-bin.000001"))
+	c.Assert(found, Equals, false)
+}
+
+func (s *BinlogDaoTestSuite) TestIsBinlogsReset(c *C) {
+	c.Assert(isBinlogsReset([]string{"mysql-bin.000007", "mysql-bin.000008"}, []string{"mysql-bin.000008", "mysql-bin.000009"}), Equals, false)
+	c.Assert(isBinlogsReset([]string{"mysql-bin.000007", "mysql-bin.000008"}, []string{"mysql-bin.000001"}), Equals, true)
+	c.Assert(isBinlogsReset([]string{"mysql-bin.000001", "mysql-bin.000002"}, []string{"mysql-bin.000001"}), Equals, true)
+	c.Assert(isBinlogsReset([]string{}, []string{"mysql-bin.000001"}), Equals, false)
+}
@@ -17,6 +17,7 @@
 package inst
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -24,6 +25,8 @@ import (
 	"github.com/outbrain/golib/sqlutils"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/db"
+	"github.com/outbrain/orchestrator/metrics"
+	"github.com/pmylund/go-cache"
 	"regexp"
 	"strings"
 	"time"
@@ -43,8 +46,31 @@ const topologyConcurrency = 100
 
 var topologyConcurrencyChan = make(chan bool, topologyConcurrency)
 
+var instancePollCounter = metrics.NewCounter("orchestrator_instance_polls_total", "Number of topology instance reads")
+var instancePollFailuresCounter = metrics.NewCounter("orchestrator_instance_poll_failures_total", "Number of failed topology instance reads")
+var writeInstanceFailuresCounter = metrics.NewCounter("orchestrator_backend_write_instance_failures_total", "Number of failed attempts to write an instance to the backend database")
+
+// instanceClusterCache maps instance keys to their [cluster name, cluster alias], for credentials resolution
+var instanceClusterCache = cache.New(time.Minute, time.Minute)
+
 func init() {
 	detachPattern, _ = regexp.Compile(`//([^/:]+):([\d]+)`)
+	db.TopologyClusterResolver = resolveInstanceCluster
+}
+
+// resolveInstanceCluster returns the cluster name and alias of given instance, as last known by the backend
+func resolveInstanceCluster(hostname string, port int) (string, string) {
+	instanceKey := InstanceKey{Hostname: hostname, Port: port}
+	if cluster, found := instanceClusterCache.Get(instanceKey.DisplayString()); found {
+		return cluster.([2]string)[0], cluster.([2]string)[1]
+	}
+	cluster := [2]string{}
+	if instance, found, _ := ReadInstance(&instanceKey); found {
+		cluster[0] = instance.ClusterName
+		cluster[1] = GetClusterAlias(instance.ClusterName)
+	}
+	instanceClusterCache.Set(instanceKey.DisplayString(), cluster, cache.DefaultExpiration)
+	return cluster[0], cluster[1]
 }
 
 // ExecuteOnTopology will execute given function while maintaining concurrency limit
@@ -64,28 +90,47 @@ func ExecDBWriteFunc(f func() error) error {
 }
 
 // ExecInstance executes a given query on the given MySQL topology instance
-func ExecInstance(instanceKey *InstanceKey, query string, args ...interface{}) (sql.Result, error) {
+// In dry-run mode the query is only recorded onto the plan, and a nil result is returned.
+func ExecInstance(ctx context.Context, instanceKey *InstanceKey, query string, args ...interface{}) (sql.Result, error) {
+	if plan := planFromContext(ctx); plan != nil {
+		plan.addStatement(instanceKey, query, args...)
+		return nil, nil
+	}
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
 		return nil, err
 	}
-	res, err := sqlutils.Exec(db, query, args...)
+	res, err := db.ExecContext(ctx, query, args...)
 	return res, err
 }
 
 // ScanInstanceRow executes a read-a-single-row query on a given MySQL topology instance
-func ScanInstanceRow(instanceKey *InstanceKey, query string, dest ...interface{}) error {
+func ScanInstanceRow(ctx context.Context, instanceKey *InstanceKey, query string, dest ...interface{}) error {
 	db, err := db.OpenTopology(instanceKey.Hostname, instanceKey.Port)
 	if err != nil {
 		return err
 	}
-	err = db.QueryRow(query).Scan(dest...)
+	err = db.QueryRowContext(ctx, query).Scan(dest...)
 	return err
 }
 
+// queryRowsMapContext is sqlutils.QueryRowsMap, bound to given context
+func queryRowsMapContext(ctx context.Context, db *sql.DB, query string, onRow func(sqlutils.RowMap) error, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if err := sqlutils.ScanRowsToMaps(rows, onRow); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
 // ReadTopologyInstance connects to a topology MySQL instance and reads its configuration and
 // replication status. It writes read info into orchestrator's backend.
-func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
+// Queries on the instance are bound to given context.
+func ReadTopologyInstance(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Errorf("Unexpected error: %+v", err)
@@ -108,7 +153,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 	}
 
 	instance.Key = *instanceKey
-	err = db.QueryRow("select @@hostname, @@global.server_id, @@global.version, @@global.read_only, @@global.binlog_format, @@global.log_bin, @@global.log_slave_updates").Scan(
+	err = db.QueryRowContext(ctx, "select @@hostname, @@global.server_id, @@global.version, @@global.read_only, @@global.binlog_format, @@global.log_bin, @@global.log_slave_updates").Scan(
 		&resolvedHostname, &instance.ServerID, &instance.Version, &instance.ReadOnly, &instance.Binlog_format, &instance.LogBinEnabled, &instance.LogSlaveUpdatesEnabled)
 	if err != nil {
 		goto Cleanup
@@ -117,7 +162,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 		UpdateResolvedHostname(instance.Key.Hostname, resolvedHostname)
 		instance.Key.Hostname = resolvedHostname
 	}
-	err = sqlutils.QueryRowsMap(db, "show slave status", func(m sqlutils.RowMap) error {
+	err = queryRowsMapContext(ctx, db, "show slave status", func(m sqlutils.RowMap) error {
 		instance.Slave_IO_Running = (m.GetString("Slave_IO_Running") == "Yes")
 		instance.Slave_SQL_Running = (m.GetString("Slave_SQL_Running") == "Yes")
 		instance.ReadBinlogCoordinates.LogFile = m.GetString("Master_Log_File")
@@ -142,7 +187,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 		}
 		instance.MasterKey = *masterKey
 		instance.SecondsBehindMaster = m.GetNullInt64("Seconds_Behind_Master")
-		if config.Config.SlaveLagQuery == "" {
+		if config.Config().SlaveLagQuery == "" {
 			instance.SlaveLagSeconds = instance.SecondsBehindMaster
 		}
 		// Not breaking the flow even on error
@@ -153,7 +198,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 	}
 
 	if instance.LogBinEnabled {
-		err = sqlutils.QueryRowsMap(db, "show master status", func(m sqlutils.RowMap) error {
+		err = queryRowsMapContext(ctx, db, "show master status", func(m sqlutils.RowMap) error {
 			var err error
 			instance.SelfBinlogCoordinates.LogFile = m.GetString("File")
 			instance.SelfBinlogCoordinates.LogPos = m.GetInt64("Position")
@@ -165,8 +210,8 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 	}
 
 	// Get slaves, either by SHOW SLAVE HOSTS or via PROCESSLIST
-	if config.Config.DiscoverByShowSlaveHosts {
-		err := sqlutils.QueryRowsMap(db, `show slave hosts`,
+	if config.Config().DiscoverByShowSlaveHosts {
+		err := queryRowsMapContext(ctx, db, `show slave hosts`,
 			func(m sqlutils.RowMap) error {
 				slaveKey, err := NewInstanceKeyFromStrings(m.GetString("Host"), m.GetString("Port"))
 				slaveKey.Hostname, resolveErr = ResolveHostname(slaveKey.Hostname)
@@ -184,7 +229,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 	if !foundBySlaveHosts {
 		// Either not configured to read SHOW SLAVE HOSTS or nothing was there.
 		// Discover by processlist
-		err := sqlutils.QueryRowsMap(db, `
+		err := queryRowsMapContext(ctx, db, `
         	select 
         		substring_index(host, ':', 1) as slave_hostname 
         	from 
@@ -209,7 +254,7 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 		binlogs := []string{}
 		if instance.LogBinEnabled {
 			// Get binary (master) logs
-			err = sqlutils.QueryRowsMap(db, "show binary logs", func(m sqlutils.RowMap) error {
+			err = queryRowsMapContext(ctx, db, "show binary logs", func(m sqlutils.RowMap) error {
 				binlogs = append(binlogs, m.GetString("Log_name"))
 				return nil
 			})
@@ -218,12 +263,13 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 			}
 		}
 		instance.SetBinaryLogs(binlogs)
+		ReviewInstanceBinlogs(instance)
 	}
 	instanceFound = true
 	// Anything after this point does not affect the fact the instance is found.
 	{
 		// Get long running processes
-		err := sqlutils.QueryRowsMap(db, `
+		err := queryRowsMapContext(ctx, db, `
 				  select 
 				    id,
 				    user,
@@ -267,8 +313,19 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 		}
 	}
 
-	if config.Config.SlaveLagQuery != "" {
-		err = db.QueryRow(config.Config.SlaveLagQuery).Scan(&instance.SlaveLagSeconds)
+	{
+		// Sampled for lag history; not breaking the flow on error
+		err := queryRowsMapContext(ctx, db, "show global status like 'Threads_running'", func(m sqlutils.RowMap) error {
+			instance.ThreadsRunning = m.GetNullInt64("Value")
+			return nil
+		})
+		if err != nil {
+			log.Errore(err)
+		}
+	}
+
+	if config.Config().SlaveLagQuery != "" {
+		err = db.QueryRowContext(ctx, config.Config().SlaveLagQuery).Scan(&instance.SlaveLagSeconds)
 		if err != nil {
 			goto Cleanup
 		}
@@ -278,15 +335,24 @@ func ReadTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 	if err != nil {
 		goto Cleanup
 	}
+	if instance.ReplicationDepth == 0 || !instance.ReadOnly {
+		// The topology root (or either writeable co-master) describes its own cluster
+		detectClusterMetadata(ctx, db, instance.ClusterName)
+	}
 
 Cleanup:
 	if instanceFound {
 		_ = writeInstance(instance, instanceFound, err)
 		WriteLongRunningProcesses(&instance.Key, longRunningProcesses)
+		if err == nil {
+			WriteLagHistorySample(instance)
+		}
 	} else {
 		_ = UpdateInstanceLastChecked(&instance.Key)
 	}
+	instancePollCounter.Inc()
 	if err != nil {
+		instancePollFailuresCounter.Inc()
 		log.Errore(err)
 	}
 	return instance, err
@@ -362,8 +428,8 @@ func readInstanceRow(m sqlutils.RowMap) *Instance {
 	slaveHostsJson := m.GetString("slave_hosts")
 	instance.ClusterName = m.GetString("cluster_name")
 	instance.ReplicationDepth = m.GetUint("replication_depth")
-	instance.IsUpToDate = (m.GetUint("seconds_since_last_checked") <= config.Config.InstancePollSeconds)
-	instance.IsRecentlyChecked = (m.GetUint("seconds_since_last_checked") <= config.Config.InstancePollSeconds*5)
+	instance.IsUpToDate = (m.GetUint("seconds_since_last_checked") <= config.Config().InstancePollSeconds)
+	instance.IsRecentlyChecked = (m.GetUint("seconds_since_last_checked") <= config.Config().InstancePollSeconds*5)
 	instance.IsLastCheckValid = m.GetBool("is_last_check_valid")
 	instance.SecondsSinceLastSeen = m.GetNullInt64("seconds_since_last_seen")
 
@@ -441,6 +507,11 @@ func ReadClusterInstances(clusterName string) ([](*Instance), error) {
 	return readInstancesByCondition(condition)
 }
 
+// ReadAllInstances reads all known instances
+func ReadAllInstances() ([](*Instance), error) {
+	return readInstancesByCondition(`1=1`)
+}
+
 // ReadSlaveInstances reads slaves of a given master
 func ReadSlaveInstances(masterKey *InstanceKey) ([](*Instance), error) {
 	condition := fmt.Sprintf(`
@@ -466,7 +537,10 @@ func ReadProblemInstances() ([](*Instance), error) {
 			or (not slave_sql_running)
 			or (not slave_io_running)
 			or (seconds_behind_master > 10)
-		`, config.Config.InstancePollSeconds)
+			or ((hostname, port) in (
+				select master_host, master_port from cluster_injected_pseudo_gtid where last_error != ''
+			))
+		`, config.Config().InstancePollSeconds)
 	return readInstancesByCondition(condition)
 }
 
@@ -510,7 +584,7 @@ func updateInstanceClusterName(instance *Instance) error {
 		if err != nil {
 			return log.Errore(err)
 		}
-		AuditOperation("update-cluster-name", &instance.Key, fmt.Sprintf("set to %s", instance.ClusterName))
+		AuditOperation(context.Background(), "update-cluster-name", &instance.Key, fmt.Sprintf("set to %s", instance.ClusterName))
 		return nil
 	}
 	return ExecDBWriteFunc(writeFunc)
@@ -544,7 +618,7 @@ func ReviewUnseenInstances() error {
 		}
 	}
 
-	AuditOperation("review-unseen-instances", nil, fmt.Sprintf("Operations: %d", operations))
+	AuditOperation(context.Background(), "review-unseen-instances", nil, fmt.Sprintf("Operations: %d", operations))
 	return err
 }
 
@@ -610,14 +684,14 @@ func InjectUnseenMasters() error {
 		}
 	}
 
-	AuditOperation("inject-unseen-masters", nil, fmt.Sprintf("Operations: %d", operations))
+	AuditOperation(context.Background(), "inject-unseen-masters", nil, fmt.Sprintf("Operations: %d", operations))
 	return err
 }
 
 // ReadCountMySQLSnapshots is a utility method to return registered number of snapshots for a given list of hosts
 func ReadCountMySQLSnapshots(hostnames []string) (map[string]int, error) {
 	res := make(map[string]int)
-	if !config.Config.ServeAgentsHttp {
+	if !config.Config().ServeAgentsHttp {
 		return res, nil
 	}
 	query := fmt.Sprintf(`
@@ -699,6 +773,27 @@ func ReadClusters() ([]string, error) {
 	return clusterNames, err
 }
 
+// detectClusterMetadata runs the configured cluster alias and domain detection queries on a master, and
+// registers their results for the master's cluster. Failures are logged and do not fail discovery.
+func detectClusterMetadata(ctx context.Context, db *sql.DB, clusterName string) {
+	if config.Config().DetectClusterAliasQuery != "" {
+		clusterAlias := ""
+		if err := db.QueryRowContext(ctx, config.Config().DetectClusterAliasQuery).Scan(&clusterAlias); err != nil {
+			log.Errore(err)
+		} else if clusterAlias != "" && clusterAlias != getClusterAliasOverride(clusterName) {
+			SetClusterAlias(clusterName, clusterAlias)
+		}
+	}
+	if config.Config().DetectClusterDomainQuery != "" {
+		domainName := ""
+		if err := db.QueryRowContext(ctx, config.Config().DetectClusterDomainQuery).Scan(&domainName); err != nil {
+			log.Errore(err)
+		} else if domainName != "" {
+			SetClusterDomainName(clusterName, domainName)
+		}
+	}
+}
+
 // ReadClusterInfo reads some info about a given cluster
 func ReadClusterInfo(clusterName string) (*ClusterInfo, error) {
 	clusterInfo := &ClusterInfo{}
@@ -710,18 +805,24 @@ func ReadClusterInfo(clusterName string) (*ClusterInfo, error) {
 
 	query := fmt.Sprintf(`
 		select 
-			cluster_name,
-			count(*) as count_instances
+			database_instance.cluster_name,
+			count(*) as count_instances,
+			ifnull(min(cluster_domain_name.domain_name), '') as domain_name,
+			ifnull(min(cluster_alias.owner_team), '') as owner_team
 		from 
 			database_instance 
+			left join cluster_domain_name on (database_instance.cluster_name = cluster_domain_name.cluster_name)
+			left join cluster_alias on (database_instance.cluster_name = cluster_alias.cluster_name)
 		where
-			cluster_name='%s'
+			database_instance.cluster_name='%s'
 		group by
-			cluster_name`, clusterName)
+			database_instance.cluster_name`, clusterName)
 
 	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
 		clusterInfo.ClusterName = m.GetString("cluster_name")
 		clusterInfo.CountInstances = m.GetUint("count_instances")
+		clusterInfo.ClusterDomain = m.GetString("domain_name")
+		clusterInfo.OwnerTeam = m.GetString("owner_team")
 		ApplyClusterAlias(clusterInfo)
 		return nil
 	})
@@ -740,16 +841,22 @@ func ReadClustersInfo() ([]ClusterInfo, error) {
 
 	query := fmt.Sprintf(`
 		select 
-			cluster_name,
-			count(*) as count_instances
+			database_instance.cluster_name,
+			count(*) as count_instances,
+			ifnull(min(cluster_domain_name.domain_name), '') as domain_name,
+			ifnull(min(cluster_alias.owner_team), '') as owner_team
 		from 
 			database_instance 
+			left join cluster_domain_name on (database_instance.cluster_name = cluster_domain_name.cluster_name)
+			left join cluster_alias on (database_instance.cluster_name = cluster_alias.cluster_name)
 		group by
-			cluster_name`)
+			database_instance.cluster_name`)
 
 	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
 		clusterInfo := ClusterInfo{
 			ClusterName:    m.GetString("cluster_name"),
+			ClusterDomain:  m.GetString("domain_name"),
+			OwnerTeam:      m.GetString("owner_team"),
 			CountInstances: m.GetUint("count_instances"),
 		}
 		ApplyClusterAlias(&clusterInfo)
@@ -761,6 +868,107 @@ func ReadClustersInfo() ([]ClusterInfo, error) {
 	return clusters, err
 }
 
+// ReadClusterNameByAlias returns the name of the cluster identified by given hint, which is either a cluster's
+// alias or its name. An alias shared by multiple clusters (e.g. a stale cluster left behind by failover) resolves
+// to the single one among them having a valid writeable master; it is otherwise an error.
+func ReadClusterNameByAlias(clusterHint string) (string, error) {
+	clusters, err := ReadClusters()
+	if err != nil {
+		return "", err
+	}
+	for _, clusterName := range clusters {
+		if clusterName == clusterHint {
+			return clusterName, nil
+		}
+	}
+	aliasedClusters := []string{}
+	for _, clusterName := range clusters {
+		if GetClusterAlias(clusterName) == clusterHint {
+			aliasedClusters = append(aliasedClusters, clusterName)
+		}
+	}
+	switch len(aliasedClusters) {
+	case 0:
+		return "", fmt.Errorf("Unknown cluster: %s", clusterHint)
+	case 1:
+		return aliasedClusters[0], nil
+	}
+	validClusters := []string{}
+	for _, clusterName := range aliasedClusters {
+		if _, err := ReadClusterMaster(clusterName); err == nil {
+			validClusters = append(validClusters, clusterName)
+		}
+	}
+	if len(validClusters) == 1 {
+		return validClusters[0], nil
+	}
+	return "", fmt.Errorf("Ambiguous cluster alias %s, shared by clusters: %s", clusterHint, strings.Join(aliasedClusters, ", "))
+}
+
+// ReadClusterMaster returns the writeable master of given cluster. This is the root of the topology or, with
+// co-masters, whichever of the two is not read-only. Masters whose last check failed are disregarded. It is an
+// error for the cluster to have no such writeable master, or more than one.
+func ReadClusterMaster(clusterName string) (*Instance, error) {
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	candidateKeys := make(map[InstanceKey]bool)
+	for _, root := range NewTopologyTree(instances).Roots {
+		if root.MasterUnreachable && root.CoMaster == nil {
+			// Slave of an unknown master
+			continue
+		}
+		candidateKeys[root.Key] = true
+		if root.CoMaster != nil {
+			candidateKeys[*root.CoMaster] = true
+		}
+	}
+	masters := [](*Instance){}
+	for _, instance := range instances {
+		if candidateKeys[instance.Key] && !instance.ReadOnly && instance.IsLastCheckValid {
+			masters = append(masters, instance)
+		}
+	}
+	if len(masters) == 0 {
+		return nil, fmt.Errorf("No valid writeable master found for cluster %s", clusterName)
+	}
+	if len(masters) > 1 {
+		return nil, fmt.Errorf("Found %d writeable masters for cluster %s", len(masters), clusterName)
+	}
+	return masters[0], nil
+}
+
+// ReadClusterSlaves returns the instances of given cluster other than its writeable master. With
+// non-negative maxLagSeconds, only slaves which are replicating and lag no more than maxLagSeconds are returned.
+// With non nil readOnly, only slaves whose read_only setting equals it are returned.
+func ReadClusterSlaves(clusterName string, maxLagSeconds int64, readOnly *bool) ([](*Instance), error) {
+	master, err := ReadClusterMaster(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	slaves := [](*Instance){}
+	for _, instance := range instances {
+		if instance.Key.Equals(&master.Key) {
+			continue
+		}
+		if maxLagSeconds >= 0 {
+			if !instance.IsLastCheckValid || !instance.SlaveRunning() || !instance.SlaveLagSeconds.Valid || instance.SlaveLagSeconds.Int64 > maxLagSeconds {
+				continue
+			}
+		}
+		if readOnly != nil && instance.ReadOnly != *readOnly {
+			continue
+		}
+		slaves = append(slaves, instance)
+	}
+	return slaves, nil
+}
+
 // ReadOutdatedInstanceKeys reads and returns keys for all instances that are not up to date (i.e.
 // pre-configured time has passed since they were last cheked)
 // But we also check for the case where an attempt at instance checking has been made, that hasn't
@@ -781,7 +989,7 @@ func ReadOutdatedInstanceKeys() ([]InstanceKey, error) {
 				last_checked < now() - interval (%d * 20) second
 			)
 			`,
-		config.Config.InstancePollSeconds, config.Config.InstancePollSeconds)
+		config.Config().InstancePollSeconds, config.Config().InstancePollSeconds)
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		goto Cleanup
@@ -944,7 +1152,11 @@ func writeInstance(instance *Instance, instanceWasActuallyFound bool, lastError
 		}
 		return nil
 	}
-	return ExecDBWriteFunc(writeFunc)
+	err := ExecDBWriteFunc(writeFunc)
+	if err != nil {
+		writeInstanceFailuresCounter.Inc()
+	}
+	return err
 }
 
 // UpdateInstanceLastChecked updates the last_check timestamp in the orchestrator backed database
@@ -1013,7 +1225,7 @@ func UpdateInstanceLastAttemptedCheck(instanceKey *InstanceKey) error {
 
 // ForgetInstance removes an instance entry from the orchestrator backed database.
 // It may be auto-rediscovered through topology or requested for discovery by multiple means.
-func ForgetInstance(instanceKey *InstanceKey) error {
+func ForgetInstance(ctx context.Context, instanceKey *InstanceKey) error {
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		return log.Errore(err)
@@ -1027,7 +1239,7 @@ func ForgetInstance(instanceKey *InstanceKey) error {
 		instanceKey.Hostname,
 		instanceKey.Port,
 	)
-	AuditOperation("forget", instanceKey, "")
+	AuditOperation(ctx, "forget", instanceKey, "")
 	return err
 }
 
@@ -1043,7 +1255,7 @@ func ForgetLongUnseenInstances() error {
 				from database_instance 
 			where 
 				last_seen < NOW() - interval ? hour`,
-		config.Config.UnseenInstanceForgetHours,
+		config.Config().UnseenInstanceForgetHours,
 	)
 	if err != nil {
 		return log.Errore(err)
@@ -1052,13 +1264,13 @@ func ForgetLongUnseenInstances() error {
 	if err != nil {
 		return log.Errore(err)
 	}
-	AuditOperation("forget-unseen", nil, fmt.Sprintf("Forgotten instances: %d", rows))
+	AuditOperation(context.Background(), "forget-unseen", nil, fmt.Sprintf("Forgotten instances: %d", rows))
 	return err
 }
 
 // RefreshTopologyInstance will synchronuously re-read topology instance
-func RefreshTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
-	_, err := ReadTopologyInstance(instanceKey)
+func RefreshTopologyInstance(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	_, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return nil, err
 	}
@@ -1072,7 +1284,7 @@ func RefreshTopologyInstance(instanceKey *InstanceKey) (*Instance, error) {
 }
 
 // RefreshTopologyInstances will do a blocking (though concurrent) refresh of all given instances
-func RefreshTopologyInstances(instances [](*Instance)) {
+func RefreshTopologyInstances(ctx context.Context, instances [](*Instance)) {
 	// use concurrency but wait for all to complete
 	barrier := make(chan InstanceKey)
 	for _, instance := range instances {
@@ -1081,7 +1293,7 @@ func RefreshTopologyInstances(instances [](*Instance)) {
 			// Wait your turn to read a slave
 			ExecuteOnTopology(func() {
 				log.Debugf("... reading instance: %+v", instance.Key)
-				ReadTopologyInstance(&instance.Key)
+				ReadTopologyInstance(ctx, &instance.Key)
 			})
 			// Signal compelted slave
 			barrier <- instance.Key
@@ -1095,19 +1307,19 @@ func RefreshTopologyInstances(instances [](*Instance)) {
 // RefreshInstanceSlaveHosts is a workaround for a bug in MySQL where
 // SHOW SLAVE HOSTS continues to present old, long disconnected slaves.
 // It turns out issuing a couple FLUSH commands mitigates the problem.
-func RefreshInstanceSlaveHosts(instanceKey *InstanceKey) (*Instance, error) {
-	_, _ = ExecInstance(instanceKey, `flush error logs`)
-	_, _ = ExecInstance(instanceKey, `flush error logs`)
+func RefreshInstanceSlaveHosts(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	_, _ = ExecInstance(ctx, instanceKey, `flush error logs`)
+	_, _ = ExecInstance(ctx, instanceKey, `flush error logs`)
 
-	instance, err := ReadTopologyInstance(instanceKey)
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // StopSlaveNicely stops a slave such that SQL_thread and IO_thread are aligned (i.e.
 // SQL_thread consumes all relay log entries)
 // It will actually START the sql_thread even if the slave is completely stopped.
-func StopSlaveNicely(instanceKey *InstanceKey, timeout time.Duration) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func StopSlaveNicely(ctx context.Context, instanceKey *InstanceKey, timeout time.Duration) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
@@ -1116,16 +1328,26 @@ func StopSlaveNicely(instanceKey *InstanceKey, timeout time.Duration) (*Instance
 		return instance, errors.New(fmt.Sprintf("instance is not a slave: %+v", instanceKey))
 	}
 
-	_, err = ExecInstance(instanceKey, `stop slave io_thread`)
-	_, err = ExecInstance(instanceKey, `start slave sql_thread`)
+	_, err = ExecInstance(ctx, instanceKey, `stop slave io_thread`)
+	_, err = ExecInstance(ctx, instanceKey, `start slave sql_thread`)
 
-	startTime := time.Now()
+	if IsDryRun(ctx) {
+		// Nothing was actually stopped; there is nothing to wait for
+		_, err = ExecInstance(ctx, instanceKey, `stop slave`)
+		return instance, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	for upToDate := false; !upToDate; {
-		if timeout > 0 && time.Since(startTime) >= timeout {
-			// timeout
-			return nil, errors.New(fmt.Sprintf("StopSlaveNicely timeout on %+v", *instanceKey))
+		if ctx.Err() != nil {
+			// timeout or cancellation. Leave the slave in a running state
+			ExecInstance(cleanupContext(ctx), instanceKey, `start slave io_thread`)
+			return nil, errors.New(fmt.Sprintf("StopSlaveNicely aborted on %+v: %+v", *instanceKey, ctx.Err()))
 		}
-		instance, err = ReadTopologyInstance(instanceKey)
+		instance, err = ReadTopologyInstance(ctx, instanceKey)
 		if err != nil {
 			return instance, log.Errore(err)
 		}
@@ -1133,27 +1355,27 @@ func StopSlaveNicely(instanceKey *InstanceKey, timeout time.Duration) (*Instance
 		if instance.SQLThreadUpToDate() {
 			upToDate = true
 		} else {
-			time.Sleep(SQLThreadPollDuration)
+			sleepContext(ctx, SQLThreadPollDuration)
 		}
 	}
-	_, err = ExecInstance(instanceKey, `stop slave`)
+	_, err = ExecInstance(ctx, instanceKey, `stop slave`)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // StopSlavesNicely will attemt to stop all given slaves nicely, up to timeout
-func StopSlavesNicely(slaves [](*Instance), timeout time.Duration) {
+func StopSlavesNicely(ctx context.Context, slaves [](*Instance), timeout time.Duration) {
 	// use concurrency but wait for all to complete
 	barrier := make(chan InstanceKey)
 	for _, instance := range slaves {
 		instance := instance
 		go func() {
 			// Wait your turn to read a slave
-			ExecuteOnTopology(func() { StopSlaveNicely(&instance.Key, timeout) })
+			ExecuteOnTopology(func() { StopSlaveNicely(ctx, &instance.Key, timeout) })
 			// Signal compelted slave
 			barrier <- instance.Key
 		}()
@@ -1164,8 +1386,8 @@ func StopSlavesNicely(slaves [](*Instance), timeout time.Duration) {
 }
 
 // StopSlave stops replication on a given instance
-func StopSlave(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func StopSlave(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
@@ -1173,19 +1395,19 @@ func StopSlave(instanceKey *InstanceKey) (*Instance, error) {
 	if !instance.IsSlave() {
 		return instance, errors.New(fmt.Sprintf("instance is not a slave: %+v", instanceKey))
 	}
-	_, err = ExecInstance(instanceKey, `stop slave`)
+	_, err = ExecInstance(ctx, instanceKey, `stop slave`)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 
-	log.Infof("Stopped slave on %+v, Self:%+v, Exec:%+v", *instanceKey, instance.SelfBinlogCoordinates, instance.ExecBinlogCoordinates)
+	logOperationInfof(ctx, "Stopped slave on %+v, Self:%+v, Exec:%+v", *instanceKey, instance.SelfBinlogCoordinates, instance.ExecBinlogCoordinates)
 	return instance, err
 }
 
 // StartSlave starts replication on a given instance
-func StartSlave(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func StartSlave(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
@@ -1194,28 +1416,28 @@ func StartSlave(instanceKey *InstanceKey) (*Instance, error) {
 		return instance, errors.New(fmt.Sprintf("instance is not a slave: %+v", instanceKey))
 	}
 
-	_, err = ExecInstance(instanceKey, `start slave`)
+	_, err = ExecInstance(ctx, instanceKey, `start slave`)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	log.Infof("Started slave on %+v", instanceKey)
-	if config.Config.SlaveStartPostWaitMilliseconds > 0 {
-		time.Sleep(time.Duration(config.Config.SlaveStartPostWaitMilliseconds) * time.Millisecond)
+	logOperationInfof(ctx, "Started slave on %+v", instanceKey)
+	if config.Config().SlaveStartPostWaitMilliseconds > 0 && !IsDryRun(ctx) {
+		sleepContext(ctx, time.Duration(config.Config().SlaveStartPostWaitMilliseconds)*time.Millisecond)
 	}
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // StartSlaves will do concurrent start-slave
-func StartSlaves(slaves [](*Instance)) {
+func StartSlaves(ctx context.Context, slaves [](*Instance)) {
 	// use concurrency but wait for all to complete
 	barrier := make(chan InstanceKey)
 	for _, instance := range slaves {
 		instance := instance
 		go func() {
 			// Wait your turn to read a slave
-			ExecuteOnTopology(func() { StartSlave(&instance.Key) })
+			ExecuteOnTopology(func() { StartSlave(ctx, &instance.Key) })
 			// Signal compelted slave
 			barrier <- instance.Key
 		}()
@@ -1226,8 +1448,8 @@ func StartSlaves(slaves [](*Instance)) {
 }
 
 // StartSlaveUntilMasterCoordinates issuesa START SLAVE UNTIL... statement on given instance
-func StartSlaveUntilMasterCoordinates(instanceKey *InstanceKey, masterCoordinates *BinlogCoordinates) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func StartSlaveUntilMasterCoordinates(ctx context.Context, instanceKey *InstanceKey, masterCoordinates *BinlogCoordinates) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
@@ -1235,27 +1457,35 @@ func StartSlaveUntilMasterCoordinates(instanceKey *InstanceKey, masterCoordinate
 	if !instance.IsSlave() {
 		return instance, errors.New(fmt.Sprintf("instance is not a slave: %+v", instanceKey))
 	}
-	if instance.SlaveRunning() {
+	if instance.SlaveRunning() && !IsDryRun(ctx) {
 		return instance, errors.New(fmt.Sprintf("slave already running: %+v", instanceKey))
 	}
 
-	log.Infof("Will start slave on %+v until coordinates: %+v", instanceKey, masterCoordinates)
+	logOperationInfof(ctx, "Will start slave on %+v until coordinates: %+v", instanceKey, masterCoordinates)
 
-	_, err = ExecInstance(instanceKey, fmt.Sprintf("start slave until master_log_file='%s', master_log_pos=%d",
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf("start slave until master_log_file='%s', master_log_pos=%d",
 		masterCoordinates.LogFile, masterCoordinates.LogPos))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
+	if IsDryRun(ctx) {
+		return StopSlave(ctx, instanceKey)
+	}
 
 	for upToDate := false; !upToDate; {
-		instance, err = ReadTopologyInstance(instanceKey)
+		if ctx.Err() != nil {
+			// Do not leave the slave running with an UNTIL condition
+			ExecInstance(cleanupContext(ctx), instanceKey, `stop slave`)
+			return instance, errors.New(fmt.Sprintf("StartSlaveUntilMasterCoordinates aborted on %+v: %+v", *instanceKey, ctx.Err()))
+		}
+		instance, err = ReadTopologyInstance(ctx, instanceKey)
 		if err != nil {
 			return instance, log.Errore(err)
 		}
 
 		switch {
 		case instance.ExecBinlogCoordinates.SmallerThan(masterCoordinates):
-			time.Sleep(SQLThreadPollDuration)
+			sleepContext(ctx, SQLThreadPollDuration)
 		case instance.ExecBinlogCoordinates.Equals(masterCoordinates):
 			upToDate = true
 		case masterCoordinates.SmallerThan(&instance.ExecBinlogCoordinates):
@@ -1263,7 +1493,7 @@ func StartSlaveUntilMasterCoordinates(instanceKey *InstanceKey, masterCoordinate
 		}
 	}
 
-	instance, err = StopSlave(instanceKey)
+	instance, err = StopSlave(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
@@ -1272,64 +1502,64 @@ func StartSlaveUntilMasterCoordinates(instanceKey *InstanceKey, masterCoordinate
 }
 
 // ChangeMasterTo changes the given instance's master according to given input.
-func ChangeMasterTo(instanceKey *InstanceKey, masterKey *InstanceKey, masterBinlogCoordinates *BinlogCoordinates) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func ChangeMasterTo(ctx context.Context, instanceKey *InstanceKey, masterKey *InstanceKey, masterBinlogCoordinates *BinlogCoordinates) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	if instance.SlaveRunning() {
+	if instance.SlaveRunning() && !IsDryRun(ctx) {
 		return instance, errors.New(fmt.Sprintf("Cannot change master on: %+v because slave is running", instanceKey))
 	}
 
-	_, err = ExecInstance(instanceKey, fmt.Sprintf("change master to master_host='%s', master_port=%d, master_log_file='%s', master_log_pos=%d",
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf("change master to master_host='%s', master_port=%d, master_log_file='%s', master_log_pos=%d",
 		masterKey.Hostname, masterKey.Port, masterBinlogCoordinates.LogFile, masterBinlogCoordinates.LogPos))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	log.Infof("Changed master on %+v to: %+v, %+v", instanceKey, masterKey, masterBinlogCoordinates)
+	logOperationInfof(ctx, "Changed master on %+v to: %+v, %+v", instanceKey, masterKey, masterBinlogCoordinates)
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // ResetSlave resets a slave, breaking the replication
-func ResetSlave(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func ResetSlave(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	if instance.SlaveRunning() {
+	if instance.SlaveRunning() && !IsDryRun(ctx) {
 		return instance, errors.New(fmt.Sprintf("Cannot reset slave on: %+v because slave is running", instanceKey))
 	}
 
 	// MySQL's RESET SLAVE is done correctly; however SHOW SLAVE STATUS still returns old hostnames etc
 	// and only resets till after next restart. This leads to orchestrator still thinking the instance replicates
 	// from old host. We therefore forcibly modify the hostname.
-	_, err = ExecInstance(instanceKey, `change master to master_host='_'`)
+	_, err = ExecInstance(ctx, instanceKey, `change master to master_host='_'`)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	_, err = ExecInstance(instanceKey, `reset slave`)
+	_, err = ExecInstance(ctx, instanceKey, `reset slave`)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	log.Infof("Reset slave %+v", instanceKey)
+	logOperationInfof(ctx, "Reset slave %+v", instanceKey)
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // DetachSlave detaches a slave from replication; forcibly corrupting the binlog coordinates (though in such way
 // that is reversible)
-func DetachSlave(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func DetachSlave(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	if instance.SlaveRunning() {
+	if instance.SlaveRunning() && !IsDryRun(ctx) {
 		return instance, errors.New(fmt.Sprintf("Cannot detach slave on: %+v because slave is running", instanceKey))
 	}
 
@@ -1340,25 +1570,25 @@ func DetachSlave(instanceKey *InstanceKey) (*Instance, error) {
 
 	detachedCoordinates := BinlogCoordinates{LogFile: fmt.Sprintf("//%s:%d", instance.ExecBinlogCoordinates.LogFile, instance.ExecBinlogCoordinates.LogPos), LogPos: instance.ExecBinlogCoordinates.LogPos}
 	// Encode the current coordinates within the log file name, in such way that replication is broken, but info can still be resurrected
-	_, err = ExecInstance(instanceKey, fmt.Sprintf(`change master to master_log_file='%s', master_log_pos=%d`, detachedCoordinates.LogFile, detachedCoordinates.LogPos))
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf(`change master to master_log_file='%s', master_log_pos=%d`, detachedCoordinates.LogFile, detachedCoordinates.LogPos))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	log.Infof("Detach slave %+v", instanceKey)
+	logOperationInfof(ctx, "Detach slave %+v", instanceKey)
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // ReattachSlave restores a detahced slave back into replication
-func ReattachSlave(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func ReattachSlave(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	if instance.SlaveRunning() {
+	if instance.SlaveRunning() && !IsDryRun(ctx) {
 		return instance, errors.New(fmt.Sprintf("Cannot (need not) reattach slave on: %+v because slave is running", instanceKey))
 	}
 
@@ -1367,72 +1597,72 @@ func ReattachSlave(instanceKey *InstanceKey) (*Instance, error) {
 		return instance, errors.New(fmt.Sprintf("Cannot reattach slave on: %+v because slave is not detached", instanceKey))
 	}
 
-	_, err = ExecInstance(instanceKey, fmt.Sprintf(`change master to master_log_file='%s', master_log_pos=%s`, detachedCoordinatesSubmatch[1], detachedCoordinatesSubmatch[2]))
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf(`change master to master_log_file='%s', master_log_pos=%s`, detachedCoordinatesSubmatch[1], detachedCoordinatesSubmatch[2]))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	log.Infof("Reattach slave %+v", instanceKey)
+	logOperationInfof(ctx, "Reattach slave %+v", instanceKey)
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // MasterPosWait issues a MASTER_POS_WAIT() an given instance according to given coordinates.
-func MasterPosWait(instanceKey *InstanceKey, binlogCoordinates *BinlogCoordinates) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MasterPosWait(ctx context.Context, instanceKey *InstanceKey, binlogCoordinates *BinlogCoordinates) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	_, err = ExecInstance(instanceKey, fmt.Sprintf("select master_pos_wait('%s', %d)",
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf("select master_pos_wait('%s', %d)",
 		binlogCoordinates.LogFile, binlogCoordinates.LogPos))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	log.Infof("Instance %+v has reached coordinates: %+v", instanceKey, binlogCoordinates)
+	logOperationInfof(ctx, "Instance %+v has reached coordinates: %+v", instanceKey, binlogCoordinates)
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	return instance, err
 }
 
 // SetReadOnly sets or clears the instance's global read_only variable
-func SetReadOnly(instanceKey *InstanceKey, readOnly bool) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func SetReadOnly(ctx context.Context, instanceKey *InstanceKey, readOnly bool) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	_, err = ExecInstance(instanceKey, fmt.Sprintf("set global read_only = %t", readOnly))
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf("set global read_only = %t", readOnly))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 
-	log.Infof("instance %+v read_only: %t", instanceKey, readOnly)
-	AuditOperation("read-only", instanceKey, fmt.Sprintf("set as %t", readOnly))
+	logOperationInfof(ctx, "instance %+v read_only: %t", instanceKey, readOnly)
+	AuditOperation(ctx, "read-only", instanceKey, fmt.Sprintf("set as %t", readOnly))
 
 	return instance, err
 }
 
 // KillQuery stops replication on a given instance
-func KillQuery(instanceKey *InstanceKey, process int64) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func KillQuery(ctx context.Context, instanceKey *InstanceKey, process int64) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	_, err = ExecInstance(instanceKey, fmt.Sprintf(`kill query %d`, process))
+	_, err = ExecInstance(ctx, instanceKey, fmt.Sprintf(`kill query %d`, process))
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	instance, err = ReadTopologyInstance(instanceKey)
+	instance, err = ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
-	log.Infof("Killed query on %+v", *instanceKey)
-	AuditOperation("kill-query", instanceKey, fmt.Sprintf("Killed query %d", process))
+	logOperationInfof(ctx, "Killed query on %+v", *instanceKey)
+	AuditOperation(ctx, "kill-query", instanceKey, fmt.Sprintf("Killed query %d", process))
 	return instance, err
 }
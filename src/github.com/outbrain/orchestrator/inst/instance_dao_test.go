@@ -1,3 +1,6 @@
+//go:build integration
+// +build integration
+
 /*
    Copyright 2014 Outbrain Inc.
 
@@ -14,9 +17,10 @@
    limitations under the License.
 */
 
-package inst
+package inst_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/db"
@@ -24,15 +28,13 @@ import (
 	"github.com/outbrain/orchestrator/logic"
 	. "gopkg.in/check.v1"
 	"math/rand"
-	"testing"
 	"time"
 )
 
-func Test(t *testing.T) { TestingT(t) }
-
-type TestSuite struct{}
+// DaoTestSuite runs against a MySQL sandbox, as described below. Run it with: go test -tags integration ./inst/
+type DaoTestSuite struct{}
 
-var _ = Suite(&TestSuite{})
+var _ = Suite(&DaoTestSuite{})
 
 // This test suite assumes one master and three direct slaves, as follows;
 // This was setup with mysqlsandbox (using MySQL 5.5.32, not that it matters) via:
@@ -60,33 +62,33 @@ func clearTestMaintenance() {
 }
 
 // The test also assumes one backend MySQL server.
-func (s *TestSuite) SetUpSuite(c *C) {
-	config.Config.MySQLTopologyUser = "msandbox"
-	config.Config.MySQLTopologyPassword = "msandbox"
-	config.Config.MySQLOrchestratorHost = "127.0.0.1"
-	config.Config.MySQLOrchestratorPort = 5532
-	config.Config.MySQLOrchestratorDatabase = "orchestrator"
-	config.Config.MySQLOrchestratorUser = "msandbox"
-	config.Config.MySQLOrchestratorPassword = "msandbox"
-	config.Config.DiscoverByShowSlaveHosts = true
+func (s *DaoTestSuite) SetUpSuite(c *C) {
+	config.Config().MySQLTopologyUser = "msandbox"
+	config.Config().MySQLTopologyPassword = "msandbox"
+	config.Config().MySQLOrchestratorHost = "127.0.0.1"
+	config.Config().MySQLOrchestratorPort = 5532
+	config.Config().MySQLOrchestratorDatabase = "orchestrator"
+	config.Config().MySQLOrchestratorUser = "msandbox"
+	config.Config().MySQLOrchestratorPassword = "msandbox"
+	config.Config().DiscoverByShowSlaveHosts = true
 
 	_, _ = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", masterKey.Hostname, masterKey.Port)
 	_, _ = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", slave1Key.Hostname, slave1Key.Port)
 	_, _ = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", slave2Key.Hostname, slave2Key.Port)
 	_, _ = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", slave3Key.Hostname, slave3Key.Port)
 
-	inst.ExecInstance(&masterKey, "drop database if exists orchestrator_test")
-	inst.ExecInstance(&masterKey, "create database orchestrator_test")
-	inst.ExecInstance(&masterKey, `create table orchestrator_test.test_table(
+	inst.ExecInstance(context.Background(), &masterKey, "drop database if exists orchestrator_test")
+	inst.ExecInstance(context.Background(), &masterKey, "create database orchestrator_test")
+	inst.ExecInstance(context.Background(), &masterKey, `create table orchestrator_test.test_table(
 			name    varchar(128) charset ascii not null primary key,
 			value   varchar(128) charset ascii not null
 		)`)
 	rand.Seed(time.Now().UTC().UnixNano())
 }
 
-func (s *TestSuite) TestReadTopologyMaster(c *C) {
+func (s *DaoTestSuite) TestReadTopologyMaster(c *C) {
 	key := masterKey
-	i, _ := inst.ReadTopologyInstance(&key)
+	i, _ := inst.ReadTopologyInstance(context.Background(), &key)
 
 	c.Assert(i.Key.Hostname, Equals, key.Hostname)
 	c.Assert(i.IsSlave(), Equals, false)
@@ -94,16 +96,16 @@ func (s *TestSuite) TestReadTopologyMaster(c *C) {
 	c.Assert(len(i.SlaveHosts.GetInstanceKeys()), Equals, len(i.SlaveHosts))
 }
 
-func (s *TestSuite) TestReadTopologySlave(c *C) {
+func (s *DaoTestSuite) TestReadTopologySlave(c *C) {
 	key := slave3Key
-	i, _ := inst.ReadTopologyInstance(&key)
+	i, _ := inst.ReadTopologyInstance(context.Background(), &key)
 	c.Assert(i.Key.Hostname, Equals, key.Hostname)
 	c.Assert(i.IsSlave(), Equals, true)
 	c.Assert(len(i.SlaveHosts), Equals, 0)
 }
 
-func (s *TestSuite) TestReadTopologyAndInstanceMaster(c *C) {
-	i, _ := inst.ReadTopologyInstance(&masterKey)
+func (s *DaoTestSuite) TestReadTopologyAndInstanceMaster(c *C) {
+	i, _ := inst.ReadTopologyInstance(context.Background(), &masterKey)
 	iRead, found, _ := inst.ReadInstance(&masterKey)
 	c.Assert(found, Equals, true)
 	c.Assert(iRead.Key.Hostname, Equals, i.Key.Hostname)
@@ -111,87 +113,87 @@ func (s *TestSuite) TestReadTopologyAndInstanceMaster(c *C) {
 	c.Assert(len(iRead.SlaveHosts), Equals, len(i.SlaveHosts))
 }
 
-func (s *TestSuite) TestReadTopologyAndInstanceSlave(c *C) {
-	i, _ := inst.ReadTopologyInstance(&slave1Key)
+func (s *DaoTestSuite) TestReadTopologyAndInstanceSlave(c *C) {
+	i, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	iRead, found, _ := inst.ReadInstance(&slave1Key)
 	c.Assert(found, Equals, true)
 	c.Assert(iRead.Key.Hostname, Equals, i.Key.Hostname)
 	c.Assert(iRead.Version, Equals, i.Version)
 }
 
-func (s *TestSuite) TestGetMasterOfASlave(c *C) {
-	i, err := inst.ReadTopologyInstance(&slave1Key)
+func (s *DaoTestSuite) TestGetMasterOfASlave(c *C) {
+	i, err := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(err, IsNil)
-	master, err := inst.GetInstanceMaster(i)
+	master, err := inst.GetInstanceMaster(context.Background(), i)
 	c.Assert(err, IsNil)
 	c.Assert(master.IsSlave(), Equals, false)
 	c.Assert(master.Key.Port, Equals, 22987)
 }
 
-func (s *TestSuite) TestSlavesAreSiblings(c *C) {
-	i0, _ := inst.ReadTopologyInstance(&slave1Key)
-	i1, _ := inst.ReadTopologyInstance(&slave2Key)
+func (s *DaoTestSuite) TestSlavesAreSiblings(c *C) {
+	i0, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
+	i1, _ := inst.ReadTopologyInstance(context.Background(), &slave2Key)
 	c.Assert(inst.InstancesAreSiblings(i0, i1), Equals, true)
 }
 
-func (s *TestSuite) TestNonSiblings(c *C) {
-	i0, _ := inst.ReadTopologyInstance(&masterKey)
-	i1, _ := inst.ReadTopologyInstance(&slave1Key)
+func (s *DaoTestSuite) TestNonSiblings(c *C) {
+	i0, _ := inst.ReadTopologyInstance(context.Background(), &masterKey)
+	i1, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(inst.InstancesAreSiblings(i0, i1), Not(Equals), true)
 }
 
-func (s *TestSuite) TestInstanceIsMasterOf(c *C) {
-	i0, _ := inst.ReadTopologyInstance(&masterKey)
-	i1, _ := inst.ReadTopologyInstance(&slave1Key)
+func (s *DaoTestSuite) TestInstanceIsMasterOf(c *C) {
+	i0, _ := inst.ReadTopologyInstance(context.Background(), &masterKey)
+	i1, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(inst.InstanceIsMasterOf(i0, i1), Equals, true)
 }
 
-func (s *TestSuite) TestStopStartSlave(c *C) {
+func (s *DaoTestSuite) TestStopStartSlave(c *C) {
 
-	i, _ := inst.ReadTopologyInstance(&slave1Key)
+	i, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(i.SlaveRunning(), Equals, true)
-	i, _ = inst.StopSlaveNicely(&i.Key, 0)
+	i, _ = inst.StopSlaveNicely(context.Background(), &i.Key, 0)
 
 	c.Assert(i.SlaveRunning(), Equals, false)
 	c.Assert(i.SQLThreadUpToDate(), Equals, true)
 
-	i, _ = inst.StartSlave(&i.Key)
+	i, _ = inst.StartSlave(context.Background(), &i.Key)
 	c.Assert(i.SlaveRunning(), Equals, true)
 }
 
-func (s *TestSuite) TestReadTopologyUnexisting(c *C) {
+func (s *DaoTestSuite) TestReadTopologyUnexisting(c *C) {
 	key := inst.InstanceKey{
 		Hostname: "127.0.0.1",
 		Port:     22999,
 	}
-	_, err := inst.ReadTopologyInstance(&key)
+	_, err := inst.ReadTopologyInstance(context.Background(), &key)
 
 	c.Assert(err, Not(IsNil))
 }
 
-func (s *TestSuite) TestMoveBelowAndBack(c *C) {
+func (s *DaoTestSuite) TestMoveBelowAndBack(c *C) {
 	clearTestMaintenance()
 	// become child
-	slave1, err := inst.MoveBelow(&slave1Key, &slave2Key)
+	slave1, err := inst.MoveBelow(context.Background(), &slave1Key, &slave2Key)
 	c.Assert(err, IsNil)
 
 	c.Assert(slave1.MasterKey.Equals(&slave2Key), Equals, true)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
 
 	// And back; keep topology intact
-	slave1, _ = inst.MoveUp(&slave1Key)
-	slave2, _ := inst.ReadTopologyInstance(&slave2Key)
+	slave1, _ = inst.MoveUp(context.Background(), &slave1Key)
+	slave2, _ := inst.ReadTopologyInstance(context.Background(), &slave2Key)
 
 	c.Assert(inst.InstancesAreSiblings(slave1, slave2), Equals, true)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
 
 }
 
-func (s *TestSuite) TestMoveBelowAndBackComplex(c *C) {
+func (s *DaoTestSuite) TestMoveBelowAndBackComplex(c *C) {
 	clearTestMaintenance()
 
 	// become child
-	slave1, _ := inst.MoveBelow(&slave1Key, &slave2Key)
+	slave1, _ := inst.MoveBelow(context.Background(), &slave1Key, &slave2Key)
 
 	c.Assert(slave1.MasterKey.Equals(&slave2Key), Equals, true)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
@@ -199,70 +201,70 @@ func (s *TestSuite) TestMoveBelowAndBackComplex(c *C) {
 	// Now let's have fun. Stop slave2 (which is now parent of slave1), execute queries on master,
 	// move s1 back under master, start all, verify queries.
 
-	_, err := inst.StopSlave(&slave2Key)
+	_, err := inst.StopSlave(context.Background(), &slave2Key)
 	c.Assert(err, IsNil)
 
 	randValue := rand.Int()
-	_, err = inst.ExecInstance(&masterKey, `replace into orchestrator_test.test_table (name, value) values ('TestMoveBelowAndBackComplex', ?)`, randValue)
+	_, err = inst.ExecInstance(context.Background(), &masterKey, `replace into orchestrator_test.test_table (name, value) values ('TestMoveBelowAndBackComplex', ?)`, randValue)
 	c.Assert(err, IsNil)
-	master, err := inst.ReadTopologyInstance(&masterKey)
+	master, err := inst.ReadTopologyInstance(context.Background(), &masterKey)
 	c.Assert(err, IsNil)
 
 	// And back; keep topology intact
-	slave1, err = inst.MoveUp(&slave1Key)
+	slave1, err = inst.MoveUp(context.Background(), &slave1Key)
 	c.Assert(err, IsNil)
-	_, err = inst.MasterPosWait(&slave1Key, &master.SelfBinlogCoordinates)
+	_, err = inst.MasterPosWait(context.Background(), &slave1Key, &master.SelfBinlogCoordinates)
 	c.Assert(err, IsNil)
-	slave2, err := inst.ReadTopologyInstance(&slave2Key)
+	slave2, err := inst.ReadTopologyInstance(context.Background(), &slave2Key)
 	c.Assert(err, IsNil)
-	_, err = inst.MasterPosWait(&slave2Key, &master.SelfBinlogCoordinates)
+	_, err = inst.MasterPosWait(context.Background(), &slave2Key, &master.SelfBinlogCoordinates)
 	c.Assert(err, IsNil)
 	// Now check for value!
 	var value1, value2 int
-	inst.ScanInstanceRow(&slave1Key, `select value from orchestrator_test.test_table where name='TestMoveBelowAndBackComplex'`, &value1)
-	inst.ScanInstanceRow(&slave2Key, `select value from orchestrator_test.test_table where name='TestMoveBelowAndBackComplex'`, &value2)
+	inst.ScanInstanceRow(context.Background(), &slave1Key, `select value from orchestrator_test.test_table where name='TestMoveBelowAndBackComplex'`, &value1)
+	inst.ScanInstanceRow(context.Background(), &slave2Key, `select value from orchestrator_test.test_table where name='TestMoveBelowAndBackComplex'`, &value2)
 
 	c.Assert(inst.InstancesAreSiblings(slave1, slave2), Equals, true)
 	c.Assert(value1, Equals, randValue)
 	c.Assert(value2, Equals, randValue)
 }
 
-func (s *TestSuite) TestFailMoveBelow(c *C) {
+func (s *DaoTestSuite) TestFailMoveBelow(c *C) {
 	clearTestMaintenance()
-	_, _ = inst.ExecInstance(&slave2Key, `set global binlog_format:='ROW'`)
-	_, err := inst.MoveBelow(&slave1Key, &slave2Key)
-	_, _ = inst.ExecInstance(&slave2Key, `set global binlog_format:='STATEMENT'`)
+	_, _ = inst.ExecInstance(context.Background(), &slave2Key, `set global binlog_format:='ROW'`)
+	_, err := inst.MoveBelow(context.Background(), &slave1Key, &slave2Key)
+	_, _ = inst.ExecInstance(context.Background(), &slave2Key, `set global binlog_format:='STATEMENT'`)
 	c.Assert(err, Not(IsNil))
 }
 
-func (s *TestSuite) TestMakeCoMasterAndBack(c *C) {
+func (s *DaoTestSuite) TestMakeCoMasterAndBack(c *C) {
 	clearTestMaintenance()
 
-	slave1, err := inst.MakeCoMaster(&slave1Key)
+	slave1, err := inst.MakeCoMaster(context.Background(), &slave1Key)
 	c.Assert(err, IsNil)
 
 	// Now master & slave1 expected to be co-masters. Check!
-	master, _ := inst.ReadTopologyInstance(&masterKey)
+	master, _ := inst.ReadTopologyInstance(context.Background(), &masterKey)
 	c.Assert(master.IsSlaveOf(slave1), Equals, true)
 	c.Assert(slave1.IsSlaveOf(master), Equals, true)
 
 	// reset - restore to original state
-	master, err = inst.ResetSlaveOperation(&masterKey)
-	slave1, _ = inst.ReadTopologyInstance(&slave1Key)
+	master, err = inst.ResetSlaveOperation(context.Background(), &masterKey)
+	slave1, _ = inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(err, IsNil)
 	c.Assert(master.MasterKey.Hostname, Equals, "_")
 }
 
-func (s *TestSuite) TestFailMakeCoMaster(c *C) {
+func (s *DaoTestSuite) TestFailMakeCoMaster(c *C) {
 	clearTestMaintenance()
-	_, err := inst.MakeCoMaster(&masterKey)
+	_, err := inst.MakeCoMaster(context.Background(), &masterKey)
 	c.Assert(err, Not(IsNil))
 }
 
-func (s *TestSuite) TestMakeCoMasterAndBackAndFailOthersToBecomeCoMasters(c *C) {
+func (s *DaoTestSuite) TestMakeCoMasterAndBackAndFailOthersToBecomeCoMasters(c *C) {
 	clearTestMaintenance()
 
-	slave1, err := inst.MakeCoMaster(&slave1Key)
+	slave1, err := inst.MakeCoMaster(context.Background(), &slave1Key)
 	c.Assert(err, IsNil)
 
 	// Now master & slave1 expected to be co-masters. Check!
@@ -272,20 +274,20 @@ func (s *TestSuite) TestMakeCoMasterAndBackAndFailOthersToBecomeCoMasters(c *C)
 	c.Assert(slave1.IsSlaveOf(master), Equals, true)
 
 	// Verify can't have additional co-masters
-	_, err = inst.MakeCoMaster(&masterKey)
+	_, err = inst.MakeCoMaster(context.Background(), &masterKey)
 	c.Assert(err, Not(IsNil))
-	_, err = inst.MakeCoMaster(&slave1Key)
+	_, err = inst.MakeCoMaster(context.Background(), &slave1Key)
 	c.Assert(err, Not(IsNil))
-	_, err = inst.MakeCoMaster(&slave2Key)
+	_, err = inst.MakeCoMaster(context.Background(), &slave2Key)
 	c.Assert(err, Not(IsNil))
 
 	// reset slave - restore to original state
-	master, err = inst.ResetSlaveOperation(&masterKey)
+	master, err = inst.ResetSlaveOperation(context.Background(), &masterKey)
 	c.Assert(err, IsNil)
 	c.Assert(master.MasterKey.Hostname, Equals, "_")
 }
 
-func (s *TestSuite) TestDiscover(c *C) {
+func (s *DaoTestSuite) TestDiscover(c *C) {
 	var err error
 	_, err = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", masterKey.Hostname, masterKey.Port)
 	_, err = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", slave1Key.Hostname, slave1Key.Port)
@@ -293,103 +295,103 @@ func (s *TestSuite) TestDiscover(c *C) {
 	_, err = db.ExecOrchestrator("delete from database_instance where hostname = ? and port = ?", slave3Key.Hostname, slave3Key.Port)
 	_, found, _ := inst.ReadInstance(&masterKey)
 	c.Assert(found, Equals, false)
-	_, _ = inst.ReadTopologyInstance(&slave1Key)
+	_, _ = inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	orchestrator.StartDiscovery(slave1Key)
 	_, found, err = inst.ReadInstance(&slave1Key)
 	c.Assert(found, Equals, true)
 	c.Assert(err, IsNil)
 }
 
-func (s *TestSuite) TestForgetMaster(c *C) {
-	_, _ = inst.ReadTopologyInstance(&masterKey)
+func (s *DaoTestSuite) TestForgetMaster(c *C) {
+	_, _ = inst.ReadTopologyInstance(context.Background(), &masterKey)
 	_, found, _ := inst.ReadInstance(&masterKey)
 	c.Assert(found, Equals, true)
-	inst.ForgetInstance(&masterKey)
+	inst.ForgetInstance(context.Background(), &masterKey)
 	_, found, _ = inst.ReadInstance(&masterKey)
 	c.Assert(found, Equals, false)
 }
 
-func (s *TestSuite) TestCluster(c *C) {
+func (s *DaoTestSuite) TestCluster(c *C) {
 	inst.ReadInstance(&masterKey)
 	orchestrator.StartDiscovery(slave1Key)
 	instances, _ := inst.ReadClusterInstances(fmt.Sprintf("%s:%d", masterKey.Hostname, masterKey.Port))
 	c.Assert(len(instances) >= 1, Equals, true)
 }
 
-func (s *TestSuite) TestBeginMaintenance(c *C) {
+func (s *DaoTestSuite) TestBeginMaintenance(c *C) {
 	clearTestMaintenance()
-	_, _ = inst.ReadTopologyInstance(&masterKey)
-	_, err := inst.BeginMaintenance(&masterKey, "unittest", "TestBeginMaintenance")
+	_, _ = inst.ReadTopologyInstance(context.Background(), &masterKey)
+	_, err := inst.BeginMaintenance(context.Background(), &masterKey, "unittest", "TestBeginMaintenance")
 
 	c.Assert(err, IsNil)
 }
 
-func (s *TestSuite) TestBeginEndMaintenance(c *C) {
+func (s *DaoTestSuite) TestBeginEndMaintenance(c *C) {
 	clearTestMaintenance()
-	_, _ = inst.ReadTopologyInstance(&masterKey)
-	k, err := inst.BeginMaintenance(&masterKey, "unittest", "TestBeginEndMaintenance")
+	_, _ = inst.ReadTopologyInstance(context.Background(), &masterKey)
+	k, err := inst.BeginMaintenance(context.Background(), &masterKey, "unittest", "TestBeginEndMaintenance")
 	c.Assert(err, IsNil)
-	err = inst.EndMaintenance(k)
+	err = inst.EndMaintenance(context.Background(), k)
 	c.Assert(err, IsNil)
 }
 
-func (s *TestSuite) TestFailBeginMaintenanceTwice(c *C) {
+func (s *DaoTestSuite) TestFailBeginMaintenanceTwice(c *C) {
 	clearTestMaintenance()
-	_, _ = inst.ReadTopologyInstance(&masterKey)
-	_, err := inst.BeginMaintenance(&masterKey, "unittest", "TestFailBeginMaintenanceTwice")
+	_, _ = inst.ReadTopologyInstance(context.Background(), &masterKey)
+	_, err := inst.BeginMaintenance(context.Background(), &masterKey, "unittest", "TestFailBeginMaintenanceTwice")
 	c.Assert(err, IsNil)
-	_, err = inst.BeginMaintenance(&masterKey, "unittest", "TestFailBeginMaintenanceTwice")
+	_, err = inst.BeginMaintenance(context.Background(), &masterKey, "unittest", "TestFailBeginMaintenanceTwice")
 	c.Assert(err, Not(IsNil))
 }
 
-func (s *TestSuite) TestFailEndMaintenanceTwice(c *C) {
+func (s *DaoTestSuite) TestFailEndMaintenanceTwice(c *C) {
 	clearTestMaintenance()
-	_, _ = inst.ReadTopologyInstance(&masterKey)
-	k, err := inst.BeginMaintenance(&masterKey, "unittest", "TestFailEndMaintenanceTwice")
+	_, _ = inst.ReadTopologyInstance(context.Background(), &masterKey)
+	k, err := inst.BeginMaintenance(context.Background(), &masterKey, "unittest", "TestFailEndMaintenanceTwice")
 	c.Assert(err, IsNil)
-	err = inst.EndMaintenance(k)
+	err = inst.EndMaintenance(context.Background(), k)
 	c.Assert(err, IsNil)
-	err = inst.EndMaintenance(k)
+	err = inst.EndMaintenance(context.Background(), k)
 	c.Assert(err, Not(IsNil))
 }
 
-func (s *TestSuite) TestFailMoveBelowUponMaintenance(c *C) {
+func (s *DaoTestSuite) TestFailMoveBelowUponMaintenance(c *C) {
 	clearTestMaintenance()
-	_, _ = inst.ReadTopologyInstance(&slave1Key)
-	k, err := inst.BeginMaintenance(&slave1Key, "unittest", "TestBeginEndMaintenance")
+	_, _ = inst.ReadTopologyInstance(context.Background(), &slave1Key)
+	k, err := inst.BeginMaintenance(context.Background(), &slave1Key, "unittest", "TestBeginEndMaintenance")
 	c.Assert(err, IsNil)
 
-	_, err = inst.MoveBelow(&slave1Key, &slave2Key)
+	_, err = inst.MoveBelow(context.Background(), &slave1Key, &slave2Key)
 	c.Assert(err, Not(IsNil))
 
-	err = inst.EndMaintenance(k)
+	err = inst.EndMaintenance(context.Background(), k)
 	c.Assert(err, IsNil)
 }
 
-func (s *TestSuite) TestFailMoveBelowUponSlaveStopped(c *C) {
+func (s *DaoTestSuite) TestFailMoveBelowUponSlaveStopped(c *C) {
 	clearTestMaintenance()
 
-	slave1, _ := inst.ReadTopologyInstance(&slave1Key)
+	slave1, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
-	slave1, _ = inst.StopSlaveNicely(&slave1.Key, 0)
+	slave1, _ = inst.StopSlaveNicely(context.Background(), &slave1.Key, 0)
 	c.Assert(slave1.SlaveRunning(), Equals, false)
 
-	_, err := inst.MoveBelow(&slave1Key, &slave2Key)
+	_, err := inst.MoveBelow(context.Background(), &slave1Key, &slave2Key)
 	c.Assert(err, Not(IsNil))
 
-	_, _ = inst.StartSlave(&slave1.Key)
+	_, _ = inst.StartSlave(context.Background(), &slave1.Key)
 }
 
-func (s *TestSuite) TestFailMoveBelowUponOtherSlaveStopped(c *C) {
+func (s *DaoTestSuite) TestFailMoveBelowUponOtherSlaveStopped(c *C) {
 	clearTestMaintenance()
 
-	slave1, _ := inst.ReadTopologyInstance(&slave1Key)
+	slave1, _ := inst.ReadTopologyInstance(context.Background(), &slave1Key)
 	c.Assert(slave1.SlaveRunning(), Equals, true)
-	slave1, _ = inst.StopSlaveNicely(&slave1.Key, 0)
+	slave1, _ = inst.StopSlaveNicely(context.Background(), &slave1.Key, 0)
 	c.Assert(slave1.SlaveRunning(), Equals, false)
 
-	_, err := inst.MoveBelow(&slave2Key, &slave1Key)
+	_, err := inst.MoveBelow(context.Background(), &slave2Key, &slave1Key)
 	c.Assert(err, Not(IsNil))
 
-	_, _ = inst.StartSlave(&slave1.Key)
+	_, _ = inst.StartSlave(context.Background(), &slave1.Key)
 }
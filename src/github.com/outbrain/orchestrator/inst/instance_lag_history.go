@@ -0,0 +1,101 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+)
+
+// LagHistorySample is a single point in an instance's replication lag time series
+type LagHistorySample struct {
+	Key                   InstanceKey
+	SampleTimestamp       string
+	ClusterName           string
+	ReadOnly              bool
+	Slave_SQL_Running     bool
+	Slave_IO_Running      bool
+	ExecBinlogCoordinates BinlogCoordinates
+	ExecCoordinatesDelta  sql.NullInt64
+	SecondsBehindMaster   sql.NullInt64
+	SlaveLagSeconds       sql.NullInt64
+	ThreadsRunning        sql.NullInt64
+}
+
+// computeExecCoordinatesDelta fills in, for each sample, the number of relay-master bytes executed since the
+// previous sample of the same instance. The delta is unknown (NULL) on the first sample of an instance and
+// whenever the instance has rotated onto a different master log file in between samples.
+// Samples are expected to be ordered by instance, then by time.
+func computeExecCoordinatesDelta(samples []LagHistorySample) {
+	for i := range samples {
+		samples[i].ExecCoordinatesDelta = sql.NullInt64{}
+		if i == 0 {
+			continue
+		}
+		previous := samples[i-1]
+		if !previous.Key.Equals(&samples[i].Key) {
+			continue
+		}
+		if previous.ExecBinlogCoordinates.LogFile != samples[i].ExecBinlogCoordinates.LogFile {
+			continue
+		}
+		samples[i].ExecCoordinatesDelta = sql.NullInt64{
+			Int64: samples[i].ExecBinlogCoordinates.LogPos - previous.ExecBinlogCoordinates.LogPos,
+			Valid: true,
+		}
+	}
+}
+
+// lagHistorySampleTime identifies a lag history sample by instance and time
+type lagHistorySampleTime struct {
+	Key           InstanceKey
+	UnixTimestamp int64
+}
+
+// lagHistoryTimeRange is a time range [FromUnixTimestamp, UntilUnixTimestamp) of an instance's lag history
+type lagHistoryTimeRange struct {
+	Key                InstanceKey
+	FromUnixTimestamp  int64
+	UntilUnixTimestamp int64
+}
+
+// lagHistoryDownsampleWindow returns the time range [from, until) of complete downsampling buckets which aged
+// past the given cutoff within the last two runIntervalSeconds; twice the interval so that a late run does
+// not skip a bucket. Revisiting a bucket is harmless, as downsampling is idempotent.
+func lagHistoryDownsampleWindow(cutoffUnixTimestamp int64, runIntervalSeconds int64, bucketSeconds int64) (fromUnixTimestamp int64, untilUnixTimestamp int64) {
+	previousCutoffUnixTimestamp := cutoffUnixTimestamp - 2*runIntervalSeconds
+	fromUnixTimestamp = previousCutoffUnixTimestamp - previousCutoffUnixTimestamp%bucketSeconds
+	untilUnixTimestamp = cutoffUnixTimestamp - cutoffUnixTimestamp%bucketSeconds
+	return fromUnixTimestamp, untilUnixTimestamp
+}
+
+// downsampleLagHistory returns the time ranges whose samples are to be discarded such that only the latest
+// sample per instance per bucketSeconds is kept.
+// Samples are expected to be ordered by instance, then by time.
+func downsampleLagHistory(samples []lagHistorySampleTime, bucketSeconds int64) []lagHistoryTimeRange {
+	discarded := []lagHistoryTimeRange{}
+	for i, sample := range samples {
+		bucket := sample.UnixTimestamp - sample.UnixTimestamp%bucketSeconds
+		if i+1 < len(samples) && samples[i+1].Key.Equals(&sample.Key) && samples[i+1].UnixTimestamp < bucket+bucketSeconds {
+			// Not the latest sample in its bucket
+			continue
+		}
+		if i > 0 && samples[i-1].Key.Equals(&sample.Key) && samples[i-1].UnixTimestamp >= bucket {
+			discarded = append(discarded, lagHistoryTimeRange{Key: sample.Key, FromUnixTimestamp: bucket, UntilUnixTimestamp: sample.UnixTimestamp})
+		}
+	}
+	return discarded
+}
@@ -0,0 +1,261 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/db"
+	"strings"
+	"time"
+)
+
+// lagHistoryDeleteBatchSize is the number of discarded time ranges removed by a single delete statement
+const lagHistoryDeleteBatchSize = 100
+
+// WriteLagHistorySample records the current replication state of given instance as a lag history sample.
+// It is expected to be called upon successful read of a topology instance.
+func WriteLagHistorySample(instance *Instance) error {
+	if config.Config().LagHistoryRetentionHours == 0 {
+		return nil
+	}
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			insert ignore into database_instance_lag_history (
+				hostname,
+				port,
+				sample_timestamp,
+				cluster_name,
+				read_only,
+				slave_sql_running,
+				slave_io_running,
+				relay_master_log_file,
+				exec_master_log_pos,
+				seconds_behind_master,
+				slave_lag_seconds,
+				threads_running
+			) values (?, ?, NOW(), ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`,
+			instance.Key.Hostname,
+			instance.Key.Port,
+			instance.ClusterName,
+			instance.ReadOnly,
+			instance.Slave_SQL_Running,
+			instance.Slave_IO_Running,
+			instance.ExecBinlogCoordinates.LogFile,
+			instance.ExecBinlogCoordinates.LogPos,
+			instance.SecondsBehindMaster,
+			instance.SlaveLagSeconds,
+			instance.ThreadsRunning,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// readLagHistory reads lag history samples by given condition, ordered by instance and time
+func readLagHistory(condition string, sinceSeconds uint, args ...interface{}) ([]LagHistorySample, error) {
+	res := []LagHistorySample{}
+	query := fmt.Sprintf(`
+		select 
+			hostname,
+			port,
+			sample_timestamp,
+			cluster_name,
+			read_only,
+			slave_sql_running,
+			slave_io_running,
+			relay_master_log_file,
+			exec_master_log_pos,
+			seconds_behind_master,
+			slave_lag_seconds,
+			threads_running
+		from 
+			database_instance_lag_history
+		where
+			%s
+			and sample_timestamp >= NOW() - interval ? second
+		order by
+			hostname, port, sample_timestamp
+		`, condition)
+	args = append(args, sinceSeconds)
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		goto Cleanup
+	}
+
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		sample := LagHistorySample{}
+		sample.Key.Hostname = m.GetString("hostname")
+		sample.Key.Port = m.GetInt("port")
+		sample.SampleTimestamp = m.GetString("sample_timestamp")
+		sample.ClusterName = m.GetString("cluster_name")
+		sample.ReadOnly = m.GetBool("read_only")
+		sample.Slave_SQL_Running = m.GetBool("slave_sql_running")
+		sample.Slave_IO_Running = m.GetBool("slave_io_running")
+		sample.ExecBinlogCoordinates.LogFile = m.GetString("relay_master_log_file")
+		sample.ExecBinlogCoordinates.LogPos = m.GetInt64("exec_master_log_pos")
+		sample.SecondsBehindMaster = m.GetNullInt64("seconds_behind_master")
+		sample.SlaveLagSeconds = m.GetNullInt64("slave_lag_seconds")
+		sample.ThreadsRunning = m.GetNullInt64("threads_running")
+
+		res = append(res, sample)
+		return nil
+	}, args...)
+Cleanup:
+
+	if err != nil {
+		log.Errore(err)
+	}
+	computeExecCoordinatesDelta(res)
+	return res, err
+}
+
+// ReadInstanceLagHistory returns the lag history of a given instance over the last given number of seconds
+func ReadInstanceLagHistory(instanceKey *InstanceKey, sinceSeconds uint) ([]LagHistorySample, error) {
+	condition := `
+			hostname = ?
+			and port = ?
+		`
+	return readLagHistory(condition, sinceSeconds, instanceKey.Hostname, instanceKey.Port)
+}
+
+// ReadClusterLagHistory returns the lag history of all instances in a given cluster over the last given number of seconds
+func ReadClusterLagHistory(clusterName string, sinceSeconds uint) ([]LagHistorySample, error) {
+	condition := `
+			cluster_name = ?
+		`
+	return readLagHistory(condition, sinceSeconds, clusterName)
+}
+
+// DownsampleLagHistory thins out lag history samples older than LagHistoryDownsampleHours, such that
+// only the latest sample per instance per LagHistoryDownsampleMinutes is kept.
+// It is expected to be called every runInterval, and only visits the buckets which aged past
+// LagHistoryDownsampleHours since the previous call.
+func DownsampleLagHistory(runInterval time.Duration) error {
+	if config.Config().LagHistoryRetentionHours == 0 || config.Config().LagHistoryDownsampleMinutes == 0 {
+		return nil
+	}
+	bucketSeconds := int64(config.Config().LagHistoryDownsampleMinutes * 60)
+	cutoffUnixTimestamp := time.Now().Add(-time.Duration(config.Config().LagHistoryDownsampleHours) * time.Hour).Unix()
+	fromUnixTimestamp, untilUnixTimestamp := lagHistoryDownsampleWindow(cutoffUnixTimestamp, int64(runInterval.Seconds()), bucketSeconds)
+	if fromUnixTimestamp >= untilUnixTimestamp {
+		return nil
+	}
+
+	samples := []lagHistorySampleTime{}
+	query := `
+		select
+			hostname,
+			port,
+			unix_timestamp(sample_timestamp) as sample_unix_timestamp
+		from
+			database_instance_lag_history
+		where
+			sample_timestamp >= from_unixtime(?)
+			and sample_timestamp < from_unixtime(?)
+		order by
+			hostname, port, sample_timestamp
+		`
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		return log.Errore(err)
+	}
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		sample := lagHistorySampleTime{}
+		sample.Key.Hostname = m.GetString("hostname")
+		sample.Key.Port = m.GetInt("port")
+		sample.UnixTimestamp = m.GetInt64("sample_unix_timestamp")
+		samples = append(samples, sample)
+		return nil
+	}, fromUnixTimestamp, untilUnixTimestamp)
+	if err != nil {
+		return log.Errore(err)
+	}
+
+	discarded := downsampleLagHistory(samples, bucketSeconds)
+	for len(discarded) > 0 {
+		batchSize := lagHistoryDeleteBatchSize
+		if batchSize > len(discarded) {
+			batchSize = len(discarded)
+		}
+		batch := discarded[:batchSize]
+		discarded = discarded[batchSize:]
+
+		conditions := []string{}
+		args := []interface{}{}
+		for _, timeRange := range batch {
+			conditions = append(conditions, `(hostname = ? and port = ? and sample_timestamp >= from_unixtime(?) and sample_timestamp < from_unixtime(?))`)
+			args = append(args, timeRange.Key.Hostname, timeRange.Key.Port, timeRange.FromUnixTimestamp, timeRange.UntilUnixTimestamp)
+		}
+		writeFunc := func() error {
+			_, err := sqlutils.Exec(db, fmt.Sprintf(`
+				delete 
+					from database_instance_lag_history
+				where
+					%s
+				`, strings.Join(conditions, " or ")),
+				args...,
+			)
+			if err != nil {
+				return log.Errore(err)
+			}
+			return nil
+		}
+		if err := ExecDBWriteFunc(writeFunc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpireLagHistory removes lag history samples older than LagHistoryRetentionHours
+func ExpireLagHistory() error {
+	if config.Config().LagHistoryRetentionHours == 0 {
+		return nil
+	}
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			delete 
+				from database_instance_lag_history 
+			where 
+				sample_timestamp < NOW() - interval ? hour
+			`,
+			config.Config().LagHistoryRetentionHours,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
@@ -0,0 +1,132 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"database/sql"
+	. "gopkg.in/check.v1"
+)
+
+type LagHistoryTestSuite struct{}
+
+var _ = Suite(&LagHistoryTestSuite{})
+
+func (s *LagHistoryTestSuite) TestComputeExecCoordinatesDelta(c *C) {
+	db1 := InstanceKey{Hostname: "db-1", Port: 3306}
+	db2 := InstanceKey{Hostname: "db-2", Port: 3306}
+	sample := func(key InstanceKey, logFile string, logPos int64) LagHistorySample {
+		return LagHistorySample{Key: key, ExecBinlogCoordinates: BinlogCoordinates{LogFile: logFile, LogPos: logPos}}
+	}
+	unknown := sql.NullInt64{}
+	delta := func(value int64) sql.NullInt64 { return sql.NullInt64{Int64: value, Valid: true} }
+
+	testCases := []struct {
+		description string
+		samples     []LagHistorySample
+		deltas      []sql.NullInt64
+	}{
+		{"empty", []LagHistorySample{}, []sql.NullInt64{}},
+		{"single sample", []LagHistorySample{sample(db1, "mysql-bin.000007", 100)}, []sql.NullInt64{unknown}},
+		{
+			"same binlog",
+			[]LagHistorySample{sample(db1, "mysql-bin.000007", 100), sample(db1, "mysql-bin.000007", 350), sample(db1, "mysql-bin.000007", 350)},
+			[]sql.NullInt64{unknown, delta(250), delta(0)},
+		},
+		{
+			"binlog rotation",
+			[]LagHistorySample{sample(db1, "mysql-bin.000007", 100), sample(db1, "mysql-bin.000008", 4), sample(db1, "mysql-bin.000008", 120)},
+			[]sql.NullInt64{unknown, unknown, delta(116)},
+		},
+		{
+			"multiple instances",
+			[]LagHistorySample{sample(db1, "mysql-bin.000007", 100), sample(db1, "mysql-bin.000007", 200), sample(db2, "mysql-bin.000007", 300), sample(db2, "mysql-bin.000007", 450)},
+			[]sql.NullInt64{unknown, delta(100), unknown, delta(150)},
+		},
+	}
+	for _, testCase := range testCases {
+		computeExecCoordinatesDelta(testCase.samples)
+		for i := range testCase.samples {
+			c.Assert(testCase.samples[i].ExecCoordinatesDelta, Equals, testCase.deltas[i], Commentf("%s, sample %d", testCase.description, i))
+		}
+	}
+}
+
+func (s *LagHistoryTestSuite) TestDownsampleLagHistory(c *C) {
+	db1 := InstanceKey{Hostname: "db-1", Port: 3306}
+	db2 := InstanceKey{Hostname: "db-2", Port: 3306}
+	sample := func(key InstanceKey, unixTimestamp int64) lagHistorySampleTime {
+		return lagHistorySampleTime{Key: key, UnixTimestamp: unixTimestamp}
+	}
+
+	testCases := []struct {
+		description string
+		samples     []lagHistorySampleTime
+		kept        []lagHistorySampleTime
+	}{
+		{"empty", []lagHistorySampleTime{}, []lagHistorySampleTime{}},
+		{
+			"one sample per bucket",
+			[]lagHistorySampleTime{sample(db1, 600), sample(db1, 1200), sample(db1, 1800)},
+			[]lagHistorySampleTime{sample(db1, 600), sample(db1, 1200), sample(db1, 1800)},
+		},
+		{
+			"latest sample per bucket",
+			[]lagHistorySampleTime{sample(db1, 600), sample(db1, 605), sample(db1, 1199), sample(db1, 1200), sample(db1, 1790)},
+			[]lagHistorySampleTime{sample(db1, 1199), sample(db1, 1790)},
+		},
+		{
+			"per instance",
+			[]lagHistorySampleTime{sample(db1, 600), sample(db1, 700), sample(db2, 650), sample(db2, 1250), sample(db2, 1260)},
+			[]lagHistorySampleTime{sample(db1, 700), sample(db2, 650), sample(db2, 1260)},
+		},
+	}
+	for _, testCase := range testCases {
+		discarded := downsampleLagHistory(testCase.samples, 600)
+		kept := []lagHistorySampleTime{}
+		for _, sample := range testCase.samples {
+			isDiscarded := false
+			for _, timeRange := range discarded {
+				if timeRange.Key.Equals(&sample.Key) && sample.UnixTimestamp >= timeRange.FromUnixTimestamp && sample.UnixTimestamp < timeRange.UntilUnixTimestamp {
+					isDiscarded = true
+				}
+			}
+			if !isDiscarded {
+				kept = append(kept, sample)
+			}
+		}
+		c.Assert(kept, DeepEquals, testCase.kept, Commentf(testCase.description))
+	}
+}
+
+func (s *LagHistoryTestSuite) TestLagHistoryDownsampleWindow(c *C) {
+	testCases := []struct {
+		description string
+		cutoff      int64
+		from        int64
+		until       int64
+	}{
+		{"within a bucket", 6300, 6000, 6000},
+		{"bucket just completed", 6610, 6000, 6600},
+		{"late run", 6710, 6000, 6600},
+		{"long after", 7130, 6600, 6600},
+	}
+	for _, testCase := range testCases {
+		from, until := lagHistoryDownsampleWindow(testCase.cutoff, 60, 600)
+		c.Assert(from, Equals, testCase.from, Commentf(testCase.description))
+		c.Assert(until, Equals, testCase.until, Commentf(testCase.description))
+	}
+}
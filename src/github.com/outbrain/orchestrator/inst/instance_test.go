@@ -14,17 +14,19 @@
    limitations under the License.
 */
 
-package inst
+package inst_test
 
 import (
+	"context"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/inst"
 	. "gopkg.in/check.v1"
+	"strings"
 	"testing"
 )
 
 func init() {
-	config.Config.HostnameResolveMethod = "none"
+	config.Config().HostnameResolveMethod = "none"
 }
 
 func Test(t *testing.T) { TestingT(t) }
@@ -176,3 +178,164 @@ func (s *TestSuite) TestParseInstanceKey(c *C) {
 	c.Assert(i.Hostname, Equals, "127.0.0.1")
 	c.Assert(i.Port, Equals, 3306)
 }
+
+func (s *TestSuite) TestDryRunExecInstance(c *C) {
+	ctx, plan := inst.NewDryRunContext(context.Background())
+	c.Assert(inst.IsDryRun(ctx), Equals, true)
+	c.Assert(inst.IsDryRun(context.Background()), Equals, false)
+
+	instanceKey := inst.InstanceKey{Hostname: "sql00.db", Port: 3306}
+	res, err := inst.ExecInstance(ctx, &instanceKey, `change master to 
+		master_log_file='mysql-bin.000012', master_log_pos=4`)
+	c.Assert(err, IsNil)
+	c.Assert(res, IsNil)
+	c.Assert(len(plan.Statements), Equals, 1)
+	c.Assert(plan.Statements[0].InstanceKey, Equals, instanceKey)
+	c.Assert(plan.Statements[0].Statement, Equals, "change master to master_log_file='mysql-bin.000012', master_log_pos=4")
+	c.Assert(plan.HumanReadableDescription(), Equals, "sql00.db:3306: change master to master_log_file='mysql-bin.000012', master_log_pos=4")
+}
+
+func (s *TestSuite) TestRoleOnCluster(c *C) {
+	role, err := inst.ParseRole("Operator")
+	c.Assert(err, IsNil)
+	c.Assert(role, Equals, inst.OperatorRole)
+	_, err = inst.ParseRole("superuser")
+	c.Assert(err, Not(IsNil))
+
+	permissions := &inst.Permissions{
+		Role:         inst.ViewerRole,
+		ClusterRoles: map[string]inst.Role{"app1": inst.OperatorRole, "db-b:3306": inst.AdminRole},
+	}
+	config.Config().ClusterNameToAlias = map[string]string{"^db-a": "app1"}
+	c.Assert(permissions.RoleOnCluster("db-a:3306"), Equals, inst.OperatorRole)
+	c.Assert(permissions.RoleOnCluster("db-b:3306"), Equals, inst.AdminRole)
+	c.Assert(permissions.RoleOnCluster("db-c:3306"), Equals, inst.ViewerRole)
+	c.Assert(permissions.RoleOnCluster(""), Equals, inst.ViewerRole)
+
+	permissions.CapAt(inst.ViewerRole)
+	c.Assert(permissions.RoleOnCluster("db-b:3306"), Equals, inst.ViewerRole)
+}
+
+func (s *TestSuite) TestAPITokenScopes(c *C) {
+	scopes, err := inst.ParseScopes("read-only, maintenance")
+	c.Assert(err, IsNil)
+	c.Assert(scopes, DeepEquals, []string{"read-only", "maintenance"})
+	_, err = inst.ParseScopes("read-only,everything")
+	c.Assert(err, Not(IsNil))
+	_, err = inst.ParseScopes("")
+	c.Assert(err, Not(IsNil))
+
+	token := &inst.APIToken{TokenName: "deploy", Scopes: []string{inst.ReadOnlyScope}}
+	c.Assert(token.Role(), Equals, inst.ViewerRole)
+	token.Scopes = append(token.Scopes, inst.MaintenanceScope)
+	c.Assert(token.Role(), Equals, inst.OperatorRole)
+
+	permissions, err := inst.ReadAPITokenPermissions(token)
+	c.Assert(err, IsNil)
+	c.Assert(permissions.Role, Equals, inst.OperatorRole)
+	c.Assert(permissions.HasScope(inst.MaintenanceScope), Equals, true)
+	c.Assert(permissions.HasScope(inst.TopologyChangesScope), Equals, false)
+	c.Assert((&inst.Permissions{}).HasScope(inst.TopologyChangesScope), Equals, true)
+}
+
+func (s *TestSuite) TestTopologyTree(c *C) {
+	newInstance := func(hostname string, masterHostname string) *inst.Instance {
+		instance := inst.NewInstance()
+		instance.Key = inst.InstanceKey{Hostname: hostname, Port: 3306}
+		if masterHostname != "" {
+			instance.MasterKey = inst.InstanceKey{Hostname: masterHostname, Port: 3306}
+			instance.ReadBinlogCoordinates.LogFile = "mysql-bin.000001"
+		}
+		return instance
+	}
+	instances := [](*inst.Instance){
+		newInstance("db-s1", "db-m"),
+		newInstance("db-m", ""),
+		newInstance("db-orphan", "db-gone"),
+		newInstance("db-b", "db-a"),
+		newInstance("db-a", "db-b"),
+		newInstance("db-c", "db-a"),
+	}
+	for _, instance := range instances {
+		// db-m failed its last check
+		instance.IsLastCheckValid = (instance.Key.Hostname != "db-m")
+	}
+	tree := inst.NewTopologyTree(instances)
+	c.Assert(tree.Roots, HasLen, 3)
+
+	c.Assert(tree.Roots[0].Key.Hostname, Equals, "db-m")
+	c.Assert(tree.Roots[0].MasterUnreachable, Equals, false)
+	c.Assert(tree.Roots[0].Slaves, HasLen, 1)
+	c.Assert(tree.Roots[0].Slaves[0].MasterUnreachable, Equals, true)
+	c.Assert(tree.Roots[1].Key.Hostname, Equals, "db-orphan")
+	c.Assert(tree.Roots[1].MasterUnreachable, Equals, true)
+	// co-masters: rooted at db-a, with db-b and db-c below it
+	c.Assert(tree.Roots[2].Key.Hostname, Equals, "db-a")
+	c.Assert(tree.Roots[2].CoMaster.Hostname, Equals, "db-b")
+	c.Assert(tree.Roots[2].MasterUnreachable, Equals, false)
+	c.Assert(tree.Roots[2].Slaves, HasLen, 2)
+	c.Assert(tree.Roots[2].Slaves[1].MasterUnreachable, Equals, false)
+	c.Assert(tree.Roots[2].Slaves[0].Slaves, HasLen, 0)
+
+	dot, err := tree.Export("test", inst.DOTFormat)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(dot, `"db-b:3306" -> "db-a:3306" [label="stopped", style=dashed];`), Equals, true)
+	c.Assert(strings.Contains(dot, `"db-m:3306" -> "db-s1:3306"`), Equals, true)
+
+	mermaid, err := tree.Export("test", inst.MermaidFormat)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(mermaid, "n64622d6d3a33333036 -->|stopped| n64622d73313a33333036"), Equals, true)
+
+	// db-1 and db_1 must not share a node id
+	collisionTree := inst.NewTopologyTree([](*inst.Instance){newInstance("db-1", ""), newInstance("db_1", "")})
+	mermaid, err = collisionTree.Export("test", inst.MermaidFormat)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(mermaid, `n64622d313a33333036["db-1:3306`), Equals, true)
+	c.Assert(strings.Contains(mermaid, `n64625f313a33333036["db_1:3306`), Equals, true)
+
+	_, err = tree.Export("test", "svg")
+	c.Assert(err, NotNil)
+}
+
+func (s *TestSuite) TestTopologyTreeAscii(c *C) {
+	newInstance := func(hostname string, masterHostname string) *inst.Instance {
+		instance := inst.NewInstance()
+		instance.Key = inst.InstanceKey{Hostname: hostname, Port: 3306}
+		if masterHostname != "" {
+			instance.MasterKey = inst.InstanceKey{Hostname: masterHostname, Port: 3306}
+			instance.ReadBinlogCoordinates.LogFile = "mysql-bin.000001"
+		}
+		return instance
+	}
+	instances := [](*inst.Instance){
+		newInstance("db-m", ""),
+		newInstance("db-s1", "db-m"),
+		newInstance("db-s2", "db-s1"),
+		newInstance("db-b", "db-a"),
+		newInstance("db-a", "db-b"),
+		newInstance("db-c", "db-a"),
+		newInstance("db-d", "db-b"),
+	}
+	instances[1].UsingPseudoGTID = true
+	tree := inst.NewTopologyTree(instances)
+	tree.SetMaintenance([]inst.Maintenance{{Key: instances[1].Key, Owner: "ops", Reason: "upgrade"}})
+
+	lines := strings.Split(tree.Ascii(), "\n")
+	c.Assert(lines, HasLen, 6)
+	c.Assert(strings.HasPrefix(lines[0], "db-m:3306 "), Equals, true)
+	c.Assert(strings.HasPrefix(lines[1], "- db-s1:3306 "), Equals, true)
+	c.Assert(strings.HasSuffix(lines[1], " gtid:pseudo [maintenance: ops, upgrade]"), Equals, true)
+	c.Assert(strings.HasPrefix(lines[2], "  - db-s2:3306 "), Equals, true)
+	// co-masters side by side, followed by the slaves of each
+	c.Assert(strings.HasPrefix(lines[3], "db-a:3306 "), Equals, true)
+	c.Assert(strings.Contains(lines[3], " <-> db-b:3306 "), Equals, true)
+	c.Assert(strings.HasPrefix(lines[4], "- db-c:3306 "), Equals, true)
+	c.Assert(strings.HasPrefix(lines[5], "- db-d:3306 "), Equals, true)
+	c.Assert(strings.HasSuffix(lines[5], " (of db-b:3306)"), Equals, true)
+
+	subtree := tree.Subtree(&instances[1].Key)
+	c.Assert(subtree, NotNil)
+	c.Assert(subtree.Keys(), HasLen, 2)
+	c.Assert(strings.Split(subtree.Ascii(), "\n"), HasLen, 2)
+	c.Assert(tree.Subtree(&inst.InstanceKey{Hostname: "db-none", Port: 3306}), IsNil)
+}
@@ -17,12 +17,11 @@
 package inst
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/orchestrator/config"
 	"sort"
-	"strings"
 	"time"
 )
 
@@ -40,28 +39,8 @@ func (this InstancesByExecBinlogCoordinates) Less(i, j int) bool {
 	return this[i].ExecBinlogCoordinates.SmallerThan(&this[j].ExecBinlogCoordinates)
 }
 
-// getAsciiTopologyEntry will get an ascii topology tree rooted at given instance. Ir recursively
-// draws the tree
-func getAsciiTopologyEntry(depth int, instance *Instance, replicationMap map[*Instance]([]*Instance)) []string {
-	prefix := ""
-	if depth > 0 {
-		prefix = strings.Repeat(" ", (depth-1)*2)
-		if instance.SlaveRunning() {
-			prefix += "+ "
-		} else {
-			prefix += "- "
-		}
-	}
-	entry := fmt.Sprintf("%s%s %s", prefix, instance.Key.DisplayString(), instance.HumanReadableDescription())
-	result := []string{entry}
-	for _, slave := range replicationMap[instance] {
-		slavesResult := getAsciiTopologyEntry(depth+1, slave, replicationMap)
-		result = append(result, slavesResult...)
-	}
-	return result
-}
-
-// AsciiTopology returns a string representation of the topology of given instance.
+// AsciiTopology returns a string representation of the topology of given instance's cluster, annotated
+// with active maintenance.
 func AsciiTopology(instanceKey *InstanceKey) (string, error) {
 	instance, found, err := ReadInstance(instanceKey)
 	if err != nil || !found {
@@ -71,39 +50,19 @@ func AsciiTopology(instanceKey *InstanceKey) (string, error) {
 	if err != nil {
 		return "", err
 	}
-
-	instancesMap := make(map[InstanceKey](*Instance))
-	for _, instance := range instances {
-		log.Debugf("instanceKey: %+v", instance.Key)
-		instancesMap[instance.Key] = instance
-	}
-
-	replicationMap := make(map[*Instance]([]*Instance))
-	var masterInstance *Instance
-	// Investigate slaves:
-	for _, instance := range instances {
-		master, ok := instancesMap[instance.MasterKey]
-		if ok {
-			if _, ok := replicationMap[master]; !ok {
-				replicationMap[master] = [](*Instance){}
-			}
-			replicationMap[master] = append(replicationMap[master], instance)
-		} else {
-			masterInstance = instance
-		}
-	}
-	if masterInstance == nil {
-		return "", nil
+	maintenance, err := ReadActiveMaintenance()
+	if err != nil {
+		return "", err
 	}
-	resultArray := getAsciiTopologyEntry(0, masterInstance, replicationMap)
-	result := strings.Join(resultArray, "\n")
-	return result, nil
+	tree := NewTopologyTree(instances)
+	tree.SetMaintenance(maintenance)
+	return tree.Ascii(), nil
 }
 
 // GetInstanceMaster synchronously reaches into the replication topology
 // and retrieves master's data
-func GetInstanceMaster(instance *Instance) (*Instance, error) {
-	master, err := ReadTopologyInstance(&instance.MasterKey)
+func GetInstanceMaster(ctx context.Context, instance *Instance) (*Instance, error) {
+	master, err := ReadTopologyInstance(ctx, &instance.MasterKey)
 	return master, err
 }
 
@@ -137,74 +96,74 @@ func InstanceIsMasterOf(instance0, instance1 *Instance) bool {
 // MoveUp will attempt moving instance indicated by instanceKey up the topology hierarchy.
 // It will perform all safety and sanity checks and will tamper with this instance's replication
 // as well as its master.
-func MoveUp(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MoveUp(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
 	if !instance.IsSlave() {
-		return instance, errors.New(fmt.Sprintf("instance is not a slave: %+v", instanceKey))
+		return instance, newPreconditionError("instance is not a slave: %+v", instanceKey)
 	}
 	rinstance, _, _ := ReadInstance(&instance.Key)
 	if canMove, merr := rinstance.CanMove(); !canMove {
 		return instance, merr
 	}
-	master, err := GetInstanceMaster(instance)
+	master, err := GetInstanceMaster(ctx, instance)
 	if err != nil {
 		return instance, log.Errorf("Cannot GetInstanceMaster() for %+v. error=%+v", instance, err)
 	}
 
 	if !master.IsSlave() {
-		return instance, errors.New(fmt.Sprintf("master is not a slave itself: %+v", master.Key))
+		return instance, newPreconditionError("master is not a slave itself: %+v", master.Key)
 	}
 
 	if canReplicate, err := instance.CanReplicateFrom(master); canReplicate == false {
 		return instance, err
 	}
 
-	log.Infof("Will move %+v up the topology", *instanceKey)
+	logOperationInfof(ctx, "Will move %+v up the topology", *instanceKey)
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), "move up"); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), "move up"); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
-	if maintenanceToken, merr := BeginMaintenance(&master.Key, GetMaintenanceOwner(), fmt.Sprintf("child %+v moves up", *instanceKey)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", master.Key))
+	if maintenanceToken, merr := BeginMaintenance(ctx, &master.Key, GetMaintenanceOwner(), fmt.Sprintf("child %+v moves up", *instanceKey)); merr != nil {
+		err = beginMaintenanceError(merr, master.Key)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
-	master, err = StopSlave(&master.Key)
+	master, err = StopSlave(ctx, &master.Key)
 	if err != nil {
 		goto Cleanup
 	}
 
-	instance, err = StopSlave(instanceKey)
+	instance, err = StopSlave(ctx, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
 
-	instance, err = StartSlaveUntilMasterCoordinates(instanceKey, &master.SelfBinlogCoordinates)
+	instance, err = StartSlaveUntilMasterCoordinates(ctx, instanceKey, &master.SelfBinlogCoordinates)
 	if err != nil {
 		goto Cleanup
 	}
 
-	instance, err = ChangeMasterTo(instanceKey, &master.MasterKey, &master.ExecBinlogCoordinates)
+	instance, err = ChangeMasterTo(ctx, instanceKey, &master.MasterKey, &master.ExecBinlogCoordinates)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	instance, _ = StartSlave(instanceKey)
-	master, _ = StartSlave(&master.Key)
+	instance, _ = StartSlave(cleanupContext(ctx), instanceKey)
+	master, _ = StartSlave(cleanupContext(ctx), &master.Key)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 	// and we're done (pending deferred functions)
-	AuditOperation("move-up", instanceKey, fmt.Sprintf("moved up %+v. Previous master: %+v", *instanceKey, master.Key))
+	AuditOperation(ctx, "move-up", instanceKey, fmt.Sprintf("moved up %+v. Previous master: %+v", *instanceKey, master.Key))
 
 	return instance, err
 }
@@ -212,12 +171,12 @@ Cleanup:
 // MoveBelow will attempt moving instance indicated by instanceKey below its supposed sibling indicated by sinblingKey.
 // It will perform all safety and sanity checks and will tamper with this instance's replication
 // as well as its sibling.
-func MoveBelow(instanceKey, siblingKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MoveBelow(ctx context.Context, instanceKey, siblingKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
-	sibling, err := ReadTopologyInstance(siblingKey)
+	sibling, err := ReadTopologyInstance(ctx, siblingKey)
 	if err != nil {
 		return instance, err
 	}
@@ -231,75 +190,75 @@ func MoveBelow(instanceKey, siblingKey *InstanceKey) (*Instance, error) {
 		return instance, merr
 	}
 	if !InstancesAreSiblings(instance, sibling) {
-		return instance, errors.New(fmt.Sprintf("instances are not siblings: %+v, %+v", *instanceKey, *siblingKey))
+		return instance, newPreconditionError("instances are not siblings: %+v, %+v", *instanceKey, *siblingKey)
 	}
 
 	if canReplicate, err := instance.CanReplicateFrom(sibling); !canReplicate {
 		return instance, err
 	}
-	log.Infof("Will move %+v below its sibling %+v", instanceKey, siblingKey)
+	logOperationInfof(ctx, "Will move %+v below its sibling %+v", instanceKey, siblingKey)
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), fmt.Sprintf("move below %+v", *siblingKey)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), fmt.Sprintf("move below %+v", *siblingKey)); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
-	if maintenanceToken, merr := BeginMaintenance(siblingKey, GetMaintenanceOwner(), fmt.Sprintf("%+v moves below this", *instanceKey)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *siblingKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, siblingKey, GetMaintenanceOwner(), fmt.Sprintf("%+v moves below this", *instanceKey)); merr != nil {
+		err = beginMaintenanceError(merr, *siblingKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
-	instance, err = StopSlave(instanceKey)
+	instance, err = StopSlave(ctx, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
 
-	sibling, err = StopSlave(siblingKey)
+	sibling, err = StopSlave(ctx, siblingKey)
 	if err != nil {
 		goto Cleanup
 	}
 
 	if instance.ExecBinlogCoordinates.SmallerThan(&sibling.ExecBinlogCoordinates) {
-		instance, err = StartSlaveUntilMasterCoordinates(instanceKey, &sibling.ExecBinlogCoordinates)
+		instance, err = StartSlaveUntilMasterCoordinates(ctx, instanceKey, &sibling.ExecBinlogCoordinates)
 		if err != nil {
 			goto Cleanup
 		}
 	} else if sibling.ExecBinlogCoordinates.SmallerThan(&instance.ExecBinlogCoordinates) {
-		sibling, err = StartSlaveUntilMasterCoordinates(siblingKey, &instance.ExecBinlogCoordinates)
+		sibling, err = StartSlaveUntilMasterCoordinates(ctx, siblingKey, &instance.ExecBinlogCoordinates)
 		if err != nil {
 			goto Cleanup
 		}
 	}
 	// At this point both siblings have executed exact same statements and are identical
 
-	instance, err = ChangeMasterTo(instanceKey, &sibling.Key, &sibling.SelfBinlogCoordinates)
+	instance, err = ChangeMasterTo(ctx, instanceKey, &sibling.Key, &sibling.SelfBinlogCoordinates)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	instance, _ = StartSlave(instanceKey)
-	sibling, _ = StartSlave(siblingKey)
+	instance, _ = StartSlave(cleanupContext(ctx), instanceKey)
+	sibling, _ = StartSlave(cleanupContext(ctx), siblingKey)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 	// and we're done (pending deferred functions)
-	AuditOperation("move-below", instanceKey, fmt.Sprintf("moved %+v below %+v", *instanceKey, *siblingKey))
+	AuditOperation(ctx, "move-below", instanceKey, fmt.Sprintf("moved %+v below %+v", *instanceKey, *siblingKey))
 
 	return instance, err
 }
 
 // MakeCoMaster will attempt to make an instance co-master with its master, by making its master a slave of its own.
 // This only works out if the master is not replicating; the master does not have a known master (it may have an unknown master).
-func MakeCoMaster(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MakeCoMaster(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
-	master, err := GetInstanceMaster(instance)
+	master, err := GetInstanceMaster(ctx, instance)
 	if err != nil {
 		return instance, err
 	}
@@ -314,173 +273,179 @@ func MakeCoMaster(instanceKey *InstanceKey) (*Instance, error) {
 	}
 
 	if instanceKey.Equals(&master.MasterKey) {
-		return instance, errors.New(fmt.Sprintf("instance  %+v is already co master of %+v", instanceKey, master.Key))
+		return instance, newPreconditionError("instance  %+v is already co master of %+v", instanceKey, master.Key)
 	}
 	if _, found, _ := ReadInstance(&master.MasterKey); found {
-		return instance, errors.New(fmt.Sprintf("master %+v already has known master: %+v", master.Key, master.MasterKey))
+		return instance, newPreconditionError("master %+v already has known master: %+v", master.Key, master.MasterKey)
 	}
 	if canReplicate, err := master.CanReplicateFrom(instance); !canReplicate {
 		return instance, err
 	}
-	log.Infof("Will make %+v co-master of %+v", instanceKey, master.Key)
+	logOperationInfof(ctx, "Will make %+v co-master of %+v", instanceKey, master.Key)
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), fmt.Sprintf("make co-master of %+v", master.Key)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), fmt.Sprintf("make co-master of %+v", master.Key)); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
-	if maintenanceToken, merr := BeginMaintenance(&master.Key, GetMaintenanceOwner(), fmt.Sprintf("%+v turns into co-master of this", *instanceKey)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", master.Key))
+	if maintenanceToken, merr := BeginMaintenance(ctx, &master.Key, GetMaintenanceOwner(), fmt.Sprintf("%+v turns into co-master of this", *instanceKey)); merr != nil {
+		err = beginMaintenanceError(merr, master.Key)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
 	// the coMaster used to be merely a slave. Just point master into *some* position
 	// within coMaster...
-	master, err = ChangeMasterTo(&master.Key, instanceKey, &instance.SelfBinlogCoordinates)
+	master, err = ChangeMasterTo(ctx, &master.Key, instanceKey, &instance.SelfBinlogCoordinates)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	master, _ = StartSlave(&master.Key)
+	master, _ = StartSlave(cleanupContext(ctx), &master.Key)
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 	// and we're done (pending deferred functions)
-	AuditOperation("make-co-master", instanceKey, fmt.Sprintf("%+v made co-master of %+v", *instanceKey, master.Key))
+	AuditOperation(ctx, "make-co-master", instanceKey, fmt.Sprintf("%+v made co-master of %+v", *instanceKey, master.Key))
+	if !IsDryRun(ctx) {
+		// The writeable master may now be either of the co-masters
+		if perr := PublishClusterMaster(master.ClusterName); perr != nil {
+			log.Errore(perr)
+		}
+	}
 
 	return instance, err
 }
 
 // ResetSlaveOperation will reset a slave
-func ResetSlaveOperation(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func ResetSlaveOperation(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
 
-	log.Infof("Will reset %+v", instanceKey)
+	logOperationInfof(ctx, "Will reset %+v", instanceKey)
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), "reset slave"); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), "reset slave"); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
 	if instance.IsSlave() {
-		instance, err = StopSlave(instanceKey)
+		instance, err = StopSlave(ctx, instanceKey)
 		if err != nil {
 			goto Cleanup
 		}
 	}
 
-	instance, err = ResetSlave(instanceKey)
+	instance, err = ResetSlave(ctx, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	instance, _ = StartSlave(instanceKey)
+	instance, _ = StartSlave(cleanupContext(ctx), instanceKey)
 
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
 	// and we're done (pending deferred functions)
-	AuditOperation("reset slave", instanceKey, fmt.Sprintf("%+v replication reset", *instanceKey))
+	AuditOperation(ctx, "reset slave", instanceKey, fmt.Sprintf("%+v replication reset", *instanceKey))
 
 	return instance, err
 }
 
 // DetachSlaveOperation will detach a slave from its master by forcibly corrupting its replication coordinates
-func DetachSlaveOperation(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func DetachSlaveOperation(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
 
-	log.Infof("Will detach %+v", instanceKey)
+	logOperationInfof(ctx, "Will detach %+v", instanceKey)
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), "detach slave"); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), "detach slave"); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
 	if instance.IsSlave() {
-		instance, err = StopSlave(instanceKey)
+		instance, err = StopSlave(ctx, instanceKey)
 		if err != nil {
 			goto Cleanup
 		}
 	}
 
-	instance, err = DetachSlave(instanceKey)
+	instance, err = DetachSlave(ctx, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	instance, _ = StartSlave(instanceKey)
+	instance, _ = StartSlave(cleanupContext(ctx), instanceKey)
 
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
 	// and we're done (pending deferred functions)
-	AuditOperation("detach slave", instanceKey, fmt.Sprintf("%+v replication detached", *instanceKey))
+	AuditOperation(ctx, "detach slave", instanceKey, fmt.Sprintf("%+v replication detached", *instanceKey))
 
 	return instance, err
 }
 
 // ReattachSlaveOperation will detach a slave from its master by forcibly corrupting its replication coordinates
-func ReattachSlaveOperation(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func ReattachSlaveOperation(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
 
-	log.Infof("Will reattach %+v", instanceKey)
+	logOperationInfof(ctx, "Will reattach %+v", instanceKey)
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), "detach slave"); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), "detach slave"); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
 	if instance.IsSlave() {
-		instance, err = StopSlave(instanceKey)
+		instance, err = StopSlave(ctx, instanceKey)
 		if err != nil {
 			goto Cleanup
 		}
 	}
 
-	instance, err = ReattachSlave(instanceKey)
+	instance, err = ReattachSlave(ctx, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	instance, _ = StartSlave(instanceKey)
+	instance, _ = StartSlave(cleanupContext(ctx), instanceKey)
 
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 
 	// and we're done (pending deferred functions)
-	AuditOperation("reattach slave", instanceKey, fmt.Sprintf("%+v replication reattached", *instanceKey))
+	AuditOperation(ctx, "reattach slave", instanceKey, fmt.Sprintf("%+v replication reattached", *instanceKey))
 
 	return instance, err
 }
 
 // FindLastPseudoGTIDEntry will search an instance's binary logs or relay logs for the last pseudo-GTID entry,
 // and return found coordinates as well as entry text
-func FindLastPseudoGTIDEntry(instance *Instance, recordedInstanceRelayLogCoordinates BinlogCoordinates, exhaustiveSearch bool) (*BinlogCoordinates, string, error) {
+func FindLastPseudoGTIDEntry(ctx context.Context, instance *Instance, recordedInstanceRelayLogCoordinates BinlogCoordinates, exhaustiveSearch bool) (*BinlogCoordinates, string, error) {
 	var instancePseudoGtidText string
 	var instancePseudoGtidCoordinates *BinlogCoordinates
 	var err error = nil
@@ -492,13 +457,13 @@ func FindLastPseudoGTIDEntry(instance *Instance, recordedInstanceRelayLogCoordin
 		// The approach is not to take chances. If log-slave-updates is disabled, fail and go for relay-logs.
 		// If log-slave-updates was just enabled then possibly no pseudo-gtid is found, and so again we will go
 		// for relay logs.
-		instancePseudoGtidCoordinates, instancePseudoGtidText, err = getLastPseudoGTIDEntryInInstance(instance, exhaustiveSearch)
+		instancePseudoGtidCoordinates, instancePseudoGtidText, err = getLastPseudoGTIDEntryInInstance(ctx, instance, exhaustiveSearch)
 	}
 	if err != nil || instancePseudoGtidCoordinates == nil {
 		// Unable to find pseudo GTID in binary logs.
 		// Then MAYBE we are lucky enough (chances are we are, if this slave did not crash) that we can
 		// extract the Pseudo GTID entry from the last (current) relay log file.
-		instancePseudoGtidCoordinates, instancePseudoGtidText, err = getLastPseudoGTIDEntryInRelayLogs(instance, recordedInstanceRelayLogCoordinates, exhaustiveSearch)
+		instancePseudoGtidCoordinates, instancePseudoGtidText, err = getLastPseudoGTIDEntryInRelayLogs(ctx, instance, recordedInstanceRelayLogCoordinates, exhaustiveSearch)
 	}
 	return instancePseudoGtidCoordinates, instancePseudoGtidText, err
 }
@@ -508,15 +473,15 @@ func FindLastPseudoGTIDEntry(instance *Instance, recordedInstanceRelayLogCoordin
 // The "other instance" could be the sibling of the moving instance any of its ancestors. It may actuall be
 // a cousin of some sort (though unlikely). The only important thing is that the "other instance" is more
 // advanced in replication than given instance.
-func MatchBelow(instanceKey, otherKey *InstanceKey, requireInstanceMaintenance bool, requireOtherMaintenance bool) (*Instance, *BinlogCoordinates, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MatchBelow(ctx context.Context, instanceKey, otherKey *InstanceKey, requireInstanceMaintenance bool, requireOtherMaintenance bool) (*Instance, *BinlogCoordinates, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, nil, err
 	}
 	if instanceKey.Equals(otherKey) {
-		return instance, nil, errors.New(fmt.Sprintf("MatchBelow: attempt to match an instance below itself %+v", *instanceKey))
+		return instance, nil, newPreconditionError("MatchBelow: attempt to match an instance below itself %+v", *instanceKey)
 	}
-	otherInstance, err := ReadTopologyInstance(otherKey)
+	otherInstance, err := ReadTopologyInstance(ctx, otherKey)
 	if err != nil {
 		return instance, nil, err
 	}
@@ -529,7 +494,7 @@ func MatchBelow(instanceKey, otherKey *InstanceKey, requireInstanceMaintenance b
 	if canReplicate, err := instance.CanReplicateFrom(otherInstance); !canReplicate {
 		return instance, nil, err
 	}
-	log.Infof("Will match %+v below %+v", *instanceKey, *otherKey)
+	logOperationInfof(ctx, "Will match %+v below %+v", *instanceKey, *otherKey)
 
 	var instancePseudoGtidText string
 	var instancePseudoGtidCoordinates *BinlogCoordinates
@@ -537,25 +502,25 @@ func MatchBelow(instanceKey, otherKey *InstanceKey, requireInstanceMaintenance b
 	var nextBinlogCoordinatesToMatch *BinlogCoordinates
 	var recordedInstanceRelayLogCoordinates BinlogCoordinates
 
-	if requireInstanceMaintenance {
-		if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), fmt.Sprintf("match below %+v", *otherKey)); merr != nil {
-			err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if requireInstanceMaintenance && !IsDryRun(ctx) {
+		if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), fmt.Sprintf("match below %+v", *otherKey)); merr != nil {
+			err = beginMaintenanceError(merr, *instanceKey)
 			goto Cleanup
 		} else {
-			defer EndMaintenance(maintenanceToken)
+			defer EndMaintenance(ctx, maintenanceToken)
 		}
 	}
-	if requireOtherMaintenance {
-		if maintenanceToken, merr := BeginMaintenance(otherKey, GetMaintenanceOwner(), fmt.Sprintf("%+v matches below this", *instanceKey)); merr != nil {
-			err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *otherKey))
+	if requireOtherMaintenance && !IsDryRun(ctx) {
+		if maintenanceToken, merr := BeginMaintenance(ctx, otherKey, GetMaintenanceOwner(), fmt.Sprintf("%+v matches below this", *instanceKey)); merr != nil {
+			err = beginMaintenanceError(merr, *otherKey)
 			goto Cleanup
 		} else {
-			defer EndMaintenance(maintenanceToken)
+			defer EndMaintenance(ctx, maintenanceToken)
 		}
 	}
 
-	log.Debugf("Stopping slave on %+v", *instanceKey)
-	instance, err = StopSlave(instanceKey)
+	logOperationDebugf(ctx, "Stopping slave on %+v", *instanceKey)
+	instance, err = StopSlave(ctx, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
@@ -563,12 +528,12 @@ func MatchBelow(instanceKey, otherKey *InstanceKey, requireInstanceMaintenance b
 	// a FLUSH LOGS/FLUSH RELAY LOGS (or a START SLAVE, though that's an altogether different problem) etc.
 	// We want to be on the safe side; we don't utterly trust that we are the only ones playing with the instance.
 	recordedInstanceRelayLogCoordinates = instance.RelaylogCoordinates
-	instancePseudoGtidCoordinates, instancePseudoGtidText, err = FindLastPseudoGTIDEntry(instance, recordedInstanceRelayLogCoordinates, true)
+	instancePseudoGtidCoordinates, instancePseudoGtidText, err = FindLastPseudoGTIDEntry(ctx, instance, recordedInstanceRelayLogCoordinates, true)
 
 	if err != nil {
 		goto Cleanup
 	}
-	otherInstancePseudoGtidCoordinates, err = SearchPseudoGTIDEntryInInstance(otherInstance, instancePseudoGtidText)
+	otherInstancePseudoGtidCoordinates, err = SearchPseudoGTIDEntryInInstance(ctx, otherInstance, instancePseudoGtidText)
 	if err != nil {
 		goto Cleanup
 	}
@@ -586,33 +551,35 @@ func MatchBelow(instanceKey, otherKey *InstanceKey, requireInstanceMaintenance b
 	// - good result: the first position within otherInstance where instance has not replicated yet. It is easy to point
 	//   instance into otherInstance.
 
-	nextBinlogCoordinatesToMatch, err = GetNextBinlogCoordinatesToMatch(instance, *instancePseudoGtidCoordinates,
+	nextBinlogCoordinatesToMatch, err = GetNextBinlogCoordinatesToMatch(ctx, instance, *instancePseudoGtidCoordinates,
 		recordedInstanceRelayLogCoordinates, otherInstance, *otherInstancePseudoGtidCoordinates)
 	if err != nil {
 		goto Cleanup
 	}
-	log.Debugf("%+v will match below %+v at %+v", *instanceKey, *otherKey, *nextBinlogCoordinatesToMatch)
+	logOperationDebugf(ctx, "%+v will match below %+v at %+v", *instanceKey, *otherKey, *nextBinlogCoordinatesToMatch)
 
 	// Drum roll......
-	instance, err = ChangeMasterTo(instanceKey, otherKey, nextBinlogCoordinatesToMatch)
+	instance, err = ChangeMasterTo(ctx, instanceKey, otherKey, nextBinlogCoordinatesToMatch)
 	if err != nil {
 		goto Cleanup
 	}
 
 Cleanup:
-	instance, _ = StartSlave(instanceKey)
+	instance, _ = StartSlave(cleanupContext(ctx), instanceKey)
 	if err != nil {
 		return instance, nextBinlogCoordinatesToMatch, log.Errore(err)
 	}
 	// and we're done (pending deferred functions)
-	AuditOperation("match-below", instanceKey, fmt.Sprintf("matched %+v below %+v", *instanceKey, *otherKey))
+	if !IsDryRun(ctx) {
+		AuditOperation(ctx, "match-below", instanceKey, fmt.Sprintf("matched %+v below %+v", *instanceKey, *otherKey))
+	}
 
 	return instance, nextBinlogCoordinatesToMatch, err
 }
 
 // RematchSlave will re-match a slave to its master, using pseudo-gtid
-func RematchSlave(instanceKey *InstanceKey, requireInstanceMaintenance bool, requireOtherMaintenance bool) (*Instance, *BinlogCoordinates, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func RematchSlave(ctx context.Context, instanceKey *InstanceKey, requireInstanceMaintenance bool, requireOtherMaintenance bool) (*Instance, *BinlogCoordinates, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, nil, err
 	}
@@ -620,28 +587,28 @@ func RematchSlave(instanceKey *InstanceKey, requireInstanceMaintenance bool, req
 	if err != nil || !found {
 		return instance, nil, err
 	}
-	return MatchBelow(instanceKey, &masterInstance.Key, requireInstanceMaintenance, requireOtherMaintenance)
+	return MatchBelow(ctx, instanceKey, &masterInstance.Key, requireInstanceMaintenance, requireOtherMaintenance)
 }
 
 // MakeMaster will take an instance, make all its siblings its slaves (via pseudo-GTID) and make it master
 // (stop its replicaiton, make writeable).
-func MakeMaster(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MakeMaster(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
-	masterInstance, err := ReadTopologyInstance(&instance.MasterKey)
+	masterInstance, err := ReadTopologyInstance(ctx, &instance.MasterKey)
 	if err != nil {
 		if masterInstance.IsSlave() {
-			return instance, errors.New(fmt.Sprintf("MakeMaster: instance's master %+v seems to be replicating", masterInstance.Key))
+			return instance, newPreconditionError("MakeMaster: instance's master %+v seems to be replicating", masterInstance.Key)
 		}
 		if masterInstance.IsLastCheckValid {
-			return instance, errors.New(fmt.Sprintf("MakeMaster: instance's master %+v seems to be accessible", masterInstance.Key))
+			return instance, newPreconditionError("MakeMaster: instance's master %+v seems to be accessible", masterInstance.Key)
 		}
 	}
 	// If err == nil this is "good": that means the master is inaccessible... So it's OK to do the promotion
 	if !instance.SQLThreadUpToDate() {
-		return instance, errors.New(fmt.Sprintf("MakeMaster: instance's SQL thread must be up-to-date with I/O thread for %+v", *instanceKey))
+		return instance, newPreconditionError("MakeMaster: instance's SQL thread must be up-to-date with I/O thread for %+v", *instanceKey)
 	}
 	siblings, err := ReadSlaveInstances(&masterInstance.Key)
 	if err != nil {
@@ -649,38 +616,39 @@ func MakeMaster(instanceKey *InstanceKey) (*Instance, error) {
 	}
 	for _, sibling := range siblings {
 		if instance.ExecBinlogCoordinates.SmallerThan(&sibling.ExecBinlogCoordinates) {
-			return instance, errors.New(fmt.Sprintf("MakeMaster: instance %+v has more advanced sibling: %+v", *instanceKey, sibling.Key))
+			return instance, newPreconditionError("MakeMaster: instance %+v has more advanced sibling: %+v", *instanceKey, sibling.Key)
 		}
 	}
 
-	if maintenanceToken, merr := BeginMaintenance(instanceKey, GetMaintenanceOwner(), fmt.Sprintf("siblings match below this", *instanceKey)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", *instanceKey))
+	if maintenanceToken, merr := BeginMaintenance(ctx, instanceKey, GetMaintenanceOwner(), fmt.Sprintf("siblings match below this", *instanceKey)); merr != nil {
+		err = beginMaintenanceError(merr, *instanceKey)
 		goto Cleanup
 	} else {
-		defer EndMaintenance(maintenanceToken)
+		defer EndMaintenance(ctx, maintenanceToken)
 	}
 
-	_, _, err = MultiMatchBelow(siblings, instanceKey)
+	_, _, err = MultiMatchBelow(ctx, siblings, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
 
-	SetReadOnly(instanceKey, false)
+	SetReadOnly(ctx, instanceKey, false)
 
 Cleanup:
 	if err != nil {
 		return instance, log.Errore(err)
 	}
 	// and we're done (pending deferred functions)
-	AuditOperation("make-master", instanceKey, fmt.Sprintf("made master of %+v", *instanceKey))
+	AuditOperation(ctx, "make-master", instanceKey, fmt.Sprintf("made master of %+v", *instanceKey))
+	publishPromotedMaster(ctx, instance)
 
 	return instance, err
 }
 
 // EnslaveSiblingsSimple is a convenience method for turning sublings of a slave to be its subordinates.
 // This uses normal connected replication (does not utilize Pseudo-GTID)
-func EnslaveSiblingsSimple(instanceKey *InstanceKey) (*Instance, int, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func EnslaveSiblingsSimple(ctx context.Context, instanceKey *InstanceKey) (*Instance, int, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, 0, err
 	}
@@ -694,7 +662,7 @@ func EnslaveSiblingsSimple(instanceKey *InstanceKey) (*Instance, int, error) {
 	}
 	enslavedSiblings := 0
 	for _, sibling := range siblings {
-		if _, err := MoveBelow(&sibling.Key, &instance.Key); err == nil {
+		if _, err := MoveBelow(ctx, &sibling.Key, &instance.Key); err == nil {
 			enslavedSiblings++
 		}
 	}
@@ -706,8 +674,8 @@ func EnslaveSiblingsSimple(instanceKey *InstanceKey) (*Instance, int, error) {
 // This serves as a convenience method to recover replication when a local master fails; the instance promoted is one of its slaves,
 // which is most advanced among its siblings.
 // This method utilizes Pseudo GTID
-func MakeLocalMaster(instanceKey *InstanceKey) (*Instance, error) {
-	instance, err := ReadTopologyInstance(instanceKey)
+func MakeLocalMaster(ctx context.Context, instanceKey *InstanceKey) (*Instance, error) {
+	instance, err := ReadTopologyInstance(ctx, instanceKey)
 	if err != nil {
 		return instance, err
 	}
@@ -715,7 +683,7 @@ func MakeLocalMaster(instanceKey *InstanceKey) (*Instance, error) {
 	if err != nil || !found {
 		return instance, err
 	}
-	grandparentInstance, err := ReadTopologyInstance(&masterInstance.MasterKey)
+	grandparentInstance, err := ReadTopologyInstance(ctx, &masterInstance.MasterKey)
 	if err != nil {
 		return instance, err
 	}
@@ -725,21 +693,21 @@ func MakeLocalMaster(instanceKey *InstanceKey) (*Instance, error) {
 	}
 	for _, sibling := range siblings {
 		if instance.ExecBinlogCoordinates.SmallerThan(&sibling.ExecBinlogCoordinates) {
-			return instance, errors.New(fmt.Sprintf("MakeMaster: instance %+v has more advanced sibling: %+v", *instanceKey, sibling.Key))
+			return instance, newPreconditionError("MakeMaster: instance %+v has more advanced sibling: %+v", *instanceKey, sibling.Key)
 		}
 	}
 
-	instance, err = StopSlaveNicely(instanceKey, 0)
+	instance, err = StopSlaveNicely(ctx, instanceKey, 0)
 	if err != nil {
 		goto Cleanup
 	}
 
-	_, _, err = MatchBelow(instanceKey, &grandparentInstance.Key, true, true)
+	_, _, err = MatchBelow(ctx, instanceKey, &grandparentInstance.Key, true, true)
 	if err != nil {
 		goto Cleanup
 	}
 
-	_, _, err = MultiMatchBelow(siblings, instanceKey)
+	_, _, err = MultiMatchBelow(ctx, siblings, instanceKey)
 	if err != nil {
 		goto Cleanup
 	}
@@ -749,14 +717,14 @@ Cleanup:
 		return instance, log.Errore(err)
 	}
 	// and we're done (pending deferred functions)
-	AuditOperation("make-local-master", instanceKey, fmt.Sprintf("made master of %+v", *instanceKey))
+	AuditOperation(ctx, "make-local-master", instanceKey, fmt.Sprintf("made master of %+v", *instanceKey))
 
 	return instance, err
 }
 
 // sortedSlaves returns the list of slaves of a given master, sorted by exec coordinates
 // (most up-to-date slave first)
-func sortedSlaves(masterKey *InstanceKey, forceRefresh bool, resumeReplication bool) ([](*Instance), error) {
+func sortedSlaves(ctx context.Context, masterKey *InstanceKey, forceRefresh bool, resumeReplication bool) ([](*Instance), error) {
 	slaves, err := ReadSlaveInstances(masterKey)
 	if err != nil {
 		return slaves, err
@@ -765,11 +733,11 @@ func sortedSlaves(masterKey *InstanceKey, forceRefresh bool, resumeReplication b
 		return slaves, nil
 	}
 	if forceRefresh {
-		StopSlavesNicely(slaves, time.Duration(config.Config.InstanceBulkOperationsWaitTimeoutSeconds)*time.Second)
+		StopSlavesNicely(ctx, slaves, time.Duration(config.Config().InstanceBulkOperationsWaitTimeoutSeconds)*time.Second)
 	}
 	sort.Sort(sort.Reverse(InstancesByExecBinlogCoordinates(slaves)))
 	if forceRefresh && resumeReplication {
-		StartSlaves(slaves)
+		StartSlaves(cleanupContext(ctx), slaves)
 	}
 
 	return slaves, err
@@ -787,12 +755,12 @@ func removeInstance(instances [](*Instance), instanceKey *InstanceKey) [](*Insta
 
 // MultiMatchBelow will efficiently match multiple slaves below a given instance.
 // It is assumed that all given slaves are siblings
-func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance), *Instance, error) {
+func MultiMatchBelow(ctx context.Context, slaves [](*Instance), belowKey *InstanceKey) ([](*Instance), *Instance, error) {
 	res := [](*Instance){}
 
 	slaves = removeInstance(slaves, belowKey)
 
-	belowInstance, err := ReadTopologyInstance(belowKey)
+	belowInstance, err := ReadTopologyInstance(ctx, belowKey)
 	if err != nil {
 		// Can't access the server below which we need to match ==> can't move slaves
 		return res, belowInstance, err
@@ -802,10 +770,10 @@ func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance)
 	if len(slaves) == 0 {
 		return res, belowInstance, nil
 	}
-	log.Debugf("MultiMatchBelow: stopping nicely %d slaves", len(slaves))
+	logOperationDebugf(ctx, "MultiMatchBelow: stopping nicely %d slaves", len(slaves))
 	// We want the slaves to have SQL thread up to date with IO thread.
 	// We will wait for them (up to a timeout) to do so.
-	StopSlavesNicely(slaves, time.Duration(config.Config.InstanceBulkOperationsWaitTimeoutSeconds)*time.Second)
+	StopSlavesNicely(ctx, slaves, time.Duration(config.Config().InstanceBulkOperationsWaitTimeoutSeconds)*time.Second)
 	sort.Sort(sort.Reverse(InstancesByExecBinlogCoordinates(slaves)))
 
 	// Optimizations:
@@ -818,20 +786,31 @@ func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance)
 		slave := slave
 		slaveBuckets[slave.ExecBinlogCoordinates] = append(slaveBuckets[slave.ExecBinlogCoordinates], slave)
 	}
-	log.Debugf("MultiMatchBelow: %d slaves merged into %d buckets", len(slaves), len(slaveBuckets))
+	logOperationDebugf(ctx, "MultiMatchBelow: %d slaves merged into %d buckets", len(slaves), len(slaveBuckets))
 	for bucket, bucketSlaves := range slaveBuckets {
-		log.Debugf("+- bucket: %+v, %d slaves", bucket, len(bucketSlaves))
+		logOperationDebugf(ctx, "+- bucket: %+v, %d slaves", bucket, len(bucketSlaves))
+	}
+	if plan := planFromContext(ctx); plan != nil {
+		plannedBuckets := make(map[BinlogCoordinates]bool)
+		for _, slave := range slaves {
+			if !plannedBuckets[slave.ExecBinlogCoordinates] {
+				plannedBuckets[slave.ExecBinlogCoordinates] = true
+				plan.addBucket(slave.ExecBinlogCoordinates, slaveBuckets[slave.ExecBinlogCoordinates])
+			}
+		}
 	}
 	matchedSlaves := make(map[InstanceKey]bool)
 	barrier := make(chan *BinlogCoordinates)
 	// Now go over the buckets, and try a single slave from each bucket
 	// (though if one results with an error, synchronuously-for-that-bucket continue to the next slave in bucket)
 
-	if maintenanceToken, merr := BeginMaintenance(&belowInstance.Key, GetMaintenanceOwner(), fmt.Sprintf("slaves multi match below this: %+v", belowInstance.Key)); merr != nil {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance on %+v", belowInstance.Key))
-		return res, belowInstance, err
-	} else {
-		defer EndMaintenance(maintenanceToken)
+	if !IsDryRun(ctx) {
+		if maintenanceToken, merr := BeginMaintenance(ctx, &belowInstance.Key, GetMaintenanceOwner(), fmt.Sprintf("slaves multi match below this: %+v", belowInstance.Key)); merr != nil {
+			err = beginMaintenanceError(merr, belowInstance.Key)
+			return res, belowInstance, err
+		} else {
+			defer EndMaintenance(ctx, maintenanceToken)
+		}
 	}
 
 	for execCoordinates, bucketSlaves := range slaveBuckets {
@@ -842,18 +821,25 @@ func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance)
 			func() {
 				for _, slave := range bucketSlaves {
 					slave := slave
+					if ctx.Err() != nil {
+						// Operation aborted; no point in trying further slaves in this bucket
+						return
+					}
 					var matchedCoordinates *BinlogCoordinates
-					log.Debugf("MultiMatchBelow: attempting slave %+v in bucket %+v", slave.Key, execCoordinates)
+					logOperationDebugf(ctx, "MultiMatchBelow: attempting slave %+v in bucket %+v", slave.Key, execCoordinates)
 					ExecuteOnTopology(func() {
-						_, matchedCoordinates, err = MatchBelow(&slave.Key, &belowInstance.Key, true, false)
+						_, matchedCoordinates, err = MatchBelow(ctx, &slave.Key, &belowInstance.Key, true, false)
 					})
-					log.Debugf("MultiMatchBelow: match result: %+v, %+v", matchedCoordinates, err)
+					logOperationDebugf(ctx, "MultiMatchBelow: match result: %+v, %+v", matchedCoordinates, err)
 
 					if err == nil {
 						// Success! We matched a slave of this bucket
 						knownCoordinatesMap[execCoordinates] = matchedCoordinates
 						matchedSlaves[slave.Key] = true
-						log.Debugf("MultiMatchBelow: matched slave %+v in bucket %+v", slave.Key, execCoordinates)
+						if plan := planFromContext(ctx); plan != nil {
+							plan.setBucketMatch(execCoordinates, matchedCoordinates)
+						}
+						logOperationDebugf(ctx, "MultiMatchBelow: matched slave %+v in bucket %+v", slave.Key, execCoordinates)
 						return
 					}
 					log.Errore(err)
@@ -869,6 +855,10 @@ func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance)
 	// Now that we've handled the representative slaves-per-bucket, let's go over all other slaves
 	for _, slave := range slaves {
 		slave := slave
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
 		if _, found := matchedSlaves[slave.Key]; found {
 			// Already matched this slave
 			continue
@@ -882,9 +872,9 @@ func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance)
 			log.Errorf("MultiMatchBelow: found nil matchedCoordinates in bucket %+v", slave.ExecBinlogCoordinates)
 			continue
 		}
-		log.Debugf("MultiMatchBelow: Will match up %+v to previously matched master coordinates %+v", slave.Key, matchedCoordinates)
-		if _, err := ChangeMasterTo(&slave.Key, &belowInstance.Key, matchedCoordinates); err == nil {
-			StartSlave(&slave.Key)
+		logOperationDebugf(ctx, "MultiMatchBelow: Will match up %+v to previously matched master coordinates %+v", slave.Key, matchedCoordinates)
+		if _, err := ChangeMasterTo(ctx, &slave.Key, &belowInstance.Key, matchedCoordinates); err == nil {
+			StartSlave(cleanupContext(ctx), &slave.Key)
 			matchedSlaves[slave.Key] = true
 		} else {
 			log.Errorf("MultiMatchBelow: Cannot match up %+v: error is %+v", slave.Key, err)
@@ -903,10 +893,10 @@ func MultiMatchBelow(slaves [](*Instance), belowKey *InstanceKey) ([](*Instance)
 }
 
 // MultiMatchSlaves will match (via pseudo-gtid) all slaves of given master below given instance.
-func MultiMatchSlaves(masterKey *InstanceKey, belowKey *InstanceKey) ([](*Instance), *Instance, error) {
+func MultiMatchSlaves(ctx context.Context, masterKey *InstanceKey, belowKey *InstanceKey) ([](*Instance), *Instance, error) {
 	res := [](*Instance){}
 
-	belowInstance, err := ReadTopologyInstance(belowKey)
+	belowInstance, err := ReadTopologyInstance(ctx, belowKey)
 	if err != nil {
 		// Can't access "below" ==> can't match slaves beneath it
 		return res, nil, err
@@ -917,34 +907,34 @@ func MultiMatchSlaves(masterKey *InstanceKey, belowKey *InstanceKey) ([](*Instan
 	if err != nil {
 		return res, belowInstance, err
 	}
-	return MultiMatchBelow(slaves, &belowInstance.Key)
+	return MultiMatchBelow(ctx, slaves, &belowInstance.Key)
 }
 
 // MatchUpSlaves will move all slaves of given master up the replication chain,
 // so that they become siblings of their master.
 // This should be called when the local master dies, and all its slaves are to be resurrected via Pseudo-GTID
-func MatchUpSlaves(masterKey *InstanceKey) ([](*Instance), *Instance, error) {
+func MatchUpSlaves(ctx context.Context, masterKey *InstanceKey) ([](*Instance), *Instance, error) {
 	res := [](*Instance){}
 
 	masterInstance, found, err := ReadInstance(masterKey)
 	if err != nil || !found {
 		return res, nil, err
 	}
-	return MultiMatchSlaves(masterKey, &masterInstance.MasterKey)
+	return MultiMatchSlaves(ctx, masterKey, &masterInstance.MasterKey)
 }
 
 // GetCandidateSlave chooses the best slave to promote given a (possibly dead) master
-func GetCandidateSlave(masterKey *InstanceKey, forceRefresh bool, resumeReplication bool) (*Instance, [](*Instance), [](*Instance), [](*Instance), error) {
+func GetCandidateSlave(ctx context.Context, masterKey *InstanceKey, forceRefresh bool, resumeReplication bool) (*Instance, [](*Instance), [](*Instance), [](*Instance), error) {
 	var candidateSlave *Instance = nil
 	aheadSlaves := [](*Instance){}
 	equalSlaves := [](*Instance){}
 	laterSlaves := [](*Instance){}
-	slaves, err := sortedSlaves(masterKey, forceRefresh, resumeReplication)
+	slaves, err := sortedSlaves(ctx, masterKey, forceRefresh, resumeReplication)
 	if err != nil {
 		return candidateSlave, aheadSlaves, equalSlaves, laterSlaves, err
 	}
 	if len(slaves) == 0 {
-		return candidateSlave, aheadSlaves, equalSlaves, laterSlaves, errors.New(fmt.Sprintf("No slaves found for %+v", *masterKey))
+		return candidateSlave, aheadSlaves, equalSlaves, laterSlaves, newPreconditionError("No slaves found for %+v", *masterKey)
 	}
 	for _, slave := range slaves {
 		slave := slave
@@ -955,7 +945,7 @@ func GetCandidateSlave(masterKey *InstanceKey, forceRefresh bool, resumeReplicat
 		}
 	}
 	if candidateSlave == nil {
-		return candidateSlave, aheadSlaves, equalSlaves, laterSlaves, errors.New(fmt.Sprintf("No slaves found with log_slave_updates for %+v", *masterKey))
+		return candidateSlave, aheadSlaves, equalSlaves, laterSlaves, newPreconditionError("No slaves found with log_slave_updates for %+v", *masterKey)
 	}
 	slaves = removeInstance(slaves, &candidateSlave.Key)
 	for _, slave := range slaves {
@@ -968,14 +958,17 @@ func GetCandidateSlave(masterKey *InstanceKey, forceRefresh bool, resumeReplicat
 			aheadSlaves = append(aheadSlaves, slave)
 		}
 	}
-	log.Debugf("sortedSlaves: candidate: %+v, ahead: %d, equal: %d, late: %d", candidateSlave.Key, len(aheadSlaves), len(equalSlaves), len(laterSlaves))
+	logOperationDebugf(ctx, "sortedSlaves: candidate: %+v, ahead: %d, equal: %d, late: %d", candidateSlave.Key, len(aheadSlaves), len(equalSlaves), len(laterSlaves))
+	if plan := planFromContext(ctx); plan != nil {
+		plan.setCandidate(candidateSlave, aheadSlaves, equalSlaves, laterSlaves)
+	}
 	return candidateSlave, aheadSlaves, equalSlaves, laterSlaves, nil
 }
 
 // RegroupSlaves will choose a candidate slave of a given instance, and enslave its siblings using
 // either simple CHANGE MASTER TO, where possible, or pseudo-gtid
-func RegroupSlaves(masterKey *InstanceKey) ([](*Instance), [](*Instance), [](*Instance), *Instance, error) {
-	candidateSlave, aheadSlaves, equalSlaves, laterSlaves, err := GetCandidateSlave(masterKey, true, false)
+func RegroupSlaves(ctx context.Context, masterKey *InstanceKey) ([](*Instance), [](*Instance), [](*Instance), *Instance, error) {
+	candidateSlave, aheadSlaves, equalSlaves, laterSlaves, err := GetCandidateSlave(ctx, masterKey, true, false)
 	if err != nil {
 		return aheadSlaves, equalSlaves, laterSlaves, nil, err
 	}
@@ -987,7 +980,7 @@ func RegroupSlaves(masterKey *InstanceKey) ([](*Instance), [](*Instance), [](*In
 		// is *extremely* easy to attach below the candidate slave!
 		go func() {
 			ExecuteOnTopology(func() {
-				ChangeMasterTo(&slave.Key, &candidateSlave.Key, &candidateSlave.SelfBinlogCoordinates)
+				ChangeMasterTo(ctx, &slave.Key, &candidateSlave.Key, &candidateSlave.SelfBinlogCoordinates)
 			})
 			barrier <- &candidateSlave.Key
 		}()
@@ -997,7 +990,7 @@ func RegroupSlaves(masterKey *InstanceKey) ([](*Instance), [](*Instance), [](*In
 	}
 
 	// As for the laterSlaves, we'll have to apply pseudo GTID
-	laterSlaves, instance, err := MultiMatchBelow(laterSlaves, &candidateSlave.Key)
+	laterSlaves, instance, err := MultiMatchBelow(ctx, laterSlaves, &candidateSlave.Key)
 
 	barrier = make(chan *InstanceKey)
 	operatedSlaves := append(equalSlaves, candidateSlave)
@@ -1008,7 +1001,7 @@ func RegroupSlaves(masterKey *InstanceKey) ([](*Instance), [](*Instance), [](*In
 		// is *extremely* easy to attach below the candidate slave!
 		go func() {
 			ExecuteOnTopology(func() {
-				StartSlave(&slave.Key)
+				StartSlave(cleanupContext(ctx), &slave.Key)
 			})
 			barrier <- &candidateSlave.Key
 		}()
@@ -17,6 +17,7 @@
 package inst
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/outbrain/golib/log"
@@ -73,7 +74,7 @@ Cleanup:
 }
 
 // BeginMaintenance will make new maintenance entry for given instanceKey.
-func BeginMaintenance(instanceKey *InstanceKey, owner string, reason string) (int64, error) {
+func BeginMaintenance(ctx context.Context, instanceKey *InstanceKey, owner string, reason string) (int64, error) {
 	db, err := db.OpenOrchestrator()
 	var maintenanceToken int64 = 0
 	if err != nil {
@@ -98,17 +99,17 @@ func BeginMaintenance(instanceKey *InstanceKey, owner string, reason string) (in
 	}
 
 	if affected, _ := res.RowsAffected(); affected == 0 {
-		err = errors.New(fmt.Sprintf("Cannot begin maintenance for instance: %+v", instanceKey))
+		err = &TopologyConflictError{Message: fmt.Sprintf("Cannot begin maintenance for instance: %+v", instanceKey)}
 	} else {
 		// success
 		maintenanceToken, _ = res.LastInsertId()
-		AuditOperation("begin-maintenance", instanceKey, fmt.Sprintf("maintenanceToken: %d, owner: %s, reason: %s", maintenanceToken, owner, reason))
+		AuditOperation(ctx, "begin-maintenance", instanceKey, fmt.Sprintf("maintenanceToken: %d, owner: %s, reason: %s", maintenanceToken, owner, reason))
 	}
 	return maintenanceToken, err
 }
 
 // EndMaintenanceByInstanceKey will terminate an active maintenance using given instanceKey as hint
-func EndMaintenanceByInstanceKey(instanceKey *InstanceKey) error {
+func EndMaintenanceByInstanceKey(ctx context.Context, instanceKey *InstanceKey) error {
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		return log.Errore(err)
@@ -136,7 +137,7 @@ func EndMaintenanceByInstanceKey(instanceKey *InstanceKey) error {
 		err = errors.New(fmt.Sprintf("Instance is not in maintenance mode: %+v", instanceKey))
 	} else {
 		// success
-		AuditOperation("end-maintenance", instanceKey, "")
+		AuditOperation(ctx, "end-maintenance", instanceKey, "")
 	}
 	return err
 }
@@ -175,7 +176,7 @@ Cleanup:
 }
 
 // EndMaintenance will terminate an active maintenance via maintenanceToken
-func EndMaintenance(maintenanceToken int64) error {
+func EndMaintenance(ctx context.Context, maintenanceToken int64) error {
 	db, err := db.OpenOrchestrator()
 	if err != nil {
 		return log.Errore(err)
@@ -200,7 +201,7 @@ func EndMaintenance(maintenanceToken int64) error {
 	} else {
 		// success
 		instanceKey, _ := ReadMaintenanceInstanceKey(maintenanceToken)
-		AuditOperation("end-maintenance", instanceKey, fmt.Sprintf("maintenanceToken: %d", maintenanceToken))
+		AuditOperation(ctx, "end-maintenance", instanceKey, fmt.Sprintf("maintenanceToken: %d", maintenanceToken))
 	}
 	return err
 }
@@ -0,0 +1,293 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	OperationRunning   = "running"
+	OperationCompleted = "completed"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+	OperationAbandoned = "abandoned"
+)
+
+// Operation is a running, cancellable topology operation
+type Operation struct {
+	Id          int64
+	Description string
+	Owner       string
+	StartTime   time.Time
+	Deadline    time.Time
+	ctx         context.Context
+	cancel      context.CancelFunc
+	ended       bool
+}
+
+// OperationResult is the outcome of a successful operation: a human readable message, and details
+// (typically the affected instance)
+type OperationResult struct {
+	Message string
+	Details interface{}
+}
+
+// MatchSlavesResult is the outcome of matching slaves below a new master
+type MatchSlavesResult struct {
+	NewMaster     InstanceKey
+	MatchedSlaves [](InstanceKey)
+}
+
+// NewMatchSlavesResult summarizes the slaves matched below a new master
+func NewMatchSlavesResult(newMaster *Instance, matchedSlaves [](*Instance)) *MatchSlavesResult {
+	return &MatchSlavesResult{
+		NewMaster:     newMaster.Key,
+		MatchedSlaves: instanceKeys(matchedSlaves),
+	}
+}
+
+// RegroupSlavesResult is the outcome of regrouping slaves below a promoted slave
+type RegroupSlavesResult struct {
+	PromotedSlave InstanceKey
+	LostSlaves    [](InstanceKey)
+	EqualSlaves   [](InstanceKey)
+	AheadSlaves   [](InstanceKey)
+}
+
+// NewRegroupSlavesResult summarizes the slaves regrouped below a promoted slave
+func NewRegroupSlavesResult(promotedSlave *Instance, lostSlaves, equalSlaves, aheadSlaves [](*Instance)) *RegroupSlavesResult {
+	return &RegroupSlavesResult{
+		PromotedSlave: promotedSlave.Key,
+		LostSlaves:    instanceKeys(lostSlaves),
+		EqualSlaves:   instanceKeys(equalSlaves),
+		AheadSlaves:   instanceKeys(aheadSlaves),
+	}
+}
+
+// OperationFunc is the body of an operation, running under given context
+type OperationFunc func(ctx context.Context) (*OperationResult, error)
+
+type operationIdContextKey struct{}
+
+var activeOperations = make(map[int64]*Operation)
+var activeOperationsMutex = &sync.Mutex{}
+
+// lastLocalOperationId numbers operations which could not be persisted. These are given negative ids
+// so as not to collide with persisted ones.
+var lastLocalOperationId int64 = 0
+
+// BeginOperation registers a new operation and returns the context under which it is to run.
+// The context is cancelled when the parent context is cancelled, when the operation is cancelled via
+// CancelOperation, or when OperationTimeoutSeconds elapse. EndOperation must be called once the operation
+// completes.
+func BeginOperation(parent context.Context, description string, owner string) (context.Context, *Operation) {
+	return BeginOperationWithTimeout(parent, description, owner, time.Duration(config.Config().OperationTimeoutSeconds)*time.Second)
+}
+
+// BeginOperationWithTimeout is like BeginOperation, with an explicit timeout. A zero timeout means no limit.
+func BeginOperationWithTimeout(parent context.Context, description string, owner string, timeout time.Duration) (context.Context, *Operation) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	operation := &Operation{
+		Description: description,
+		Owner:       owner,
+		StartTime:   time.Now(),
+	}
+	if timeout > 0 {
+		operation.Deadline = operation.StartTime.Add(timeout)
+		ctx, cancel = context.WithDeadline(parent, operation.Deadline)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	operation.cancel = cancel
+
+	operationId, err := writeNewOperation(operation)
+	if err != nil {
+		log.Errorf("Unable to persist operation %s; its progress will not be tracked", description)
+	}
+
+	activeOperationsMutex.Lock()
+	defer activeOperationsMutex.Unlock()
+
+	if err != nil {
+		lastLocalOperationId--
+		operationId = lastLocalOperationId
+	}
+	operation.Id = operationId
+	operation.ctx = context.WithValue(ctx, operationIdContextKey{}, operation.Id)
+	activeOperations[operation.Id] = operation
+
+	return operation.ctx, operation
+}
+
+// EndOperation releases resources of a completed operation, and records its outcome: the given result
+// or error. Only the first call takes effect, so it is safe to call it again, e.g. deferred.
+func EndOperation(operation *Operation, result *OperationResult, operationErr error) {
+	activeOperationsMutex.Lock()
+	if operation.ended {
+		activeOperationsMutex.Unlock()
+		return
+	}
+	operation.ended = true
+	state := OperationCompleted
+	if operationErr != nil {
+		state = OperationFailed
+		if operation.ctx.Err() == context.Canceled {
+			state = OperationCancelled
+		}
+	}
+	operation.cancel()
+	delete(activeOperations, operation.Id)
+	activeOperationsMutex.Unlock()
+
+	if operation.Id <= 0 {
+		return
+	}
+	message := ""
+	var details interface{}
+	if operationErr != nil {
+		message = operationErr.Error()
+	} else if result != nil {
+		message = result.Message
+		details = result.Details
+	}
+	resultJSON := []byte{}
+	if details != nil {
+		var err error
+		if resultJSON, err = json.Marshal(details); err != nil {
+			log.Errore(err)
+		}
+	}
+	writeOperationEnd(operation.Id, state, message, string(resultJSON))
+}
+
+// RunOperation runs given function as a registered operation, and records its outcome
+func RunOperation(parent context.Context, description string, owner string, operationFunc OperationFunc) (*OperationResult, error) {
+	ctx, operation := BeginOperation(parent, description, owner)
+	result, err := operationFunc(ctx)
+	EndOperation(operation, result, err)
+	return result, err
+}
+
+// SubmitOperation runs given function as a registered operation in the background, and returns immediately.
+// The operation's progress and outcome are then read via ReadOperationStatus. The operation keeps the values
+// of given parent context (e.g. the authenticated API token), but outlives its cancellation.
+func SubmitOperation(parent context.Context, description string, owner string, operationFunc OperationFunc) *Operation {
+	ctx, operation := BeginOperation(uncancellableContext{parent: parent}, description, owner)
+	go func() {
+		result, err := operationFunc(ctx)
+		if err != nil {
+			log.Errore(err)
+		}
+		EndOperation(operation, result, err)
+	}()
+	return operation
+}
+
+// CancelOperation cancels a running operation. The operation aborts at its next
+// cancellation point, restarting replication where it had been stopped.
+// Only operations running on this orchestrator node can be cancelled.
+func CancelOperation(ctx context.Context, operationId int64) error {
+	activeOperationsMutex.Lock()
+	operation, found := activeOperations[operationId]
+	activeOperationsMutex.Unlock()
+
+	if !found {
+		return fmt.Errorf("No active operation with id %d on this node", operationId)
+	}
+	operation.cancel()
+	AuditOperation(ctx, "cancel-operation", nil, fmt.Sprintf("Cancelled operation %d: %s", operationId, operation.Description))
+	return nil
+}
+
+// ReadActiveOperations returns the operations currently running on this node, in order of submission
+func ReadActiveOperations() []Operation {
+	activeOperationsMutex.Lock()
+	defer activeOperationsMutex.Unlock()
+
+	operationIds := []int{}
+	for operationId := range activeOperations {
+		operationIds = append(operationIds, int(operationId))
+	}
+	sort.Ints(operationIds)
+
+	operations := []Operation{}
+	for _, operationId := range operationIds {
+		operations = append(operations, *activeOperations[int64(operationId)])
+	}
+	return operations
+}
+
+// logOperationInfof logs given message at INFO level, and records it as a step of the operation
+// given context belongs to, if any.
+func logOperationInfof(ctx context.Context, format string, args ...interface{}) {
+	log.Infof(format, args...)
+	logOperationStep(ctx, fmt.Sprintf(format, args...))
+}
+
+// logOperationDebugf logs given message at DEBUG level, and records it as a step of the operation
+// given context belongs to, if any.
+func logOperationDebugf(ctx context.Context, format string, args ...interface{}) {
+	log.Debugf(format, args...)
+	logOperationStep(ctx, fmt.Sprintf(format, args...))
+}
+
+func logOperationStep(ctx context.Context, message string) {
+	if operationId, ok := OperationIdFromContext(ctx); ok && operationId > 0 {
+		writeOperationStep(operationId, message)
+	}
+}
+
+// OperationIdFromContext returns the id of the operation given context belongs to, if any
+func OperationIdFromContext(ctx context.Context) (int64, bool) {
+	operationId, ok := ctx.Value(operationIdContextKey{}).(int64)
+	return operationId, ok
+}
+
+// uncancellableContext keeps the values of its parent context, but is never cancelled
+type uncancellableContext struct {
+	parent context.Context
+}
+
+func (this uncancellableContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (this uncancellableContext) Done() <-chan struct{}             { return nil }
+func (this uncancellableContext) Err() error                        { return nil }
+func (this uncancellableContext) Value(key interface{}) interface{} { return this.parent.Value(key) }
+
+// cleanupContext returns the context to use in an operation's Cleanup path. An operation may well have reached
+// its Cleanup because it was cancelled or has timed out; it must nonetheless be allowed to restore replication.
+func cleanupContext(ctx context.Context) context.Context {
+	return uncancellableContext{parent: ctx}
+}
+
+// sleepContext sleeps for given duration, or until given context is done, in which case it returns the context's error
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-time.After(duration):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,268 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/db"
+	"strings"
+	"time"
+)
+
+// OperationStatus is the persisted record of a topology operation: its state, progress and outcome
+type OperationStatus struct {
+	OperationId       int64
+	Description       string
+	Owner             string
+	State             string
+	StartTimestamp    string
+	EndTimestamp      string
+	DeadlineTimestamp string
+	Message           string
+	Result            json.RawMessage
+	Steps             []string
+}
+
+// OperationNotFoundError is returned when reading an unknown operation
+type OperationNotFoundError struct {
+	OperationId int64
+}
+
+func (this *OperationNotFoundError) Error() string {
+	return fmt.Sprintf("Operation not found: %d", this.OperationId)
+}
+
+// writeNewOperation persists a newly started operation, returning its id
+func writeNewOperation(operation *Operation) (int64, error) {
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+
+	deadlineSeconds := int64(0)
+	if !operation.Deadline.IsZero() {
+		deadlineSeconds = int64(operation.Deadline.Sub(operation.StartTime).Seconds())
+	}
+	sqlResult, err := sqlutils.Exec(db, `
+			insert 
+				into topology_operation (
+					description, owner, state, start_timestamp, end_timestamp, deadline_timestamp, message, step_log, result
+				) VALUES (
+					?, ?, ?, NOW(), NULL, IF(? > 0, NOW() + interval ? second, NULL), '', '', ''
+				)
+			`,
+		operation.Description,
+		operation.Owner,
+		OperationRunning,
+		deadlineSeconds,
+		deadlineSeconds,
+	)
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	operationId, err := sqlResult.LastInsertId()
+	if err != nil {
+		return 0, log.Errore(err)
+	}
+	return operationId, nil
+}
+
+// writeOperationStep appends a progress message to the step log of given operation
+func writeOperationStep(operationId int64, message string) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			update 
+				topology_operation 
+			set 
+				step_log = concat(step_log, ?) 
+			where 
+				operation_id = ?
+			`,
+			fmt.Sprintf("%s %s\n", time.Now().Format(log.TimeFormat), message),
+			operationId,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// writeOperationEnd records the final state and outcome of given operation
+func writeOperationEnd(operationId int64, state string, message string, result string) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			update 
+				topology_operation 
+			set 
+				state = ?,
+				end_timestamp = NOW(),
+				message = ?,
+				result = ?
+			where 
+				operation_id = ?
+			`,
+			state,
+			message,
+			result,
+			operationId,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// readOperations reads operation records matching given condition
+func readOperations(condition string, limit string) ([]OperationStatus, error) {
+	res := []OperationStatus{}
+	query := fmt.Sprintf(`
+		select 
+			operation_id,
+			description,
+			owner,
+			state,
+			start_timestamp,
+			ifnull(end_timestamp, '') as end_timestamp,
+			ifnull(deadline_timestamp, '') as deadline_timestamp,
+			message,
+			step_log,
+			result
+		from 
+			topology_operation
+		where
+			%s
+		order by
+			operation_id desc
+		%s
+		`, condition, limit)
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		goto Cleanup
+	}
+
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		operationStatus := OperationStatus{}
+		operationStatus.OperationId = m.GetInt64("operation_id")
+		operationStatus.Description = m.GetString("description")
+		operationStatus.Owner = m.GetString("owner")
+		operationStatus.State = m.GetString("state")
+		operationStatus.StartTimestamp = m.GetString("start_timestamp")
+		operationStatus.EndTimestamp = m.GetString("end_timestamp")
+		operationStatus.DeadlineTimestamp = m.GetString("deadline_timestamp")
+		operationStatus.Message = m.GetString("message")
+		operationStatus.Steps = []string{}
+		if stepLog := strings.TrimSpace(m.GetString("step_log")); stepLog != "" {
+			operationStatus.Steps = strings.Split(stepLog, "\n")
+		}
+		if result := m.GetString("result"); result != "" {
+			operationStatus.Result = json.RawMessage(result)
+		}
+
+		res = append(res, operationStatus)
+		return nil
+	})
+Cleanup:
+
+	if err != nil {
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// ReadOperationStatus returns the record of given operation, whether running or ended
+func ReadOperationStatus(operationId int64) (*OperationStatus, error) {
+	operations, err := readOperations(fmt.Sprintf("operation_id = %d", operationId), "")
+	if err != nil {
+		return nil, err
+	}
+	if len(operations) == 0 {
+		return nil, &OperationNotFoundError{OperationId: operationId}
+	}
+	return &operations[0], nil
+}
+
+// ReadRecentOperations returns records of latest operations, most recent first, using page number.
+func ReadRecentOperations(page int) ([]OperationStatus, error) {
+	return readOperations("1=1", fmt.Sprintf("limit %d offset %d", config.Config().AuditPageSize, page*config.Config().AuditPageSize))
+}
+
+// ExpireOperations marks operations which are past their deadline, yet never ended, as abandoned. These are
+// typically operations whose orchestrator process died mid-way. Operations with no deadline are abandoned once
+// older than OperationHistoryDays. It also purges records of operations older than OperationHistoryDays.
+func ExpireOperations() error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			update 
+				topology_operation 
+			set 
+				state = ?,
+				end_timestamp = NOW()
+			where 
+				state = ?
+				and (
+					deadline_timestamp < NOW() - interval ? second
+					or (deadline_timestamp is null and start_timestamp < NOW() - interval ? day)
+				)
+			`,
+			OperationAbandoned,
+			OperationRunning,
+			config.Config().InstanceBulkOperationsWaitTimeoutSeconds,
+			config.Config().OperationHistoryDays,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		_, err = sqlutils.Exec(db, `
+			delete 
+				from topology_operation 
+			where 
+				start_timestamp < NOW() - interval ? day
+				and state != ?
+			`,
+			config.Config().OperationHistoryDays,
+			OperationRunning,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
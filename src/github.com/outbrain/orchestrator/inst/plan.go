@@ -0,0 +1,172 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PlannedStatement is a statement a dry-run operation would have issued on an instance
+type PlannedStatement struct {
+	InstanceKey InstanceKey
+	Statement   string
+}
+
+// PlannedBucket is a group of slaves sharing same exec coordinates, which MultiMatchBelow matches as one
+type PlannedBucket struct {
+	ExecBinlogCoordinates BinlogCoordinates
+	Slaves                [](InstanceKey)
+	MatchedCoordinates    *BinlogCoordinates
+}
+
+// Plan describes what a topology operation would do, as collected when running it in dry-run mode.
+// In dry-run mode no statement which changes replication state is issued; reading of binary & relay logs
+// (e.g. for Pseudo-GTID matching) still takes place. As replication is not actually stopped, the plan
+// reflects the coordinates the slaves were at while planning.
+type Plan struct {
+	CandidateSlave *InstanceKey
+	AheadSlaves    [](InstanceKey)
+	EqualSlaves    [](InstanceKey)
+	LaterSlaves    [](InstanceKey)
+	Buckets        [](*PlannedBucket)
+	Statements     [](PlannedStatement)
+	mutex          *sync.Mutex
+}
+
+// UnmarshalJSON decodes a plan, e.g. one returned by the API, such that it is readily usable
+func (this *Plan) UnmarshalJSON(b []byte) error {
+	type plan Plan
+	decoded := plan{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+	*this = Plan(decoded)
+	this.mutex = &sync.Mutex{}
+	return nil
+}
+
+type planContextKey struct{}
+
+// NewDryRunContext returns a context under which topology operations only plan, rather than execute, their changes.
+// The plan is collected onto the returned Plan.
+func NewDryRunContext(parent context.Context) (context.Context, *Plan) {
+	plan := &Plan{
+		AheadSlaves: [](InstanceKey){},
+		EqualSlaves: [](InstanceKey){},
+		LaterSlaves: [](InstanceKey){},
+		Buckets:     [](*PlannedBucket){},
+		Statements:  [](PlannedStatement){},
+		mutex:       &sync.Mutex{},
+	}
+	return context.WithValue(parent, planContextKey{}, plan), plan
+}
+
+// planFromContext returns the plan collected under given context, or nil when not in dry-run mode
+func planFromContext(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(planContextKey{}).(*Plan)
+	return plan
+}
+
+// IsDryRun returns true when given context is that of a dry-run operation
+func IsDryRun(ctx context.Context) bool {
+	return planFromContext(ctx) != nil
+}
+
+func instanceKeys(instances [](*Instance)) [](InstanceKey) {
+	keys := [](InstanceKey){}
+	for _, instance := range instances {
+		keys = append(keys, instance.Key)
+	}
+	return keys
+}
+
+func (this *Plan) addStatement(instanceKey *InstanceKey, query string, args ...interface{}) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	statement := strings.Join(strings.Fields(query), " ")
+	if len(args) > 0 {
+		statement = fmt.Sprintf("%s; args: %+v", statement, args)
+	}
+	this.Statements = append(this.Statements, PlannedStatement{InstanceKey: *instanceKey, Statement: statement})
+}
+
+func (this *Plan) setCandidate(candidateSlave *Instance, aheadSlaves, equalSlaves, laterSlaves [](*Instance)) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.CandidateSlave = &candidateSlave.Key
+	this.AheadSlaves = instanceKeys(aheadSlaves)
+	this.EqualSlaves = instanceKeys(equalSlaves)
+	this.LaterSlaves = instanceKeys(laterSlaves)
+}
+
+// addBucket records a bucket of slaves; slaves are expected in order of exec coordinates
+func (this *Plan) addBucket(execBinlogCoordinates BinlogCoordinates, slaves [](*Instance)) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.Buckets = append(this.Buckets, &PlannedBucket{ExecBinlogCoordinates: execBinlogCoordinates, Slaves: instanceKeys(slaves)})
+}
+
+func (this *Plan) setBucketMatch(execBinlogCoordinates BinlogCoordinates, matchedCoordinates *BinlogCoordinates) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, bucket := range this.Buckets {
+		if bucket.ExecBinlogCoordinates.Equals(&execBinlogCoordinates) {
+			bucket.MatchedCoordinates = matchedCoordinates
+		}
+	}
+}
+
+func displayStrings(instanceKeys [](InstanceKey)) string {
+	tokens := []string{}
+	for _, instanceKey := range instanceKeys {
+		tokens = append(tokens, instanceKey.DisplayString())
+	}
+	return strings.Join(tokens, ", ")
+}
+
+// HumanReadableDescription returns a multi-line, human readable description of the plan
+func (this *Plan) HumanReadableDescription() string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	lines := []string{}
+	if this.CandidateSlave != nil {
+		lines = append(lines, fmt.Sprintf("candidate: %s", this.CandidateSlave.DisplayString()))
+		lines = append(lines, fmt.Sprintf("ahead: %s", displayStrings(this.AheadSlaves)))
+		lines = append(lines, fmt.Sprintf("equal: %s", displayStrings(this.EqualSlaves)))
+		lines = append(lines, fmt.Sprintf("later: %s", displayStrings(this.LaterSlaves)))
+	}
+	for _, bucket := range this.Buckets {
+		matched := "unmatched"
+		if bucket.MatchedCoordinates != nil {
+			matched = fmt.Sprintf("matched at %s:%d", bucket.MatchedCoordinates.LogFile, bucket.MatchedCoordinates.LogPos)
+		}
+		lines = append(lines, fmt.Sprintf("bucket %s:%d: %s; %s", bucket.ExecBinlogCoordinates.LogFile, bucket.ExecBinlogCoordinates.LogPos, displayStrings(bucket.Slaves), matched))
+	}
+	for _, statement := range this.Statements {
+		lines = append(lines, fmt.Sprintf("%s: %s", statement.InstanceKey.DisplayString(), statement.Statement))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"context"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var pseudoGTIDInjectionsCounter = metrics.NewCounter("orchestrator_pseudo_gtid_injections_total", "Number of pseudo GTID entries injected onto cluster masters")
+var pseudoGTIDInjectionFailuresCounter = metrics.NewCounter("orchestrator_pseudo_gtid_injection_failures_total", "Number of failed pseudo GTID injections")
+
+// PseudoGTIDInjection is the state of pseudo GTID injection onto a cluster's master (also in the database)
+type PseudoGTIDInjection struct {
+	ClusterName            string
+	MasterKey              InstanceKey
+	Token                  string // Last injected, or attempted, token
+	InjectedTimestamp      string // Time of last successful injection
+	LastAttemptedTimestamp string
+	LastError              string // Error of last attempt; empty when it succeeded
+}
+
+var lastPseudoGTIDToken int64 = 0
+
+// nextPseudoGTIDToken returns a unique token, ascending within this process. Tokens are fixed-width hex
+// encoded nanosecond timestamps, and so sort textually as they sort numerically.
+func nextPseudoGTIDToken() string {
+	for {
+		last := atomic.LoadInt64(&lastPseudoGTIDToken)
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastPseudoGTIDToken, last, next) {
+			return fmt.Sprintf("%016x", next)
+		}
+	}
+}
+
+// SeedPseudoGTIDToken raises the last token to the greatest token injected so far by any orchestrator node, such
+// that tokens keep ascending across a change of the elected node even when clocks are skewed. It is expected to
+// be called upon election, before injecting.
+func SeedPseudoGTIDToken() error {
+	token, err := readMaxPseudoGTIDToken()
+	if err != nil || token == "" {
+		return err
+	}
+	seed, err := strconv.ParseInt(token, 16, 64)
+	if err != nil {
+		return log.Errorf("Cannot parse injected pseudo GTID token %s: %+v", token, err)
+	}
+	for {
+		last := atomic.LoadInt64(&lastPseudoGTIDToken)
+		if seed <= last || atomic.CompareAndSwapInt64(&lastPseudoGTIDToken, last, seed) {
+			return nil
+		}
+	}
+}
+
+// InjectPseudoGTID writes a pseudo GTID entry onto the binary log of given cluster's master, by executing
+// the configured injection statement. The attempt is recorded whether or not it succeeds. The statement is
+// aborted if it does not complete within PseudoGTIDInjectionSeconds, such that a hanging master does not
+// hold up subsequent injections.
+func InjectPseudoGTID(clusterName string) error {
+	token := nextPseudoGTIDToken()
+	master, err := ReadClusterMaster(clusterName)
+	if err != nil {
+		writePseudoGTIDInjection(clusterName, &InstanceKey{}, token, err)
+		return err
+	}
+	statement := strings.Replace(config.Config().PseudoGTIDInjectionStatement, "{token}", token, -1)
+	ExecuteOnTopology(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Config().PseudoGTIDInjectionSeconds)*time.Second)
+		defer cancel()
+		_, err = ExecInstance(ctx, &master.Key, statement)
+	})
+	if err != nil {
+		pseudoGTIDInjectionFailuresCounter.Inc()
+		log.Errorf("Failed injecting pseudo GTID onto %+v: %+v", master.Key, err)
+	} else {
+		pseudoGTIDInjectionsCounter.Inc()
+	}
+	writePseudoGTIDInjection(clusterName, &master.Key, token, err)
+	return err
+}
+
+// InjectPseudoGTIDOnClusters injects a pseudo GTID entry onto the master of each known cluster, concurrently
+func InjectPseudoGTIDOnClusters() error {
+	clusterNames, err := ReadClusters()
+	if err != nil {
+		return log.Errore(err)
+	}
+	var wg sync.WaitGroup
+	for _, clusterName := range clusterNames {
+		wg.Add(1)
+		go func(clusterName string) {
+			defer wg.Done()
+			InjectPseudoGTID(clusterName)
+		}(clusterName)
+	}
+	wg.Wait()
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/metrics"
+	"github.com/pmylund/go-cache"
+	"strings"
+	"sync"
+	"time"
+)
+
+var pseudoGTIDCacheHitsCounter = metrics.NewCounter("orchestrator_pseudo_gtid_cache_hits_total", "Number of pseudo GTID lookups served from cache")
+var pseudoGTIDCacheMissesCounter = metrics.NewCounter("orchestrator_pseudo_gtid_cache_misses_total", "Number of pseudo GTID lookups which required scanning binary logs")
+var pseudoGTIDCacheInvalidationsCounter = metrics.NewCounter("orchestrator_pseudo_gtid_cache_invalidations_total", "Number of cached pseudo GTID entries invalidated upon binary log purge or rotation")
+
+// instancePseudoGTIDEntryCache maps (instance, pseudo GTID entry text) to the entry's coordinates
+var instancePseudoGTIDEntryCache = cache.New(time.Duration(10)*time.Minute, time.Minute)
+
+// binlogLastPseudoGTIDEntryCache maps (instance, binary log) to the last pseudo GTID entry in that binary log.
+// Only binary logs which have been rotated, and so no longer change, are cached.
+var binlogLastPseudoGTIDEntryCache = cache.New(time.Duration(24)*time.Hour, time.Hour)
+
+// binlogFirstPseudoGTIDEntryCache maps (instance, binary log) to its first pseudo GTID entry. With monotonic
+// entries, a binary log's range of entries spans from its first entry up to the next binary log's first entry.
+var binlogFirstPseudoGTIDEntryCache = cache.New(time.Duration(24)*time.Hour, time.Hour)
+
+// binlogPseudoGTIDEntry is a pseudo GTID entry found in a binary log. Coordinates are nil when the binary log
+// has no pseudo GTID entry.
+type binlogPseudoGTIDEntry struct {
+	Coordinates *BinlogCoordinates
+	EntryText   string
+}
+
+// seenInstanceBinlogs remembers the binary logs last seen per instance, by which purge and rotation are detected
+var seenInstanceBinlogs = make(map[InstanceKey][]string)
+
+// seenInstanceSelfCoordinates remembers the binary log coordinates last seen per instance, by which a reset is
+// detected even as the first binary log's name repeats
+var seenInstanceSelfCoordinates = make(map[InstanceKey]BinlogCoordinates)
+var seenInstanceBinlogsMutex = &sync.Mutex{}
+
+func getInstancePseudoGTIDKey(instance *Instance, entry string) string {
+	return fmt.Sprintf("%s;%s", instance.Key.DisplayString(), entry)
+}
+
+func getInstanceBinlogKey(instanceKey *InstanceKey, binlog string) string {
+	return fmt.Sprintf("%s;%s", instanceKey.DisplayString(), binlog)
+}
+
+// getCachedPseudoGTIDEntryCoordinates returns the cached coordinates of given entry in given instance, if any,
+// consulting the backend database when PseudoGTIDCachePersistent. Cached coordinates in binary logs since
+// purged are discarded.
+func getCachedPseudoGTIDEntryCoordinates(instance *Instance, entryText string) (*BinlogCoordinates, bool) {
+	cacheKey := getInstancePseudoGTIDKey(instance, entryText)
+	if coords, found := instancePseudoGTIDEntryCache.Get(cacheKey); found {
+		coordinates := coords.(*BinlogCoordinates)
+		if instance.hasBinaryLog(coordinates.LogFile) {
+			pseudoGTIDCacheHitsCounter.Inc()
+			return coordinates, true
+		}
+		instancePseudoGTIDEntryCache.Delete(cacheKey)
+		pseudoGTIDCacheInvalidationsCounter.Inc()
+	}
+	if config.Config().PseudoGTIDCachePersistent {
+		if coordinates, found, _ := readPseudoGTIDEntryCoordinates(&instance.Key, entryText); found && instance.hasBinaryLog(coordinates.LogFile) {
+			instancePseudoGTIDEntryCache.Set(cacheKey, coordinates, cache.DefaultExpiration)
+			pseudoGTIDCacheHitsCounter.Inc()
+			return coordinates, true
+		}
+	}
+	pseudoGTIDCacheMissesCounter.Inc()
+	return nil, false
+}
+
+// setCachedPseudoGTIDEntryCoordinates caches the coordinates of given entry in given instance
+func setCachedPseudoGTIDEntryCoordinates(instance *Instance, entryText string, coordinates *BinlogCoordinates) {
+	instancePseudoGTIDEntryCache.Set(getInstancePseudoGTIDKey(instance, entryText), coordinates, cache.DefaultExpiration)
+	if config.Config().PseudoGTIDCachePersistent {
+		writePseudoGTIDEntryCoordinates(&instance.Key, entryText, coordinates)
+	}
+}
+
+// getCachedBinlogLastPseudoGTIDEntry returns the cached last pseudo GTID entry of given binary log, if any
+func getCachedBinlogLastPseudoGTIDEntry(instanceKey *InstanceKey, binlog string) (*binlogPseudoGTIDEntry, bool) {
+	if entry, found := binlogLastPseudoGTIDEntryCache.Get(getInstanceBinlogKey(instanceKey, binlog)); found {
+		pseudoGTIDCacheHitsCounter.Inc()
+		return entry.(*binlogPseudoGTIDEntry), true
+	}
+	pseudoGTIDCacheMissesCounter.Inc()
+	return nil, false
+}
+
+// isBinlogsReset returns true when given binary logs, as compared with those previously seen, go backwards: the
+// binary logs have been reset (RESET MASTER), and binary log names may since repeat.
+func isBinlogsReset(previousBinlogs []string, binlogs []string) bool {
+	if len(previousBinlogs) == 0 || len(binlogs) == 0 {
+		return false
+	}
+	return binlogs[0] < previousBinlogs[0] || binlogs[len(binlogs)-1] < previousBinlogs[len(previousBinlogs)-1]
+}
+
+// flushInstancePseudoGTIDEntries invalidates all cached pseudo GTID entries of given instance
+func flushInstancePseudoGTIDEntries(instanceKey *InstanceKey) {
+	instancePrefix := fmt.Sprintf("%s;", instanceKey.DisplayString())
+	for _, instanceCache := range []*cache.Cache{instancePseudoGTIDEntryCache, binlogLastPseudoGTIDEntryCache, binlogFirstPseudoGTIDEntryCache} {
+		for cacheKey := range instanceCache.Items() {
+			if strings.HasPrefix(cacheKey, instancePrefix) {
+				instanceCache.Delete(cacheKey)
+				pseudoGTIDCacheInvalidationsCounter.Inc()
+			}
+		}
+	}
+	if config.Config().PseudoGTIDCachePersistent {
+		deleteInstancePseudoGTIDEntryCoordinates(instanceKey)
+	}
+}
+
+// ReviewInstanceBinlogs invalidates the cached pseudo GTID entries of given instance upon purge or rotation of its
+// binary logs. Upon reset of the binary logs, all of the instance's cached entries are invalidated.
+func ReviewInstanceBinlogs(instance *Instance) {
+	binlogs := instance.GetBinaryLogs()
+	seenInstanceBinlogsMutex.Lock()
+	previousBinlogs, seen := seenInstanceBinlogs[instance.Key]
+	previousSelfCoordinates := seenInstanceSelfCoordinates[instance.Key]
+	seenInstanceBinlogs[instance.Key] = binlogs
+	seenInstanceSelfCoordinates[instance.Key] = instance.SelfBinlogCoordinates
+	seenInstanceBinlogsMutex.Unlock()
+	if !seen || len(previousBinlogs) == 0 {
+		return
+	}
+	selfCoordinatesReset := previousSelfCoordinates.LogFile != "" && instance.SelfBinlogCoordinates.LogFile != "" && instance.SelfBinlogCoordinates.SmallerThan(&previousSelfCoordinates)
+	if isBinlogsReset(previousBinlogs, binlogs) || selfCoordinatesReset {
+		flushInstancePseudoGTIDEntries(&instance.Key)
+		log.Infof("Binary logs of %+v have been reset; invalidated all cached pseudo GTID entries", instance.Key)
+		return
+	}
+
+	invalidatedBinlogs := make(map[string]bool)
+	purgedBinlogs := []string{}
+	for _, binlog := range previousBinlogs {
+		if !instance.hasBinaryLog(binlog) {
+			invalidatedBinlogs[binlog] = true
+			purgedBinlogs = append(purgedBinlogs, binlog)
+		}
+	}
+	if config.Config().PseudoGTIDCachePersistent {
+		deletePseudoGTIDEntryCoordinatesInBinlogs(&instance.Key, purgedBinlogs)
+	}
+	if previousCurrentBinlog := previousBinlogs[len(previousBinlogs)-1]; len(binlogs) == 0 || binlogs[len(binlogs)-1] != previousCurrentBinlog {
+		// rotated: the formerly current binary log may have been sampled while still being written to
+		invalidatedBinlogs[previousCurrentBinlog] = true
+	}
+	if len(invalidatedBinlogs) == 0 {
+		return
+	}
+	for binlog := range invalidatedBinlogs {
+		binlogKey := getInstanceBinlogKey(&instance.Key, binlog)
+		binlogLastPseudoGTIDEntryCache.Delete(binlogKey)
+		binlogFirstPseudoGTIDEntryCache.Delete(binlogKey)
+		pseudoGTIDCacheInvalidationsCounter.Inc()
+	}
+	instancePrefix := fmt.Sprintf("%s;", instance.Key.DisplayString())
+	for cacheKey, item := range instancePseudoGTIDEntryCache.Items() {
+		if !strings.HasPrefix(cacheKey, instancePrefix) {
+			continue
+		}
+		if coordinates := item.Object.(*BinlogCoordinates); !instance.hasBinaryLog(coordinates.LogFile) {
+			instancePseudoGTIDEntryCache.Delete(cacheKey)
+			pseudoGTIDCacheInvalidationsCounter.Inc()
+		}
+	}
+	log.Debugf("Invalidated cached pseudo GTID entries of %+v in binlogs: %+v", instance.Key, invalidatedBinlogs)
+}
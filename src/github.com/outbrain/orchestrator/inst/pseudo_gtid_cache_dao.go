@@ -0,0 +1,172 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+	"strings"
+)
+
+// pseudoGTIDEntryCacheRetentionDays is the number of days persisted pseudo GTID entry coordinates are kept
+const pseudoGTIDEntryCacheRetentionDays = 7
+
+func pseudoGTIDEntryHash(entryText string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(entryText)))
+}
+
+// readPseudoGTIDEntryCoordinates reads the persisted coordinates of given pseudo GTID entry in given instance
+func readPseudoGTIDEntryCoordinates(instanceKey *InstanceKey, entryText string) (*BinlogCoordinates, bool, error) {
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		return nil, false, log.Errore(err)
+	}
+	coordinates := BinlogCoordinates{Type: BinaryLog}
+	err = db.QueryRow(`
+		select 
+			log_file,
+			log_pos
+		from 
+			pseudo_gtid_entry_cache
+		where
+			hostname = ?
+			and port = ?
+			and entry_hash = ?
+		`, instanceKey.Hostname, instanceKey.Port, pseudoGTIDEntryHash(entryText)).Scan(&coordinates.LogFile, &coordinates.LogPos)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, log.Errore(err)
+	}
+	return &coordinates, true, nil
+}
+
+// writePseudoGTIDEntryCoordinates persists the coordinates of given pseudo GTID entry in given instance
+func writePseudoGTIDEntryCoordinates(instanceKey *InstanceKey, entryText string, coordinates *BinlogCoordinates) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			replace into 
+					pseudo_gtid_entry_cache (hostname, port, entry_hash, log_file, log_pos, cached_timestamp)
+				values
+					(?, ?, ?, ?, ?, NOW())
+			`,
+			instanceKey.Hostname,
+			instanceKey.Port,
+			pseudoGTIDEntryHash(entryText),
+			coordinates.LogFile,
+			coordinates.LogPos)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// deletePseudoGTIDEntryCoordinatesInBinlogs removes persisted coordinates of given instance which are in given
+// (purged) binary logs
+func deletePseudoGTIDEntryCoordinatesInBinlogs(instanceKey *InstanceKey, binlogs []string) error {
+	if len(binlogs) == 0 {
+		return nil
+	}
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		args := []interface{}{instanceKey.Hostname, instanceKey.Port}
+		for _, binlog := range binlogs {
+			args = append(args, binlog)
+		}
+		_, err = sqlutils.Exec(db, fmt.Sprintf(`
+			delete 
+				from pseudo_gtid_entry_cache 
+			where 
+				hostname = ?
+				and port = ?
+				and log_file in (%s)
+			`, strings.TrimSuffix(strings.Repeat("?,", len(binlogs)), ",")),
+			args...)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// deleteInstancePseudoGTIDEntryCoordinates removes all persisted coordinates of given instance
+func deleteInstancePseudoGTIDEntryCoordinates(instanceKey *InstanceKey) error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			delete 
+				from pseudo_gtid_entry_cache 
+			where 
+				hostname = ?
+				and port = ?
+			`,
+			instanceKey.Hostname,
+			instanceKey.Port,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ExpirePseudoGTIDEntryCache removes persisted pseudo GTID entry coordinates which have not been refreshed lately
+func ExpirePseudoGTIDEntryCache() error {
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			delete 
+				from pseudo_gtid_entry_cache 
+			where 
+				cached_timestamp < NOW() - interval ? day
+			`,
+			pseudoGTIDEntryCacheRetentionDays,
+		)
+		if err != nil {
+			return log.Errore(err)
+		}
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
@@ -0,0 +1,130 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/golib/sqlutils"
+	"github.com/outbrain/orchestrator/db"
+)
+
+// writePseudoGTIDInjection records an attempt to inject pseudo GTID onto a cluster's master, along with its
+// error, if any
+func writePseudoGTIDInjection(clusterName string, masterKey *InstanceKey, token string, injectionErr error) error {
+	lastError := ""
+	if injectionErr != nil {
+		lastError = injectionErr.Error()
+	}
+	writeFunc := func() error {
+		db, err := db.OpenOrchestrator()
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		_, err = sqlutils.Exec(db, `
+			insert into 
+					cluster_injected_pseudo_gtid (cluster_name, master_host, master_port, token, time_injected, last_attempted, last_error)
+				values
+					(?, ?, ?, ?, if(? = '', NOW(), NULL), NOW(), ?)
+				on duplicate key update
+					master_host = values(master_host),
+					master_port = values(master_port),
+					token = values(token),
+					time_injected = ifnull(values(time_injected), time_injected),
+					last_attempted = values(last_attempted),
+					last_error = values(last_error)
+			`,
+			clusterName,
+			masterKey.Hostname,
+			masterKey.Port,
+			token,
+			lastError,
+			lastError)
+		if err != nil {
+			return log.Errore(err)
+		}
+
+		return nil
+	}
+	return ExecDBWriteFunc(writeFunc)
+}
+
+// ReadPseudoGTIDInjections returns the pseudo GTID injection state of all clusters
+func ReadPseudoGTIDInjections() ([]PseudoGTIDInjection, error) {
+	res := []PseudoGTIDInjection{}
+	query := `
+		select 
+			cluster_name,
+			master_host,
+			master_port,
+			token,
+			ifnull(time_injected, '') as time_injected,
+			last_attempted,
+			last_error
+		from 
+			cluster_injected_pseudo_gtid
+		order by
+			cluster_name
+		`
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		goto Cleanup
+	}
+
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		injection := PseudoGTIDInjection{}
+		injection.ClusterName = m.GetString("cluster_name")
+		injection.MasterKey.Hostname = m.GetString("master_host")
+		injection.MasterKey.Port = m.GetInt("master_port")
+		injection.Token = m.GetString("token")
+		injection.InjectedTimestamp = m.GetString("time_injected")
+		injection.LastAttemptedTimestamp = m.GetString("last_attempted")
+		injection.LastError = m.GetString("last_error")
+
+		res = append(res, injection)
+		return err
+	})
+Cleanup:
+
+	if err != nil {
+		log.Errore(err)
+	}
+	return res, err
+}
+
+// readMaxPseudoGTIDToken returns the greatest token injected onto any cluster, or empty string when there is none
+func readMaxPseudoGTIDToken() (string, error) {
+	token := ""
+	query := `
+		select 
+			ifnull(max(token), '') as token
+		from 
+			cluster_injected_pseudo_gtid
+		`
+	db, err := db.OpenOrchestrator()
+	if err != nil {
+		return token, log.Errore(err)
+	}
+	err = sqlutils.QueryRowsMap(db, query, func(m sqlutils.RowMap) error {
+		token = m.GetString("token")
+		return nil
+	})
+	if err != nil {
+		return token, log.Errore(err)
+	}
+	return token, nil
+}
@@ -33,13 +33,15 @@ type HostnameResolve struct {
 	resolvedHostname string
 }
 
-func init() {
-	if config.Config.ExpiryHostnameResolvesMinutes < 1 {
-		config.Config.ExpiryHostnameResolvesMinutes = 1
+// expiryHostnameResolvesMinutes returns the configured hostname resolve expiry, no less than a minute
+func expiryHostnameResolvesMinutes() int {
+	if config.Config().ExpiryHostnameResolvesMinutes < 1 {
+		return 1
 	}
+	return config.Config().ExpiryHostnameResolvesMinutes
 }
 
-var hostnameResolvesLightweightCache = cache.New(time.Duration(config.Config.ExpiryHostnameResolvesMinutes)*time.Minute, time.Minute)
+var hostnameResolvesLightweightCache = cache.New(time.Duration(expiryHostnameResolvesMinutes())*time.Minute, time.Minute)
 
 // GetCNAME resolves an IP or hostname into a normalized valid CNAME
 func GetCNAME(hostname string) (string, error) {
@@ -52,7 +54,7 @@ func GetCNAME(hostname string) (string, error) {
 }
 
 func resolveHostname(hostname string) (string, error) {
-	switch strings.ToLower(config.Config.HostnameResolveMethod) {
+	switch strings.ToLower(config.Config().HostnameResolveMethod) {
 	case "none":
 		return hostname, nil
 	case "default":
@@ -74,9 +76,9 @@ func ResolveHostname(hostname string) (string, error) {
 	// Unfound: resolve!
 	log.Debugf("Hostname unresolved yet: %s", hostname)
 	resolvedHostname, err := resolveHostname(hostname)
-	if config.Config.RejectHostnameResolvePattern != "" {
+	if config.Config().RejectHostnameResolvePattern != "" {
 		// Reject, don't even cache
-		if matched, _ := regexp.MatchString(config.Config.RejectHostnameResolvePattern, resolvedHostname); matched {
+		if matched, _ := regexp.MatchString(config.Config().RejectHostnameResolvePattern, resolvedHostname); matched {
 			return hostname, errors.New(fmt.Sprintf("Resolved hostname is rejected: %s", resolvedHostname))
 		}
 	}
@@ -101,7 +103,7 @@ func UpdateResolvedHostname(hostname string, resolvedHostname string) bool {
 		return false
 	}
 	hostnameResolvesLightweightCache.Set(hostname, resolvedHostname, 0)
-	if strings.ToLower(config.Config.HostnameResolveMethod) != "none" {
+	if strings.ToLower(config.Config().HostnameResolveMethod) != "none" {
 		WriteResolvedHostname(hostname, resolvedHostname)
 	}
 	return true
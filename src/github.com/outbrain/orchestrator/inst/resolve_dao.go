@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/golib/sqlutils"
-	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/db"
 )
 
@@ -122,7 +121,7 @@ func ForgetExpiredHostnameResolves() error {
 				from hostname_resolve 
 			where 
 				resolved_timestamp < NOW() - interval (? * 2) minute`,
-		config.Config.ExpiryHostnameResolvesMinutes,
+		expiryHostnameResolvesMinutes(),
 	)
 	return err
 }
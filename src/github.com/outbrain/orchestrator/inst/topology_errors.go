@@ -0,0 +1,53 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"fmt"
+)
+
+// TopologyPreconditionError is returned when an operation is refused since the topology is not in a state
+// which allows it; e.g. the instance is not a slave, or has a more advanced sibling
+type TopologyPreconditionError struct {
+	Message string
+}
+
+func (this *TopologyPreconditionError) Error() string {
+	return this.Message
+}
+
+func newPreconditionError(format string, args ...interface{}) error {
+	return &TopologyPreconditionError{Message: fmt.Sprintf(format, args...)}
+}
+
+// TopologyConflictError is returned when an operation cannot begin since an instance it involves is
+// already under maintenance
+type TopologyConflictError struct {
+	Message string
+}
+
+func (this *TopologyConflictError) Error() string {
+	return this.Message
+}
+
+// beginMaintenanceError describes a failure to begin maintenance on an instance, as part of an operation
+func beginMaintenanceError(err error, instanceKey InstanceKey) error {
+	if _, isConflict := err.(*TopologyConflictError); isConflict {
+		return &TopologyConflictError{Message: fmt.Sprintf("Cannot begin maintenance on %+v", instanceKey)}
+	}
+	return fmt.Errorf("Cannot begin maintenance on %+v: %+v", instanceKey, err)
+}
@@ -0,0 +1,369 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package inst
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Topology export formats
+const (
+	DOTFormat     = "dot"
+	JSONFormat    = "json"
+	MermaidFormat = "mermaid"
+)
+
+// TopologyNode is an instance within a topology tree, along with the slaves replicating from it
+type TopologyNode struct {
+	Key               InstanceKey
+	MasterKey         InstanceKey
+	Status            string
+	Version           string
+	ReadOnly          bool
+	SlaveRunning      bool
+	LagSeconds        *int64       // nil when lag is unknown or the instance is not a slave
+	GTIDMode          string       // "oracle", "mariadb", "pseudo" or empty
+	Maintenance       *Maintenance // Active maintenance on this instance, if any
+	CoMaster          *InstanceKey // The co-master this (root) node replicates from, closing a replication cycle
+	MasterUnreachable bool         // This node is a slave whose master is not among the cluster's known instances, or failed its last check
+	Slaves            [](*TopologyNode)
+	description       string
+}
+
+// TopologyTree is a cluster's replication topology. A cluster normally has a single root: its master.
+// A cycle of co-masters is rooted at one of them (the co-master edge closing the cycle is then noted
+// on the root), and slaves of an unknown master are roots of their own.
+type TopologyTree struct {
+	Roots [](*TopologyNode)
+}
+
+func newTopologyNode(instance *Instance) *TopologyNode {
+	node := &TopologyNode{
+		Key:          instance.Key,
+		MasterKey:    instance.MasterKey,
+		Status:       instance.StatusString(),
+		Version:      instance.Version,
+		ReadOnly:     instance.ReadOnly,
+		SlaveRunning: instance.SlaveRunning(),
+		Slaves:       [](*TopologyNode){},
+		description:  instance.HumanReadableDescription(),
+	}
+	switch {
+	case instance.UsingOracleGTID:
+		node.GTIDMode = "oracle"
+	case instance.UsingMariaDBGTID:
+		node.GTIDMode = "mariadb"
+	case instance.UsingPseudoGTID:
+		node.GTIDMode = "pseudo"
+	}
+	if instance.IsSlave() && instance.SecondsBehindMaster.Valid {
+		lag := instance.SecondsBehindMaster.Int64
+		node.LagSeconds = &lag
+	}
+	return node
+}
+
+// instancesByKey sorts instances by their display key, for a deterministic tree
+type instancesByKey [](*Instance)
+
+func (this instancesByKey) Len() int      { return len(this) }
+func (this instancesByKey) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+func (this instancesByKey) Less(i, j int) bool {
+	return this[i].Key.DisplayString() < this[j].Key.DisplayString()
+}
+
+// NewTopologyTree builds the replication tree of given instances of a cluster
+func NewTopologyTree(instances [](*Instance)) *TopologyTree {
+	sorted := make([](*Instance), len(instances))
+	copy(sorted, instances)
+	sort.Sort(instancesByKey(sorted))
+
+	instancesMap := make(map[InstanceKey](*Instance))
+	for _, instance := range sorted {
+		instancesMap[instance.Key] = instance
+	}
+	slavesMap := make(map[InstanceKey]([]*Instance))
+	for _, instance := range sorted {
+		if _, ok := instancesMap[instance.MasterKey]; ok && !instance.MasterKey.Equals(&instance.Key) {
+			slavesMap[instance.MasterKey] = append(slavesMap[instance.MasterKey], instance)
+		}
+	}
+
+	tree := &TopologyTree{Roots: [](*TopologyNode){}}
+	visited := make(map[InstanceKey]bool)
+	var build func(instance *Instance) *TopologyNode
+	build = func(instance *Instance) *TopologyNode {
+		visited[instance.Key] = true
+		node := newTopologyNode(instance)
+		for _, slave := range slavesMap[instance.Key] {
+			if !visited[slave.Key] {
+				slaveNode := build(slave)
+				slaveNode.MasterUnreachable = !instance.IsLastCheckValid
+				node.Slaves = append(node.Slaves, slaveNode)
+			}
+		}
+		return node
+	}
+	// Masters, and slaves of unknown masters
+	for _, instance := range sorted {
+		if _, ok := instancesMap[instance.MasterKey]; !ok || instance.MasterKey.Equals(&instance.Key) {
+			node := build(instance)
+			node.MasterUnreachable = instance.IsSlave() && !instance.MasterKey.Equals(&instance.Key)
+			tree.Roots = append(tree.Roots, node)
+		}
+	}
+	// Whatever remains unvisited lies on a replication cycle (co-masters); root each cycle at its first instance
+	for _, instance := range sorted {
+		if !visited[instance.Key] {
+			node := build(instance)
+			coMaster := instance.MasterKey
+			node.CoMaster = &coMaster
+			node.MasterUnreachable = !instancesMap[coMaster].IsLastCheckValid
+			tree.Roots = append(tree.Roots, node)
+		}
+	}
+	return tree
+}
+
+// walk visits all nodes of the tree, masters before their slaves, along with each node's master (nil for roots)
+func (this *TopologyTree) walk(visit func(node *TopologyNode, master *TopologyNode)) {
+	var walkNode func(node *TopologyNode, master *TopologyNode)
+	walkNode = func(node *TopologyNode, master *TopologyNode) {
+		visit(node, master)
+		for _, slave := range node.Slaves {
+			walkNode(slave, node)
+		}
+	}
+	for _, root := range this.Roots {
+		walkNode(root, nil)
+	}
+}
+
+// Keys returns the keys of all instances in the tree, masters before their slaves
+func (this *TopologyTree) Keys() [](InstanceKey) {
+	keys := [](InstanceKey){}
+	this.walk(func(node *TopologyNode, master *TopologyNode) {
+		keys = append(keys, node.Key)
+	})
+	return keys
+}
+
+// Subtree returns the tree rooted at given instance, or nil when the instance is not in this tree
+func (this *TopologyTree) Subtree(instanceKey *InstanceKey) *TopologyTree {
+	var subtree *TopologyTree
+	this.walk(func(node *TopologyNode, master *TopologyNode) {
+		if subtree == nil && node.Key.Equals(instanceKey) {
+			subtree = &TopologyTree{Roots: [](*TopologyNode){node}}
+		}
+	})
+	return subtree
+}
+
+// SetMaintenance marks the instances under given active maintenance
+func (this *TopologyTree) SetMaintenance(maintenance []Maintenance) {
+	maintenanceMap := make(map[InstanceKey]*Maintenance)
+	for i := range maintenance {
+		maintenanceMap[maintenance[i].Key] = &maintenance[i]
+	}
+	this.walk(func(node *TopologyNode, master *TopologyNode) {
+		node.Maintenance = maintenanceMap[node.Key]
+	})
+}
+
+// asciiEntry returns the ascii line describing this node: its key and status, annotated with lag, GTID mode
+// and maintenance
+func (this *TopologyNode) asciiEntry() string {
+	tokens := []string{this.Key.DisplayString(), this.description}
+	if this.LagSeconds != nil {
+		tokens = append(tokens, fmt.Sprintf("lag:%ds", *this.LagSeconds))
+	}
+	if this.GTIDMode != "" {
+		tokens = append(tokens, fmt.Sprintf("gtid:%s", this.GTIDMode))
+	}
+	if this.Maintenance != nil {
+		tokens = append(tokens, fmt.Sprintf("[maintenance: %s, %s]", this.Maintenance.Owner, this.Maintenance.Reason))
+	}
+	return strings.Join(tokens, " ")
+}
+
+// asciiLines renders this node and its slaves, at given depth. Slaves which are running are prefixed
+// with "+", others with "-". Given annotation, if any, is appended to this node's line.
+func (this *TopologyNode) asciiLines(depth int, annotation string, skip *InstanceKey) []string {
+	prefix := ""
+	if depth > 0 {
+		prefix = strings.Repeat(" ", (depth-1)*2)
+		if this.SlaveRunning {
+			prefix += "+ "
+		} else {
+			prefix += "- "
+		}
+	}
+	lines := []string{fmt.Sprintf("%s%s%s", prefix, this.asciiEntry(), annotation)}
+	for _, slave := range this.Slaves {
+		if skip != nil && slave.Key.Equals(skip) {
+			continue
+		}
+		lines = append(lines, slave.asciiLines(depth+1, "", nil)...)
+	}
+	return lines
+}
+
+// Ascii returns a text representation of the tree; each root is rendered in turn. Co-masters replicating
+// from each other are rendered side by side, followed by the slaves of each.
+func (this *TopologyTree) Ascii() string {
+	lines := []string{}
+	for _, root := range this.Roots {
+		if root.MasterUnreachable && root.CoMaster == nil {
+			lines = append(lines, root.asciiLines(0, fmt.Sprintf(" (master %s unreachable)", root.MasterKey.DisplayString()), nil)...)
+			continue
+		}
+		if root.CoMaster == nil {
+			lines = append(lines, root.asciiLines(0, "", nil)...)
+			continue
+		}
+		var coMaster *TopologyNode
+		for _, slave := range root.Slaves {
+			if slave.Key.Equals(root.CoMaster) {
+				coMaster = slave
+			}
+		}
+		if coMaster == nil {
+			// A longer replication ring
+			lines = append(lines, root.asciiLines(0, fmt.Sprintf(" (replication cycle via %s)", root.CoMaster.DisplayString()), nil)...)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s <-> %s", root.asciiEntry(), coMaster.asciiEntry()))
+		lines = append(lines, root.asciiLines(0, "", &coMaster.Key)[1:]...)
+		for _, slave := range coMaster.Slaves {
+			lines = append(lines, slave.asciiLines(1, fmt.Sprintf(" (of %s)", coMaster.Key.DisplayString()), nil)...)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lagLabel describes the replication lag of given node, for edge labels
+func (this *TopologyNode) lagLabel() string {
+	if !this.SlaveRunning {
+		return "stopped"
+	}
+	if this.LagSeconds == nil {
+		return "?"
+	}
+	return fmt.Sprintf("%ds", *this.LagSeconds)
+}
+
+// statusColor maps a node's StatusString onto a color
+func (this *TopologyNode) statusColor() string {
+	switch this.Status {
+	case "OK":
+		return "green"
+	case "lags too much", "cannot determine slave lag":
+		return "orange"
+	case "not replicating":
+		return "red"
+	default:
+		return "gray"
+	}
+}
+
+// DOT returns the tree in Graphviz DOT format. Nodes are colored by status, edges are labeled by lag.
+func (this *TopologyTree) DOT(name string) string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "digraph %q {\n", name)
+	fmt.Fprintln(&buffer, "  node [shape=box, style=filled, fillcolor=white];")
+	this.walk(func(node *TopologyNode, master *TopologyNode) {
+		fmt.Fprintf(&buffer, "  %q [label=%q, color=%s];\n", node.Key.DisplayString(),
+			fmt.Sprintf("%s\n%s\n%s", node.Key.DisplayString(), node.Version, node.Status), node.statusColor())
+		if master != nil {
+			fmt.Fprintf(&buffer, "  %q -> %q [label=%q];\n", master.Key.DisplayString(), node.Key.DisplayString(), node.lagLabel())
+		}
+		if node.CoMaster != nil {
+			fmt.Fprintf(&buffer, "  %q -> %q [label=%q, style=dashed];\n", node.CoMaster.DisplayString(), node.Key.DisplayString(), node.lagLabel())
+		}
+		if node.MasterUnreachable && master == nil && node.CoMaster == nil {
+			fmt.Fprintf(&buffer, "  %q [label=%q, style=dashed];\n", node.MasterKey.DisplayString(), fmt.Sprintf("%s\nunreachable", node.MasterKey.DisplayString()))
+			fmt.Fprintf(&buffer, "  %q -> %q [label=%q, style=dashed];\n", node.MasterKey.DisplayString(), node.Key.DisplayString(), node.lagLabel())
+		}
+	})
+	fmt.Fprintln(&buffer, "}")
+	return buffer.String()
+}
+
+// mermaidId returns an identifier for given key, as Mermaid node ids may not contain dots or colons.
+// The key is hex encoded, such that distinct keys never share an id.
+func mermaidId(key *InstanceKey) string {
+	return fmt.Sprintf("n%s", hex.EncodeToString([]byte(key.DisplayString())))
+}
+
+// Mermaid returns the tree as a Mermaid flowchart. Nodes are classed by status, edges are labeled by lag.
+func (this *TopologyTree) Mermaid() string {
+	var buffer bytes.Buffer
+	fmt.Fprintln(&buffer, "graph TD")
+	colors := make(map[string]bool)
+	this.walk(func(node *TopologyNode, master *TopologyNode) {
+		fmt.Fprintf(&buffer, "  %s[\"%s<br/>%s<br/>%s\"]\n", mermaidId(&node.Key), node.Key.DisplayString(), node.Version, node.Status)
+		fmt.Fprintf(&buffer, "  class %s %s\n", mermaidId(&node.Key), node.statusColor())
+		colors[node.statusColor()] = true
+		if master != nil {
+			fmt.Fprintf(&buffer, "  %s -->|%s| %s\n", mermaidId(&master.Key), node.lagLabel(), mermaidId(&node.Key))
+		}
+		if node.CoMaster != nil {
+			fmt.Fprintf(&buffer, "  %s -.->|%s| %s\n", mermaidId(node.CoMaster), node.lagLabel(), mermaidId(&node.Key))
+		}
+		if node.MasterUnreachable && master == nil && node.CoMaster == nil {
+			fmt.Fprintf(&buffer, "  %s[\"%s<br/>unreachable\"]\n", mermaidId(&node.MasterKey), node.MasterKey.DisplayString())
+			fmt.Fprintf(&buffer, "  %s -.->|%s| %s\n", mermaidId(&node.MasterKey), node.lagLabel(), mermaidId(&node.Key))
+		}
+	})
+	for _, color := range []string{"green", "orange", "red", "gray"} {
+		if colors[color] {
+			fmt.Fprintf(&buffer, "  classDef %s fill:%s\n", color, color)
+		}
+	}
+	return buffer.String()
+}
+
+// Export returns the tree in given format: "dot", "json" (nested tree) or "mermaid"
+func (this *TopologyTree) Export(name string, format string) (string, error) {
+	switch format {
+	case DOTFormat:
+		return this.DOT(name), nil
+	case MermaidFormat:
+		return this.Mermaid(), nil
+	case JSONFormat:
+		b, err := json.MarshalIndent(this.Roots, "", "  ")
+		return string(b), err
+	}
+	return "", fmt.Errorf("Unknown topology export format: %s (expected dot|json|mermaid)", format)
+}
+
+// ExportClusterTopology returns the topology of given cluster in given format
+func ExportClusterTopology(clusterName string, format string) (string, error) {
+	instances, err := ReadClusterInstances(clusterName)
+	if err != nil {
+		return "", err
+	}
+	if len(instances) == 0 {
+		return "", fmt.Errorf("Cluster not found: %s", clusterName)
+	}
+	return NewTopologyTree(instances).Export(clusterName, format)
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// consulStore is a KVStore backed by Consul's HTTP key-value API
+type consulStore struct {
+	address  string
+	aclToken string
+	client   *http.Client
+}
+
+// NewConsulStore returns a KVStore writing to the Consul agent at given address, e.g. http://127.0.0.1:8500
+func NewConsulStore(address string, aclToken string) KVStore {
+	if !strings.Contains(address, "://") {
+		address = fmt.Sprintf("http://%s", address)
+	}
+	return &consulStore{
+		address:  strings.TrimRight(address, "/"),
+		aclToken: aclToken,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// do issues a request on given key, returning the response body and status code
+func (this *consulStore) do(method string, key string, body string) ([]byte, int, error) {
+	url := fmt.Sprintf("%s/v1/kv/%s", this.address, key)
+	if method == "GET" {
+		url = fmt.Sprintf("%s?raw", url)
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if this.aclToken != "" {
+		req.Header.Set("X-Consul-Token", this.aclToken)
+	}
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	return content, resp.StatusCode, err
+}
+
+func (this *consulStore) PutKeyValue(key string, value string) error {
+	content, status, err := this.do("PUT", key, value)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("Consul: PUT %s returned %d: %s", key, status, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+func (this *consulStore) GetKeyValue(key string) (string, bool, error) {
+	content, status, err := this.do("GET", key, "")
+	if err != nil {
+		return "", false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return string(content), true, nil
+	case http.StatusNotFound:
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("Consul: GET %s returned %d: %s", key, status, strings.TrimSpace(string(content)))
+}
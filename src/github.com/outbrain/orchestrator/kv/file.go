@@ -0,0 +1,84 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// fileStore is a KVStore kept as a JSON object in a local file. It serves local setups and testing.
+type fileStore struct {
+	fileName string
+	mutex    sync.Mutex
+}
+
+// NewFileStore returns a KVStore persisted in given file, which is created as needed
+func NewFileStore(fileName string) KVStore {
+	return &fileStore{fileName: fileName}
+}
+
+func (this *fileStore) read() (map[string]string, error) {
+	kvMap := make(map[string]string)
+	content, err := ioutil.ReadFile(this.fileName)
+	if os.IsNotExist(err) {
+		return kvMap, nil
+	}
+	if err != nil {
+		return kvMap, err
+	}
+	if len(content) == 0 {
+		return kvMap, nil
+	}
+	err = json.Unmarshal(content, &kvMap)
+	return kvMap, err
+}
+
+func (this *fileStore) PutKeyValue(key string, value string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	kvMap, err := this.read()
+	if err != nil {
+		return err
+	}
+	kvMap[key] = value
+	content, err := json.MarshalIndent(kvMap, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write & rename, so that readers never see a partially written file
+	tmpFileName := this.fileName + ".tmp"
+	if err := ioutil.WriteFile(tmpFileName, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, this.fileName)
+}
+
+func (this *fileStore) GetKeyValue(key string) (string, bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	kvMap, err := this.read()
+	if err != nil {
+		return "", false, err
+	}
+	value, found := kvMap[key]
+	return value, found, nil
+}
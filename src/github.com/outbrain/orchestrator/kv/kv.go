@@ -0,0 +1,76 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"strings"
+	"sync"
+)
+
+// KVPair is a key and its value, as published to key-value stores
+type KVPair struct {
+	Key   string
+	Value string
+}
+
+func (this *KVPair) String() string {
+	return fmt.Sprintf("%s:%s", this.Key, this.Value)
+}
+
+// KVStore is a key-value store to which orchestrator publishes information, such as cluster masters
+type KVStore interface {
+	PutKeyValue(key string, value string) error
+	GetKeyValue(key string) (value string, found bool, err error)
+}
+
+var kvStores []KVStore
+var kvStoresMutex = &sync.Mutex{}
+
+// GetKVStores returns the configured key-value stores
+func GetKVStores() []KVStore {
+	kvStoresMutex.Lock()
+	defer kvStoresMutex.Unlock()
+	if kvStores == nil {
+		kvStores = []KVStore{}
+		if config.Config().ConsulAddress != "" {
+			kvStores = append(kvStores, NewConsulStore(config.Config().ConsulAddress, config.Config().ConsulACLToken))
+		}
+		if config.Config().KVFile != "" {
+			kvStores = append(kvStores, NewFileStore(config.Config().KVFile))
+		}
+	}
+	return kvStores
+}
+
+// PutKVPair writes given pair to all key-value stores. All stores are attempted; the last error, if any,
+// is returned.
+func PutKVPair(kvPair *KVPair) (err error) {
+	for _, store := range GetKVStores() {
+		if putErr := store.PutKeyValue(kvPair.Key, kvPair.Value); putErr != nil {
+			err = log.Errore(putErr)
+		}
+	}
+	return err
+}
+
+// ClusterMasterKey returns the key under which the master of given cluster is published
+func ClusterMasterKey(clusterAlias string) string {
+	return fmt.Sprintf("%s/%s", strings.TrimRight(config.Config().KVClusterMasterPrefix, "/"), clusterAlias)
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"github.com/outbrain/orchestrator/config"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type KVTestSuite struct{}
+
+var _ = Suite(&KVTestSuite{})
+
+func (s *KVTestSuite) TestFileStore(c *C) {
+	store := NewFileStore(filepath.Join(c.MkDir(), "kv.json"))
+	_, found, err := store.GetKeyValue("mysql/master/main")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, false)
+
+	c.Assert(store.PutKeyValue("mysql/master/main", "db-1:3306"), IsNil)
+	c.Assert(store.PutKeyValue("mysql/master/main", "db-2:3306"), IsNil)
+	value, found, err := store.GetKeyValue("mysql/master/main")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, true)
+	c.Assert(value, Equals, "db-2:3306")
+}
+
+func (s *KVTestSuite) TestConsulStore(c *C) {
+	kvMap := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.Assert(req.Header.Get("X-Consul-Token"), Equals, "secret")
+		key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+		switch req.Method {
+		case "PUT":
+			body, _ := ioutil.ReadAll(req.Body)
+			kvMap[key] = string(body)
+			w.Write([]byte("true"))
+		case "GET":
+			if value, ok := kvMap[key]; ok {
+				w.Write([]byte(value))
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}
+	}))
+	defer server.Close()
+
+	store := NewConsulStore(server.URL, "secret")
+	c.Assert(store.PutKeyValue("mysql/master/main", "db-1:3306"), IsNil)
+	value, found, err := store.GetKeyValue("mysql/master/main")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, true)
+	c.Assert(value, Equals, "db-1:3306")
+	_, found, err = store.GetKeyValue("mysql/master/other")
+	c.Assert(err, IsNil)
+	c.Assert(found, Equals, false)
+}
+
+func (s *KVTestSuite) TestClusterMasterKey(c *C) {
+	config.Config().KVClusterMasterPrefix = "mysql/master/"
+	defer func() { config.Config().KVClusterMasterPrefix = "mysql/master" }()
+	c.Assert(ClusterMasterKey("main"), Equals, "mysql/master/main")
+}
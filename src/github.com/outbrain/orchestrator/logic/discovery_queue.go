@@ -0,0 +1,177 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package orchestrator
+
+import (
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"github.com/outbrain/orchestrator/inst"
+	"sync"
+	"time"
+)
+
+// DiscoveryQueue is a bounded queue of instance keys pending discovery, consumed by a fixed pool of workers.
+// A key is only ever queued once: until its discovery completes, pushing it again is a no-op.
+// Discovery of a single key is bounded by a timeout, after which the worker moves on. The key itself
+// remains in-flight until its (hung) discovery actually returns, so that it cannot pile up.
+// Keys may be pushed as part of a walk: a WaitGroup tracking a key, and transitively the keys its
+// discovery follows on to, until all of them are discovered.
+type DiscoveryQueue struct {
+	keys     chan inst.InstanceKey
+	inFlight map[inst.InstanceKey][]*sync.WaitGroup
+	mutex    *sync.Mutex
+	timeout  time.Duration
+}
+
+var discoveryQueue *DiscoveryQueue
+var discoveryQueueOnce sync.Once
+
+// NewDiscoveryQueue creates a queue of given capacity, with given per-key discovery timeout.
+// Workers are not started.
+func NewDiscoveryQueue(capacity int, timeout time.Duration) *DiscoveryQueue {
+	queue := &DiscoveryQueue{
+		keys:     make(chan inst.InstanceKey, capacity),
+		inFlight: make(map[inst.InstanceKey][]*sync.WaitGroup),
+		mutex:    &sync.Mutex{},
+		timeout:  timeout,
+	}
+	return queue
+}
+
+// getDiscoveryQueue returns the application's discovery queue, creating it and starting its
+// workers upon first call.
+func getDiscoveryQueue() *DiscoveryQueue {
+	discoveryQueueOnce.Do(func() {
+		discoveryQueue = NewDiscoveryQueue(config.Config().DiscoveryQueueCapacity, time.Duration(config.Config().DiscoveryTimeoutSeconds)*time.Second)
+		discoveryQueue.StartWorkers(config.Config().DiscoveryMaxConcurrency, DiscoverInstance)
+	})
+	return discoveryQueue
+}
+
+// Push queues given key for discovery. It never blocks. It returns false when the key
+// was not queued: either because it is already queued or in-flight, or because the queue is saturated.
+func (this *DiscoveryQueue) Push(instanceKey inst.InstanceKey) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if _, found := this.inFlight[instanceKey]; found {
+		return false
+	}
+	select {
+	case this.keys <- instanceKey:
+		this.inFlight[instanceKey] = nil
+		return true
+	default:
+		discoveryQueueDroppedCounter.Inc()
+		return false
+	}
+}
+
+// PushToWalk queues given key for discovery as part of given walk. Unlike Push, the key is never dropped:
+// if it is already queued or in-flight the walk joins it, and if the queue is saturated the key is
+// handed over asynchronously, as soon as there is room.
+func (this *DiscoveryQueue) PushToWalk(instanceKey inst.InstanceKey, walk *sync.WaitGroup) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	walk.Add(1)
+	if walks, found := this.inFlight[instanceKey]; found {
+		this.inFlight[instanceKey] = append(walks, walk)
+		return
+	}
+	this.inFlight[instanceKey] = []*sync.WaitGroup{walk}
+	select {
+	case this.keys <- instanceKey:
+	default:
+		log.Debugf("Discovery queue is saturated; queueing %+v once there is room", instanceKey)
+		go func() { this.keys <- instanceKey }()
+	}
+}
+
+// release marks given key as no longer in-flight. Walks the key was part of follow on to given keys.
+func (this *DiscoveryQueue) release(instanceKey inst.InstanceKey, followKeys []inst.InstanceKey) {
+	this.mutex.Lock()
+	walks := this.inFlight[instanceKey]
+	delete(this.inFlight, instanceKey)
+	this.mutex.Unlock()
+
+	for _, followKey := range followKeys {
+		if len(walks) == 0 {
+			this.Push(followKey)
+		}
+		for _, walk := range walks {
+			this.PushToWalk(followKey, walk)
+		}
+	}
+	// Only now, with the follow-up keys accounted for, may the walks complete
+	for _, walk := range walks {
+		walk.Done()
+	}
+}
+
+// Depth returns the number of keys waiting for a worker
+func (this *DiscoveryQueue) Depth() int {
+	return len(this.keys)
+}
+
+// InFlight returns the number of keys either waiting for a worker or being discovered
+func (this *DiscoveryQueue) InFlight() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return len(this.inFlight)
+}
+
+// IsSaturated returns true when no more keys can be queued
+func (this *DiscoveryQueue) IsSaturated() bool {
+	return len(this.keys) >= cap(this.keys)
+}
+
+// StartWorkers spawns given number of workers, each applying given discovery function on queued keys.
+// The discovery function returns the keys to follow on to.
+func (this *DiscoveryQueue) StartWorkers(numWorkers int, discover func(inst.InstanceKey) []inst.InstanceKey) {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	for i := 0; i < numWorkers; i++ {
+		go this.work(discover)
+	}
+}
+
+// work consumes the queue, one key at a time
+func (this *DiscoveryQueue) work(discover func(inst.InstanceKey) []inst.InstanceKey) {
+	for instanceKey := range this.keys {
+		done := make(chan bool, 1)
+		go func(instanceKey inst.InstanceKey) {
+			followKeys := []inst.InstanceKey{}
+			defer func() { this.release(instanceKey, followKeys) }()
+			followKeys = discover(instanceKey)
+			done <- true
+		}(instanceKey)
+
+		if this.timeout <= 0 {
+			<-done
+			continue
+		}
+		select {
+		case <-done:
+		case <-time.After(this.timeout):
+			discoveryTimeoutsCounter.Inc()
+			log.Warningf("Discovery of %+v timed out after %+v; moving on", instanceKey, this.timeout)
+		}
+	}
+}
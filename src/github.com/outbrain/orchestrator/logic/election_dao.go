@@ -45,7 +45,7 @@ func AttemptElection() (bool, error) {
 					or (hostname = ? and token = ?)
 				)					
 			`,
-		ThisHostname, ProcessToken.Hash, config.Config.ActiveNodeExpireSeconds, ThisHostname, ProcessToken.Hash,
+		ThisHostname, ProcessToken.Hash, config.Config().ActiveNodeExpireSeconds, ThisHostname, ProcessToken.Hash,
 	)
 	if err != nil {
 		return false, log.Errore(err)
@@ -0,0 +1,130 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package orchestrator
+
+import (
+	"fmt"
+	"github.com/outbrain/orchestrator/agent"
+	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/metrics"
+)
+
+var discoveryQueueDroppedCounter = metrics.NewCounter("orchestrator_discovery_queue_dropped_total", "Number of instance keys not queued for discovery due to a saturated queue")
+var discoveryTimeoutsCounter = metrics.NewCounter("orchestrator_discovery_timeouts_total", "Number of instance discoveries that exceeded DiscoveryTimeoutSeconds")
+var discoverySkippedTicksCounter = metrics.NewCounter("orchestrator_discovery_skipped_ticks_total", "Number of continuous discovery ticks skipped due to a saturated queue")
+var discoveryPublishFailuresCounter = metrics.NewCounter("orchestrator_discovery_publish_cluster_master_failures_total", "Number of failed attempts to publish a discovered cluster master to the key-value stores")
+var pseudoGTIDSkippedTicksCounter = metrics.NewCounter("orchestrator_pseudo_gtid_skipped_ticks_total", "Number of pseudo GTID injection ticks skipped while a previous injection round is still running")
+var discoveryLatencyHistogram = metrics.NewHistogram("orchestrator_discovery_latency_seconds", "Time it takes to read a topology instance upon discovery", metrics.DefaultLatencyBuckets)
+
+func init() {
+	metrics.NewGaugeFunc("orchestrator_discovery_queue_length", "Number of instance keys waiting to be discovered", func() float64 {
+		return float64(getDiscoveryQueue().Depth())
+	})
+	metrics.NewGaugeFunc("orchestrator_discovery_in_flight", "Number of instance keys either waiting to be discovered or being discovered", func() float64 {
+		return float64(getDiscoveryQueue().InFlight())
+	})
+	metrics.NewGaugeFunc("orchestrator_is_elected", "1 when this node is the elected active orchestrator node, 0 otherwise", func() float64 {
+		if elected, _ := IsElected(); elected {
+			return 1
+		}
+		return 0
+	})
+	metrics.NewGaugeFunc("orchestrator_active_maintenance", "Number of active maintenance locks", func() float64 {
+		maintenance, _ := inst.ReadActiveMaintenance()
+		return float64(len(maintenance))
+	})
+	metrics.NewGaugeFunc("orchestrator_active_seeds", "Number of active agent seed operations", func() float64 {
+		seeds, _ := agent.ReadActiveSeeds()
+		return float64(len(seeds))
+	})
+	metrics.NewCollector("orchestrator_cluster_instances", "Number of known instances per cluster", metrics.GaugeType, collectClusterInstances)
+	metrics.NewCollector("orchestrator_cluster_problem_instances", "Number of problem instances per cluster", metrics.GaugeType, collectClusterProblems)
+	metrics.NewCollector("orchestrator_instance_slave_lag_seconds", "Replication lag per instance, as last read", metrics.GaugeType, collectInstancesLag)
+}
+
+// readClusterAliases maps cluster names to their aliases
+func readClusterAliases() map[string]string {
+	aliases := make(map[string]string)
+	clustersInfo, _ := inst.ReadClustersInfo()
+	for _, clusterInfo := range clustersInfo {
+		aliases[clusterInfo.ClusterName] = clusterInfo.ClusterAlias
+	}
+	return aliases
+}
+
+func collectClusterInstances() []metrics.Sample {
+	samples := []metrics.Sample{}
+	clustersInfo, err := inst.ReadClustersInfo()
+	if err != nil {
+		return samples
+	}
+	for _, clusterInfo := range clustersInfo {
+		samples = append(samples, metrics.Sample{
+			Name:   "orchestrator_cluster_instances",
+			Labels: metrics.Labels{"cluster": clusterInfo.ClusterName, "cluster_alias": clusterInfo.ClusterAlias},
+			Value:  float64(clusterInfo.CountInstances),
+		})
+	}
+	return samples
+}
+
+func collectClusterProblems() []metrics.Sample {
+	samples := []metrics.Sample{}
+	instances, err := inst.ReadProblemInstances()
+	if err != nil {
+		return samples
+	}
+	counts := make(map[string]int)
+	for _, instance := range instances {
+		counts[instance.ClusterName]++
+	}
+	aliases := readClusterAliases()
+	for clusterName, count := range counts {
+		samples = append(samples, metrics.Sample{
+			Name:   "orchestrator_cluster_problem_instances",
+			Labels: metrics.Labels{"cluster": clusterName, "cluster_alias": aliases[clusterName]},
+			Value:  float64(count),
+		})
+	}
+	return samples
+}
+
+func collectInstancesLag() []metrics.Sample {
+	samples := []metrics.Sample{}
+	instances, err := inst.ReadAllInstances()
+	if err != nil {
+		return samples
+	}
+	aliases := readClusterAliases()
+	for _, instance := range instances {
+		if !instance.SlaveLagSeconds.Valid {
+			continue
+		}
+		samples = append(samples, metrics.Sample{
+			Name: "orchestrator_instance_slave_lag_seconds",
+			Labels: metrics.Labels{
+				"instance":      instance.Key.DisplayString(),
+				"hostname":      instance.Key.Hostname,
+				"port":          fmt.Sprintf("%d", instance.Key.Port),
+				"cluster":       instance.ClusterName,
+				"cluster_alias": aliases[instance.ClusterName],
+			},
+			Value: float64(instance.SlaveLagSeconds.Int64),
+		})
+	}
+	return samples
+}
@@ -17,52 +17,55 @@
 package orchestrator
 
 import (
+	"context"
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/orchestrator/agent"
 	"github.com/outbrain/orchestrator/config"
 	"github.com/outbrain/orchestrator/inst"
+	"github.com/outbrain/orchestrator/metrics"
+	"github.com/pmylund/go-cache"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const (
-	maxConcurrency = 5
-)
+// pseudoGTIDInjectionInProgress is 1 while a pseudo GTID injection round runs; ticks arriving meanwhile are skipped
+var pseudoGTIDInjectionInProgress int32 = 0
 
-// discoveryInstanceKeys is a channel of instanceKey-s that were requested for discovery.
-// It can be continuously updated as discovery process progresses.
-var discoveryInstanceKeys chan inst.InstanceKey = make(chan inst.InstanceKey, maxConcurrency)
+// pseudoGTIDTokenSeeded is 1 once pseudo GTID tokens have been seeded since this node was elected
+var pseudoGTIDTokenSeeded int32 = 0
 
-// handleDiscoveryRequests iterates the discoveryInstanceKeys channel and calls upon
-// instance discovery per entry.
-func handleDiscoveryRequests(pendingTokens chan bool, completedTokens chan bool) {
-	for instanceKey := range discoveryInstanceKeys {
-		AccountedDiscoverInstance(instanceKey, pendingTokens, completedTokens)
-	}
-}
+// recentPublishFailures holds clusters whose cluster master publish failure was logged within the last minute,
+// such that a persistent failure is not logged upon every discovery
+var recentPublishFailures = cache.New(time.Minute, time.Minute)
+
+// lagHistoryMaintenanceInProgress is 1 while lag history is being downsampled and expired
+var lagHistoryMaintenanceInProgress int32 = 0
 
-// AccountedDiscoverInstance will call upon DiscoverInstance and will keep track of
-// discovery tokens such that management of multiple discoveries can figure out
-// whether all instances in a topology are accounted for.
-func AccountedDiscoverInstance(instanceKey inst.InstanceKey, pendingTokens chan bool, completedTokens chan bool) {
-	if pendingTokens != nil {
-		pendingTokens <- true
+// appendDiscoveryKey appends given key, formalized, to given keys, unless it is invalid
+func appendDiscoveryKey(instanceKeys []inst.InstanceKey, instanceKey inst.InstanceKey) []inst.InstanceKey {
+	instanceKey.Formalize()
+	if !instanceKey.IsValid() {
+		return instanceKeys
 	}
-	go func() {
-		DiscoverInstance(instanceKey)
-		if completedTokens != nil {
-			completedTokens <- true
-		}
-	}()
+	return append(instanceKeys, instanceKey)
 }
 
 // DiscoverInstance will attempt discovering an instance (unless it is already up to date) and will
 // list down its master and slaves (if any) for further discovery.
-func DiscoverInstance(instanceKey inst.InstanceKey) {
+func DiscoverInstance(instanceKey inst.InstanceKey) (followKeys []inst.InstanceKey) {
 	instanceKey.Formalize()
 	if !instanceKey.IsValid() {
-		return
+		return followKeys
 	}
 
+	var discoveryStartTime time.Time
+	ctx := context.Background()
+	if config.Config().DiscoveryTimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.Config().DiscoveryTimeoutSeconds)*time.Second)
+		defer cancel()
+	}
 	instance, found, err := inst.ReadInstance(&instanceKey)
 
 	if found && instance.IsUpToDate && instance.IsLastCheckValid {
@@ -70,7 +73,9 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 		goto Cleanup
 	}
 	// First we've ever heard of this instance. Continue investigation:
-	instance, err = inst.ReadTopologyInstance(&instanceKey)
+	discoveryStartTime = time.Now()
+	instance, err = inst.ReadTopologyInstance(ctx, &instanceKey)
+	discoveryLatencyHistogram.Observe(time.Since(discoveryStartTime).Seconds())
 	// panic can occur (IO stuff). Therefore it may happen
 	// that instance is nil. Check it.
 	if err != nil || instance == nil {
@@ -80,14 +85,25 @@ func DiscoverInstance(instanceKey inst.InstanceKey) {
 
 	log.Debugf("Discovered host: %+v, master: %+v", instance.Key, instance.MasterKey)
 
+	if !instance.IsSlave() || !instance.ReadOnly {
+		// Possibly a (new) master
+		if err := inst.PublishDiscoveredClusterMaster(instance); err != nil {
+			discoveryPublishFailuresCounter.Inc()
+			if recentPublishFailures.Add(instance.ClusterName, true, cache.DefaultExpiration) == nil {
+				log.Errore(err)
+			}
+		}
+	}
+
 	// Investigate slaves:
 	for _, slaveKey := range instance.SlaveHosts.GetInstanceKeys() {
-		discoveryInstanceKeys <- slaveKey
+		followKeys = appendDiscoveryKey(followKeys, slaveKey)
 	}
 	// Investigate master:
-	discoveryInstanceKeys <- instance.MasterKey
+	followKeys = appendDiscoveryKey(followKeys, instance.MasterKey)
 
 Cleanup:
+	return followKeys
 }
 
 // Start discovery begins a one time asynchronuous discovery process for the given
@@ -98,22 +114,15 @@ Cleanup:
 // in such topology, this function will detect the entire topology.
 func StartDiscovery(instanceKey inst.InstanceKey) {
 	log.Infof("Starting discovery at %+v", instanceKey)
-	pendingTokens := make(chan bool, maxConcurrency)
-	completedTokens := make(chan bool, maxConcurrency)
-
-	AccountedDiscoverInstance(instanceKey, pendingTokens, completedTokens)
-	go handleDiscoveryRequests(pendingTokens, completedTokens)
-
-	// Block until all are complete
-	for {
-		select {
-		case <-pendingTokens:
-			<-completedTokens
-		default:
-			inst.AuditOperation("start-discovery", &instanceKey, "")
-			return
-		}
+	instanceKey.Formalize()
+	if !instanceKey.IsValid() {
+		return
 	}
+	walk := &sync.WaitGroup{}
+	getDiscoveryQueue().PushToWalk(instanceKey, walk)
+	inst.AuditOperation(context.Background(), "start-discovery", &instanceKey, "")
+	// Block until all instances this discovery leads to are complete
+	walk.Wait()
 }
 
 // ContinuousDiscovery starts an asynchronuous infinite discovery process where instances are
@@ -122,27 +131,69 @@ func StartDiscovery(instanceKey inst.InstanceKey) {
 func ContinuousDiscovery() {
 	log.Infof("Starting continuous discovery")
 	inst.LoadHostnameResolveCacheFromDatabase()
-	go handleDiscoveryRequests(nil, nil)
-	tick := time.Tick(time.Duration(config.Config.DiscoveryPollSeconds) * time.Second)
-	forgetUnseenTick := time.Tick(time.Minute)
+	queue := getDiscoveryQueue()
+	go metrics.ContinuousGraphitePush()
+	tick := time.Tick(time.Duration(config.Config().DiscoveryPollSeconds) * time.Second)
+	forgetUnseenInterval := time.Minute
+	forgetUnseenTick := time.Tick(forgetUnseenInterval)
+	var pseudoGTIDTick <-chan time.Time
+	if config.Config().AutoPseudoGTID {
+		pseudoGTIDTick = time.Tick(time.Duration(config.Config().PseudoGTIDInjectionSeconds) * time.Second)
+	}
 	for {
 		select {
 		case <-tick:
 			if elected, _ := AttemptElection(); elected {
+				if queue.IsSaturated() {
+					discoverySkippedTicksCounter.Inc()
+					log.Warningf("Discovery queue is saturated (%d keys); skipping this tick", queue.Depth())
+					continue
+				}
 				instanceKeys, _ := inst.ReadOutdatedInstanceKeys()
 				log.Debugf("outdated keys: %+v", instanceKeys)
 				for _, instanceKey := range instanceKeys {
-					discoveryInstanceKeys <- instanceKey
+					queue.Push(instanceKey)
 				}
 			} else {
 				log.Debugf("Not elected as active node; polling")
 			}
+		case <-pseudoGTIDTick:
+			if elected, _ := IsElected(); elected {
+				if !atomic.CompareAndSwapInt32(&pseudoGTIDInjectionInProgress, 0, 1) {
+					pseudoGTIDSkippedTicksCounter.Inc()
+					log.Warningf("Previous pseudo GTID injection round still running; skipping this tick")
+					continue
+				}
+				go func() {
+					defer atomic.StoreInt32(&pseudoGTIDInjectionInProgress, 0)
+					if atomic.LoadInt32(&pseudoGTIDTokenSeeded) == 0 {
+						if err := inst.SeedPseudoGTIDToken(); err != nil {
+							log.Errorf("Cannot seed pseudo GTID token; skipping injection: %+v", err)
+							return
+						}
+						atomic.StoreInt32(&pseudoGTIDTokenSeeded, 1)
+					}
+					inst.InjectPseudoGTIDOnClusters()
+				}()
+			} else {
+				// Upon election, tokens are seeded anew from those injected by the node elected meanwhile
+				atomic.StoreInt32(&pseudoGTIDTokenSeeded, 0)
+			}
 		case <-forgetUnseenTick:
 			// See if we should also forget objects (lower frequency)
 			inst.ForgetLongUnseenInstances()
 			inst.ForgetExpiredHostnameResolves()
 			inst.ReviewUnseenInstances()
 			inst.InjectUnseenMasters()
+			if atomic.CompareAndSwapInt32(&lagHistoryMaintenanceInProgress, 0, 1) {
+				go func() {
+					defer atomic.StoreInt32(&lagHistoryMaintenanceInProgress, 0)
+					inst.DownsampleLagHistory(forgetUnseenInterval)
+					inst.ExpireLagHistory()
+				}()
+			}
+			inst.ExpireOperations()
+			inst.ExpirePseudoGTIDEntryCache()
 		}
 	}
 }
@@ -171,7 +222,7 @@ func ContinuousAgentsPoll() {
 
 	go discoverSeededAgents()
 
-	tick := time.Tick(time.Duration(config.Config.DiscoveryPollSeconds) * time.Second)
+	tick := time.Tick(time.Duration(config.Config().DiscoveryPollSeconds) * time.Second)
 	forgetUnseenTick := time.Tick(time.Hour)
 	for _ = range tick {
 		agentsHosts, _ := agent.ReadOutdatedAgentsHosts()
@@ -21,18 +21,29 @@ import (
 	"github.com/outbrain/golib/log"
 	"github.com/outbrain/orchestrator/app"
 	"github.com/outbrain/orchestrator/config"
+	"os"
 )
 
 // main is the application's entry point. It will either spawn a CLI or HTTP itnerfaces.
 func main() {
 	configFile := flag.String("config", "", "config file name")
-	command := flag.String("c", "", "command (discover|forget|continuous|move-up|move-below|begin-maintenance|end-maintenance|clusters|topology)")
+	command := flag.String("c", "", "command (discover|forget|continuous|move-up|move-below|begin-maintenance|end-maintenance|clusters|which-cluster-master|topology|validate-config)")
 	strict := flag.Bool("strict", false, "strict mode (more checks, slower)")
 	instance := flag.String("i", "", "instance, host:port")
 	sibling := flag.String("s", "", "sibling instance, host:port")
 	owner := flag.String("owner", "", "operation owner")
 	reason := flag.String("reason", "", "operation reason")
 	pattern := flag.String("pattern", "", "regular expression pattern")
+	clusterAlias := flag.String("alias", "", "cluster alias or name (which-cluster-master|submit-masters-to-kv-stores), as alternative to -i")
+	operationId := flag.Int64("operation", 0, "topology operation id")
+	tokenName := flag.String("token", "", "API token name (create-api-token|revoke-api-token)")
+	scopes := flag.String("scopes", "read-only", "comma delimited API token scopes: read-only, maintenance, topology-changes")
+	expiry := flag.Duration("expiry", 0, "API token expiry, e.g. 720h (0 for never)")
+	api := flag.String("api", "", "URL of an orchestrator service (e.g. http://orchestrator:3000) via which to execute commands, rather than accessing databases directly. Defaults to ORCHESTRATOR_API")
+	format := flag.String("format", "ascii", "topology format: ascii|dot|json|mermaid")
+	subtree := flag.Bool("subtree", false, "with topology: only show given instance and the slaves under it")
+	output := flag.String("output", "text", "output format: text|json|tsv")
+	dryRun := flag.Bool("dry-run", false, "plan, rather than execute, topology refactoring (regroup-slaves, multi-match-slaves etc.)")
 	discovery := flag.Bool("discovery", true, "auto discovery mode")
 	verbose := flag.Bool("verbose", false, "verbose")
 	debug := flag.Bool("debug", false, "debug mode (very verbose)")
@@ -52,15 +63,26 @@ func main() {
 
 	log.Info("starting")
 
+	if *command == "validate-config" {
+		// Configuration problems are reported rather than bailed out on
+		app.ValidateConfig(*configFile, *output)
+		return
+	}
 	if len(*configFile) > 0 {
 		config.ForceRead(*configFile)
 	} else {
-		config.Read("/etc/orchestrator.conf.json", "conf/orchestrator.conf.json", "orchestrator.conf.json")
+		config.Read(config.DefaultConfigFiles...)
+	}
+
+	if *api == "" {
+		*api = os.Getenv("ORCHESTRATOR_API")
 	}
 
 	switch {
+	case *api != "" && (len(flag.Args()) == 0 || flag.Arg(0) == "cli"):
+		app.RemoteCli(*api, *command, *strict, *instance, *sibling, *owner, *reason, *pattern, *operationId, *dryRun, *output, *format, *subtree, *clusterAlias)
 	case len(flag.Args()) == 0 || flag.Arg(0) == "cli":
-		app.Cli(*command, *strict, *instance, *sibling, *owner, *reason, *pattern)
+		app.Cli(*command, *strict, *instance, *sibling, *owner, *reason, *pattern, *operationId, *dryRun, *tokenName, *scopes, *expiry, *output, *format, *subtree, *clusterAlias)
 	case flag.Arg(0) == "http":
 		app.Http(*discovery)
 	default:
@@ -0,0 +1,169 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"github.com/outbrain/golib/log"
+	"github.com/outbrain/orchestrator/config"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxStatsdPacketSize keeps StatsD datagrams below common MTU sizes
+const maxStatsdPacketSize = 1400
+
+var graphitePathTokenPattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// sanitizeGraphiteToken turns an arbitrary string into a single graphite path element
+func sanitizeGraphiteToken(token string) string {
+	return graphitePathTokenPattern.ReplaceAllString(token, "_")
+}
+
+// GraphitePathPrefix returns the configured graphite path, with "{hostname}" substituted
+// by this node's hostname
+func GraphitePathPrefix(pathTemplate string) string {
+	hostname, _ := os.Hostname()
+	return strings.Replace(pathTemplate, "{hostname}", sanitizeGraphiteToken(hostname), -1)
+}
+
+// graphitePath returns the dotted path of a sample: the prefix, followed by the metric name and its label
+// values, ordered by label name. Histogram buckets have no graphite counterpart and yield an empty path.
+func graphitePath(prefix string, sample Sample) string {
+	if strings.HasSuffix(sample.Name, "_bucket") {
+		return ""
+	}
+	tokens := []string{}
+	if prefix != "" {
+		tokens = append(tokens, prefix)
+	}
+	tokens = append(tokens, sanitizeGraphiteToken(strings.TrimPrefix(sample.Name, "orchestrator_")))
+
+	labelNames := []string{}
+	for labelName := range sample.Labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+	for _, labelName := range labelNames {
+		labelValue := sample.Labels[labelName]
+		if labelValue == "" {
+			labelValue = "none"
+		}
+		tokens = append(tokens, sanitizeGraphiteToken(labelValue))
+	}
+	return strings.Join(tokens, ".")
+}
+
+// GraphiteLines formats given samples as lines of the graphite plaintext protocol
+func GraphiteLines(prefix string, samples []Sample, timestamp time.Time) []string {
+	lines := []string{}
+	for _, sample := range samples {
+		if path := graphitePath(prefix, sample); path != "" {
+			lines = append(lines, fmt.Sprintf("%s %s %d", path, formatFloat(sample.Value), timestamp.Unix()))
+		}
+	}
+	return lines
+}
+
+// StatsdLines formats given samples as StatsD gauges
+func StatsdLines(prefix string, samples []Sample) []string {
+	lines := []string{}
+	for _, sample := range samples {
+		if path := graphitePath(prefix, sample); path != "" {
+			lines = append(lines, fmt.Sprintf("%s:%s|g", path, formatFloat(sample.Value)))
+		}
+	}
+	return lines
+}
+
+// pushGraphite sends given lines to a graphite server over TCP
+func pushGraphite(addr string, lines []string) error {
+	conn, err := net.DialTimeout("tcp", addr, time.Duration(config.Config().MySQLConnectTimeoutSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(conn, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushStatsd sends given lines to a StatsD server over UDP, batching lines into datagrams
+func pushStatsd(addr string, lines []string) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	packet := ""
+	for _, line := range lines {
+		if packet != "" && len(packet)+len(line)+1 > maxStatsdPacketSize {
+			if _, err := conn.Write([]byte(packet)); err != nil {
+				return err
+			}
+			packet = ""
+		}
+		if packet != "" {
+			packet += "\n"
+		}
+		packet += line
+	}
+	if packet != "" {
+		if _, err := conn.Write([]byte(packet)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PushMetrics collects all registered metrics and pushes them to given address using given
+// protocol ("graphite" or "statsd")
+func PushMetrics(protocol string, addr string, pathTemplate string) error {
+	prefix := GraphitePathPrefix(pathTemplate)
+	samples := Collect()
+	switch strings.ToLower(protocol) {
+	case "graphite", "":
+		return pushGraphite(addr, GraphiteLines(prefix, samples, time.Now()))
+	case "statsd":
+		return pushStatsd(addr, StatsdLines(prefix, samples))
+	}
+	return fmt.Errorf("Unsupported metrics push protocol: %s", protocol)
+}
+
+// ContinuousGraphitePush periodically pushes metrics to the configured graphite/StatsD server.
+// It returns immediately when no such server is configured.
+func ContinuousGraphitePush() {
+	if config.Config().GraphiteAddr == "" || config.Config().GraphitePollSeconds == 0 {
+		return
+	}
+	log.Infof("Starting metrics push to %s (%s)", config.Config().GraphiteAddr, config.Config().GraphiteProtocol)
+	tick := time.Tick(time.Duration(config.Config().GraphitePollSeconds) * time.Second)
+	for _ = range tick {
+		if err := PushMetrics(config.Config().GraphiteProtocol, config.Config().GraphiteAddr, config.Config().GraphitePath); err != nil {
+			log.Errore(err)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package metrics provides a minimal registry of orchestrator's internal metrics: counters, gauges,
+// histograms and on-demand collectors. The registry can be exported in Prometheus text format.
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Metric types, as named by the Prometheus text format
+const (
+	CounterType   = "counter"
+	GaugeType     = "gauge"
+	HistogramType = "histogram"
+)
+
+// Labels is a set of label name/value pairs attached to a sample
+type Labels map[string]string
+
+// Sample is a single value of a metric
+type Sample struct {
+	Name   string
+	Labels Labels
+	Value  float64
+}
+
+// Metric is anything that can be registered and later collected
+type Metric interface {
+	Name() string
+	Help() string
+	Type() string
+	Samples() []Sample
+}
+
+var registry = []Metric{}
+var registryMutex = &sync.Mutex{}
+
+// Register adds a metric to the registry
+func Register(metric Metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, metric)
+}
+
+// registeredMetrics returns a copy of the registry, sorted by name
+func registeredMetrics() []Metric {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	metrics := make([]Metric, len(registry))
+	copy(metrics, registry)
+	sort.Sort(metricsByName(metrics))
+	return metrics
+}
+
+type metricsByName []Metric
+
+func (this metricsByName) Len() int           { return len(this) }
+func (this metricsByName) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+func (this metricsByName) Less(i, j int) bool { return this[i].Name() < this[j].Name() }
+
+// Collect returns all samples of all registered metrics
+func Collect() []Sample {
+	samples := []Sample{}
+	for _, metric := range registeredMetrics() {
+		samples = append(samples, metric.Samples()...)
+	}
+	return samples
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name string, help string) *Counter {
+	counter := &Counter{name: name, help: help}
+	Register(counter)
+	return counter
+}
+
+func (this *Counter) Name() string { return this.name }
+func (this *Counter) Help() string { return this.help }
+func (this *Counter) Type() string { return CounterType }
+
+// Inc increments the counter by one
+func (this *Counter) Inc() {
+	this.Add(1)
+}
+
+// Add increments the counter by given delta
+func (this *Counter) Add(delta uint64) {
+	atomic.AddUint64(&this.value, delta)
+}
+
+// Value returns the current value of the counter
+func (this *Counter) Value() uint64 {
+	return atomic.LoadUint64(&this.value)
+}
+
+func (this *Counter) Samples() []Sample {
+	return []Sample{{Name: this.name, Value: float64(this.Value())}}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	name string
+	help string
+	bits uint64
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name string, help string) *Gauge {
+	gauge := &Gauge{name: name, help: help}
+	Register(gauge)
+	return gauge
+}
+
+func (this *Gauge) Name() string { return this.name }
+func (this *Gauge) Help() string { return this.help }
+func (this *Gauge) Type() string { return GaugeType }
+
+// Set sets the gauge's value
+func (this *Gauge) Set(value float64) {
+	atomic.StoreUint64(&this.bits, math.Float64bits(value))
+}
+
+// Value returns the current value of the gauge
+func (this *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&this.bits))
+}
+
+func (this *Gauge) Samples() []Sample {
+	return []Sample{{Name: this.name, Value: this.Value()}}
+}
+
+// DefaultLatencyBuckets are histogram upper bounds, in seconds, suitable for measuring MySQL operations
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+	mutex   sync.Mutex
+}
+
+// NewHistogram creates and registers a histogram with given (sorted) bucket upper bounds
+func NewHistogram(name string, help string, buckets []float64) *Histogram {
+	histogram := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	Register(histogram)
+	return histogram
+}
+
+func (this *Histogram) Name() string { return this.name }
+func (this *Histogram) Help() string { return this.help }
+func (this *Histogram) Type() string { return HistogramType }
+
+// Observe adds a single observation to the histogram
+func (this *Histogram) Observe(value float64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for i, upperBound := range this.buckets {
+		if value <= upperBound {
+			this.counts[i]++
+		}
+	}
+	this.sum += value
+	this.count++
+}
+
+func (this *Histogram) Samples() []Sample {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	samples := []Sample{}
+	for i, upperBound := range this.buckets {
+		samples = append(samples, Sample{Name: this.name + "_bucket", Labels: Labels{"le": formatFloat(upperBound)}, Value: float64(this.counts[i])})
+	}
+	samples = append(samples, Sample{Name: this.name + "_bucket", Labels: Labels{"le": "+Inf"}, Value: float64(this.count)})
+	samples = append(samples, Sample{Name: this.name + "_sum", Value: this.sum})
+	samples = append(samples, Sample{Name: this.name + "_count", Value: float64(this.count)})
+	return samples
+}
+
+// Collector is a metric whose samples are computed on demand, at collection time.
+// It is useful for values read from the backend database, and for labeled values.
+type Collector struct {
+	name       string
+	help       string
+	metricType string
+	collect    func() []Sample
+}
+
+// NewCollector creates and registers a collector. The collect function is expected to return
+// samples named by the collector's name.
+func NewCollector(name string, help string, metricType string, collect func() []Sample) *Collector {
+	collector := &Collector{name: name, help: help, metricType: metricType, collect: collect}
+	Register(collector)
+	return collector
+}
+
+// NewGaugeFunc creates and registers a single, unlabeled gauge whose value is computed on demand
+func NewGaugeFunc(name string, help string, value func() float64) *Collector {
+	return NewCollector(name, help, GaugeType, func() []Sample {
+		return []Sample{{Name: name, Value: value()}}
+	})
+}
+
+func (this *Collector) Name() string { return this.name }
+func (this *Collector) Help() string { return this.help }
+func (this *Collector) Type() string { return this.metricType }
+
+func (this *Collector) Samples() []Sample {
+	return this.collect()
+}
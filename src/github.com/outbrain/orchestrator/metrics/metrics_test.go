@@ -0,0 +1,97 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	. "gopkg.in/check.v1"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type TestSuite struct{}
+
+var _ = Suite(&TestSuite{})
+
+func (s *TestSuite) TestHistogramSamples(c *C) {
+	histogram := &Histogram{name: "test_latency", buckets: []float64{0.1, 1}, counts: make([]uint64, 2)}
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	samples := histogram.Samples()
+	c.Assert(len(samples), Equals, 5)
+	c.Assert(samples[0].Labels["le"], Equals, "0.1")
+	c.Assert(samples[0].Value, Equals, float64(1))
+	c.Assert(samples[1].Value, Equals, float64(2))
+	c.Assert(samples[2].Labels["le"], Equals, "+Inf")
+	c.Assert(samples[2].Value, Equals, float64(3))
+	c.Assert(samples[3].Value, Equals, 5.55)
+	c.Assert(samples[4].Value, Equals, float64(3))
+}
+
+func (s *TestSuite) TestWritePrometheus(c *C) {
+	counter := NewCounter("test_prometheus_counter_total", "A test counter")
+	counter.Add(3)
+	NewCollector("test_prometheus_labeled", "A labeled gauge", GaugeType, func() []Sample {
+		return []Sample{{Name: "test_prometheus_labeled", Labels: Labels{"cluster_alias": `my"db`, "cluster": "db-1:3306"}, Value: 7}}
+	})
+
+	var buffer bytes.Buffer
+	err := WritePrometheus(&buffer)
+	c.Assert(err, IsNil)
+
+	output := buffer.String()
+	c.Assert(strings.Contains(output, "# TYPE test_prometheus_counter_total counter\ntest_prometheus_counter_total 3\n"), Equals, true)
+	c.Assert(strings.Contains(output, `test_prometheus_labeled{cluster="db-1:3306",cluster_alias="my\"db"} 7`), Equals, true)
+}
+
+func (s *TestSuite) TestGraphitePath(c *C) {
+	sample := Sample{Name: "orchestrator_instance_slave_lag_seconds", Labels: Labels{"instance": "db-2.example.com:3306", "cluster_alias": ""}, Value: 3}
+	c.Assert(graphitePath("orchestrator.myhost", sample), Equals, "orchestrator.myhost.instance_slave_lag_seconds.none.db-2_example_com_3306")
+
+	bucket := Sample{Name: "orchestrator_discovery_latency_seconds_bucket", Labels: Labels{"le": "0.1"}}
+	c.Assert(graphitePath("orchestrator", bucket), Equals, "")
+}
+
+func (s *TestSuite) TestPushStatsd(c *C) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	counter := NewCounter("test_statsd_polls_total", "A test counter")
+	counter.Add(5)
+
+	err = PushMetrics("statsd", listener.LocalAddr().String(), "orchestrator.test")
+	c.Assert(err, IsNil)
+
+	received := ""
+	buffer := make([]byte, maxStatsdPacketSize)
+	listener.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+		received += string(buffer[:n]) + "\n"
+	}
+	c.Assert(strings.Contains(received, "orchestrator.test.test_statsd_polls_total:5|g\n"), Equals, true)
+}
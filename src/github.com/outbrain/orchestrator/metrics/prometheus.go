@@ -0,0 +1,75 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tokens := []string{}
+	for _, name := range names {
+		tokens = append(tokens, fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(labels[name])))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(tokens, ","))
+}
+
+// WritePrometheus writes all registered metrics onto given writer, in Prometheus text format
+func WritePrometheus(writer io.Writer) error {
+	buffered := bufio.NewWriter(writer)
+	for _, metric := range registeredMetrics() {
+		fmt.Fprintf(buffered, "# HELP %s %s\n", metric.Name(), helpEscaper.Replace(metric.Help()))
+		fmt.Fprintf(buffered, "# TYPE %s %s\n", metric.Name(), metric.Type())
+		for _, sample := range metric.Samples() {
+			fmt.Fprintf(buffered, "%s%s %s\n", sample.Name, formatLabels(sample.Labels), formatFloat(sample.Value))
+		}
+	}
+	return buffered.Flush()
+}
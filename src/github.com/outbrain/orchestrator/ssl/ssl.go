@@ -0,0 +1,82 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package ssl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewTLSConfig returns a client TLS configuration. Peers are verified by given certificate authority file,
+// or by the system's CAs when caFile is empty. When certFile is given, the client certificate (with its private
+// key in keyFile) is presented to peers.
+func NewTLSConfig(caFile string, certFile string, keyFile string, skipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if caFile != "" {
+		caPool, err := ReadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = caPool
+	}
+	if certFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load key pair %s, %s: %+v", certFile, keyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+// ReadCertPool reads a PEM file of one or more certificates into a certificate pool
+func ReadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("No certificates found in %s", caFile)
+	}
+	return caPool, nil
+}
+
+// NewServerTLSConfig returns a server TLS configuration. When verifyClients is set, clients are required to
+// present a certificate signed by the certificate authority in caFile.
+func NewServerTLSConfig(caFile string, verifyClients bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if verifyClients {
+		if caFile == "" {
+			return nil, fmt.Errorf("Verifying client certificates requires a certificate authority file")
+		}
+		caPool, err := ReadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = caPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,112 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package ssl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type SSLTestSuite struct{}
+
+var _ = Suite(&SSLTestSuite{})
+
+// writeSelfSignedCertificate writes a self signed certificate and its key into given directory
+func writeSelfSignedCertificate(c *C, dir string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "orchestrator-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	c.Assert(ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600), IsNil)
+	c.Assert(ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600), IsNil)
+	return certFile, keyFile
+}
+
+func (s *SSLTestSuite) TestNewTLSConfig(c *C) {
+	dir := c.MkDir()
+	certFile, keyFile := writeSelfSignedCertificate(c, dir)
+
+	tlsConfig, err := NewTLSConfig(certFile, certFile, keyFile, false)
+	c.Assert(err, IsNil)
+	c.Assert(tlsConfig.RootCAs, NotNil)
+	c.Assert(len(tlsConfig.Certificates), Equals, 1)
+	c.Assert(tlsConfig.InsecureSkipVerify, Equals, false)
+
+	tlsConfig, err = NewTLSConfig("", "", "", true)
+	c.Assert(err, IsNil)
+	c.Assert(tlsConfig.RootCAs, IsNil)
+	c.Assert(len(tlsConfig.Certificates), Equals, 0)
+	c.Assert(tlsConfig.InsecureSkipVerify, Equals, true)
+}
+
+func (s *SSLTestSuite) TestNewTLSConfigErrors(c *C) {
+	dir := c.MkDir()
+	_, err := NewTLSConfig(filepath.Join(dir, "missing.pem"), "", "", false)
+	c.Assert(err, NotNil)
+
+	notPEM := filepath.Join(dir, "not.pem")
+	c.Assert(ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600), IsNil)
+	_, err = ReadCertPool(notPEM)
+	c.Assert(err, NotNil)
+
+	certFile, _ := writeSelfSignedCertificate(c, dir)
+	_, err = NewTLSConfig("", certFile, filepath.Join(dir, "missing-key.pem"), false)
+	c.Assert(err, NotNil)
+}
+
+func (s *SSLTestSuite) TestNewServerTLSConfig(c *C) {
+	dir := c.MkDir()
+	certFile, _ := writeSelfSignedCertificate(c, dir)
+
+	tlsConfig, err := NewServerTLSConfig("", false)
+	c.Assert(err, IsNil)
+	c.Assert(tlsConfig.ClientAuth, Equals, tls.NoClientCert)
+
+	tlsConfig, err = NewServerTLSConfig(certFile, true)
+	c.Assert(err, IsNil)
+	c.Assert(tlsConfig.ClientCAs, NotNil)
+	c.Assert(tlsConfig.ClientAuth, Equals, tls.RequireAndVerifyClientCert)
+
+	_, err = NewServerTLSConfig("", true)
+	c.Assert(err, NotNil)
+}